@@ -35,25 +35,46 @@ const _ = proto.ProtoPackageIsVersion4
 type QueryType int32
 
 const (
-	QueryType_ip       QueryType = 0
-	QueryType_port     QueryType = 1
-	QueryType_mac      QueryType = 2
-	QueryType_protocol QueryType = 3
+	QueryType_ip        QueryType = 0
+	QueryType_port      QueryType = 1
+	QueryType_mac       QueryType = 2
+	QueryType_protocol  QueryType = 3
+	QueryType_mpls      QueryType = 4
+	QueryType_vni       QueryType = 5
+	QueryType_flow      QueryType = 6  // TCP or UDP 5-tuple, e.g. 10.0.0.1:1234,10.0.0.2:80,tcp
+	QueryType_interface QueryType = 7  // Name of the capture interface, e.g. eth1
+	QueryType_domain    QueryType = 8  // Name in the question of a DNS query or response, e.g. example.com
+	QueryType_host      QueryType = 9  // TLS server name or HTTP Host of a request, e.g. mail.google.com
+	QueryType_vlan      QueryType = 10 // 802.1Q VLAN ID, outer or inner for QinQ
 )
 
 // Enum value maps for QueryType.
 var (
 	QueryType_name = map[int32]string{
-		0: "ip",
-		1: "port",
-		2: "mac",
-		3: "protocol",
+		0:  "ip",
+		1:  "port",
+		2:  "mac",
+		3:  "protocol",
+		4:  "mpls",
+		5:  "vni",
+		6:  "flow",
+		7:  "interface",
+		8:  "domain",
+		9:  "host",
+		10: "vlan",
 	}
 	QueryType_value = map[string]int32{
-		"ip":       0,
-		"port":     1,
-		"mac":      2,
-		"protocol": 3,
+		"ip":        0,
+		"port":      1,
+		"mac":       2,
+		"protocol":  3,
+		"mpls":      4,
+		"vni":       5,
+		"flow":      6,
+		"interface": 7,
+		"domain":    8,
+		"host":      9,
+		"vlan":      10,
 	}
 )
 
@@ -84,25 +105,303 @@ func (QueryType) EnumDescriptor() ([]byte, []int) {
 	return file_v1_api_proto_rawDescGZIP(), []int{0}
 }
 
+// FlowSummary limits the results to the first and/or last matching packet
+// of each flow (5-tuple, in either direction).
+type FlowSummary int32
+
+const (
+	FlowSummary_off        FlowSummary = 0
+	FlowSummary_first      FlowSummary = 1
+	FlowSummary_last       FlowSummary = 2
+	FlowSummary_first_last FlowSummary = 3
+)
+
+// Enum value maps for FlowSummary.
+var (
+	FlowSummary_name = map[int32]string{
+		0: "off",
+		1: "first",
+		2: "last",
+		3: "first_last",
+	}
+	FlowSummary_value = map[string]int32{
+		"off":        0,
+		"first":      1,
+		"last":       2,
+		"first_last": 3,
+	}
+)
+
+func (x FlowSummary) Enum() *FlowSummary {
+	p := new(FlowSummary)
+	*p = x
+	return p
+}
+
+func (x FlowSummary) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FlowSummary) Descriptor() protoreflect.EnumDescriptor {
+	return file_v1_api_proto_enumTypes[1].Descriptor()
+}
+
+func (FlowSummary) Type() protoreflect.EnumType {
+	return &file_v1_api_proto_enumTypes[1]
+}
+
+func (x FlowSummary) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FlowSummary.Descriptor instead.
+func (FlowSummary) EnumDescriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{1}
+}
+
+// Direction scopes an address query to the source or destination side of
+// a packet. It is currently only supported for mac queries.
+type Direction int32
+
+const (
+	Direction_any Direction = 0
+	Direction_src Direction = 1
+	Direction_dst Direction = 2
+)
+
+// Enum value maps for Direction.
+var (
+	Direction_name = map[int32]string{
+		0: "any",
+		1: "src",
+		2: "dst",
+	}
+	Direction_value = map[string]int32{
+		"any": 0,
+		"src": 1,
+		"dst": 2,
+	}
+)
+
+func (x Direction) Enum() *Direction {
+	p := new(Direction)
+	*p = x
+	return p
+}
+
+func (x Direction) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Direction) Descriptor() protoreflect.EnumDescriptor {
+	return file_v1_api_proto_enumTypes[2].Descriptor()
+}
+
+func (Direction) Type() protoreflect.EnumType {
+	return &file_v1_api_proto_enumTypes[2]
+}
+
+func (x Direction) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Direction.Descriptor instead.
+func (Direction) EnumDescriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{2}
+}
+
+// TermMatch is how the terms of a query are combined with its main query
+// type and query.
+type TermMatch int32
+
+const (
+	TermMatch_match_all TermMatch = 0 // AND: packets matching every term
+	TermMatch_match_any TermMatch = 1 // OR: packets matching at least one term
+)
+
+// Enum value maps for TermMatch.
+var (
+	TermMatch_name = map[int32]string{
+		0: "match_all",
+		1: "match_any",
+	}
+	TermMatch_value = map[string]int32{
+		"match_all": 0,
+		"match_any": 1,
+	}
+)
+
+func (x TermMatch) Enum() *TermMatch {
+	p := new(TermMatch)
+	*p = x
+	return p
+}
+
+func (x TermMatch) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TermMatch) Descriptor() protoreflect.EnumDescriptor {
+	return file_v1_api_proto_enumTypes[3].Descriptor()
+}
+
+func (TermMatch) Type() protoreflect.EnumType {
+	return &file_v1_api_proto_enumTypes[3]
+}
+
+func (x TermMatch) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TermMatch.Descriptor instead.
+func (TermMatch) EnumDescriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{3}
+}
+
+// BinaryFormat is the file format of a binary query.
+type BinaryFormat int32
+
+const (
+	BinaryFormat_pcap   BinaryFormat = 0
+	BinaryFormat_pcapng BinaryFormat = 1 // With an interface for each capture interface and link type
+)
+
+// Enum value maps for BinaryFormat.
+var (
+	BinaryFormat_name = map[int32]string{
+		0: "pcap",
+		1: "pcapng",
+	}
+	BinaryFormat_value = map[string]int32{
+		"pcap":   0,
+		"pcapng": 1,
+	}
+)
+
+func (x BinaryFormat) Enum() *BinaryFormat {
+	p := new(BinaryFormat)
+	*p = x
+	return p
+}
+
+func (x BinaryFormat) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (BinaryFormat) Descriptor() protoreflect.EnumDescriptor {
+	return file_v1_api_proto_enumTypes[4].Descriptor()
+}
+
+func (BinaryFormat) Type() protoreflect.EnumType {
+	return &file_v1_api_proto_enumTypes[4]
+}
+
+func (x BinaryFormat) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use BinaryFormat.Descriptor instead.
+func (BinaryFormat) EnumDescriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{4}
+}
+
+// QueryTerm is an additional query type and query to combine with the
+// main one of a QueryReq.
+type QueryTerm struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	QueryType QueryType `protobuf:"varint,1,opt,name=queryType,proto3,enum=v1.QueryType" json:"queryType,omitempty"`
+	Query     string    `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	Direction Direction `protobuf:"varint,3,opt,name=direction,proto3,enum=v1.Direction" json:"direction,omitempty"`
+}
+
+func (x *QueryTerm) Reset() {
+	*x = QueryTerm{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *QueryTerm) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryTerm) ProtoMessage() {}
+
+func (x *QueryTerm) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryTerm.ProtoReflect.Descriptor instead.
+func (*QueryTerm) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *QueryTerm) GetQueryType() QueryType {
+	if x != nil {
+		return x.QueryType
+	}
+	return QueryType_ip
+}
+
+func (x *QueryTerm) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *QueryTerm) GetDirection() Direction {
+	if x != nil {
+		return x.Direction
+	}
+	return Direction_any
+}
+
 type QueryReq struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	StartTime    *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=startTime,proto3" json:"startTime,omitempty"`
-	Duration     *durationpb.Duration   `protobuf:"bytes,2,opt,name=duration,proto3" json:"duration,omitempty"`
-	Label        string                 `protobuf:"bytes,3,opt,name=label,proto3" json:"label,omitempty"`
-	QueryType    QueryType              `protobuf:"varint,4,opt,name=queryType,proto3,enum=v1.QueryType" json:"queryType,omitempty"`
-	Query        string                 `protobuf:"bytes,5,opt,name=query,proto3" json:"query,omitempty"`
-	BinaryOutput bool                   `protobuf:"varint,6,opt,name=binaryOutput,proto3" json:"binaryOutput,omitempty"` // If true, will send binary; if false, will send QueryResp
-	ShowAll      bool                   `protobuf:"varint,7,opt,name=showAll,proto3" json:"showAll,omitempty"`           // If true, will show all of the packet details in Text field
-	Encode       bool                   `protobuf:"varint,8,opt,name=encode,proto3" json:"encode,omitempty"`             // If true, will encode response text as Base64
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=startTime,proto3" json:"startTime,omitempty"`
+	Duration      *durationpb.Duration   `protobuf:"bytes,2,opt,name=duration,proto3" json:"duration,omitempty"`
+	Label         string                 `protobuf:"bytes,3,opt,name=label,proto3" json:"label,omitempty"`
+	QueryType     QueryType              `protobuf:"varint,4,opt,name=queryType,proto3,enum=v1.QueryType" json:"queryType,omitempty"`
+	Query         string                 `protobuf:"bytes,5,opt,name=query,proto3" json:"query,omitempty"`
+	BinaryOutput  bool                   `protobuf:"varint,6,opt,name=binaryOutput,proto3" json:"binaryOutput,omitempty"`                       // If true, will send binary; if false, will send QueryResp
+	ShowAll       bool                   `protobuf:"varint,7,opt,name=showAll,proto3" json:"showAll,omitempty"`                                 // If true, will show all of the packet details in Text field
+	Encode        bool                   `protobuf:"varint,8,opt,name=encode,proto3" json:"encode,omitempty"`                                   // If true, will encode response text as Base64
+	Direction     Direction              `protobuf:"varint,9,opt,name=direction,proto3,enum=v1.Direction" json:"direction,omitempty"`           // Match only the source or destination address (mac only)
+	FlowSummary   FlowSummary            `protobuf:"varint,10,opt,name=flowSummary,proto3,enum=v1.FlowSummary" json:"flowSummary,omitempty"`    // Only send the first and/or last packet of each flow
+	ShowInterface bool                   `protobuf:"varint,11,opt,name=showInterface,proto3" json:"showInterface,omitempty"`                    // If true, will set the capture interface in QueryResp
+	IncludeData   bool                   `protobuf:"varint,12,opt,name=includeData,proto3" json:"includeData,omitempty"`                        // If true, will set the raw packet data in QueryResp
+	DisplayFilter string                 `protobuf:"bytes,13,opt,name=displayFilter,proto3" json:"displayFilter,omitempty"`                     // Only send packets matching this display filter expression
+	PcapPathIdx   []uint32               `protobuf:"varint,14,rep,packed,name=pcapPathIdx,proto3" json:"pcapPathIdx,omitempty"`                 // Only read packets from these pcap-path indices (all if empty)
+	WidePortRange bool                   `protobuf:"varint,15,opt,name=widePortRange,proto3" json:"widePortRange,omitempty"`                    // If true, allow a port range query of more than 16384 ports
+	Terms         []*QueryTerm           `protobuf:"bytes,16,rep,name=terms,proto3" json:"terms,omitempty"`                                     // More terms to combine with queryType and query
+	TermMatch     TermMatch              `protobuf:"varint,17,opt,name=termMatch,proto3,enum=v1.TermMatch" json:"termMatch,omitempty"`          // How the terms are combined, AND by default
+	BinaryFormat  BinaryFormat           `protobuf:"varint,18,opt,name=binaryFormat,proto3,enum=v1.BinaryFormat" json:"binaryFormat,omitempty"` // The file format of binary output
+	Limit         uint32                 `protobuf:"varint,19,opt,name=limit,proto3" json:"limit,omitempty"`                                    // Stop after sending this many packets (0 for no limit)
+	Reverse       bool                   `protobuf:"varint,20,opt,name=reverse,proto3" json:"reverse,omitempty"`                                // Read the newest indices (and packets in each index) first
+	Cursor        string                 `protobuf:"bytes,21,opt,name=cursor,proto3" json:"cursor,omitempty"`                                   // Resume after the packet of the cursor from a previous limited query
 }
 
 func (x *QueryReq) Reset() {
 	*x = QueryReq{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_v1_api_proto_msgTypes[0]
+		mi := &file_v1_api_proto_msgTypes[1]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -115,7 +414,7 @@ func (x *QueryReq) String() string {
 func (*QueryReq) ProtoMessage() {}
 
 func (x *QueryReq) ProtoReflect() protoreflect.Message {
-	mi := &file_v1_api_proto_msgTypes[0]
+	mi := &file_v1_api_proto_msgTypes[1]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -128,7 +427,7 @@ func (x *QueryReq) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use QueryReq.ProtoReflect.Descriptor instead.
 func (*QueryReq) Descriptor() ([]byte, []int) {
-	return file_v1_api_proto_rawDescGZIP(), []int{0}
+	return file_v1_api_proto_rawDescGZIP(), []int{1}
 }
 
 func (x *QueryReq) GetStartTime() *timestamppb.Timestamp {
@@ -187,6 +486,97 @@ func (x *QueryReq) GetEncode() bool {
 	return false
 }
 
+func (x *QueryReq) GetDirection() Direction {
+	if x != nil {
+		return x.Direction
+	}
+	return Direction_any
+}
+
+func (x *QueryReq) GetFlowSummary() FlowSummary {
+	if x != nil {
+		return x.FlowSummary
+	}
+	return FlowSummary_off
+}
+
+func (x *QueryReq) GetShowInterface() bool {
+	if x != nil {
+		return x.ShowInterface
+	}
+	return false
+}
+
+func (x *QueryReq) GetIncludeData() bool {
+	if x != nil {
+		return x.IncludeData
+	}
+	return false
+}
+
+func (x *QueryReq) GetDisplayFilter() string {
+	if x != nil {
+		return x.DisplayFilter
+	}
+	return ""
+}
+
+func (x *QueryReq) GetPcapPathIdx() []uint32 {
+	if x != nil {
+		return x.PcapPathIdx
+	}
+	return nil
+}
+
+func (x *QueryReq) GetWidePortRange() bool {
+	if x != nil {
+		return x.WidePortRange
+	}
+	return false
+}
+
+func (x *QueryReq) GetTerms() []*QueryTerm {
+	if x != nil {
+		return x.Terms
+	}
+	return nil
+}
+
+func (x *QueryReq) GetTermMatch() TermMatch {
+	if x != nil {
+		return x.TermMatch
+	}
+	return TermMatch_match_all
+}
+
+func (x *QueryReq) GetBinaryFormat() BinaryFormat {
+	if x != nil {
+		return x.BinaryFormat
+	}
+	return BinaryFormat_pcap
+}
+
+func (x *QueryReq) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *QueryReq) GetReverse() bool {
+	if x != nil {
+		return x.Reverse
+	}
+	return false
+}
+
+func (x *QueryReq) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
 // QueryResp will send either text or binary, depending on the QueryReq.
 type QueryResp struct {
 	state         protoimpl.MessageState
@@ -207,12 +597,17 @@ type QueryResp struct {
 	Ipv6       bool                   `protobuf:"varint,12,opt,name=ipv6,proto3" json:"ipv6,omitempty"`
 	Text       string                 `protobuf:"bytes,14,opt,name=text,proto3" json:"text,omitempty"`
 	Data       []byte                 `protobuf:"bytes,15,opt,name=data,proto3" json:"data,omitempty"`
+	Interface  string                 `protobuf:"bytes,16,opt,name=interface,proto3" json:"interface,omitempty"`  // Capture interface, if requested and known
+	Truncated  bool                   `protobuf:"varint,17,opt,name=truncated,proto3" json:"truncated,omitempty"` // The packet was longer than the capture snap length, so the data is incomplete
+	LinkType   uint32                 `protobuf:"varint,18,opt,name=linkType,proto3" json:"linkType,omitempty"`   // The link type of data (as in a pcap file header), if it is included
+	Cursor     string                 `protobuf:"bytes,19,opt,name=cursor,proto3" json:"cursor,omitempty"`        // Only set, without a packet, on the last response of a query that stopped at its limit
+	Vlan       []uint32               `protobuf:"varint,20,rep,packed,name=vlan,proto3" json:"vlan,omitempty"`    // 802.1Q VLAN IDs, the outer tag first (not set for summaries from packet metadata)
 }
 
 func (x *QueryResp) Reset() {
 	*x = QueryResp{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_v1_api_proto_msgTypes[1]
+		mi := &file_v1_api_proto_msgTypes[2]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -225,7 +620,7 @@ func (x *QueryResp) String() string {
 func (*QueryResp) ProtoMessage() {}
 
 func (x *QueryResp) ProtoReflect() protoreflect.Message {
-	mi := &file_v1_api_proto_msgTypes[1]
+	mi := &file_v1_api_proto_msgTypes[2]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -238,7 +633,7 @@ func (x *QueryResp) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use QueryResp.ProtoReflect.Descriptor instead.
 func (*QueryResp) Descriptor() ([]byte, []int) {
-	return file_v1_api_proto_rawDescGZIP(), []int{1}
+	return file_v1_api_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *QueryResp) GetTimestamp() *timestamppb.Timestamp {
@@ -339,19 +734,56 @@ func (x *QueryResp) GetData() []byte {
 	return nil
 }
 
-// QueryBinaryResp will send a pcap binary stream.
+func (x *QueryResp) GetInterface() string {
+	if x != nil {
+		return x.Interface
+	}
+	return ""
+}
+
+func (x *QueryResp) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *QueryResp) GetLinkType() uint32 {
+	if x != nil {
+		return x.LinkType
+	}
+	return 0
+}
+
+func (x *QueryResp) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *QueryResp) GetVlan() []uint32 {
+	if x != nil {
+		return x.Vlan
+	}
+	return nil
+}
+
+// QueryBinaryResp will send a pcap (or pcapng) binary stream. A query that
+// stopped at its limit ends with a response that only has a cursor.
 type QueryBinaryResp struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
 	Binary []byte `protobuf:"bytes,2,opt,name=binary,proto3" json:"binary,omitempty"`
+	Cursor string `protobuf:"bytes,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
 }
 
 func (x *QueryBinaryResp) Reset() {
 	*x = QueryBinaryResp{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_v1_api_proto_msgTypes[2]
+		mi := &file_v1_api_proto_msgTypes[3]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -364,7 +796,7 @@ func (x *QueryBinaryResp) String() string {
 func (*QueryBinaryResp) ProtoMessage() {}
 
 func (x *QueryBinaryResp) ProtoReflect() protoreflect.Message {
-	mi := &file_v1_api_proto_msgTypes[2]
+	mi := &file_v1_api_proto_msgTypes[3]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -377,7 +809,7 @@ func (x *QueryBinaryResp) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use QueryBinaryResp.ProtoReflect.Descriptor instead.
 func (*QueryBinaryResp) Descriptor() ([]byte, []int) {
-	return file_v1_api_proto_rawDescGZIP(), []int{2}
+	return file_v1_api_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *QueryBinaryResp) GetBinary() []byte {
@@ -387,9 +819,766 @@ func (x *QueryBinaryResp) GetBinary() []byte {
 	return nil
 }
 
-var File_v1_api_proto protoreflect.FileDescriptor
+func (x *QueryBinaryResp) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
 
-var file_v1_api_proto_rawDesc = []byte{
+// FollowReq polls for packets after the since cursor.
+type FollowReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Query *QueryReq `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"` // The duration is ignored, follow queries are open ended
+	Since string    `protobuf:"bytes,2,opt,name=since,proto3" json:"since,omitempty"` // The cursor from the previous FollowResp, empty to start at the query start time
+}
+
+func (x *FollowReq) Reset() {
+	*x = FollowReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FollowReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FollowReq) ProtoMessage() {}
+
+func (x *FollowReq) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FollowReq.ProtoReflect.Descriptor instead.
+func (*FollowReq) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *FollowReq) GetQuery() *QueryReq {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+func (x *FollowReq) GetSince() string {
+	if x != nil {
+		return x.Since
+	}
+	return ""
+}
+
+// FollowResp sends a matching packet with the cursor after it, or the
+// cursor after an index once all of it has been read. The last cursor is
+// passed as since on the next poll.
+type FollowResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Result *QueryResp `protobuf:"bytes,1,opt,name=result,proto3" json:"result,omitempty"`
+	Cursor string     `protobuf:"bytes,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+}
+
+func (x *FollowResp) Reset() {
+	*x = FollowResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FollowResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FollowResp) ProtoMessage() {}
+
+func (x *FollowResp) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FollowResp.ProtoReflect.Descriptor instead.
+func (*FollowResp) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *FollowResp) GetResult() *QueryResp {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *FollowResp) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+// WarmReq selects the indices to open ahead of queries.
+type WarmReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	StartTime *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=startTime,proto3" json:"startTime,omitempty"`
+	Duration  *durationpb.Duration   `protobuf:"bytes,2,opt,name=duration,proto3" json:"duration,omitempty"`
+	Label     string                 `protobuf:"bytes,3,opt,name=label,proto3" json:"label,omitempty"`
+}
+
+func (x *WarmReq) Reset() {
+	*x = WarmReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *WarmReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WarmReq) ProtoMessage() {}
+
+func (x *WarmReq) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WarmReq.ProtoReflect.Descriptor instead.
+func (*WarmReq) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *WarmReq) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *WarmReq) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *WarmReq) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+// WarmResp reports the indices that are open and ready for queries.
+type WarmResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Indices []string `protobuf:"bytes,1,rep,name=indices,proto3" json:"indices,omitempty"`
+}
+
+func (x *WarmResp) Reset() {
+	*x = WarmResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *WarmResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WarmResp) ProtoMessage() {}
+
+func (x *WarmResp) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WarmResp.ProtoReflect.Descriptor instead.
+func (*WarmResp) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *WarmResp) GetIndices() []string {
+	if x != nil {
+		return x.Indices
+	}
+	return nil
+}
+
+// ProtocolsReq selects the indices to count the protocols of.
+type ProtocolsReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	StartTime *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=startTime,proto3" json:"startTime,omitempty"`
+	Duration  *durationpb.Duration   `protobuf:"bytes,2,opt,name=duration,proto3" json:"duration,omitempty"`
+	Label     string                 `protobuf:"bytes,3,opt,name=label,proto3" json:"label,omitempty"`
+}
+
+func (x *ProtocolsReq) Reset() {
+	*x = ProtocolsReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProtocolsReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProtocolsReq) ProtoMessage() {}
+
+func (x *ProtocolsReq) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProtocolsReq.ProtoReflect.Descriptor instead.
+func (*ProtocolsReq) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ProtocolsReq) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *ProtocolsReq) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *ProtocolsReq) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+// ProtocolCount is the number of packets of an IP protocol.
+type ProtocolCount struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Number  uint32 `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Name    string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Packets uint64 `protobuf:"varint,3,opt,name=packets,proto3" json:"packets,omitempty"`
+}
+
+func (x *ProtocolCount) Reset() {
+	*x = ProtocolCount{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProtocolCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProtocolCount) ProtoMessage() {}
+
+func (x *ProtocolCount) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProtocolCount.ProtoReflect.Descriptor instead.
+func (*ProtocolCount) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ProtocolCount) GetNumber() uint32 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *ProtocolCount) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ProtocolCount) GetPackets() uint64 {
+	if x != nil {
+		return x.Packets
+	}
+	return 0
+}
+
+// ProtocolsResp is the protocols present in the indices, most packets
+// first.
+type ProtocolsResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Protocols []*ProtocolCount `protobuf:"bytes,1,rep,name=protocols,proto3" json:"protocols,omitempty"`
+}
+
+func (x *ProtocolsResp) Reset() {
+	*x = ProtocolsResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProtocolsResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProtocolsResp) ProtoMessage() {}
+
+func (x *ProtocolsResp) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProtocolsResp.ProtoReflect.Descriptor instead.
+func (*ProtocolsResp) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ProtocolsResp) GetProtocols() []*ProtocolCount {
+	if x != nil {
+		return x.Protocols
+	}
+	return nil
+}
+
+// CountResp is the number of packets that match a query.
+type CountResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Packets uint64 `protobuf:"varint,1,opt,name=packets,proto3" json:"packets,omitempty"`
+	// approximate is set if some of the indices do not store packet
+	// metadata, so their packets outside of the time range are counted too.
+	Approximate bool `protobuf:"varint,2,opt,name=approximate,proto3" json:"approximate,omitempty"`
+}
+
+func (x *CountResp) Reset() {
+	*x = CountResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CountResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CountResp) ProtoMessage() {}
+
+func (x *CountResp) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CountResp.ProtoReflect.Descriptor instead.
+func (*CountResp) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CountResp) GetPackets() uint64 {
+	if x != nil {
+		return x.Packets
+	}
+	return 0
+}
+
+func (x *CountResp) GetApproximate() bool {
+	if x != nil {
+		return x.Approximate
+	}
+	return false
+}
+
+// StatsReq selects the packets of a host to summarize.
+type StatsReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	StartTime *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=startTime,proto3" json:"startTime,omitempty"`
+	Duration  *durationpb.Duration   `protobuf:"bytes,2,opt,name=duration,proto3" json:"duration,omitempty"`
+	Label     string                 `protobuf:"bytes,3,opt,name=label,proto3" json:"label,omitempty"`
+	Ip        string                 `protobuf:"bytes,4,opt,name=ip,proto3" json:"ip,omitempty"`    // The host IP address
+	Top       uint32                 `protobuf:"varint,5,opt,name=top,proto3" json:"top,omitempty"` // The number of peers and ports to return, 0 for the default (10)
+}
+
+func (x *StatsReq) Reset() {
+	*x = StatsReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StatsReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsReq) ProtoMessage() {}
+
+func (x *StatsReq) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsReq.ProtoReflect.Descriptor instead.
+func (*StatsReq) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *StatsReq) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *StatsReq) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *StatsReq) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *StatsReq) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *StatsReq) GetTop() uint32 {
+	if x != nil {
+		return x.Top
+	}
+	return 0
+}
+
+// PeerCount is the traffic between a host and one of its peers.
+type PeerCount struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Ip      string `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Packets uint64 `protobuf:"varint,2,opt,name=packets,proto3" json:"packets,omitempty"`
+	Bytes   uint64 `protobuf:"varint,3,opt,name=bytes,proto3" json:"bytes,omitempty"`
+}
+
+func (x *PeerCount) Reset() {
+	*x = PeerCount{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PeerCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PeerCount) ProtoMessage() {}
+
+func (x *PeerCount) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PeerCount.ProtoReflect.Descriptor instead.
+func (*PeerCount) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *PeerCount) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *PeerCount) GetPackets() uint64 {
+	if x != nil {
+		return x.Packets
+	}
+	return 0
+}
+
+func (x *PeerCount) GetBytes() uint64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+// PortCount is the number of packets of a host with a TCP or UDP port (the
+// lower of the source and destination port, which is usually the service).
+type PortCount struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Port    uint32 `protobuf:"varint,1,opt,name=port,proto3" json:"port,omitempty"`
+	Packets uint64 `protobuf:"varint,2,opt,name=packets,proto3" json:"packets,omitempty"`
+}
+
+func (x *PortCount) Reset() {
+	*x = PortCount{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PortCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PortCount) ProtoMessage() {}
+
+func (x *PortCount) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PortCount.ProtoReflect.Descriptor instead.
+func (*PortCount) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *PortCount) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *PortCount) GetPackets() uint64 {
+	if x != nil {
+		return x.Packets
+	}
+	return 0
+}
+
+// StatsResp summarizes the traffic of a host, most packets first.
+type StatsResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Ip        string           `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Packets   uint64           `protobuf:"varint,2,opt,name=packets,proto3" json:"packets,omitempty"`
+	Bytes     uint64           `protobuf:"varint,3,opt,name=bytes,proto3" json:"bytes,omitempty"` // Total packet length (not just the captured bytes)
+	Peers     []*PeerCount     `protobuf:"bytes,4,rep,name=peers,proto3" json:"peers,omitempty"`
+	Protocols []*ProtocolCount `protobuf:"bytes,5,rep,name=protocols,proto3" json:"protocols,omitempty"`
+	Ports     []*PortCount     `protobuf:"bytes,6,rep,name=ports,proto3" json:"ports,omitempty"`
+}
+
+func (x *StatsResp) Reset() {
+	*x = StatsResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_v1_api_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StatsResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsResp) ProtoMessage() {}
+
+func (x *StatsResp) ProtoReflect() protoreflect.Message {
+	mi := &file_v1_api_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsResp.ProtoReflect.Descriptor instead.
+func (*StatsResp) Descriptor() ([]byte, []int) {
+	return file_v1_api_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *StatsResp) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *StatsResp) GetPackets() uint64 {
+	if x != nil {
+		return x.Packets
+	}
+	return 0
+}
+
+func (x *StatsResp) GetBytes() uint64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *StatsResp) GetPeers() []*PeerCount {
+	if x != nil {
+		return x.Peers
+	}
+	return nil
+}
+
+func (x *StatsResp) GetProtocols() []*ProtocolCount {
+	if x != nil {
+		return x.Protocols
+	}
+	return nil
+}
+
+func (x *StatsResp) GetPorts() []*PortCount {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+var File_v1_api_proto protoreflect.FileDescriptor
+
+var file_v1_api_proto_rawDesc = []byte{
 	0x0a, 0x0c, 0x76, 0x31, 0x2f, 0x61, 0x70, 0x69, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x02,
 	0x76, 0x31, 0x1a, 0x1c, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x61,
 	0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
@@ -397,7 +1586,145 @@ var file_v1_api_proto_rawDesc = []byte{
 	0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74,
 	0x6f, 0x1a, 0x1e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
 	0x75, 0x66, 0x2f, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x22, 0xaa, 0x02, 0x0a, 0x08, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52, 0x65, 0x71, 0x12, 0x38,
+	0x6f, 0x22, 0x7b, 0x0a, 0x09, 0x51, 0x75, 0x65, 0x72, 0x79, 0x54, 0x65, 0x72, 0x6d, 0x12, 0x2b,
+	0x0a, 0x09, 0x71, 0x75, 0x65, 0x72, 0x79, 0x54, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0e, 0x32, 0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x54, 0x79, 0x70, 0x65,
+	0x52, 0x09, 0x71, 0x75, 0x65, 0x72, 0x79, 0x54, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x71,
+	0x75, 0x65, 0x72, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x71, 0x75, 0x65, 0x72,
+	0x79, 0x12, 0x2b, 0x0a, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0e, 0x32, 0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x90,
+	0x06, 0x0a, 0x08, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52, 0x65, 0x71, 0x12, 0x38, 0x0a, 0x09, 0x73,
+	0x74, 0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x73, 0x74, 0x61, 0x72,
+	0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x35, 0x0a, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x52, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a, 0x05,
+	0x6c, 0x61, 0x62, 0x65, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6c, 0x61, 0x62,
+	0x65, 0x6c, 0x12, 0x2b, 0x0a, 0x09, 0x71, 0x75, 0x65, 0x72, 0x79, 0x54, 0x79, 0x70, 0x65, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79,
+	0x54, 0x79, 0x70, 0x65, 0x52, 0x09, 0x71, 0x75, 0x65, 0x72, 0x79, 0x54, 0x79, 0x70, 0x65, 0x12,
+	0x14, 0x0a, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x71, 0x75, 0x65, 0x72, 0x79, 0x12, 0x22, 0x0a, 0x0c, 0x62, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x4f,
+	0x75, 0x74, 0x70, 0x75, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x62, 0x69, 0x6e,
+	0x61, 0x72, 0x79, 0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x68, 0x6f,
+	0x77, 0x41, 0x6c, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x73, 0x68, 0x6f, 0x77,
+	0x41, 0x6c, 0x6c, 0x12, 0x16, 0x0a, 0x06, 0x65, 0x6e, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x08, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x06, 0x65, 0x6e, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x2b, 0x0a, 0x09, 0x64,
+	0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0d,
+	0x2e, 0x76, 0x31, 0x2e, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x09, 0x64,
+	0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x31, 0x0a, 0x0b, 0x66, 0x6c, 0x6f, 0x77,
+	0x53, 0x75, 0x6d, 0x6d, 0x61, 0x72, 0x79, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0f, 0x2e,
+	0x76, 0x31, 0x2e, 0x46, 0x6c, 0x6f, 0x77, 0x53, 0x75, 0x6d, 0x6d, 0x61, 0x72, 0x79, 0x52, 0x0b,
+	0x66, 0x6c, 0x6f, 0x77, 0x53, 0x75, 0x6d, 0x6d, 0x61, 0x72, 0x79, 0x12, 0x24, 0x0a, 0x0d, 0x73,
+	0x68, 0x6f, 0x77, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x18, 0x0b, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x0d, 0x73, 0x68, 0x6f, 0x77, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63,
+	0x65, 0x12, 0x20, 0x0a, 0x0b, 0x69, 0x6e, 0x63, 0x6c, 0x75, 0x64, 0x65, 0x44, 0x61, 0x74, 0x61,
+	0x18, 0x0c, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b, 0x69, 0x6e, 0x63, 0x6c, 0x75, 0x64, 0x65, 0x44,
+	0x61, 0x74, 0x61, 0x12, 0x24, 0x0a, 0x0d, 0x64, 0x69, 0x73, 0x70, 0x6c, 0x61, 0x79, 0x46, 0x69,
+	0x6c, 0x74, 0x65, 0x72, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x64, 0x69, 0x73, 0x70,
+	0x6c, 0x61, 0x79, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12, 0x20, 0x0a, 0x0b, 0x70, 0x63, 0x61,
+	0x70, 0x50, 0x61, 0x74, 0x68, 0x49, 0x64, 0x78, 0x18, 0x0e, 0x20, 0x03, 0x28, 0x0d, 0x52, 0x0b,
+	0x70, 0x63, 0x61, 0x70, 0x50, 0x61, 0x74, 0x68, 0x49, 0x64, 0x78, 0x12, 0x24, 0x0a, 0x0d, 0x77,
+	0x69, 0x64, 0x65, 0x50, 0x6f, 0x72, 0x74, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x18, 0x0f, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x0d, 0x77, 0x69, 0x64, 0x65, 0x50, 0x6f, 0x72, 0x74, 0x52, 0x61, 0x6e, 0x67,
+	0x65, 0x12, 0x23, 0x0a, 0x05, 0x74, 0x65, 0x72, 0x6d, 0x73, 0x18, 0x10, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x54, 0x65, 0x72, 0x6d, 0x52,
+	0x05, 0x74, 0x65, 0x72, 0x6d, 0x73, 0x12, 0x2b, 0x0a, 0x09, 0x74, 0x65, 0x72, 0x6d, 0x4d, 0x61,
+	0x74, 0x63, 0x68, 0x18, 0x11, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x54,
+	0x65, 0x72, 0x6d, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x52, 0x09, 0x74, 0x65, 0x72, 0x6d, 0x4d, 0x61,
+	0x74, 0x63, 0x68, 0x12, 0x34, 0x0a, 0x0c, 0x62, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x46, 0x6f, 0x72,
+	0x6d, 0x61, 0x74, 0x18, 0x12, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x10, 0x2e, 0x76, 0x31, 0x2e, 0x42,
+	0x69, 0x6e, 0x61, 0x72, 0x79, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x52, 0x0c, 0x62, 0x69, 0x6e,
+	0x61, 0x72, 0x79, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x69, 0x6d,
+	0x69, 0x74, 0x18, 0x13, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x12,
+	0x18, 0x0a, 0x07, 0x72, 0x65, 0x76, 0x65, 0x72, 0x73, 0x65, 0x18, 0x14, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x07, 0x72, 0x65, 0x76, 0x65, 0x72, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x75, 0x72,
+	0x73, 0x6f, 0x72, 0x18, 0x15, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x75, 0x72, 0x73, 0x6f,
+	0x72, 0x22, 0x83, 0x04, 0x0a, 0x09, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52, 0x65, 0x73, 0x70, 0x12,
+	0x38, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09,
+	0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e,
+	0x67, 0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74,
+	0x68, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x72, 0x63, 0x4d, 0x41, 0x43, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x73, 0x72, 0x63, 0x4d, 0x41, 0x43, 0x12, 0x16, 0x0a, 0x06, 0x64, 0x73, 0x74,
+	0x4d, 0x41, 0x43, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x64, 0x73, 0x74, 0x4d, 0x41,
+	0x43, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x72, 0x63, 0x49, 0x50, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x73, 0x72, 0x63, 0x49, 0x50, 0x12, 0x14, 0x0a, 0x05, 0x64, 0x73, 0x74, 0x49, 0x50,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x64, 0x73, 0x74, 0x49, 0x50, 0x12, 0x18, 0x0a,
+	0x07, 0x73, 0x72, 0x63, 0x50, 0x6f, 0x72, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07,
+	0x73, 0x72, 0x63, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x73, 0x72, 0x63, 0x50, 0x6f,
+	0x72, 0x74, 0x53, 0x74, 0x72, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x72, 0x63,
+	0x50, 0x6f, 0x72, 0x74, 0x53, 0x74, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x64, 0x73, 0x74, 0x50, 0x6f,
+	0x72, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x64, 0x73, 0x74, 0x50, 0x6f, 0x72,
+	0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x64, 0x73, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x53, 0x74, 0x72, 0x18,
+	0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x64, 0x73, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x53, 0x74,
+	0x72, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x12, 0x0a, 0x04, 0x69, 0x70, 0x76, 0x36, 0x18,
+	0x0c, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x69, 0x70, 0x76, 0x36, 0x12, 0x12, 0x0a, 0x04, 0x74,
+	0x65, 0x78, 0x74, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x65, 0x78, 0x74, 0x12,
+	0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64,
+	0x61, 0x74, 0x61, 0x12, 0x1c, 0x0a, 0x09, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65,
+	0x18, 0x10, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63,
+	0x65, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x72, 0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x64, 0x18, 0x11,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x74, 0x72, 0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x64, 0x12,
+	0x1a, 0x0a, 0x08, 0x6c, 0x69, 0x6e, 0x6b, 0x54, 0x79, 0x70, 0x65, 0x18, 0x12, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x08, 0x6c, 0x69, 0x6e, 0x6b, 0x54, 0x79, 0x70, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63,
+	0x75, 0x72, 0x73, 0x6f, 0x72, 0x18, 0x13, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x75, 0x72,
+	0x73, 0x6f, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x76, 0x6c, 0x61, 0x6e, 0x18, 0x14, 0x20, 0x03, 0x28,
+	0x0d, 0x52, 0x04, 0x76, 0x6c, 0x61, 0x6e, 0x22, 0x41, 0x0a, 0x0f, 0x51, 0x75, 0x65, 0x72, 0x79,
+	0x42, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x52, 0x65, 0x73, 0x70, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x69,
+	0x6e, 0x61, 0x72, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x62, 0x69, 0x6e, 0x61,
+	0x72, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x22, 0x45, 0x0a, 0x09, 0x46, 0x6f,
+	0x6c, 0x6c, 0x6f, 0x77, 0x52, 0x65, 0x71, 0x12, 0x22, 0x0a, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72,
+	0x79, 0x52, 0x65, 0x71, 0x52, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x73,
+	0x69, 0x6e, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x73, 0x69, 0x6e, 0x63,
+	0x65, 0x22, 0x4b, 0x0a, 0x0a, 0x46, 0x6f, 0x6c, 0x6c, 0x6f, 0x77, 0x52, 0x65, 0x73, 0x70, 0x12,
+	0x25, 0x0a, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52, 0x65, 0x73, 0x70, 0x52, 0x06,
+	0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72, 0x22, 0x90,
+	0x01, 0x0a, 0x07, 0x57, 0x61, 0x72, 0x6d, 0x52, 0x65, 0x71, 0x12, 0x38, 0x0a, 0x09, 0x73, 0x74,
+	0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x73, 0x74, 0x61, 0x72, 0x74,
+	0x54, 0x69, 0x6d, 0x65, 0x12, 0x35, 0x0a, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x52, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x6c,
+	0x61, 0x62, 0x65, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6c, 0x61, 0x62, 0x65,
+	0x6c, 0x22, 0x24, 0x0a, 0x08, 0x57, 0x61, 0x72, 0x6d, 0x52, 0x65, 0x73, 0x70, 0x12, 0x18, 0x0a,
+	0x07, 0x69, 0x6e, 0x64, 0x69, 0x63, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07,
+	0x69, 0x6e, 0x64, 0x69, 0x63, 0x65, 0x73, 0x22, 0x95, 0x01, 0x0a, 0x0c, 0x50, 0x72, 0x6f, 0x74,
+	0x6f, 0x63, 0x6f, 0x6c, 0x73, 0x52, 0x65, 0x71, 0x12, 0x38, 0x0a, 0x09, 0x73, 0x74, 0x61, 0x72,
+	0x74, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x73, 0x74, 0x61, 0x72, 0x74, 0x54, 0x69,
+	0x6d, 0x65, 0x12, 0x35, 0x0a, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52,
+	0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x61, 0x62,
+	0x65, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x22,
+	0x55, 0x0a, 0x0d, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x43, 0x6f, 0x75, 0x6e, 0x74,
+	0x12, 0x16, 0x0a, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x18, 0x0a, 0x07,
+	0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x70,
+	0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x22, 0x40, 0x0a, 0x0d, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63,
+	0x6f, 0x6c, 0x73, 0x52, 0x65, 0x73, 0x70, 0x12, 0x2f, 0x0a, 0x09, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x63, 0x6f, 0x6c, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x76, 0x31, 0x2e,
+	0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x52, 0x09, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x73, 0x22, 0x47, 0x0a, 0x09, 0x43, 0x6f, 0x75, 0x6e,
+	0x74, 0x52, 0x65, 0x73, 0x70, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12,
+	0x20, 0x0a, 0x0b, 0x61, 0x70, 0x70, 0x72, 0x6f, 0x78, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x0b, 0x61, 0x70, 0x70, 0x72, 0x6f, 0x78, 0x69, 0x6d, 0x61, 0x74,
+	0x65, 0x22, 0xb3, 0x01, 0x0a, 0x08, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x12, 0x38,
 	0x0a, 0x09, 0x73, 0x74, 0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
 	0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
 	0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x73,
@@ -406,58 +1733,81 @@ var file_v1_api_proto_rawDesc = []byte{
 	0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72,
 	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12,
 	0x14, 0x0a, 0x05, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
-	0x6c, 0x61, 0x62, 0x65, 0x6c, 0x12, 0x2b, 0x0a, 0x09, 0x71, 0x75, 0x65, 0x72, 0x79, 0x54, 0x79,
-	0x70, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75,
-	0x65, 0x72, 0x79, 0x54, 0x79, 0x70, 0x65, 0x52, 0x09, 0x71, 0x75, 0x65, 0x72, 0x79, 0x54, 0x79,
-	0x70, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x12, 0x22, 0x0a, 0x0c, 0x62, 0x69, 0x6e, 0x61,
-	0x72, 0x79, 0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c,
-	0x62, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x12, 0x18, 0x0a, 0x07,
-	0x73, 0x68, 0x6f, 0x77, 0x41, 0x6c, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x73,
-	0x68, 0x6f, 0x77, 0x41, 0x6c, 0x6c, 0x12, 0x16, 0x0a, 0x06, 0x65, 0x6e, 0x63, 0x6f, 0x64, 0x65,
-	0x18, 0x08, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x65, 0x6e, 0x63, 0x6f, 0x64, 0x65, 0x22, 0xff,
-	0x02, 0x0a, 0x09, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52, 0x65, 0x73, 0x70, 0x12, 0x38, 0x0a, 0x09,
-	0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
-	0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
-	0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x74, 0x69, 0x6d,
-	0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x16,
-	0x0a, 0x06, 0x73, 0x72, 0x63, 0x4d, 0x41, 0x43, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
-	0x73, 0x72, 0x63, 0x4d, 0x41, 0x43, 0x12, 0x16, 0x0a, 0x06, 0x64, 0x73, 0x74, 0x4d, 0x41, 0x43,
-	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x64, 0x73, 0x74, 0x4d, 0x41, 0x43, 0x12, 0x14,
-	0x0a, 0x05, 0x73, 0x72, 0x63, 0x49, 0x50, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x73,
-	0x72, 0x63, 0x49, 0x50, 0x12, 0x14, 0x0a, 0x05, 0x64, 0x73, 0x74, 0x49, 0x50, 0x18, 0x06, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x05, 0x64, 0x73, 0x74, 0x49, 0x50, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x72,
-	0x63, 0x50, 0x6f, 0x72, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x73, 0x72, 0x63,
-	0x50, 0x6f, 0x72, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x73, 0x72, 0x63, 0x50, 0x6f, 0x72, 0x74, 0x53,
-	0x74, 0x72, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x72, 0x63, 0x50, 0x6f, 0x72,
-	0x74, 0x53, 0x74, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x64, 0x73, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x18,
-	0x09, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x64, 0x73, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x1e,
-	0x0a, 0x0a, 0x64, 0x73, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x53, 0x74, 0x72, 0x18, 0x0a, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x0a, 0x64, 0x73, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x53, 0x74, 0x72, 0x12, 0x14,
-	0x0a, 0x05, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x12, 0x0a, 0x04, 0x69, 0x70, 0x76, 0x36, 0x18, 0x0c, 0x20, 0x01,
-	0x28, 0x08, 0x52, 0x04, 0x69, 0x70, 0x76, 0x36, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x65, 0x78, 0x74,
-	0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x65, 0x78, 0x74, 0x12, 0x12, 0x0a, 0x04,
-	0x64, 0x61, 0x74, 0x61, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61,
-	0x22, 0x29, 0x0a, 0x0f, 0x51, 0x75, 0x65, 0x72, 0x79, 0x42, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x52,
-	0x65, 0x73, 0x70, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x0c, 0x52, 0x06, 0x62, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x2a, 0x34, 0x0a, 0x09, 0x51,
-	0x75, 0x65, 0x72, 0x79, 0x54, 0x79, 0x70, 0x65, 0x12, 0x06, 0x0a, 0x02, 0x69, 0x70, 0x10, 0x00,
-	0x12, 0x08, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x10, 0x01, 0x12, 0x07, 0x0a, 0x03, 0x6d, 0x61,
-	0x63, 0x10, 0x02, 0x12, 0x0c, 0x0a, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x10,
-	0x03, 0x32, 0x88, 0x01, 0x0a, 0x0d, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x53, 0x65, 0x72, 0x76,
-	0x69, 0x63, 0x65, 0x12, 0x3b, 0x0a, 0x0b, 0x51, 0x75, 0x65, 0x72, 0x79, 0x53, 0x74, 0x72, 0x65,
+	0x6c, 0x61, 0x62, 0x65, 0x6c, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x02, 0x69, 0x70, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x6f, 0x70, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x03, 0x74, 0x6f, 0x70, 0x22, 0x4b, 0x0a, 0x09, 0x50, 0x65, 0x65, 0x72, 0x43,
+	0x6f, 0x75, 0x6e, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x02, 0x69, 0x70, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x14,
+	0x0a, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x62,
+	0x79, 0x74, 0x65, 0x73, 0x22, 0x39, 0x0a, 0x09, 0x50, 0x6f, 0x72, 0x74, 0x43, 0x6f, 0x75, 0x6e,
+	0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x04, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x22,
+	0xc6, 0x01, 0x0a, 0x09, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x12, 0x0e, 0x0a,
+	0x02, 0x69, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x70, 0x12, 0x18, 0x0a,
+	0x07, 0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07,
+	0x70, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x12, 0x23, 0x0a,
+	0x05, 0x70, 0x65, 0x65, 0x72, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x76,
+	0x31, 0x2e, 0x50, 0x65, 0x65, 0x72, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x52, 0x05, 0x70, 0x65, 0x65,
+	0x72, 0x73, 0x12, 0x2f, 0x0a, 0x09, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x73, 0x18,
+	0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f,
+	0x63, 0x6f, 0x6c, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x52, 0x09, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63,
+	0x6f, 0x6c, 0x73, 0x12, 0x23, 0x0a, 0x05, 0x70, 0x6f, 0x72, 0x74, 0x73, 0x18, 0x06, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x72, 0x74, 0x43, 0x6f, 0x75, 0x6e,
+	0x74, 0x52, 0x05, 0x70, 0x6f, 0x72, 0x74, 0x73, 0x2a, 0x80, 0x01, 0x0a, 0x09, 0x51, 0x75, 0x65,
+	0x72, 0x79, 0x54, 0x79, 0x70, 0x65, 0x12, 0x06, 0x0a, 0x02, 0x69, 0x70, 0x10, 0x00, 0x12, 0x08,
+	0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x10, 0x01, 0x12, 0x07, 0x0a, 0x03, 0x6d, 0x61, 0x63, 0x10,
+	0x02, 0x12, 0x0c, 0x0a, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x10, 0x03, 0x12,
+	0x08, 0x0a, 0x04, 0x6d, 0x70, 0x6c, 0x73, 0x10, 0x04, 0x12, 0x07, 0x0a, 0x03, 0x76, 0x6e, 0x69,
+	0x10, 0x05, 0x12, 0x08, 0x0a, 0x04, 0x66, 0x6c, 0x6f, 0x77, 0x10, 0x06, 0x12, 0x0d, 0x0a, 0x09,
+	0x69, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x10, 0x07, 0x12, 0x0a, 0x0a, 0x06, 0x64,
+	0x6f, 0x6d, 0x61, 0x69, 0x6e, 0x10, 0x08, 0x12, 0x08, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x10,
+	0x09, 0x12, 0x08, 0x0a, 0x04, 0x76, 0x6c, 0x61, 0x6e, 0x10, 0x0a, 0x2a, 0x3b, 0x0a, 0x0b, 0x46,
+	0x6c, 0x6f, 0x77, 0x53, 0x75, 0x6d, 0x6d, 0x61, 0x72, 0x79, 0x12, 0x07, 0x0a, 0x03, 0x6f, 0x66,
+	0x66, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x66, 0x69, 0x72, 0x73, 0x74, 0x10, 0x01, 0x12, 0x08,
+	0x0a, 0x04, 0x6c, 0x61, 0x73, 0x74, 0x10, 0x02, 0x12, 0x0e, 0x0a, 0x0a, 0x66, 0x69, 0x72, 0x73,
+	0x74, 0x5f, 0x6c, 0x61, 0x73, 0x74, 0x10, 0x03, 0x2a, 0x26, 0x0a, 0x09, 0x44, 0x69, 0x72, 0x65,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x07, 0x0a, 0x03, 0x61, 0x6e, 0x79, 0x10, 0x00, 0x12, 0x07,
+	0x0a, 0x03, 0x73, 0x72, 0x63, 0x10, 0x01, 0x12, 0x07, 0x0a, 0x03, 0x64, 0x73, 0x74, 0x10, 0x02,
+	0x2a, 0x29, 0x0a, 0x09, 0x54, 0x65, 0x72, 0x6d, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x12, 0x0d, 0x0a,
+	0x09, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x5f, 0x61, 0x6c, 0x6c, 0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09,
+	0x6d, 0x61, 0x74, 0x63, 0x68, 0x5f, 0x61, 0x6e, 0x79, 0x10, 0x01, 0x2a, 0x24, 0x0a, 0x0c, 0x42,
+	0x69, 0x6e, 0x61, 0x72, 0x79, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x08, 0x0a, 0x04, 0x70,
+	0x63, 0x61, 0x70, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x70, 0x63, 0x61, 0x70, 0x6e, 0x67, 0x10,
+	0x01, 0x32, 0xc9, 0x03, 0x0a, 0x0d, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x53, 0x65, 0x72, 0x76,
+	0x69, 0x63, 0x65, 0x12, 0x47, 0x0a, 0x0b, 0x51, 0x75, 0x65, 0x72, 0x79, 0x53, 0x74, 0x72, 0x65,
 	0x61, 0x6d, 0x12, 0x0c, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52, 0x65, 0x71,
 	0x1a, 0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52, 0x65, 0x73, 0x70, 0x22,
-	0x0d, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x07, 0x12, 0x05, 0x2f, 0x76, 0x31, 0x2f, 0x71, 0x30, 0x01,
-	0x12, 0x3a, 0x0a, 0x11, 0x51, 0x75, 0x65, 0x72, 0x79, 0x42, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x53,
-	0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x0c, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79,
-	0x52, 0x65, 0x71, 0x1a, 0x13, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x42, 0x69,
-	0x6e, 0x61, 0x72, 0x79, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x30, 0x01, 0x42, 0x23, 0x5a, 0x21,
-	0x63, 0x6f, 0x64, 0x65, 0x2e, 0x6f, 0x72, 0x6e, 0x6c, 0x2e, 0x67, 0x6f, 0x76, 0x2f, 0x73, 0x69,
-	0x74, 0x75, 0x2f, 0x6d, 0x65, 0x72, 0x63, 0x75, 0x72, 0x79, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x76,
-	0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x19, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x13, 0x12, 0x05, 0x2f, 0x76, 0x31, 0x2f, 0x71, 0x5a, 0x0a,
+	0x22, 0x05, 0x2f, 0x76, 0x31, 0x2f, 0x71, 0x3a, 0x01, 0x2a, 0x30, 0x01, 0x12, 0x3a, 0x0a, 0x11,
+	0x51, 0x75, 0x65, 0x72, 0x79, 0x42, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x53, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x12, 0x0c, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52, 0x65, 0x71, 0x1a,
+	0x13, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x42, 0x69, 0x6e, 0x61, 0x72, 0x79,
+	0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x30, 0x01, 0x12, 0x30, 0x0a, 0x0b, 0x51, 0x75, 0x65, 0x72,
+	0x79, 0x46, 0x6f, 0x6c, 0x6c, 0x6f, 0x77, 0x12, 0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x46, 0x6f, 0x6c,
+	0x6c, 0x6f, 0x77, 0x52, 0x65, 0x71, 0x1a, 0x0e, 0x2e, 0x76, 0x31, 0x2e, 0x46, 0x6f, 0x6c, 0x6c,
+	0x6f, 0x77, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x30, 0x01, 0x12, 0x36, 0x0a, 0x04, 0x57, 0x61,
+	0x72, 0x6d, 0x12, 0x0b, 0x2e, 0x76, 0x31, 0x2e, 0x57, 0x61, 0x72, 0x6d, 0x52, 0x65, 0x71, 0x1a,
+	0x0c, 0x2e, 0x76, 0x31, 0x2e, 0x57, 0x61, 0x72, 0x6d, 0x52, 0x65, 0x73, 0x70, 0x22, 0x13, 0x82,
+	0xd3, 0xe4, 0x93, 0x02, 0x0d, 0x22, 0x08, 0x2f, 0x76, 0x31, 0x2f, 0x77, 0x61, 0x72, 0x6d, 0x3a,
+	0x01, 0x2a, 0x12, 0x47, 0x0a, 0x09, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x73, 0x12,
+	0x10, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x73, 0x52, 0x65,
+	0x71, 0x1a, 0x11, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x73,
+	0x52, 0x65, 0x73, 0x70, 0x22, 0x15, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x0f, 0x12, 0x0d, 0x2f, 0x76,
+	0x31, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x73, 0x12, 0x47, 0x0a, 0x05, 0x43,
+	0x6f, 0x75, 0x6e, 0x74, 0x12, 0x0c, 0x2e, 0x76, 0x31, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52,
+	0x65, 0x71, 0x1a, 0x0d, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x52, 0x65, 0x73,
+	0x70, 0x22, 0x21, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x1b, 0x12, 0x09, 0x2f, 0x76, 0x31, 0x2f, 0x63,
+	0x6f, 0x75, 0x6e, 0x74, 0x5a, 0x0e, 0x22, 0x09, 0x2f, 0x76, 0x31, 0x2f, 0x63, 0x6f, 0x75, 0x6e,
+	0x74, 0x3a, 0x01, 0x2a, 0x12, 0x37, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x0c, 0x2e,
+	0x76, 0x31, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x1a, 0x0d, 0x2e, 0x76, 0x31,
+	0x2e, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x22, 0x11, 0x82, 0xd3, 0xe4, 0x93,
+	0x02, 0x0b, 0x12, 0x09, 0x2f, 0x76, 0x31, 0x2f, 0x73, 0x74, 0x61, 0x74, 0x73, 0x42, 0x23, 0x5a,
+	0x21, 0x63, 0x6f, 0x64, 0x65, 0x2e, 0x6f, 0x72, 0x6e, 0x6c, 0x2e, 0x67, 0x6f, 0x76, 0x2f, 0x73,
+	0x69, 0x74, 0x75, 0x2f, 0x6d, 0x65, 0x72, 0x63, 0x75, 0x72, 0x79, 0x2f, 0x61, 0x70, 0x69, 0x2f,
+	0x76, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -472,30 +1822,76 @@ func file_v1_api_proto_rawDescGZIP() []byte {
 	return file_v1_api_proto_rawDescData
 }
 
-var file_v1_api_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_v1_api_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_v1_api_proto_enumTypes = make([]protoimpl.EnumInfo, 5)
+var file_v1_api_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
 var file_v1_api_proto_goTypes = []interface{}{
 	(QueryType)(0),                // 0: v1.QueryType
-	(*QueryReq)(nil),              // 1: v1.QueryReq
-	(*QueryResp)(nil),             // 2: v1.QueryResp
-	(*QueryBinaryResp)(nil),       // 3: v1.QueryBinaryResp
-	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
-	(*durationpb.Duration)(nil),   // 5: google.protobuf.Duration
+	(FlowSummary)(0),              // 1: v1.FlowSummary
+	(Direction)(0),                // 2: v1.Direction
+	(TermMatch)(0),                // 3: v1.TermMatch
+	(BinaryFormat)(0),             // 4: v1.BinaryFormat
+	(*QueryTerm)(nil),             // 5: v1.QueryTerm
+	(*QueryReq)(nil),              // 6: v1.QueryReq
+	(*QueryResp)(nil),             // 7: v1.QueryResp
+	(*QueryBinaryResp)(nil),       // 8: v1.QueryBinaryResp
+	(*FollowReq)(nil),             // 9: v1.FollowReq
+	(*FollowResp)(nil),            // 10: v1.FollowResp
+	(*WarmReq)(nil),               // 11: v1.WarmReq
+	(*WarmResp)(nil),              // 12: v1.WarmResp
+	(*ProtocolsReq)(nil),          // 13: v1.ProtocolsReq
+	(*ProtocolCount)(nil),         // 14: v1.ProtocolCount
+	(*ProtocolsResp)(nil),         // 15: v1.ProtocolsResp
+	(*CountResp)(nil),             // 16: v1.CountResp
+	(*StatsReq)(nil),              // 17: v1.StatsReq
+	(*PeerCount)(nil),             // 18: v1.PeerCount
+	(*PortCount)(nil),             // 19: v1.PortCount
+	(*StatsResp)(nil),             // 20: v1.StatsResp
+	(*timestamppb.Timestamp)(nil), // 21: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 22: google.protobuf.Duration
 }
 var file_v1_api_proto_depIdxs = []int32{
-	4, // 0: v1.QueryReq.startTime:type_name -> google.protobuf.Timestamp
-	5, // 1: v1.QueryReq.duration:type_name -> google.protobuf.Duration
-	0, // 2: v1.QueryReq.queryType:type_name -> v1.QueryType
-	4, // 3: v1.QueryResp.timestamp:type_name -> google.protobuf.Timestamp
-	1, // 4: v1.PacketService.QueryStream:input_type -> v1.QueryReq
-	1, // 5: v1.PacketService.QueryBinaryStream:input_type -> v1.QueryReq
-	2, // 6: v1.PacketService.QueryStream:output_type -> v1.QueryResp
-	3, // 7: v1.PacketService.QueryBinaryStream:output_type -> v1.QueryBinaryResp
-	6, // [6:8] is the sub-list for method output_type
-	4, // [4:6] is the sub-list for method input_type
-	4, // [4:4] is the sub-list for extension type_name
-	4, // [4:4] is the sub-list for extension extendee
-	0, // [0:4] is the sub-list for field type_name
+	0,  // 0: v1.QueryTerm.queryType:type_name -> v1.QueryType
+	2,  // 1: v1.QueryTerm.direction:type_name -> v1.Direction
+	21, // 2: v1.QueryReq.startTime:type_name -> google.protobuf.Timestamp
+	22, // 3: v1.QueryReq.duration:type_name -> google.protobuf.Duration
+	0,  // 4: v1.QueryReq.queryType:type_name -> v1.QueryType
+	2,  // 5: v1.QueryReq.direction:type_name -> v1.Direction
+	1,  // 6: v1.QueryReq.flowSummary:type_name -> v1.FlowSummary
+	5,  // 7: v1.QueryReq.terms:type_name -> v1.QueryTerm
+	3,  // 8: v1.QueryReq.termMatch:type_name -> v1.TermMatch
+	4,  // 9: v1.QueryReq.binaryFormat:type_name -> v1.BinaryFormat
+	21, // 10: v1.QueryResp.timestamp:type_name -> google.protobuf.Timestamp
+	6,  // 11: v1.FollowReq.query:type_name -> v1.QueryReq
+	7,  // 12: v1.FollowResp.result:type_name -> v1.QueryResp
+	21, // 13: v1.WarmReq.startTime:type_name -> google.protobuf.Timestamp
+	22, // 14: v1.WarmReq.duration:type_name -> google.protobuf.Duration
+	21, // 15: v1.ProtocolsReq.startTime:type_name -> google.protobuf.Timestamp
+	22, // 16: v1.ProtocolsReq.duration:type_name -> google.protobuf.Duration
+	14, // 17: v1.ProtocolsResp.protocols:type_name -> v1.ProtocolCount
+	21, // 18: v1.StatsReq.startTime:type_name -> google.protobuf.Timestamp
+	22, // 19: v1.StatsReq.duration:type_name -> google.protobuf.Duration
+	18, // 20: v1.StatsResp.peers:type_name -> v1.PeerCount
+	14, // 21: v1.StatsResp.protocols:type_name -> v1.ProtocolCount
+	19, // 22: v1.StatsResp.ports:type_name -> v1.PortCount
+	6,  // 23: v1.PacketService.QueryStream:input_type -> v1.QueryReq
+	6,  // 24: v1.PacketService.QueryBinaryStream:input_type -> v1.QueryReq
+	9,  // 25: v1.PacketService.QueryFollow:input_type -> v1.FollowReq
+	11, // 26: v1.PacketService.Warm:input_type -> v1.WarmReq
+	13, // 27: v1.PacketService.Protocols:input_type -> v1.ProtocolsReq
+	6,  // 28: v1.PacketService.Count:input_type -> v1.QueryReq
+	17, // 29: v1.PacketService.Stats:input_type -> v1.StatsReq
+	7,  // 30: v1.PacketService.QueryStream:output_type -> v1.QueryResp
+	8,  // 31: v1.PacketService.QueryBinaryStream:output_type -> v1.QueryBinaryResp
+	10, // 32: v1.PacketService.QueryFollow:output_type -> v1.FollowResp
+	12, // 33: v1.PacketService.Warm:output_type -> v1.WarmResp
+	15, // 34: v1.PacketService.Protocols:output_type -> v1.ProtocolsResp
+	16, // 35: v1.PacketService.Count:output_type -> v1.CountResp
+	20, // 36: v1.PacketService.Stats:output_type -> v1.StatsResp
+	30, // [30:37] is the sub-list for method output_type
+	23, // [23:30] is the sub-list for method input_type
+	23, // [23:23] is the sub-list for extension type_name
+	23, // [23:23] is the sub-list for extension extendee
+	0,  // [0:23] is the sub-list for field type_name
 }
 
 func init() { file_v1_api_proto_init() }
@@ -505,7 +1901,7 @@ func file_v1_api_proto_init() {
 	}
 	if !protoimpl.UnsafeEnabled {
 		file_v1_api_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*QueryReq); i {
+			switch v := v.(*QueryTerm); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -517,7 +1913,7 @@ func file_v1_api_proto_init() {
 			}
 		}
 		file_v1_api_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*QueryResp); i {
+			switch v := v.(*QueryReq); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -529,6 +1925,18 @@ func file_v1_api_proto_init() {
 			}
 		}
 		file_v1_api_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*QueryResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*QueryBinaryResp); i {
 			case 0:
 				return &v.state
@@ -540,14 +1948,158 @@ func file_v1_api_proto_init() {
 				return nil
 			}
 		}
+		file_v1_api_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FollowReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FollowResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WarmReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WarmResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProtocolsReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProtocolCount); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProtocolsResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CountResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatsReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PeerCount); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PortCount); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_v1_api_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatsResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_v1_api_proto_rawDesc,
-			NumEnums:      1,
-			NumMessages:   3,
+			NumEnums:      5,
+			NumMessages:   16,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -576,6 +2128,20 @@ const _ = grpc.SupportPackageIsVersion6
 type PacketServiceClient interface {
 	QueryStream(ctx context.Context, in *QueryReq, opts ...grpc.CallOption) (PacketService_QueryStreamClient, error)
 	QueryBinaryStream(ctx context.Context, in *QueryReq, opts ...grpc.CallOption) (PacketService_QueryBinaryStreamClient, error)
+	QueryFollow(ctx context.Context, in *FollowReq, opts ...grpc.CallOption) (PacketService_QueryFollowClient, error)
+	// Warm opens (and caches) the indices for a label and time range so
+	// that the first query is not slowed down by opening them.
+	Warm(ctx context.Context, in *WarmReq, opts ...grpc.CallOption) (*WarmResp, error)
+	// Protocols returns the packet count of each IP protocol for a label
+	// and time range from the index keys, without reading any packets.
+	Protocols(ctx context.Context, in *ProtocolsReq, opts ...grpc.CallOption) (*ProtocolsResp, error)
+	// Count returns the number of packets that match a query from the
+	// indices alone, without reading the pcap files.
+	Count(ctx context.Context, in *QueryReq, opts ...grpc.CallOption) (*CountResp, error)
+	// Stats summarizes the traffic of a host (its top peers, protocols and
+	// ports) for a label and time range. Every packet of the host is read
+	// from the pcap files, so it costs as much as querying the IP.
+	Stats(ctx context.Context, in *StatsReq, opts ...grpc.CallOption) (*StatsResp, error)
 }
 
 type packetServiceClient struct {
@@ -650,10 +2216,92 @@ func (x *packetServiceQueryBinaryStreamClient) Recv() (*QueryBinaryResp, error)
 	return m, nil
 }
 
+func (c *packetServiceClient) QueryFollow(ctx context.Context, in *FollowReq, opts ...grpc.CallOption) (PacketService_QueryFollowClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_PacketService_serviceDesc.Streams[2], "/v1.PacketService/QueryFollow", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &packetServiceQueryFollowClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PacketService_QueryFollowClient interface {
+	Recv() (*FollowResp, error)
+	grpc.ClientStream
+}
+
+type packetServiceQueryFollowClient struct {
+	grpc.ClientStream
+}
+
+func (x *packetServiceQueryFollowClient) Recv() (*FollowResp, error) {
+	m := new(FollowResp)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *packetServiceClient) Warm(ctx context.Context, in *WarmReq, opts ...grpc.CallOption) (*WarmResp, error) {
+	out := new(WarmResp)
+	err := c.cc.Invoke(ctx, "/v1.PacketService/Warm", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packetServiceClient) Protocols(ctx context.Context, in *ProtocolsReq, opts ...grpc.CallOption) (*ProtocolsResp, error) {
+	out := new(ProtocolsResp)
+	err := c.cc.Invoke(ctx, "/v1.PacketService/Protocols", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packetServiceClient) Count(ctx context.Context, in *QueryReq, opts ...grpc.CallOption) (*CountResp, error) {
+	out := new(CountResp)
+	err := c.cc.Invoke(ctx, "/v1.PacketService/Count", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packetServiceClient) Stats(ctx context.Context, in *StatsReq, opts ...grpc.CallOption) (*StatsResp, error) {
+	out := new(StatsResp)
+	err := c.cc.Invoke(ctx, "/v1.PacketService/Stats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PacketServiceServer is the server API for PacketService service.
 type PacketServiceServer interface {
 	QueryStream(*QueryReq, PacketService_QueryStreamServer) error
 	QueryBinaryStream(*QueryReq, PacketService_QueryBinaryStreamServer) error
+	QueryFollow(*FollowReq, PacketService_QueryFollowServer) error
+	// Warm opens (and caches) the indices for a label and time range so
+	// that the first query is not slowed down by opening them.
+	Warm(context.Context, *WarmReq) (*WarmResp, error)
+	// Protocols returns the packet count of each IP protocol for a label
+	// and time range from the index keys, without reading any packets.
+	Protocols(context.Context, *ProtocolsReq) (*ProtocolsResp, error)
+	// Count returns the number of packets that match a query from the
+	// indices alone, without reading the pcap files.
+	Count(context.Context, *QueryReq) (*CountResp, error)
+	// Stats summarizes the traffic of a host (its top peers, protocols and
+	// ports) for a label and time range. Every packet of the host is read
+	// from the pcap files, so it costs as much as querying the IP.
+	Stats(context.Context, *StatsReq) (*StatsResp, error)
 }
 
 // UnimplementedPacketServiceServer can be embedded to have forward compatible implementations.
@@ -666,6 +2314,21 @@ func (*UnimplementedPacketServiceServer) QueryStream(*QueryReq, PacketService_Qu
 func (*UnimplementedPacketServiceServer) QueryBinaryStream(*QueryReq, PacketService_QueryBinaryStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method QueryBinaryStream not implemented")
 }
+func (*UnimplementedPacketServiceServer) QueryFollow(*FollowReq, PacketService_QueryFollowServer) error {
+	return status.Errorf(codes.Unimplemented, "method QueryFollow not implemented")
+}
+func (*UnimplementedPacketServiceServer) Warm(context.Context, *WarmReq) (*WarmResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Warm not implemented")
+}
+func (*UnimplementedPacketServiceServer) Protocols(context.Context, *ProtocolsReq) (*ProtocolsResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Protocols not implemented")
+}
+func (*UnimplementedPacketServiceServer) Count(context.Context, *QueryReq) (*CountResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Count not implemented")
+}
+func (*UnimplementedPacketServiceServer) Stats(context.Context, *StatsReq) (*StatsResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
 
 func RegisterPacketServiceServer(s *grpc.Server, srv PacketServiceServer) {
 	s.RegisterService(&_PacketService_serviceDesc, srv)
@@ -713,10 +2376,120 @@ func (x *packetServiceQueryBinaryStreamServer) Send(m *QueryBinaryResp) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _PacketService_QueryFollow_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FollowReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PacketServiceServer).QueryFollow(m, &packetServiceQueryFollowServer{stream})
+}
+
+type PacketService_QueryFollowServer interface {
+	Send(*FollowResp) error
+	grpc.ServerStream
+}
+
+type packetServiceQueryFollowServer struct {
+	grpc.ServerStream
+}
+
+func (x *packetServiceQueryFollowServer) Send(m *FollowResp) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PacketService_Warm_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WarmReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PacketServiceServer).Warm(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.PacketService/Warm",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PacketServiceServer).Warm(ctx, req.(*WarmReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PacketService_Protocols_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProtocolsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PacketServiceServer).Protocols(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.PacketService/Protocols",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PacketServiceServer).Protocols(ctx, req.(*ProtocolsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PacketService_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PacketServiceServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.PacketService/Count",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PacketServiceServer).Count(ctx, req.(*QueryReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PacketService_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PacketServiceServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.PacketService/Stats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PacketServiceServer).Stats(ctx, req.(*StatsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _PacketService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "v1.PacketService",
 	HandlerType: (*PacketServiceServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Warm",
+			Handler:    _PacketService_Warm_Handler,
+		},
+		{
+			MethodName: "Protocols",
+			Handler:    _PacketService_Protocols_Handler,
+		},
+		{
+			MethodName: "Count",
+			Handler:    _PacketService_Count_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _PacketService_Stats_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "QueryStream",
@@ -728,6 +2501,11 @@ var _PacketService_serviceDesc = grpc.ServiceDesc{
 			Handler:       _PacketService_QueryBinaryStream_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "QueryFollow",
+			Handler:       _PacketService_QueryFollow_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "v1/api.proto",
 }
@@ -2,12 +2,21 @@ package capture
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/gopacket/layers"
 	"github.com/rs/zerolog/log"
 
 	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/storage"
 )
 
 type CaptureServer struct {
@@ -21,13 +30,84 @@ type CaptureServer struct {
 	// readFromFile equals true if reading from file, false if from nic.
 	readFromFile bool
 
-	nic         string
+	nics        []string
 	promiscuous bool
 
 	files []string
 
 	indexPath string
 	pcapPaths []string
+
+	// manifest records the settings and files produced by this session.
+	manifest *common.Manifest
+	// checkpoint records the input files that were fully read.
+	checkpoint *checkpoint
+	// liveServer serves queries of the indices that are still in memory.
+	liveServer *http.Server
+
+	opts Options
+}
+
+// Options are optional capture settings.
+type Options struct {
+	// Store, if set, is where finalized pcap files and index archives
+	// are uploaded under StorePrefix.
+	Store       storage.Store
+	StorePrefix string
+	// DeleteLocal removes the local files after a successful upload.
+	DeleteLocal bool
+	// Checksum writes a SHA-256 sidecar file for each finalized pcap file.
+	Checksum bool
+	// Resume skips input files that were fully ingested by an earlier
+	// (interrupted) capture into the same label.
+	Resume bool
+	// ServerPortsOnly indexes only the lower (likely service) port of
+	// each TCP/UDP packet, so ephemeral client ports do not bloat the
+	// index.
+	ServerPortsOnly bool
+	// PacketMeta stores a summary of each packet (timestamp, length,
+	// protocol, ports, addresses) in the index so summary queries do not
+	// read the pcap files, at the cost of a much larger index.
+	PacketMeta bool
+	// PartitionByDate writes the pcap and index files to date directories
+	// (e.g. `2021/03/01/`) rather than directly in the pcap and label
+	// index paths.
+	PartitionByDate bool
+	// LiveQueryAddr, if set, is the address (e.g. `localhost:8124`) of an
+	// HTTP endpoint that searches the indices that have not been written
+	// yet, see liveIndex.
+	LiveQueryAddr string
+	// RotationSize is the size in bytes at which a new set of pcap files
+	// is started, 0 to only rotate them by time.
+	RotationSize uint64
+	// RotationInterval is how often a new set of pcap files is started,
+	// at most common.MaxPcapFileTime (common.DefaultRotationInterval if
+	// it is 0).
+	RotationInterval time.Duration
+	// PcapBuffer is the size in bytes of the kernel buffer for capturing
+	// from an interface, 0 for the libpcap default. A larger buffer
+	// drops fewer packets during bursts.
+	PcapBuffer int
+	// Immediate delivers packets from the interface as they arrive
+	// instead of in batches, so they reach the live query endpoint sooner
+	// at the cost of more wakeups (and lower throughput) under load.
+	Immediate bool
+	// Compression is how the pcap files are compressed, one of
+	// common.CompressionNone (or empty), common.CompressionGzip or
+	// common.CompressionZstd.
+	Compression string
+	// StatsInterval is how often to log the capture statistics (packets
+	// received and dropped by the kernel, and packets read, written and
+	// indexed) when capturing from an interface, 0 to only log them at
+	// the end.
+	StatsInterval time.Duration
+	// MaxDiskBytes is the most bytes the label index path and the pcap
+	// paths may use before the oldest indices and their pcap files are
+	// deleted, 0 to never delete them.
+	MaxDiskBytes uint64
+	// EncryptionKey is the AES key (16, 24 or 32 bytes, for AES-128, 192
+	// or 256) to encrypt the indices with, nil to not encrypt them.
+	EncryptionKey []byte
 }
 
 // start is used to calculate the duration at the end.
@@ -38,22 +118,26 @@ const (
 	muxBufferSize               = 8192
 )
 
-func NewCaptureServerInterface(nic string, promiscuous bool, indexPath string, pcapPaths []string) *CaptureServer {
+// NewCaptureServerInterface returns a capture server that captures from
+// one or more network interfaces into the same pcap files and index.
+func NewCaptureServerInterface(nics []string, promiscuous bool, indexPath string, pcapPaths []string, opts Options) *CaptureServer {
 	return &CaptureServer{
 		readFromFile: false,
-		nic:          nic,
+		nics:         nics,
 		promiscuous:  promiscuous,
 		indexPath:    indexPath,
 		pcapPaths:    pcapPaths,
+		opts:         opts,
 	}
 }
 
-func NewCaptureServerFile(files []string, indexPath string, pcapPaths []string) *CaptureServer {
+func NewCaptureServerFile(files []string, indexPath string, pcapPaths []string, opts Options) *CaptureServer {
 	return &CaptureServer{
 		readFromFile: true,
 		files:        files,
 		indexPath:    indexPath,
 		pcapPaths:    pcapPaths,
+		opts:         opts,
 	}
 }
 
@@ -68,9 +152,38 @@ func (s *CaptureServer) Run(ctx context.Context, done chan<- struct{}) error {
 	s.ctx = ctx
 	s.done = done
 
+	// A pcap writer or the index writer that cannot write only logs an
+	// error and stops, so check the directories before capturing.
+	for _, p := range s.pcapPaths {
+		err := checkWritable(p)
+		if err != nil {
+			return fmt.Errorf("pcap-path %s is not writable: %s", p, err)
+		}
+	}
+	err := checkWritable(s.indexPath)
+	if err != nil {
+		return fmt.Errorf("index-path %s is not writable: %s", s.indexPath, err)
+	}
+	if s.opts.RotationInterval == 0 {
+		s.opts.RotationInterval = common.DefaultRotationInterval
+	}
+	// Queries only look for the packets of a time range in the indices
+	// named up to MaxPcapFileTime before it.
+	if s.opts.RotationInterval < 0 || s.opts.RotationInterval > common.MaxPcapFileTime {
+		return fmt.Errorf("the rotation interval must be between 0 and %s", common.MaxPcapFileTime)
+	}
+	if s.opts.Compression == "" {
+		s.opts.Compression = common.CompressionNone
+	}
+	// The packets of the block that is being compressed are not in the
+	// file yet.
+	if s.opts.Compression != common.CompressionNone && s.opts.LiveQueryAddr != "" {
+		return fmt.Errorf("live queries are not supported with compressed pcap files")
+	}
+
 	// Open from NIC or file
 	var readOutChan chan *Message
-	var err error
+	var linkType layers.LinkType
 
 	// Interface/File reader does not have an input channel, cancel
 	// with context. All others cancel by closing the channel.
@@ -80,7 +193,7 @@ func (s *CaptureServer) Run(ctx context.Context, done chan<- struct{}) error {
 			Str("index-path", s.indexPath).
 			Strs("pcap-paths", s.pcapPaths).
 			Msg("starting capture from interface")
-		readOutChan, err = readPacketsFromInterface(ctx, s.nic, common.SnapLen, s.promiscuous, timeout)
+		readOutChan, linkType, err = s.readInterfaces(ctx)
 		if err != nil {
 			return err
 		}
@@ -89,20 +202,79 @@ func (s *CaptureServer) Run(ctx context.Context, done chan<- struct{}) error {
 			Str("index-path", s.indexPath).
 			Strs("pcap-paths", s.pcapPaths).
 			Msg("starting capture from file(s)")
-		readOutChan, err = readPacketsFromFiles(ctx, s.files, readFinished)
+		s.checkpoint, err = loadCheckpoint(s.indexPath)
 		if err != nil {
 			return err
 		}
+		if s.opts.Resume {
+			files := make([]string, 0, len(s.files))
+			for _, f := range s.files {
+				if s.checkpoint.Done(f) {
+					log.Info().Str("file", f).Msg("skipping file that was already ingested")
+					continue
+				}
+				files = append(files, f)
+			}
+			if len(files) == 0 {
+				log.Info().Strs("files", s.files).Msg("all files were already ingested")
+				return nil
+			}
+			s.files = files
+		}
+		readOutChan, linkType, err = readPacketsFromFiles(ctx, s.files, s.checkpoint, readFinished)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.manifest = &common.Manifest{
+		Version:          common.ManifestVersion,
+		Label:            path.Base(s.indexPath),
+		IndexPath:        s.indexPath,
+		PcapPaths:        s.pcapPaths,
+		Interface:        strings.Join(s.nics, ","),
+		InputFiles:       s.files,
+		LinkType:         linkType.String(),
+		SnapLen:          common.SnapLen,
+		RotationInterval: s.opts.RotationInterval.String(),
+		RotationSize:     s.opts.RotationSize,
+		StartTime:        start.UTC(),
+		Files:            make([]common.ManifestFile, 0),
+	}
+	err = s.manifest.Save()
+	if err != nil {
+		return err
+	}
+	config := &common.CaptureConfig{
+		Label:            s.manifest.Label,
+		Interface:        strings.Join(s.nics, ","),
+		Promiscuous:      !s.readFromFile && s.promiscuous,
+		InputFiles:       s.files,
+		PcapPaths:        s.pcapPaths,
+		LinkType:         linkType.String(),
+		SnapLen:          common.SnapLen,
+		RotationInterval: s.opts.RotationInterval.String(),
+		RotationSize:     s.opts.RotationSize,
+		Checksum:         s.opts.Checksum,
+		Compression:      s.opts.Compression,
+		ServerPortsOnly:  s.opts.ServerPortsOnly,
+		PacketMeta:       s.opts.PacketMeta,
+		PartitionByDate:  s.opts.PartitionByDate,
+		FileTimeFormat:   common.GetFileTimeFormat(),
+		Upload:           s.opts.Store != nil,
+		DeleteLocal:      s.opts.Store != nil && s.opts.DeleteLocal,
+		MaxDiskBytes:     s.opts.MaxDiskBytes,
+		StartTime:        start.UTC(),
 	}
 
 	// Scheduler
-	schedulerOutChans := schedule(s.pcapPaths, readOutChan, &s.wg)
+	schedulerOutChans := schedule(s.pcapPaths, s.opts.PartitionByDate, s.opts.RotationSize, s.opts.RotationInterval, time.Now, readOutChan, &s.wg)
 	s.wg.Add(1)
 
 	// PCAP writer
 	var writerOutChans []chan *Message
 	for _, schedChan := range schedulerOutChans {
-		writerOutChan, err := writePcap(common.SnapLen, schedChan, &s.wg)
+		writerOutChan, err := writePcap(common.SnapLen, linkType, s.opts.Checksum, s.opts.Compression, schedChan, &s.wg)
 		if err != nil {
 			return err
 		}
@@ -121,14 +293,57 @@ func (s *CaptureServer) Run(ctx context.Context, done chan<- struct{}) error {
 	}
 	s.wg.Add(1)
 
+	// Live query endpoint (optional)
+	var live *liveIndex
+	if s.opts.LiveQueryAddr != "" {
+		live = newLiveIndex(s.pcapPaths, linkType)
+		mux := http.NewServeMux()
+		mux.Handle("/v1/live", live)
+		lis, err := net.Listen("tcp", s.opts.LiveQueryAddr)
+		if err != nil {
+			return fmt.Errorf("unable to listen for live queries on %s: %s", s.opts.LiveQueryAddr, err)
+		}
+		s.liveServer = &http.Server{Handler: mux}
+		go func() {
+			log.Info().Str("addr", lis.Addr().String()).Msg("starting live query endpoint")
+			err := s.liveServer.Serve(lis)
+			if err != nil && err != http.ErrServerClosed {
+				log.Error().Err(err).Str("addr", s.opts.LiveQueryAddr).Msg("live query endpoint failed")
+			}
+		}()
+	}
+
 	// Index
-	indexerOutChan, err := index(extractorOutChan, &s.wg)
+	indexerOutChan, err := index(extractorOutChan, s.opts.ServerPortsOnly, s.opts.PacketMeta, live, &s.wg)
 	if err != nil {
 		return err
 	}
 	s.wg.Add(1)
 
-	err = indexWrite(s.indexPath, indexerOutChan, &s.wg)
+	// Janitor (optional), after the uploader so a capture is not deleted
+	// before it is uploaded.
+	var janitorChan chan *Message
+	if s.opts.MaxDiskBytes > 0 {
+		janitorChan = make(chan *Message, uploadChanSize)
+		err = janitor(s.opts.MaxDiskBytes, s.indexPath, s.pcapPaths, janitorChan, &s.wg)
+		if err != nil {
+			return err
+		}
+		s.wg.Add(1)
+	}
+
+	// Uploader (optional)
+	indexWriterOutChan := janitorChan
+	if s.opts.Store != nil {
+		indexWriterOutChan = make(chan *Message, uploadChanSize)
+		err = upload(s.opts.Store, s.opts.StorePrefix, s.manifest.Label, s.indexPath, s.pcapPaths, s.opts.Compression, s.opts.DeleteLocal, indexWriterOutChan, janitorChan, &s.wg)
+		if err != nil {
+			return err
+		}
+		s.wg.Add(1)
+	}
+
+	err = indexWrite(s.indexPath, s.pcapPaths, linkType, config, s.opts.EncryptionKey, s.manifest, live, indexerOutChan, indexWriterOutChan, &s.wg)
 	if err != nil {
 		return err
 	}
@@ -148,6 +363,40 @@ func (s *CaptureServer) Run(ctx context.Context, done chan<- struct{}) error {
 
 }
 
+// readInterfaces starts reading packets from each interface and returns
+// the packets of all of them and their link type. A pcap file has a
+// single link type, so the interfaces must all have the same one.
+func (s *CaptureServer) readInterfaces(ctx context.Context) (chan *Message, layers.LinkType, error) {
+	var outChans []chan *Message
+	var linkType layers.LinkType
+	for i, nic := range s.nics {
+		outChan, nicLinkType, err := readPacketsFromInterface(ctx, nic, common.SnapLen, s.promiscuous, timeout, s.opts.PcapBuffer, s.opts.Immediate, s.opts.StatsInterval)
+		if err != nil {
+			return nil, 0, err
+		}
+		if i > 0 && nicLinkType != linkType {
+			return nil, 0, fmt.Errorf("interfaces %s and %s have different link types (%s and %s), which cannot be written to the same pcap files", s.nics[0], nic, linkType, nicLinkType)
+		}
+		linkType = nicLinkType
+		outChans = append(outChans, outChan)
+	}
+	if len(outChans) == 1 {
+		return outChans[0], linkType, nil
+	}
+	s.wg.Add(1)
+	return muxMessageChans(readIfChanSize, &s.wg, outChans...), linkType, nil
+}
+
+// checkWritable creates and removes a file in dir.
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".mercury-write-check-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 func (s *CaptureServer) Stop() {
 	if s.readFromFile {
 		log.Debug().
@@ -159,7 +408,7 @@ func (s *CaptureServer) Stop() {
 		log.Debug().
 			Str("index-path", s.indexPath).
 			Strs("pcap-paths", s.pcapPaths).
-			Str("interface", s.nic).
+			Strs("interfaces", s.nics).
 			Bool("promiscuous", s.promiscuous).
 			Msg("stopping capture from interface")
 	}
@@ -167,10 +416,33 @@ func (s *CaptureServer) Stop() {
 	// Wait for all goroutines to finish.
 	s.wg.Wait()
 
+	// Every index has been written, so live queries are no longer needed.
+	if s.liveServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := s.liveServer.Shutdown(ctx)
+		cancel()
+		if err != nil {
+			log.Error().Err(err).Str("addr", s.opts.LiveQueryAddr).Msg("unable to stop live query endpoint")
+		}
+	}
+
+	err := s.manifest.Finalize(time.Now())
+	if err != nil {
+		log.Error().Err(err).Str("index-path", s.indexPath).Msg("unable to finalize manifest")
+	}
+
+	// Every file that was read to the end has now been indexed.
+	if s.checkpoint != nil {
+		err = s.checkpoint.Save()
+		if err != nil {
+			log.Error().Err(err).Str("index-path", s.indexPath).Msg("unable to save checkpoint")
+		}
+	}
+
 	if s.readFromFile {
 		log.Info().Str("duration", time.Since(start).Round(time.Millisecond).String()).Strs("files", s.files).Msg("finished capture from file")
 	} else {
-		log.Info().Str("duration", time.Since(start).Round(time.Millisecond).String()).Str("interface", s.nic).Msg("finished capture from interface")
+		log.Info().Str("duration", time.Since(start).Round(time.Millisecond).String()).Strs("interfaces", s.nics).Msg("finished capture from interface")
 	}
 
 	// Signal back to main that everything has completed.
@@ -6,33 +6,30 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-var inChanLen int
-
 // muxMessageChans takes a number of message input channels and
-// combines them into a single output channel.
+// combines them into a single output channel, which is closed once all of
+// the input channels are.
 func muxMessageChans(outBufferSize int, done *sync.WaitGroup, inCh ...chan *Message) chan *Message {
 	outCh := make(chan *Message, outBufferSize)
 	logger := log.With().Str("component", "message-chan-muxer").Logger()
 
 	logger.Info().Msg("started")
 
-	inChanLen = len(inCh)
-
+	var inputs sync.WaitGroup
+	inputs.Add(len(inCh))
 	for _, ch := range inCh {
 		go func(out chan *Message, in chan *Message) {
-			defer func() {
-				// Decrement until last input channel and then cleanup.
-				inChanLen -= 1
-				if inChanLen == 0 {
-					logger.Info().Msg("completed")
-					close(outCh)
-					done.Done()
-				}
-			}()
+			defer inputs.Done()
 			for msg := range in {
 				out <- msg
 			}
 		}(outCh, ch)
 	}
+	go func() {
+		inputs.Wait()
+		logger.Info().Msg("completed")
+		close(outCh)
+		done.Done()
+	}()
 	return outCh
 }
@@ -0,0 +1,117 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// checkpointName is the file in the label index directory that records
+// which input files have been fully ingested.
+const checkpointName = "checkpoint.json"
+
+// checkpoint records the input files that were fully ingested so that an
+// interrupted ingest of a large file list can be resumed. A file is only
+// considered done if its size and modification time are unchanged.
+type checkpoint struct {
+	path string
+	mu   sync.Mutex
+
+	Files []checkpointFile `json:"files"`
+}
+
+type checkpointFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// loadCheckpoint reads the checkpoint in indexPath, returning an empty
+// checkpoint if there is none.
+func loadCheckpoint(indexPath string) (*checkpoint, error) {
+	c := &checkpoint{path: path.Join(indexPath, checkpointName)}
+	b, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("unable to read checkpoint %s: %s", c.path, err)
+	}
+	err = json.Unmarshal(b, c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode checkpoint %s: %s", c.path, err)
+	}
+	return c, nil
+}
+
+func statCheckpointFile(file string) (checkpointFile, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return checkpointFile{}, err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return checkpointFile{}, err
+	}
+	return checkpointFile{Path: abs, Size: fi.Size(), ModTime: fi.ModTime().UTC()}, nil
+}
+
+// Done returns true if file was fully ingested and has not changed since.
+func (c *checkpoint) Done(file string) bool {
+	f, err := statCheckpointFile(file)
+	if err != nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cf := range c.Files {
+		if cf.Path == f.Path && cf.Size == f.Size && cf.ModTime.Equal(f.ModTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add records that file was fully read.
+func (c *checkpoint) Add(file string) error {
+	f, err := statCheckpointFile(file)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, cf := range c.Files {
+		if cf.Path == f.Path {
+			c.Files[i] = f
+			return nil
+		}
+	}
+	c.Files = append(c.Files, f)
+	return nil
+}
+
+// Save writes the checkpoint. It must only be called once the packets of
+// the added files have been indexed.
+func (c *checkpoint) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode checkpoint: %s", err)
+	}
+	tmp := c.path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write checkpoint %s: %s", tmp, err)
+	}
+	err = os.Rename(tmp, c.path)
+	if err != nil {
+		return fmt.Errorf("unable to rename checkpoint %s: %s", tmp, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+)
+
+// maxHostLen is the longest host name that is indexed (the DNS limit).
+const maxHostLen = 253
+
+// hostName returns the host name of the TLS ClientHello (the server name
+// indication) or HTTP request at the start of a TCP payload, or an empty
+// string if it does not start with either or the name is not in it.
+func hostName(payload []byte) string {
+	name := tlsServerName(payload)
+	if name == "" {
+		name = httpHost(payload)
+	}
+	if name == "" || len(name) > maxHostLen || strings.ContainsAny(name, " \t/") {
+		return ""
+	}
+	return name
+}
+
+// tlsServerName returns the server name of a TLS ClientHello. A ClientHello
+// that is larger than the packet (e.g. with a large post-quantum key share)
+// is only read up to the end of the packet, so its name is skipped if it is
+// not in the first segment; the other segments do not start with a record
+// header.
+func tlsServerName(b []byte) string {
+	// Record header: content type 22 (handshake), version 3.x and length.
+	if len(b) < 5 || b[0] != 22 || b[1] != 3 {
+		return ""
+	}
+	b = b[5:]
+	// Handshake header: type 1 (ClientHello) and a 3 byte length.
+	if len(b) < 4 || b[0] != 1 {
+		return ""
+	}
+	b = b[4:]
+	// Client version and random.
+	if len(b) < 34 {
+		return ""
+	}
+	b = b[34:]
+	var ok bool
+	// Session ID, cipher suites and compression methods.
+	for _, lenBytes := range []int{1, 2, 1} {
+		if b, ok = skipVector(b, lenBytes); !ok {
+			return ""
+		}
+	}
+	if len(b) < 2 {
+		return ""
+	}
+	exts := b[2:]
+	if n := int(binary.BigEndian.Uint16(b)); n < len(exts) {
+		exts = exts[:n]
+	}
+	for len(exts) >= 4 {
+		extType := binary.BigEndian.Uint16(exts)
+		extLen := int(binary.BigEndian.Uint16(exts[2:]))
+		exts = exts[4:]
+		if extLen > len(exts) {
+			return ""
+		}
+		if extType == 0 {
+			return serverNameExt(exts[:extLen])
+		}
+		exts = exts[extLen:]
+	}
+	return ""
+}
+
+// serverNameExt returns the first host name of a server_name extension.
+func serverNameExt(b []byte) string {
+	// List length, name type 0 (host_name) and the name with a 2 byte
+	// length.
+	if len(b) < 5 || b[2] != 0 {
+		return ""
+	}
+	n := int(binary.BigEndian.Uint16(b[3:]))
+	if 5+n > len(b) {
+		return ""
+	}
+	return string(b[5 : 5+n])
+}
+
+// skipVector returns b after a TLS vector with a length of lenBytes bytes,
+// or false if b is too short.
+func skipVector(b []byte, lenBytes int) ([]byte, bool) {
+	if len(b) < lenBytes {
+		return nil, false
+	}
+	var n int
+	for _, c := range b[:lenBytes] {
+		n = n<<8 | int(c)
+	}
+	b = b[lenBytes:]
+	if n > len(b) {
+		return nil, false
+	}
+	return b[n:], true
+}
+
+// httpMethods are the request methods whose Host header is indexed.
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("HEAD "), []byte("PUT "),
+	[]byte("DELETE "), []byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "),
+}
+
+// httpHost returns the Host header of an HTTP/1.x request, without the
+// port. Only the headers in the packet are read.
+func httpHost(b []byte) string {
+	isRequest := false
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(b, m) {
+			isRequest = true
+			break
+		}
+	}
+	if !isRequest {
+		return ""
+	}
+	// The body is not split, and the request line is skipped.
+	if i := bytes.Index(b, []byte("\r\n\r\n")); i >= 0 {
+		b = b[:i]
+	}
+	lines := bytes.Split(b, []byte("\r\n"))
+	for _, line := range lines[1:] {
+		if len(line) < 5 || !bytes.EqualFold(line[:5], []byte("host:")) {
+			continue
+		}
+		host := string(bytes.TrimSpace(line[5:]))
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		return strings.Trim(host, "[]")
+	}
+	return ""
+}
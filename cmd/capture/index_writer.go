@@ -1,12 +1,18 @@
 package capture
 
 import (
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"os"
 	"path"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/dgraph-io/badger/v2"
+	"github.com/google/gopacket/layers"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
@@ -18,7 +24,12 @@ var (
 	basePath string
 )
 
-func indexWrite(indexBasePath string, inCh chan *Message, done *sync.WaitGroup) error {
+// indexWrite writes each in memory index it receives to a Badger DB and
+// records the index and its pcap files in the session manifest. If outCh
+// is not nil, a message is sent on it for each index that was written.
+// Each index is removed from live once it has been written. The indices
+// are encrypted with encryptionKey unless it is nil.
+func indexWrite(indexBasePath string, pcapPaths []string, linkType layers.LinkType, config *common.CaptureConfig, encryptionKey []byte, manifest *common.Manifest, live *liveIndex, inCh chan *Message, outCh chan *Message, done *sync.WaitGroup) error {
 	basePath = indexBasePath
 	logger := log.With().Str("component", "index-writer").Logger()
 
@@ -26,22 +37,74 @@ func indexWrite(indexBasePath string, inCh chan *Message, done *sync.WaitGroup)
 	// https://dgraph.io/docs/badger/faq/#are-there-any-go-specific-settings-that-i-should-use
 	runtime.GOMAXPROCS(128)
 
+	// Metadata stored in every index.
+	pathCount := make([]byte, 2)
+	binary.LittleEndian.PutUint16(pathCount, uint16(len(pcapPaths)))
+	lt := make([]byte, 2)
+	binary.LittleEndian.PutUint16(lt, uint16(linkType))
+	version := make([]byte, 2)
+	binary.LittleEndian.PutUint16(version, idx.FormatVersion)
+	meta := map[string][]byte{
+		idx.MetaPcapPathCount: pathCount,
+		idx.MetaLinkType:      lt,
+		idx.MetaFormatVersion: version,
+	}
+	if manifest.Interface != "" {
+		meta[idx.MetaInterface] = []byte(manifest.Interface)
+	}
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("unable to encode capture config: %s", err)
+	}
+	meta[idx.MetaConfig] = configBytes
+	if config.PacketMeta {
+		meta[idx.MetaPacketMeta] = []byte{1}
+	}
+	if config.Compression != common.CompressionNone {
+		meta[idx.MetaPcapCompression] = []byte(config.Compression)
+	}
+
 	go func() {
 		logger.Info().Msg("started")
 
 		defer func() {
 			logger.Info().Msg("completed")
+			if outCh != nil {
+				close(outCh)
+			}
 			done.Done()
 		}()
 
 		for msg := range inCh {
 			if msg.msgType == msgTypeMemoryIndex {
-				idxName := fmt.Sprintf("%s.%s", msg.Get(msgPayloadMemoryIndexFile).(string), common.IndexNameSuffix)
+				filename := msg.Get(msgPayloadMemoryIndexFile).(string)
+				idxName := fmt.Sprintf("%s.%s", filename, common.IndexNameSuffix)
 				logger.Debug().Str("index-name", idxName).Msg("writing index")
 				memIndex := msg.Get(msgPayloadMemoryIndex).(idx.MemIndex)
-				err := writeIndexFile(idxName, memIndex, logger)
+				indexMeta := meta
+				if manifest.Interface == "" {
+					indexMeta = withFileInterfaces(meta, memIndex)
+				}
+				err := writeIndexFile(idxName, memIndex, indexMeta, encryptionKey, logger)
+				// The index is searched on disk from now on.
+				live.remove(filename)
 				if err != nil {
 					logger.Error().Err(err).Msg("error writing index file")
+					continue
+				}
+				mf := common.ManifestFile{
+					Index: path.Join(basePath, idxName),
+					Pcaps: make([]string, len(pcapPaths)),
+				}
+				for i, p := range pcapPaths {
+					mf.Pcaps[i] = common.PcapFileName(path.Join(p, filename), i, config.Compression)
+				}
+				err = manifest.AddFile(mf)
+				if err != nil {
+					logger.Error().Err(err).Msg("error updating manifest")
+				}
+				if outCh != nil {
+					outCh <- NewMessage(msgTypeIndexWritten).Set(msgPayloadMemoryIndexFile, filename)
 				}
 			}
 		}
@@ -50,20 +113,81 @@ func indexWrite(indexBasePath string, inCh chan *Message, done *sync.WaitGroup)
 	return nil
 }
 
-func writeIndexFile(idxName string, memIndex idx.MemIndex, logger zerolog.Logger) (err error) {
-	var db *badger.DB
+// withFileInterfaces returns a copy of meta with the interface names of the
+// packets of memIndex, which are only indexed for pcapng files that name
+// their interfaces, so the packets of each interface can be shown. meta is
+// returned if there are none.
+func withFileInterfaces(meta map[string][]byte, memIndex idx.MemIndex) map[string][]byte {
+	var names []string
+	for _, v := range memIndex {
+		if v.K.RecType == idx.InterfaceType {
+			names = append(names, string(v.K.Data))
+		}
+	}
+	if len(names) == 0 {
+		return meta
+	}
+	sort.Strings(names)
+	indexMeta := make(map[string][]byte, len(meta)+1)
+	for k, v := range meta {
+		indexMeta[k] = v
+	}
+	indexMeta[idx.MetaInterface] = []byte(strings.Join(names, ","))
+	return indexMeta
+}
+
+// writeIndexFile writes an index to a temporary directory and renames it
+// into place once the database is closed, so the query side (which only
+// opens directories with the index suffix) never opens an index that is
+// still being written. An existing index with the same name is replaced.
+func writeIndexFile(idxName string, memIndex idx.MemIndex, meta map[string][]byte, encryptionKey []byte, logger zerolog.Logger) error {
 	idxPath := path.Join(basePath, idxName)
-	logger.Debug().Str("db", idxPath).Msg("opening badger DB")
-	opts := badger.DefaultOptions(idxPath).WithLogger(&common.BadgerLogger{Logger: logger}).WithSyncWrites(false).WithKeepL0InMemory(true)
+	// The index name may include a date partition directory.
+	err := os.MkdirAll(path.Dir(idxPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	// Remove any partial index left by a capture that was killed.
+	tmpPath := idxPath + ".tmp"
+	err = os.RemoveAll(tmpPath)
+	if err != nil {
+		return err
+	}
+	err = writeDB(tmpPath, memIndex, meta, encryptionKey, logger)
+	if err != nil {
+		os.RemoveAll(tmpPath)
+		return err
+	}
+	if _, err := os.Stat(idxPath); err == nil {
+		logger.Warn().Str("db", idxPath).Msg("replacing existing index")
+		err = os.RemoveAll(idxPath)
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmpPath, idxPath)
+}
+
+func writeDB(dbPath string, memIndex idx.MemIndex, meta map[string][]byte, encryptionKey []byte, logger zerolog.Logger) (err error) {
+	var db *badger.DB
+	logger.Debug().Str("db", dbPath).Msg("opening badger DB")
+	opts := badger.DefaultOptions(dbPath).WithLogger(&common.BadgerLogger{Logger: logger}).WithSyncWrites(false).WithKeepL0InMemory(true).WithEncryptionKey(encryptionKey)
 	db, err = badger.Open(opts)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	// Closing flushes the writes, so the index is only complete if it
+	// succeeds.
+	defer func() {
+		if cerr := db.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
 	wb := db.NewWriteBatch()
 	defer wb.Cancel()
 
+	stats := idx.NewStats()
 	for _, v := range memIndex {
 		logger.Debug().Str("key", v.K.String()).Msg("")
 		kBytes, _ := v.K.MarshalBinary()
@@ -72,6 +196,25 @@ func writeIndexFile(idxName string, memIndex idx.MemIndex, logger zerolog.Logger
 		if err != nil {
 			return err
 		}
+		stats.Add(v.K, len(*v.V))
+	}
+
+	statsBytes, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	kBytes, _ := idx.NewMetaKey(idx.MetaStats).MarshalBinary()
+	err = wb.Set(kBytes, statsBytes)
+	if err != nil {
+		return err
+	}
+
+	for name, v := range meta {
+		kBytes, _ := idx.NewMetaKey(name).MarshalBinary()
+		err = wb.Set(kBytes, v)
+		if err != nil {
+			return err
+		}
 	}
 
 	err = wb.Flush()
@@ -0,0 +1,102 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	idx "code.ornl.gov/situ/mercury/index"
+	"code.ornl.gov/situ/mercury/search"
+)
+
+func TestWriteIndexFileWhileOpening(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercury-index-writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(p string) { basePath = p }(basePath)
+	basePath = dir
+	defer func(l zerolog.Logger) { log.Logger = l }(log.Logger)
+	log.Logger = zerolog.Nop()
+
+	memIndex := idx.NewMemIndex()
+	for i := 0; i < 2000; i++ {
+		ip := net.IPv4(10, 0, byte(i>>8), byte(i))
+		memIndex.Put(idx.NewIPKey(ip), idx.NewValueElement(0, uint64(24+i*100)))
+	}
+	version := make([]byte, 2)
+	binary.LittleEndian.PutUint16(version, idx.FormatVersion)
+	meta := map[string][]byte{idx.MetaFormatVersion: version}
+	lastKey, _ := idx.NewIPKey(net.IPv4(10, 0, 7, 207)).MarshalBinary()
+
+	const indices = 5
+	written := make(chan error)
+	go func() {
+		for i := 0; i < indices; i++ {
+			err := writeIndexFile(fmt.Sprintf("2020_01_01-00_00_%02d.idx", i), memIndex, meta, nil, zerolog.Nop())
+			if err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+
+	// Every index that can be seen while the others are written is
+	// complete.
+	var opened int
+	for done := false; !done; {
+		select {
+		case err := <-written:
+			if err != nil {
+				t.Fatal(err)
+			}
+			done = true
+		default:
+		}
+		names, err := search.GetIndexPaths(dir, time.Time{}, search.MaxTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			db, err := search.OpenIndex(path.Join(dir, name), search.Options{})
+			if err != nil {
+				t.Fatalf("unable to open %s while writing: %s", name, err)
+			}
+			err = db.View(func(txn *badger.Txn) error {
+				format, err := search.GetFormat(txn)
+				if err != nil {
+					return err
+				}
+				if format.Version != idx.FormatVersion {
+					return fmt.Errorf("format version %d", format.Version)
+				}
+				_, err = txn.Get(lastKey)
+				return err
+			})
+			db.Close()
+			if err != nil {
+				t.Fatalf("incomplete index %s: %s", name, err)
+			}
+			opened++
+		}
+	}
+	names, err := search.GetIndexPaths(dir, time.Time{}, search.MaxTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != indices {
+		t.Errorf("wrote %d indices, want %d", len(names), indices)
+	}
+	t.Logf("opened %d indices while writing", opened)
+}
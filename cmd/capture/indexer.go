@@ -1,14 +1,15 @@
 package capture
 
 import (
-	"fmt"
+	"bytes"
 	"net"
 	"sync"
+	"time"
 
+	"github.com/google/gopacket"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
-	"code.ornl.gov/situ/mercury/common"
 	idx "code.ornl.gov/situ/mercury/index"
 )
 
@@ -25,7 +26,13 @@ var (
 	indexCache map[string]*indexMeta
 )
 
-func index(inCh chan *Message, done *sync.WaitGroup) (chan *Message, error) {
+// index builds an in memory index for each pcap file. If serverPortsOnly
+// is true only the lower port of each packet, which is most likely the
+// service port, is indexed instead of both ports. If packetMeta is true the
+// summary of each packet is stored with its pcap file offset. Each new
+// index is added to live, if it is not nil, so it can be searched before it
+// is written.
+func index(inCh chan *Message, serverPortsOnly, packetMeta bool, live *liveIndex, done *sync.WaitGroup) (chan *Message, error) {
 	outCh := make(chan *Message, idxOutChanSize)
 
 	logger := log.With().Str("component", "indexer").Logger()
@@ -37,10 +44,7 @@ func index(inCh chan *Message, done *sync.WaitGroup) (chan *Message, error) {
 		defer func() {
 			logger.Info().Msg("completed")
 			defer close(outCh)
-			err := flushAll(logger)
-			if err != nil {
-				logger.Error().Err(err).Msg("error flushing index file")
-			}
+			flushAll(outCh, logger)
 			done.Done()
 		}()
 
@@ -76,6 +80,7 @@ func index(inCh chan *Message, done *sync.WaitGroup) (chan *Message, error) {
 						index:       idx.NewMemIndex(),
 						openWriters: 1,
 					}
+					live.add(newMemIndexFile, indexCache[newMemIndexFile].index)
 					logger.Debug().
 						Str("file-name", newMemIndexFile).
 						Int("open-writers", indexCache[newMemIndexFile].openWriters).
@@ -93,42 +98,130 @@ func index(inCh chan *Message, done *sync.WaitGroup) (chan *Message, error) {
 				im := indexCache[pcapFilename]
 				memIndex := im.index
 
-				valueElem := idx.NewValueElement(msg.Get(msgPayloadPcapIdx).(byte), msg.Get(msgPayloadOffset).(uint32))
+				valueElem := idx.NewValueElement(msg.Get(msgPayloadPcapIdx).(byte), msg.Get(msgPayloadOffset).(uint64))
+				if packetMeta {
+					valueElem.Meta = newPacketMeta(msg)
+				}
+
+				// Live queries must not read the index while it changes.
+				live.lock()
 
 				proto := msg.Get(msgPayloadIPProto)
 				if proto != nil {
 					memIndex.Put(idx.NewProtoKey(proto.(uint8)), valueElem)
 				}
 
+				// MACs are indexed under an any-direction key as well
+				// as a direction-tagged key so queries can be scoped to
+				// the source or destination side.
+				var sMAC net.HardwareAddr
+				srcMAC := msg.Get(msgPayloadSrcMAC)
+				if srcMAC != nil {
+					sMAC = srcMAC.(net.HardwareAddr)
+					if len(sMAC) > 0 {
+						memIndex.Put(idx.NewMACKey(sMAC), valueElem)
+						memIndex.Put(idx.NewSrcMACKey(sMAC), valueElem)
+					}
+				}
+
+				var dMAC net.HardwareAddr
+				dstMAC := msg.Get(msgPayloadDstMAC)
+				if dstMAC != nil {
+					dMAC = dstMAC.(net.HardwareAddr)
+					if len(dMAC) > 0 {
+						if !bytes.Equal(sMAC, dMAC) {
+							memIndex.Put(idx.NewMACKey(dMAC), valueElem)
+						}
+						memIndex.Put(idx.NewDstMACKey(dMAC), valueElem)
+					}
+				}
+
+				// The BSSID of an 802.11 frame has no direction.
+				bssid := msg.Get(msgPayloadBSSID)
+				if bssid != nil {
+					b := bssid.(net.HardwareAddr)
+					if len(b) > 0 && !bytes.Equal(b, sMAC) && !bytes.Equal(b, dMAC) {
+						memIndex.Put(idx.NewMACKey(b), valueElem)
+					}
+				}
+
 				srcIP := msg.Get(msgPayloadSrcIP)
 				if srcIP != nil {
-					sip := srcIP.(net.IP)
-					if sip.To4() != nil {
-						memIndex.Put(idx.NewIPv4Key(sip.To4()), valueElem)
-					} else if sip.To16() != nil {
-						memIndex.Put(idx.NewIPv6Key(sip.To16()), valueElem)
+					if k := idx.NewIPKey(srcIP.(net.IP)); k != nil {
+						memIndex.Put(k, valueElem)
 					}
 				}
 
 				dstIP := msg.Get(msgPayloadDstIP)
 				if dstIP != nil {
-					dip := dstIP.(net.IP)
-					if dip.To4() != nil {
-						memIndex.Put(idx.NewIPv4Key(dip.To4()), valueElem)
-					} else if dip.To16() != nil {
-						memIndex.Put(idx.NewIPv6Key(dip.To16()), valueElem)
+					if k := idx.NewIPKey(dstIP.(net.IP)); k != nil {
+						memIndex.Put(k, valueElem)
 					}
 				}
 
 				srcPort := msg.Get(msgPayloadSrcPort)
-				if srcPort != nil {
-					memIndex.Put(idx.NewPortKey(srcPort.(uint16)), valueElem)
+				dstPort := msg.Get(msgPayloadDstPort)
+				if serverPortsOnly && srcPort != nil && dstPort != nil {
+					port := srcPort.(uint16)
+					if dstPort.(uint16) < port {
+						port = dstPort.(uint16)
+					}
+					memIndex.Put(idx.NewPortKey(port), valueElem)
+				} else {
+					if srcPort != nil {
+						memIndex.Put(idx.NewPortKey(srcPort.(uint16)), valueElem)
+					}
+					if dstPort != nil {
+						memIndex.Put(idx.NewPortKey(dstPort.(uint16)), valueElem)
+					}
 				}
 
-				dstPort := msg.Get(msgPayloadDstPort)
-				if dstPort != nil {
-					memIndex.Put(idx.NewPortKey(dstPort.(uint16)), valueElem)
+				// Both directions of a TCP or UDP conversation have the same
+				// flow key. The 5-tuple has the ephemeral port, so it is not
+				// indexed with serverPortsOnly.
+				if p, _ := proto.(uint8); !serverPortsOnly && (p == 6 || p == 17) && srcPort != nil && dstPort != nil {
+					sIP, _ := srcIP.(net.IP)
+					dIP, _ := dstIP.(net.IP)
+					if k := idx.NewFlowKey(sIP, dIP, srcPort.(uint16), dstPort.(uint16), p); k != nil {
+						memIndex.Put(k, valueElem)
+					}
 				}
+
+				mplsLabel := msg.Get(msgPayloadMPLSLabel)
+				if mplsLabel != nil {
+					memIndex.Put(idx.NewMPLSKey(mplsLabel.(uint32)), valueElem)
+				}
+
+				vlans := msg.Get(msgPayloadVLANs)
+				if vlans != nil {
+					for _, id := range vlans.([]uint16) {
+						memIndex.Put(idx.NewVLANKey(id), valueElem)
+					}
+				}
+
+				vni := msg.Get(msgPayloadVNI)
+				if vni != nil {
+					memIndex.Put(idx.NewVNIKey(vni.(uint32)), valueElem)
+				}
+
+				iface := msg.Get(msgPayloadInterface)
+				if iface != nil {
+					memIndex.Put(idx.NewInterfaceKey(iface.(string)), valueElem)
+				}
+
+				host := msg.Get(msgPayloadHost)
+				if host != nil {
+					memIndex.Put(idx.NewHostKey(host.(string)), valueElem)
+				}
+
+				domains := msg.Get(msgPayloadDomains)
+				if domains != nil {
+					for _, name := range domains.([]string) {
+						memIndex.Put(idx.NewDomainKey(name), valueElem)
+					}
+				}
+				live.unlock()
+				countIndexed()
 			}
 		}
 	}()
@@ -136,17 +229,36 @@ func index(inCh chan *Message, done *sync.WaitGroup) (chan *Message, error) {
 	return outCh, nil
 }
 
-func flushAll(logger zerolog.Logger) error {
+// newPacketMeta returns the summary of a packet from the fields set by the
+// packet extractor.
+func newPacketMeta(msg *Message) *idx.PacketMeta {
+	ci := msg.Get(msgPayloadPacket).(gopacket.Packet).Metadata().CaptureInfo
+	meta := &idx.PacketMeta{
+		// The pcap record header only has microseconds.
+		Timestamp: ci.Timestamp.Truncate(time.Microsecond),
+		Length:    uint32(ci.CaptureLength),
+		Truncated: ci.CaptureLength < ci.Length,
+	}
+	meta.Proto, _ = msg.Get(msgPayloadIPProto).(uint8)
+	meta.SrcPort, _ = msg.Get(msgPayloadSrcPort).(uint16)
+	meta.DstPort, _ = msg.Get(msgPayloadDstPort).(uint16)
+	meta.SrcIP, _ = msg.Get(msgPayloadSrcIP).(net.IP)
+	meta.DstIP, _ = msg.Get(msgPayloadDstIP).(net.IP)
+	meta.SrcMAC, _ = msg.Get(msgPayloadSrcMAC).(net.HardwareAddr)
+	meta.DstMAC, _ = msg.Get(msgPayloadDstMAC).(net.HardwareAddr)
+	meta.VLANs, _ = msg.Get(msgPayloadVLANs).([]uint16)
+	return meta
+}
+
+// flushAll sends any remaining memory indices to the index writer.
+func flushAll(outCh chan *Message, logger zerolog.Logger) {
 	logger.Debug().Msg("starting flushing indices")
 	for filename, im := range indexCache {
-		idxName := fmt.Sprintf("%s.%s", filename, common.IndexNameSuffix)
 		im.openWriters = 0
-		err := writeIndexFile(idxName, im.index, logger)
-		if err != nil {
-			return err
-		}
+		outCh <- NewMessage(msgTypeMemoryIndex).
+			Set(msgPayloadMemoryIndex, im.index).
+			Set(msgPayloadMemoryIndexFile, filename)
 		delete(indexCache, filename)
 	}
 	logger.Debug().Msg("finished flushing indices")
-	return nil
 }
@@ -0,0 +1,105 @@
+package capture
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	idx "code.ornl.gov/situ/mercury/index"
+)
+
+// vxlanPacket returns a TCP packet between two hosts of a VXLAN network
+// with the VNI vni.
+func vxlanPacket(t *testing.T, vni uint32) gopacket.Packet {
+	t.Helper()
+	outerEth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	outerIP := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IPv4(192, 168, 0, 1), DstIP: net.IPv4(192, 168, 0, 2)}
+	udp := &layers.UDP{SrcPort: 50000, DstPort: 4789}
+	udp.SetNetworkLayerForChecksum(outerIP)
+	vxlan := &layers.VXLAN{ValidIDFlag: true, VNI: vni}
+	innerEth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 7},
+		DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 8},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	innerIP := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.IPv4(10, 0, 0, 1), DstIP: net.IPv4(10, 0, 0, 2)}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: 80, SYN: true}
+	tcp.SetNetworkLayerForChecksum(innerIP)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	err := gopacket.SerializeLayers(buf, opts, outerEth, outerIP, udp, vxlan, innerEth, innerIP, tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	packet.Metadata().Timestamp = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	packet.Metadata().CaptureLength = len(buf.Bytes())
+	packet.Metadata().Length = len(buf.Bytes())
+	return packet
+}
+
+func TestIndexVXLAN(t *testing.T) {
+	inCh := make(chan *Message, 4)
+	var done sync.WaitGroup
+	done.Add(2)
+	extracted, err := extractPacket(inCh, &done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexed, err := index(extracted, false, false, nil, &done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const filename = "2020_01_01-00_00_00"
+	inCh <- NewMessage(msgTypeNewPcapFile).
+		Set(msgPayloadPcapFilename, filename).
+		Set(msgPayloadPcapIdx, byte(0))
+	inCh <- NewMessage(msgTypePacket).
+		Set(msgPayloadPacket, vxlanPacket(t, 5000)).
+		Set(msgPayloadPcapFilename, filename).
+		Set(msgPayloadPcapIdx, byte(0)).
+		Set(msgPayloadOffset, uint64(24))
+	inCh <- NewMessage(msgTypeFileClosed).Set(msgPayloadPcapFilename, filename)
+	close(inCh)
+
+	var memIndex idx.MemIndex
+	for msg := range indexed {
+		if msg.msgType == msgTypeMemoryIndex {
+			memIndex = msg.Get(msgPayloadMemoryIndex).(idx.MemIndex)
+		}
+	}
+	done.Wait()
+	if memIndex == nil {
+		t.Fatal("no index was written")
+	}
+
+	// The packet is found by its VNI, and by its outer addresses but not
+	// the inner ones.
+	tests := []struct {
+		name  string
+		key   *idx.Key
+		found bool
+	}{
+		{"vni 5000", idx.NewVNIKey(5000), true},
+		{"vni 5001", idx.NewVNIKey(5001), false},
+		{"ip 192.168.0.2", idx.NewIPv4Key(net.IPv4(192, 168, 0, 2).To4()), true},
+		{"ip 10.0.0.1", idx.NewIPv4Key(net.IPv4(10, 0, 0, 1).To4()), false},
+	}
+	for _, tt := range tests {
+		value := memIndex.Get(tt.key)
+		found := value != nil && len(*value) == 1 && (*value)[0].Offset == 24
+		if found != tt.found {
+			t.Errorf("%s: found %t, want %t", tt.name, found, tt.found)
+		}
+	}
+}
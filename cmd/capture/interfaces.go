@@ -0,0 +1,72 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// Flags of a pcap.Interface (PCAP_IF_*).
+const (
+	ifLoopback uint32 = 0x1
+	ifUp       uint32 = 0x2
+	ifRunning  uint32 = 0x4
+)
+
+// permissionHint explains why interfaces may be missing or cannot be
+// listed.
+const permissionHint = "capturing usually requires root or the CAP_NET_RAW and CAP_NET_ADMIN capabilities (e.g. `sudo setcap cap_net_raw,cap_net_admin=eip mercury`)"
+
+// PrintInterfaces writes the network interfaces that can be captured from
+// to w, numbered like `tcpdump -D`, with their description, flags and
+// addresses.
+func PrintInterfaces(w io.Writer) error {
+	devs, err := pcap.FindAllDevs()
+	if err != nil {
+		msg := strings.ToLower(err.Error())
+		if strings.Contains(msg, "permission") || strings.Contains(msg, "not permitted") {
+			return fmt.Errorf("unable to list interfaces: %s; %s", err, permissionHint)
+		}
+		return fmt.Errorf("unable to list interfaces: %s", err)
+	}
+	if len(devs) == 0 {
+		return fmt.Errorf("no interfaces found, %s", permissionHint)
+	}
+
+	for i, dev := range devs {
+		line := fmt.Sprintf("%d. %s", i+1, dev.Name)
+		if dev.Description != "" {
+			line += fmt.Sprintf(" (%s)", dev.Description)
+		}
+		var flags []string
+		if dev.Flags&ifUp != 0 {
+			flags = append(flags, "Up")
+		}
+		if dev.Flags&ifRunning != 0 {
+			flags = append(flags, "Running")
+		}
+		if dev.Flags&ifLoopback != 0 {
+			flags = append(flags, "Loopback")
+		}
+		if len(flags) > 0 {
+			line += fmt.Sprintf(" [%s]", strings.Join(flags, ", "))
+		}
+		_, err = fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+		for _, addr := range dev.Addresses {
+			a := addr.IP.String()
+			if ones, bits := addr.Netmask.Size(); bits > 0 {
+				a = fmt.Sprintf("%s/%d", a, ones)
+			}
+			_, err = fmt.Fprintf(w, "    %s\n", a)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package capture
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/search"
+)
+
+// janitor deletes the oldest indices of the label, with their pcap files,
+// each time an index is written while the label index path and the pcap
+// paths are larger than maxBytes, so a continuous capture stays within a
+// fixed amount of disk like a ring buffer. The pcap files that are being
+// written have no index yet, so they are never deleted, and neither is the
+// newest index.
+func janitor(maxBytes uint64, indexBasePath string, pcapPaths []string, inCh chan *Message, done *sync.WaitGroup) error {
+	if maxBytes == 0 {
+		return fmt.Errorf("the maximum disk size must be greater than 0")
+	}
+	logger := log.With().Str("component", "janitor").Uint64("max-disk-bytes", maxBytes).Logger()
+
+	go func() {
+		logger.Info().Msg("started")
+
+		defer func() {
+			logger.Info().Msg("completed")
+			done.Done()
+		}()
+
+		for msg := range inCh {
+			if msg.msgType != msgTypeIndexWritten {
+				continue
+			}
+			err := enforceDiskCap(maxBytes, indexBasePath, pcapPaths, logger)
+			if err != nil {
+				logger.Error().Err(err).Msg("error deleting the oldest captures")
+			}
+		}
+	}()
+
+	return nil
+}
+
+// enforceDiskCap deletes the oldest indices and their pcap files until the
+// label index path and the pcap paths are no larger than maxBytes.
+func enforceDiskCap(maxBytes uint64, indexBasePath string, pcapPaths []string, logger zerolog.Logger) error {
+	var total int64
+	for _, dir := range append([]string{indexBasePath}, pcapPaths...) {
+		size, err := common.DiskSize(dir)
+		if err != nil {
+			return err
+		}
+		total += size
+	}
+	if uint64(total) <= maxBytes {
+		return nil
+	}
+
+	indices, err := search.GetIndexPaths(indexBasePath, time.Time{}, time.Now().Add(common.MaxPcapFileTime))
+	if err != nil {
+		return err
+	}
+	for i, indexName := range indices {
+		if uint64(total) <= maxBytes {
+			return nil
+		}
+		if i == len(indices)-1 {
+			logger.Warn().Int64("bytes", total).Msg("the newest capture and the files being written are larger than the maximum disk size")
+			return nil
+		}
+		size, err := common.RemoveCapture(indexBasePath, pcapPaths, indexName)
+		if err != nil {
+			return err
+		}
+		total -= size
+		logger.Info().Str("index-name", indexName).Int64("bytes", size).Msg("deleted the oldest capture")
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package capture
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/rs/zerolog/log"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/common"
+	idx "code.ornl.gov/situ/mercury/index"
+	"code.ornl.gov/situ/mercury/search"
+)
+
+// liveIndex makes the in memory indices that have not been written to disk
+// yet searchable. An index is added when the indexer creates it and removed
+// once the index writer has written it, so a packet is always in either a
+// live or a written index. The indexer holds the write lock while it adds a
+// packet; by then the packet has been written to its pcap file, so every
+// live value can be read. A nil liveIndex does nothing.
+type liveIndex struct {
+	mu        sync.RWMutex
+	indices   map[string]idx.MemIndex
+	pcapPaths []string
+	linkType  layers.LinkType
+}
+
+func newLiveIndex(pcapPaths []string, linkType layers.LinkType) *liveIndex {
+	return &liveIndex{
+		indices:   make(map[string]idx.MemIndex),
+		pcapPaths: pcapPaths,
+		linkType:  linkType,
+	}
+}
+
+// add makes the index of a pcap file name searchable.
+func (l *liveIndex) add(filename string, memIndex idx.MemIndex) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.indices[filename] = memIndex
+	l.mu.Unlock()
+}
+
+// remove stops searching the index of a pcap file name once it is written.
+func (l *liveIndex) remove(filename string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	delete(l.indices, filename)
+	l.mu.Unlock()
+}
+
+// lock must be held while the indexer updates an index.
+func (l *liveIndex) lock() {
+	if l != nil {
+		l.mu.Lock()
+	}
+}
+
+func (l *liveIndex) unlock() {
+	if l != nil {
+		l.mu.Unlock()
+	}
+}
+
+// liveValue is a copy of the value of a key in a live index.
+type liveValue struct {
+	filename string
+	value    idx.Value
+}
+
+// lookup returns a copy of the values of the key in each live index, in
+// file name (time) order.
+func (l *liveIndex) lookup(k *idx.Key) []liveValue {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	values := make([]liveValue, 0, len(l.indices))
+	for filename, memIndex := range l.indices {
+		v := memIndex.Get(k)
+		if v == nil {
+			continue
+		}
+		values = append(values, liveValue{filename: filename, value: append(idx.Value(nil), *v...)})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].filename < values[j].filename
+	})
+	return values
+}
+
+// ServeHTTP searches the live indices. The query parameters are named like
+// the QueryReq fields of the gateway (queryType, query, direction, showAll,
+// encode and displayFilter); the matching packets are sent as JSON lines
+// of QueryResp, or as a pcap stream if binary is true.
+func (l *liveIndex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	boolParam := func(name string) bool {
+		b, _ := strconv.ParseBool(params.Get(name))
+		return b
+	}
+	req := &v1.QueryReq{
+		QueryType:     v1.QueryType(v1.QueryType_value[strings.ToLower(params.Get("queryType"))]),
+		Query:         params.Get("query"),
+		Direction:     v1.Direction(v1.Direction_value[strings.ToLower(params.Get("direction"))]),
+		ShowAll:       boolParam("showAll"),
+		Encode:        boolParam("encode"),
+		BinaryOutput:  boolParam("binary"),
+		DisplayFilter: params.Get("displayFilter"),
+	}
+
+	keyBytes, err := search.CreateKey(req.QueryType, req.Query, req.Direction)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var k idx.Key
+	err = k.UnmarshalBinary(keyBytes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var fn search.PacketFunc
+	if req.BinaryOutput {
+		w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+		pw := pcapgo.NewWriter(w)
+		err = pw.WriteFileHeader(uint32(common.SnapLen), l.linkType)
+		if err != nil {
+			return
+		}
+		fn = func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			return pw.WritePacket(packet.Metadata().CaptureInfo, packet.Data())
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		m := &jsonpb.Marshaler{}
+		fn = func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			protoTs, err := ptypes.TimestampProto(ts)
+			if err != nil {
+				return fmt.Errorf("error converting timestamp %s for protobuf: %s", ts.String(), err)
+			}
+			err = m.Marshal(w, search.NewResp(protoTs, packetLen, packet, req.ShowAll, req.Encode, false))
+			if err != nil {
+				return err
+			}
+			_, err = w.Write([]byte("\n"))
+			return err
+		}
+	}
+	fn, err = search.DisplayFilter(req.DisplayFilter, fn)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	values := l.lookup(&k)
+	log.Debug().
+		Str("component", "live-query").
+		Str("query-type", req.QueryType.String()).
+		Str("query-arg", req.Query).
+		Int("indices", len(values)).
+		Msg("executing live query")
+	for _, v := range values {
+		err = search.ReadPackets(v.filename, v.value, l.pcapPaths, l.linkType, common.CompressionNone, search.Options{}, time.Time{}, search.MaxTime, fn)
+		if err != nil {
+			// The response has started, so the error can only be logged.
+			log.Warn().Err(err).Str("component", "live-query").Str("file-name", v.filename).Msg("error reading live query results")
+			return
+		}
+	}
+}
@@ -7,6 +7,7 @@ const (
 	msgTypeFileClosed
 	msgTypeNewPcapFile
 	msgTypeMemoryIndex
+	msgTypeIndexWritten
 )
 
 type messagePayload uint8
@@ -24,6 +25,13 @@ const (
 	msgPayloadSrcPort
 	msgPayloadDstIP
 	msgPayloadDstPort
+	msgPayloadMPLSLabel
+	msgPayloadVNI
+	msgPayloadBSSID
+	msgPayloadInterface
+	msgPayloadDomains
+	msgPayloadHost
+	msgPayloadVLANs
 	msgPayloadMemoryIndex
 	msgPayloadMemoryIndexFile
 )
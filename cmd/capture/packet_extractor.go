@@ -5,6 +5,7 @@ import (
 
 	"code.ornl.gov/situ/mercury/common"
 	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/rs/zerolog/log"
 )
 
@@ -31,14 +32,73 @@ func extractPacket(inChan chan *Message, done *sync.WaitGroup) (chan *Message, e
 				packet := msg.Get(msgPayloadPacket).(gopacket.Packet)
 
 				_, srcMAC, dstMAC, srcIP, dstIP, srcPort, dstPort, proto, _ := common.ParsePacket(packet)
-				msg.Set(msgPayloadSrcMAC, srcMAC)
-				msg.Set(msgPayloadDstMAC, dstMAC)
+				// Index other IP protocols (e.g. GRE or ESP) by the
+				// protocol number in the IP header.
+				if proto == 0 {
+					proto = common.IPProtocol(packet)
+				}
+				// Packets without an Ethernet or 802.11 header (e.g. raw
+				// IP or Linux cooked captures) have no MAC keys.
+				if srcMAC != nil {
+					msg.Set(msgPayloadSrcMAC, srcMAC)
+				}
+				if dstMAC != nil {
+					msg.Set(msgPayloadDstMAC, dstMAC)
+				}
 				msg.Set(msgPayloadSrcIP, srcIP)
 				msg.Set(msgPayloadDstIP, dstIP)
 				msg.Set(msgPayloadSrcPort, srcPort)
 				msg.Set(msgPayloadDstPort, dstPort)
 				msg.Set(msgPayloadIPProto, proto)
 
+				// Both tags of QinQ packets are indexed, so a VLAN query
+				// matches the outer or the inner ID.
+				if vlans := common.VLANIDs(packet); len(vlans) > 0 {
+					msg.Set(msgPayloadVLANs, vlans)
+				}
+
+				// The first MPLS layer is the top of the label stack;
+				// gopacket decodes the IP layer below the stack so it
+				// is still indexed above.
+				if mplsLayer := packet.Layer(layers.LayerTypeMPLS); mplsLayer != nil {
+					msg.Set(msgPayloadMPLSLabel, mplsLayer.(*layers.MPLS).Label)
+				}
+
+				// 802.11 frames are also indexed by the BSSID so a MAC
+				// query for an access point finds the traffic of its
+				// network.
+				if dot11Layer := packet.Layer(layers.LayerTypeDot11); dot11Layer != nil {
+					_, _, bssid := common.Dot11Addrs(dot11Layer.(*layers.Dot11))
+					msg.Set(msgPayloadBSSID, bssid)
+				}
+
+				// VXLAN is decoded from UDP port 4789; the addresses and
+				// ports above are from the outer packet.
+				if vxlanLayer := packet.Layer(layers.LayerTypeVXLAN); vxlanLayer != nil {
+					vxlan := vxlanLayer.(*layers.VXLAN)
+					if vxlan.ValidIDFlag {
+						msg.Set(msgPayloadVNI, vxlan.VNI)
+					}
+				}
+
+				// The server name of TLS ClientHellos and the Host of
+				// HTTP requests are indexed from the start of the TCP
+				// payload, without reassembling the stream.
+				if tcpLayer := packet.Layer(layers.LayerTypeTCP); tcpLayer != nil {
+					if name := hostName(tcpLayer.(*layers.TCP).Payload); name != "" {
+						msg.Set(msgPayloadHost, name)
+					}
+				}
+
+				// DNS (decoded from UDP port 53) queries and their
+				// responses are indexed by the names in the question
+				// section, so a domain query finds both.
+				if dnsLayer := packet.Layer(layers.LayerTypeDNS); dnsLayer != nil {
+					if names := dnsNames(dnsLayer.(*layers.DNS)); len(names) > 0 {
+						msg.Set(msgPayloadDomains, names)
+					}
+				}
+
 			}
 
 			outCh <- msg
@@ -48,3 +108,26 @@ func extractPacket(inChan chan *Message, done *sync.WaitGroup) (chan *Message, e
 
 	return outCh, nil
 }
+
+// dnsNames returns the distinct names in the question section of a DNS
+// message.
+func dnsNames(dns *layers.DNS) []string {
+	var names []string
+	for _, q := range dns.Questions {
+		name := string(q.Name)
+		if name == "" {
+			continue
+		}
+		dup := false
+		for _, n := range names {
+			if n == name {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -1,11 +1,19 @@
 package capture
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"fmt"
+	"io"
+	"os"
 	"time"
 
 	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
 	"github.com/rs/zerolog/log"
 )
 
@@ -14,23 +22,42 @@ const (
 )
 
 // readPacketsFromInterface reads packets from a network interface
-// and sends them to the output channel, quitting when the passed in
-// context.Context is canceled.
-func readPacketsFromInterface(ctx context.Context, deviceName string, snapshotLen int32, promiscuous bool, timeout time.Duration) (chan *Message, error) {
+// and sends them to the output channel with the interface name, quitting
+// when the passed in context.Context is canceled. It returns the link
+// type of the interface.
+// If bufferSize is not 0 it is the size in bytes of the kernel capture
+// buffer, otherwise the libpcap default is used. If immediate is true
+// packets are delivered as they arrive rather than when the buffer fills
+// or the timeout expires. If statsInterval is not 0 the capture
+// statistics are logged that often, and they are always logged when the
+// capture stops.
+func readPacketsFromInterface(ctx context.Context, deviceName string, snapshotLen int32, promiscuous bool, timeout time.Duration, bufferSize int, immediate bool, statsInterval time.Duration) (chan *Message, layers.LinkType, error) {
 	outCh := make(chan *Message, readIfChanSize)
 
-	logger := log.With().Str("component", "interface-reader").Str("interface", deviceName).Int32("snapshot-length", snapshotLen).Bool("promiscuous", promiscuous).Logger()
+	logger := log.With().Str("component", "interface-reader").Str("interface", deviceName).Int32("snapshot-length", snapshotLen).Bool("promiscuous", promiscuous).Int("buffer-size", bufferSize).Bool("immediate", immediate).Logger()
 
-	handle, err := pcap.OpenLive(deviceName, snapshotLen, promiscuous, timeout)
+	handle, err := openInterface(deviceName, snapshotLen, promiscuous, timeout, bufferSize, immediate)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+	linkType := handle.LinkType()
+	packetSource := gopacket.NewPacketSource(handle, linkType)
 
 	go func() {
 		logger.Info().Msg("started")
 
+		stopStats := make(chan struct{})
+		statsStopped := make(chan struct{})
+		if statsInterval > 0 {
+			go logStatsEvery(logger, handle, statsInterval, stopStats, statsStopped)
+		} else {
+			close(statsStopped)
+		}
+
 		defer func() {
+			close(stopStats)
+			<-statsStopped
+			logStats(logger, handle)
 			logger.Info().Msg("completed")
 			handle.Close()
 			close(outCh)
@@ -38,24 +65,68 @@ func readPacketsFromInterface(ctx context.Context, deviceName string, snapshotLe
 
 		for packet := range packetSource.Packets() {
 			select {
-			case outCh <- NewMessage(msgTypePacket).Set(msgPayloadPacket, packet):
+			case outCh <- NewMessage(msgTypePacket).Set(msgPayloadPacket, packet).Set(msgPayloadInterface, deviceName):
+				countRead()
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 
-	return outCh, nil
+	return outCh, linkType, nil
+}
+
+// openInterface opens a network interface for capturing like
+// pcap.OpenLive, which has no buffer size or immediate mode setting.
+func openInterface(deviceName string, snapshotLen int32, promiscuous bool, timeout time.Duration, bufferSize int, immediate bool) (*pcap.Handle, error) {
+	if bufferSize == 0 && !immediate {
+		return pcap.OpenLive(deviceName, snapshotLen, promiscuous, timeout)
+	}
+
+	inactive, err := pcap.NewInactiveHandle(deviceName)
+	if err != nil {
+		return nil, err
+	}
+	defer inactive.CleanUp()
+
+	if err = inactive.SetSnapLen(int(snapshotLen)); err != nil {
+		return nil, fmt.Errorf("unable to set snapshot length: %s", err)
+	}
+	if err = inactive.SetPromisc(promiscuous); err != nil {
+		return nil, fmt.Errorf("unable to set promiscuous mode: %s", err)
+	}
+	if err = inactive.SetTimeout(timeout); err != nil {
+		return nil, fmt.Errorf("unable to set read timeout: %s", err)
+	}
+	if bufferSize != 0 {
+		if err = inactive.SetBufferSize(bufferSize); err != nil {
+			return nil, fmt.Errorf("unable to set buffer size: %s", err)
+		}
+	}
+	if immediate {
+		if err = inactive.SetImmediateMode(true); err != nil {
+			return nil, fmt.Errorf("unable to set immediate mode: %s", err)
+		}
+	}
+	return inactive.Activate()
 }
 
 // readPacketsFromFiles reads packets from a pcap file and sends them
 // to the output channel, quitting when the passed in context.Context
-// is canceled or the whole file has been read.
-func readPacketsFromFiles(ctx context.Context, files []string, finished chan<- bool) (chan *Message, error) {
+// is canceled or the whole file has been read. It returns the link type
+// of the first file that can be opened; files with a different link
+// type are skipped since every pcap file written has a single link type.
+// Each file that is read to the end is added to the checkpoint.
+func readPacketsFromFiles(ctx context.Context, files []string, cp *checkpoint, finished chan<- bool) (chan *Message, layers.LinkType, error) {
 	outCh := make(chan *Message, readIfChanSize)
 
 	logger := log.With().Str("component", "file-reader").Strs("files", files).Logger()
 
+	linkType, err := filesLinkType(files)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	logger.Info().Msg("started")
 	var count uint64
 
@@ -69,26 +140,171 @@ func readPacketsFromFiles(ctx context.Context, files []string, finished chan<- b
 
 		for _, file := range files {
 			logger.Debug().Str("file", file).Msg("starting reading file")
-			handle, err := pcap.OpenOffline(file)
+			handle, err := openPcapInput(file)
 			if err != nil {
 				logger.Error().Str("file", file).Err(err).Msg("unable to open pcap file for reading")
 				continue
 			}
-			packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+			if handle.LinkType() != linkType {
+				logger.Error().
+					Str("file", file).
+					Str("link-type", handle.LinkType().String()).
+					Str("expected-link-type", linkType.String()).
+					Msg("skipping pcap file with a different link type")
+				handle.Close()
+				continue
+			}
+			packetSource := gopacket.NewPacketSource(handle, linkType)
 
+			var skipped uint64
 			for packet := range packetSource.Packets() {
+				iface, ok := packetInterface(handle, packet, linkType)
+				if !ok {
+					skipped++
+					continue
+				}
+				msg := NewMessage(msgTypePacket).Set(msgPayloadPacket, packet)
+				if iface != "" {
+					msg.Set(msgPayloadInterface, iface)
+				}
 				select {
-				case outCh <- NewMessage(msgTypePacket).Set(msgPayloadPacket, packet):
+				case outCh <- msg:
 					count++
 				case <-ctx.Done():
 					return
 				}
 			}
+			if skipped > 0 {
+				logger.Warn().
+					Str("file", file).
+					Uint64("packets", skipped).
+					Str("expected-link-type", linkType.String()).
+					Msg("skipped packets of pcapng interfaces with a different link type")
+			}
 			logger.Debug().Str("file", file).Msg("finished reading file")
 			handle.Close()
+			err = cp.Add(file)
+			if err != nil {
+				logger.Warn().Str("file", file).Err(err).Msg("unable to add file to checkpoint")
+			}
 
 		}
 	}(files)
 
-	return outCh, nil
+	return outCh, linkType, nil
+}
+
+// filesLinkType returns the link type of the first pcap file that can be
+// opened.
+func filesLinkType(files []string) (layers.LinkType, error) {
+	for _, file := range files {
+		handle, err := openPcapInput(file)
+		if err != nil {
+			continue
+		}
+		defer handle.Close()
+		return handle.LinkType(), nil
+	}
+	return 0, fmt.Errorf("unable to open any of the pcap files")
+}
+
+// pcapInput is a pcap file opened for reading.
+type pcapInput interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+	Close()
+}
+
+// gzipMagic starts a gzip compressed file.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// pcapngMagic starts a pcapng file (the section header block type).
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// openPcapInput opens a pcap or pcapng file. Legacy pcap files are read
+// with libpcap, and pcapng files with a pcapng reader, which converts the
+// timestamps of each interface from its resolution and reports the
+// interface of each packet (see ngPcapInput). Gzip compressed files (e.g.
+// an archived `.pcap.gz`) are decompressed as they are read. The formats
+// are detected by their magic bytes rather than the file name.
+func openPcapInput(file string) (pcapInput, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(pcapngMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("unable to decompress %s: %s", file, err)
+		}
+		zbr := bufio.NewReader(zr)
+		magic, _ = zbr.Peek(len(pcapngMagic))
+		if bytes.Equal(magic, pcapngMagic) {
+			return newNgPcapInput(f, zbr, file)
+		}
+		r, err := pcapgo.NewReader(zbr)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("unable to read decompressed %s: %s", file, err)
+		}
+		return &gzipPcapInput{Reader: r, f: f}, nil
+	case bytes.Equal(magic, pcapngMagic):
+		return newNgPcapInput(f, br, file)
+	}
+	f.Close()
+	handle, err := pcap.OpenOffline(file)
+	if err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
+
+// gzipPcapInput reads a gzip compressed pcap file.
+type gzipPcapInput struct {
+	*pcapgo.Reader
+	f *os.File
+}
+
+func (g *gzipPcapInput) Close() {
+	g.f.Close()
+}
+
+// ngPcapInput reads a pcapng file, which can have packets from several
+// interfaces.
+type ngPcapInput struct {
+	*pcapgo.NgReader
+	f *os.File
+}
+
+func newNgPcapInput(f *os.File, r io.Reader, file string) (*ngPcapInput, error) {
+	ng, err := pcapgo.NewNgReader(r, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to read pcapng file %s: %s", file, err)
+	}
+	return &ngPcapInput{NgReader: ng, f: f}, nil
+}
+
+func (n *ngPcapInput) Close() {
+	n.f.Close()
+}
+
+// packetInterface returns the name of the interface a packet was read from
+// (empty if the file does not name it), and false if the interface does not
+// have the link type of the capture, so its packets cannot be decoded with
+// the others. Only pcapng files have more than one interface.
+func packetInterface(in pcapInput, packet gopacket.Packet, linkType layers.LinkType) (string, bool) {
+	ng, ok := in.(*ngPcapInput)
+	if !ok {
+		return "", true
+	}
+	iface, err := ng.Interface(packet.Metadata().InterfaceIndex)
+	if err != nil {
+		return "", true
+	}
+	return iface.Name, iface.LinkType == linkType
 }
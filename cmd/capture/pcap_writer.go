@@ -1,7 +1,12 @@
 package capture
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
 	"fmt"
+	"hash"
+	"io"
 	"os"
 	"path"
 	"sync"
@@ -9,6 +14,7 @@ import (
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcapgo"
+	"github.com/klauspost/compress/zstd"
 	"github.com/rs/zerolog/log"
 
 	"code.ornl.gov/situ/mercury/common"
@@ -18,7 +24,75 @@ const (
 	pcapWriterChanSize = 8192
 )
 
-func writePcap(snapshotLen int32, inCh chan *Message, done *sync.WaitGroup) (chan *Message, error) {
+// zstdEncoder compresses the blocks of zstd pcap files. EncodeAll can be
+// called by the pcap writers of several paths at the same time.
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// blockWriter compresses the pcap data written to it in independent blocks
+// of whole packets (see common.CompressedOffset).
+type blockWriter struct {
+	w           io.Writer
+	compression string
+	// offset is the number of compressed bytes written, the offset of the
+	// current block.
+	offset int64
+	block  bytes.Buffer
+}
+
+// Write adds to the current block.
+func (b *blockWriter) Write(p []byte) (int, error) {
+	return b.block.Write(p)
+}
+
+// packetOffset returns the index offset of the next packet.
+func (b *blockWriter) packetOffset() uint64 {
+	return common.CompressedOffset(b.offset, b.block.Len())
+}
+
+// endPacket ends the current block if it is full.
+func (b *blockWriter) endPacket() error {
+	if b.block.Len() < common.PcapBlockSize {
+		return nil
+	}
+	return b.Flush()
+}
+
+// Flush compresses and writes the current block, if it is not empty, as a
+// gzip member or zstd frame.
+func (b *blockWriter) Flush() error {
+	if b.block.Len() == 0 {
+		return nil
+	}
+	var compressed bytes.Buffer
+	switch b.compression {
+	case common.CompressionGzip:
+		zw := gzip.NewWriter(&compressed)
+		_, err := zw.Write(b.block.Bytes())
+		if err != nil {
+			return err
+		}
+		err = zw.Close()
+		if err != nil {
+			return err
+		}
+	case common.CompressionZstd:
+		compressed.Write(zstdEncoder.EncodeAll(b.block.Bytes(), nil))
+	default:
+		return fmt.Errorf("unsupported pcap compression %s", b.compression)
+	}
+	n, err := b.w.Write(compressed.Bytes())
+	b.offset += int64(n)
+	if err != nil {
+		return err
+	}
+	b.block.Reset()
+	return nil
+}
+
+// writePcap writes the packets to pcap files, compressed with compression
+// unless it is common.CompressionNone, and sets the offset of each packet
+// for the index.
+func writePcap(snapshotLen int32, linkType layers.LinkType, checksum bool, compression string, inCh chan *Message, done *sync.WaitGroup) (chan *Message, error) {
 	outCh := make(chan *Message, pcapWriterChanSize)
 
 	logger := log.With().Str("component", "pcap-writer").Logger()
@@ -36,6 +110,33 @@ func writePcap(snapshotLen int32, inCh chan *Message, done *sync.WaitGroup) (cha
 		var pcapIdx byte
 		var pcapFile *os.File
 		var pcapWriter *pcapgo.Writer
+		// blocks is set if the file is compressed.
+		var blocks *blockWriter
+		// The checksum is computed as the file is written so the file
+		// does not need to be read again.
+		var pcapHash hash.Hash
+
+		// closePcap closes the current pcap file and writes its checksum.
+		closePcap := func() {
+			if blocks != nil {
+				err := blocks.Flush()
+				if err != nil {
+					logger.Error().Str("file", pcapFile.Name()).Err(err).Msg("error writing compressed block")
+				}
+			}
+			pcapFile.Close()
+			if pcapHash != nil {
+				err := common.WriteChecksum(pcapFile.Name(), pcapHash.Sum(nil))
+				if err != nil {
+					logger.Error().Str("file", pcapFile.Name()).Err(err).Msg("error writing checksum")
+				}
+			}
+		}
+		defer func() {
+			if pcapFile != nil {
+				closePcap()
+			}
+		}()
 
 		for msg := range inCh {
 
@@ -43,7 +144,7 @@ func writePcap(snapshotLen int32, inCh chan *Message, done *sync.WaitGroup) (cha
 
 			case msgTypeNewPcapFile:
 				if pcapFile != nil {
-					pcapFile.Close()
+					closePcap()
 					logger.Debug().
 						Str("file-name", pcapFilename).
 						Msg("sending file closed message")
@@ -55,33 +156,64 @@ func writePcap(snapshotLen int32, inCh chan *Message, done *sync.WaitGroup) (cha
 				pcapFilename = msg.Get(msgPayloadPcapFilename).(string)
 				pcapIdx = msg.Get(msgPayloadPcapIdx).(byte)
 				var err error
-				f := fmt.Sprintf("%s_%d.%s", path.Join(pcapBase, pcapFilename), pcapIdx, common.PcapNameSuffix)
+				f := common.PcapFileName(path.Join(pcapBase, pcapFilename), int(pcapIdx), compression)
+				// The file name may include a date partition directory.
+				err = os.MkdirAll(path.Dir(f), os.ModePerm)
+				if err != nil {
+					logger.Error().Str("file", f).Err(err).Msg("error creating directory")
+					return // unrecoverable
+				}
 				pcapFile, err = os.Create(f)
 				if err != nil {
 					logger.Error().Str("file", f).Err(err).Msg("error opening file")
 					return // unrecoverable
 				}
-				pcapWriter = pcapgo.NewWriter(pcapFile)
-				err = pcapWriter.WriteFileHeader(uint32(snapshotLen), layers.LinkTypeEthernet)
+				var w io.Writer = pcapFile
+				pcapHash = nil
+				if checksum {
+					pcapHash = sha256.New()
+					w = io.MultiWriter(pcapFile, pcapHash)
+				}
+				blocks = nil
+				if compression != common.CompressionNone {
+					blocks = &blockWriter{w: w, compression: compression}
+					w = blocks
+				}
+				pcapWriter = pcapgo.NewWriter(w)
+				err = pcapWriter.WriteFileHeader(uint32(snapshotLen), linkType)
 				if err != nil {
 					logger.Error().Str("file", f).Err(err).Msg("error writing file header")
 					return // unrecoverable
 				}
 
 			case msgTypePacket:
-				offset, err := pcapFile.Seek(0, 1)
-				if err != nil {
-					logger.Warn().Str("file", pcapFile.Name()).Err(err).Msg("error seeking in file, unable to write packet")
-					continue
+				var offset uint64
+				if blocks != nil {
+					offset = blocks.packetOffset()
+				} else {
+					fileOffset, err := pcapFile.Seek(0, 1)
+					if err != nil {
+						logger.Warn().Str("file", pcapFile.Name()).Err(err).Msg("error seeking in file, unable to write packet")
+						continue
+					}
+					offset = uint64(fileOffset)
 				}
-				msg.Set(msgPayloadOffset, uint32(offset))
+				msg.Set(msgPayloadOffset, offset)
 				msg.Set(msgPayloadPcapFilename, pcapFilename)
 				packet := msg.Get(msgPayloadPacket).(gopacket.Packet)
-				err = pcapWriter.WritePacket(packet.Metadata().CaptureInfo, packet.Data())
+				err := pcapWriter.WritePacket(packet.Metadata().CaptureInfo, packet.Data())
 				if err != nil {
 					logger.Warn().Str("file", pcapFile.Name()).Err(err).Msg("error writing packet to file, unable to write packet")
 					continue
 				}
+				if blocks != nil {
+					err = blocks.endPacket()
+					if err != nil {
+						logger.Error().Str("file", pcapFile.Name()).Err(err).Msg("error writing compressed block")
+						return // unrecoverable
+					}
+				}
+				countWritten()
 
 			}
 
@@ -1,7 +1,6 @@
 package capture
 
 import (
-	"math"
 	"sync"
 	"time"
 
@@ -13,12 +12,62 @@ import (
 
 const (
 	schedulerChanSize = 8192
-	maxPcapFileSize   = math.MaxUint32
 )
 
+// DefaultRotationSize is the default size of a pcap file before a new one
+// is started, 4GiB, the size of the files indices before FormatVersion2
+// can reference.
+const DefaultRotationSize uint64 = 4 << 30
+
+// pcapHeaderSize is the size of a new pcap file before any packets are
+// written to it.
+const pcapHeaderSize = 24
+
+// fileBalancer tracks the size of the current pcap file in each pcap path
+// so packets can be spread evenly across the paths (and their disks).
+type fileBalancer struct {
+	sizes []uint64
+	// next is where the search for the smallest file starts, so ties are
+	// broken round-robin instead of always favoring the first path.
+	next int
+}
+
+func newFileBalancer(n int) *fileBalancer {
+	b := &fileBalancer{sizes: make([]uint64, n)}
+	b.reset()
+	return b
+}
+
+// reset sets every file back to an empty pcap file.
+func (b *fileBalancer) reset() {
+	for i := range b.sizes {
+		b.sizes[i] = pcapHeaderSize
+	}
+}
+
+// smallest returns the index and size of the smallest file.
+func (b *fileBalancer) smallest() (int, uint64) {
+	minIdx := b.next
+	for i := 1; i < len(b.sizes); i++ {
+		idx := (b.next + i) % len(b.sizes)
+		if b.sizes[idx] < b.sizes[minIdx] {
+			minIdx = idx
+		}
+	}
+	return minIdx, b.sizes[minIdx]
+}
+
+// add records n bytes written to file idx.
+func (b *fileBalancer) add(idx int, n uint64) {
+	b.sizes[idx] += n
+	b.next = (idx + 1) % len(b.sizes)
+}
+
 // schedule listens on a message input channel and handles creating
-// new pcap files.
-func schedule(basePcapPath []string, inCh chan *Message, done *sync.WaitGroup) []chan *Message {
+// new pcap files, in date partition directories if partition is true,
+// every interval or once a file would be larger than maxFileSize (if it
+// is not 0). now is the time source for rotating files.
+func schedule(basePcapPath []string, partition bool, maxFileSize uint64, interval time.Duration, now func() time.Time, inCh chan *Message, done *sync.WaitGroup) []chan *Message {
 	outCh := make([]chan *Message, 0, len(basePcapPath))
 	for i := 0; i < len(basePcapPath); i++ {
 		outCh = append(outCh, make(chan *Message, schedulerChanSize))
@@ -38,57 +87,74 @@ func schedule(basePcapPath []string, inCh chan *Message, done *sync.WaitGroup) [
 		}()
 
 		createNewFile := true
-		createNewFileTime := time.Now()
-		fileBytes := make([]uint64, len(outCh))
-		for i := range fileBytes {
-			fileBytes[i] = 24 // pcap header bytes
-		}
+		createNewFileTime := now()
+		files := newFileBalancer(len(outCh))
+		// fileName is the base name of the current pcap files, and
+		// fileSecond their name without sub-second digits.
+		var fileName, fileSecond string
+		// warned is the name of the current files once a warning that they
+		// were not rotated was logged, so it is only logged once for them.
+		var warned string
 
 		for msg := range inCh {
 			// Find the smallest file size.
-			var minFileBytes uint64 = math.MaxUint64
-			minFileIdx := 0
-			for i, v := range fileBytes {
-				if v < minFileBytes {
-					minFileBytes = v
-					minFileIdx = i
-				}
-			}
+			minFileIdx, minFileBytes := files.smallest()
 
 			// Size the packet will be in the file once written.
 			packetFileSize := uint64(msg.Get(msgPayloadPacket).(gopacket.Packet).Metadata().CaptureLength) + 16 // pcap packet header bytes
-			if minFileBytes+packetFileSize >= maxPcapFileSize {
+			if maxFileSize > 0 && minFileBytes+packetFileSize >= maxFileSize {
 				createNewFile = true
 			}
-			if time.Since(createNewFileTime) >= common.MaxPcapFileTime {
+			if now().Sub(createNewFileTime) >= interval {
 				createNewFile = true
 			}
 
+			if createNewFile {
+				t := msg.Get(msgPayloadPacket).(gopacket.Packet).Metadata().Timestamp.UTC()
+				timeStr := common.GetFilePath(t, partition)
+				name := timeStr
+				// Files are named for their first packet, so a new file in
+				// the same second would overwrite the current one. Name it
+				// with the nanoseconds instead, or, if that is not possible
+				// or still the same name, keep writing to the current one;
+				// offsets are not limited to 4GB.
+				if timeStr == fileSecond {
+					var ok bool
+					name, ok = common.GetFilePathNano(t, partition)
+					if !ok || name == fileName {
+						if warned != fileName {
+							logger.Warn().Str("file-base-name", fileName).Msg("not rotating the pcap files since the new ones would have the same name")
+							warned = fileName
+						}
+						createNewFile = false
+					}
+				}
+				if createNewFile {
+					fileName = name
+					fileSecond = timeStr
+				}
+			}
 			if createNewFile {
 				for i, p := range basePcapPath {
-					t := msg.Get(msgPayloadPacket).(gopacket.Packet).Metadata().Timestamp.UTC()
-					timeStr := common.GetFileBaseName(t)
 					logger.Debug().
 						Str("directory-path", p).
-						Str("file-base-name", timeStr).
+						Str("file-base-name", fileName).
 						Int("file-index", i).
 						Msg("sending create new file to writer")
 
 					outCh[i] <- NewMessage(msgTypeNewPcapFile).
 						Set(msgPayloadPcapPathBase, p).
-						Set(msgPayloadPcapFilename, timeStr).
+						Set(msgPayloadPcapFilename, fileName).
 						Set(msgPayloadPcapIdx, byte(i))
 				}
-				for i := range fileBytes {
-					fileBytes[i] = 24 // pcap header bytes
-				}
-				createNewFileTime = time.Now()
+				files.reset()
+				createNewFileTime = now()
 				createNewFile = false
 			}
 
 			msg.Set(msgPayloadPcapIdx, uint8(minFileIdx))
 			outCh[minFileIdx] <- msg
-			fileBytes[minFileIdx] += packetFileSize
+			files.add(minFileIdx, packetFileSize)
 		}
 
 	}()
@@ -0,0 +1,121 @@
+package capture
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"code.ornl.gov/situ/mercury/common"
+)
+
+// testPacket returns a packet of captureLen bytes captured at ts.
+func testPacket(ts time.Time, captureLen int) gopacket.Packet {
+	packet := gopacket.NewPacket(make([]byte, captureLen), layers.LayerTypeEthernet, gopacket.Default)
+	packet.Metadata().Timestamp = ts
+	packet.Metadata().CaptureLength = captureLen
+	packet.Metadata().Length = captureLen
+	return packet
+}
+
+func TestScheduleRoundRobin(t *testing.T) {
+	paths := []string{"/pcap0", "/pcap1", "/pcap2"}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time { return start }
+	inCh := make(chan *Message)
+	var done sync.WaitGroup
+	done.Add(1)
+	outCh := schedule(paths, false, 0, time.Minute, now, inCh, &done)
+
+	// Packets of the same size are spread over the paths in turn.
+	const packets = 9
+	for i := 0; i < packets; i++ {
+		inCh <- NewMessage(msgTypePacket).Set(msgPayloadPacket, testPacket(start, 100))
+	}
+	close(inCh)
+	done.Wait()
+
+	for i, ch := range outCh {
+		var msgs []*Message
+		for msg := range ch {
+			msgs = append(msgs, msg)
+		}
+		if len(msgs) != 1+packets/len(paths) {
+			t.Fatalf("path %d got %d messages, want %d", i, len(msgs), 1+packets/len(paths))
+		}
+		if msgs[0].msgType != msgTypeNewPcapFile || msgs[0].Get(msgPayloadPcapPathBase) != paths[i] || msgs[0].Get(msgPayloadPcapIdx) != byte(i) {
+			t.Errorf("path %d did not start with a new file in %s", i, paths[i])
+		}
+		for _, msg := range msgs[1:] {
+			if msg.msgType != msgTypePacket || msg.Get(msgPayloadPcapIdx) != uint8(i) {
+				t.Errorf("path %d got a packet for path %v", i, msg.Get(msgPayloadPcapIdx))
+			}
+		}
+	}
+}
+
+func TestScheduleRotateSameSecond(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time { return start }
+	inCh := make(chan *Message)
+	var done sync.WaitGroup
+	done.Add(1)
+	outCh := schedule([]string{"/pcap0"}, false, 200, time.Minute, now, inCh, &done)
+
+	// Every packet after the first would make the file larger than the
+	// maximum size, but the last one has the time of the file before it.
+	for _, ms := range []int{0, 1, 2, 2} {
+		ts := start.Add(time.Duration(ms) * time.Millisecond)
+		inCh <- NewMessage(msgTypePacket).Set(msgPayloadPacket, testPacket(ts, 100))
+	}
+	close(inCh)
+	done.Wait()
+
+	var names []string
+	for msg := range outCh[0] {
+		if msg.msgType == msgTypeNewPcapFile {
+			names = append(names, msg.Get(msgPayloadPcapFilename).(string))
+		}
+	}
+	want := []string{"2020_01_01-00_00_00", "2020_01_01-00_00_00.001000000", "2020_01_01-00_00_00.002000000"}
+	if len(names) != len(want) {
+		t.Fatalf("started files %v, want %v", names, want)
+	}
+	for i, name := range names {
+		if name != want[i] {
+			t.Errorf("started files %v, want %v", names, want)
+		}
+		parsed, err := time.Parse(common.GetFileTimeFormat(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ts := start.Add(time.Duration(i) * time.Millisecond); !parsed.Equal(ts) {
+			t.Errorf("%s parsed as %s, want %s", name, parsed, ts)
+		}
+	}
+}
+
+func TestFileBalancerSmallest(t *testing.T) {
+	b := newFileBalancer(3)
+	var order []int
+	for i := 0; i < 6; i++ {
+		idx, _ := b.smallest()
+		order = append(order, idx)
+		b.add(idx, 100)
+	}
+	want := []int{0, 1, 2, 0, 1, 2}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("files were chosen in the order %v, want %v", order, want)
+		}
+	}
+
+	// A smaller file is chosen before the next one in turn.
+	b.add(2, 50)
+	b.add(1, 10)
+	if idx, size := b.smallest(); idx != 0 || size != pcapHeaderSize+200 {
+		t.Errorf("smallest file is %d with %d bytes, want 0 with %d", idx, size, pcapHeaderSize+200)
+	}
+}
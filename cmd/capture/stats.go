@@ -0,0 +1,59 @@
+package capture
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+	"github.com/rs/zerolog"
+)
+
+// pipelineStats counts the packets that have passed each stage of the
+// capture pipeline. Stages that fall further and further behind the one
+// before them cannot keep up, and packets the kernel drops never reach
+// the first.
+var pipelineStats struct {
+	read    uint64
+	written uint64
+	indexed uint64
+}
+
+func countRead()    { atomic.AddUint64(&pipelineStats.read, 1) }
+func countWritten() { atomic.AddUint64(&pipelineStats.written, 1) }
+func countIndexed() { atomic.AddUint64(&pipelineStats.indexed, 1) }
+
+// logStats logs the kernel statistics of the capture handle and the
+// pipeline counts, which are totals since the capture started.
+func logStats(logger zerolog.Logger, handle *pcap.Handle) {
+	ev := logger.Info()
+	stats, err := handle.Stats()
+	if err != nil {
+		ev = logger.Warn().AnErr("stats-error", err)
+	} else {
+		ev = ev.
+			Int("received", stats.PacketsReceived).
+			Int("dropped", stats.PacketsDropped).
+			Int("interface-dropped", stats.PacketsIfDropped)
+	}
+	ev.
+		Uint64("read", atomic.LoadUint64(&pipelineStats.read)).
+		Uint64("written", atomic.LoadUint64(&pipelineStats.written)).
+		Uint64("indexed", atomic.LoadUint64(&pipelineStats.indexed)).
+		Msg("capture statistics")
+}
+
+// logStatsEvery logs the statistics every interval until stop is closed,
+// then closes stopped. The handle must not be closed until then.
+func logStatsEvery(logger zerolog.Logger, handle *pcap.Handle, interval time.Duration, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			logStats(logger, handle)
+		case <-stop:
+			return
+		}
+	}
+}
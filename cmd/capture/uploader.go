@@ -0,0 +1,131 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/storage"
+)
+
+const (
+	uploadChanSize = 1024
+)
+
+// upload copies the pcap files and an archive of the index to the store
+// once the index has been written, optionally deleting the local files.
+// The messages are then passed on to outCh if it is not nil.
+func upload(store storage.Store, prefix, label, indexBasePath string, pcapPaths []string, compression string, deleteLocal bool, inCh chan *Message, outCh chan *Message, done *sync.WaitGroup) error {
+	logger := log.With().Str("component", "uploader").Str("store", store.String()).Logger()
+
+	go func() {
+		logger.Info().Msg("started")
+
+		defer func() {
+			logger.Info().Msg("completed")
+			if outCh != nil {
+				close(outCh)
+			}
+			done.Done()
+		}()
+
+		for msg := range inCh {
+			if msg.msgType == msgTypeIndexWritten {
+				filename := msg.Get(msgPayloadMemoryIndexFile).(string)
+				err := uploadFiles(store, prefix, label, indexBasePath, pcapPaths, compression, filename, deleteLocal, logger)
+				if err != nil {
+					logger.Error().Err(err).Str("file-name", filename).Msg("error uploading files, keeping local copies")
+				}
+			}
+			if outCh != nil {
+				outCh <- msg
+			}
+		}
+	}()
+
+	return nil
+}
+
+func uploadFiles(store storage.Store, prefix, label, indexBasePath string, pcapPaths []string, compression, filename string, deleteLocal bool, logger zerolog.Logger) error {
+	ctx := context.Background()
+
+	pcapFiles := make([]string, len(pcapPaths))
+	for i, p := range pcapPaths {
+		pcapFiles[i] = common.PcapFileName(path.Join(p, filename), i, compression)
+		f, err := os.Open(pcapFiles[i])
+		if err != nil {
+			return err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		key := storage.Key(prefix, label, path.Base(pcapFiles[i]))
+		logger.Debug().Str("file", pcapFiles[i]).Str("key", key).Msg("uploading pcap file")
+		err = store.Put(ctx, key, f, fi.Size())
+		f.Close()
+		if err != nil {
+			return err
+		}
+		err = uploadChecksum(ctx, store, prefix, label, pcapFiles[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	idxName := fmt.Sprintf("%s.%s", filename, common.IndexNameSuffix)
+	idxPath := path.Join(indexBasePath, idxName)
+	var buf bytes.Buffer
+	err := storage.TarDir(idxPath, &buf)
+	if err != nil {
+		return fmt.Errorf("unable to archive index %s: %s", idxPath, err)
+	}
+	// Objects are stored flat (without any date partition directory).
+	key := storage.Key(prefix, label, path.Base(idxName)+"."+storage.IndexArchiveSuffix)
+	logger.Debug().Str("index", idxPath).Str("key", key).Msg("uploading index archive")
+	err = store.Put(ctx, key, &buf, int64(buf.Len()))
+	if err != nil {
+		return err
+	}
+
+	if deleteLocal {
+		for _, f := range pcapFiles {
+			err = os.Remove(f)
+			if err != nil {
+				return err
+			}
+			err = os.Remove(common.ChecksumPath(f))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		err = os.RemoveAll(idxPath)
+		if err != nil {
+			return err
+		}
+		logger.Debug().Str("file-name", filename).Msg("removed local files after upload")
+	}
+	return nil
+}
+
+// uploadChecksum uploads the checksum sidecar of a pcap file if there is one.
+func uploadChecksum(ctx context.Context, store storage.Store, prefix, label, pcapFile string) error {
+	b, err := ioutil.ReadFile(common.ChecksumPath(pcapFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	key := storage.Key(prefix, label, path.Base(common.ChecksumPath(pcapFile)))
+	return store.Put(ctx, key, bytes.NewReader(b), int64(len(b)))
+}
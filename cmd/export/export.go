@@ -0,0 +1,130 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/dgraph-io/badger/v2/pb"
+
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/index"
+	"code.ornl.gov/situ/mercury/search"
+)
+
+// Export formats.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Key is a decoded index key and the packets it references, written as
+// one JSON object per line.
+type Key struct {
+	Type   string  `json:"type"`
+	Key    string  `json:"key"`
+	Values []Value `json:"values"`
+}
+
+// Value is the location of a packet in the pcap files.
+type Value struct {
+	PathIdx byte   `json:"path_idx"`
+	File    string `json:"file"`
+	// Offset is the offset of the packet record in the file or, if it
+	// is compressed, the offset of its block and in the block (see
+	// common.CompressedOffset).
+	Offset uint64 `json:"offset"`
+}
+
+// Index writes every packet key of the index at indexPath and the pcap
+// file and offset of each packet it references to w, either as JSON lines
+// (one key per line) or as CSV (one packet reference per row). Keys are
+// not written in any particular order. The index is opened with opts.
+func Index(ctx context.Context, indexPath, format string, opts search.Options, w io.Writer) error {
+	var write func(k Key) error
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		write = func(k Key) error { return enc.Encode(k) }
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		defer cw.Flush()
+		err := cw.Write([]string{"type", "key", "path_idx", "file", "offset"})
+		if err != nil {
+			return err
+		}
+		write = func(k Key) error {
+			for _, v := range k.Values {
+				err := cw.Write([]string{k.Type, k.Key, strconv.Itoa(int(v.PathIdx)), v.File, strconv.FormatUint(v.Offset, 10)})
+				if err != nil {
+					return err
+				}
+			}
+			return cw.Error()
+		}
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+
+	db, err := search.OpenIndex(indexPath, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var idxFormat index.Format
+	var compression string
+	err = db.View(func(txn *badger.Txn) (err error) {
+		idxFormat, err = search.GetFormat(txn)
+		if err != nil {
+			return err
+		}
+		compression, err = search.GetCompression(txn)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// The pcap files of an index share its base name.
+	base := strings.TrimSuffix(path.Base(path.Clean(indexPath)), "."+common.IndexNameSuffix)
+
+	stream := db.NewStream()
+	stream.LogPrefix = "export-index"
+	stream.Send = func(list *pb.KVList) error {
+		for _, kv := range list.GetKv() {
+			var k index.Key
+			err := k.UnmarshalBinary(kv.GetKey())
+			if err != nil {
+				return err
+			}
+			if k.RecType == index.MetaType {
+				continue
+			}
+			var values index.Value
+			err = values.UnmarshalFormat(kv.GetValue(), idxFormat)
+			if err != nil {
+				return fmt.Errorf("error decoding value of key %s: %s", k.String(), err)
+			}
+			out := Key{Type: k.RecType.String(), Key: k.DataString(), Values: make([]Value, len(values))}
+			for i, v := range values {
+				out.Values[i] = Value{
+					PathIdx: v.PathIdx,
+					File:    common.PcapFileName(base, int(v.PathIdx), compression),
+					Offset:  v.Offset,
+				}
+			}
+			err = write(out)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return stream.Orchestrate(ctx)
+}
@@ -0,0 +1,171 @@
+package gen
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/rs/zerolog/log"
+
+	"code.ornl.gov/situ/mercury/common"
+)
+
+// Flow distributions.
+const (
+	DistUniform = "uniform"
+	DistZipf    = "zipf"
+)
+
+// Options are the synthetic traffic settings.
+type Options struct {
+	// File is the pcap file to write.
+	File string
+	// Packets is the number of packets to generate.
+	Packets int
+	// Flows is the number of distinct 5-tuple flows the packets belong to.
+	Flows int
+	// Hosts is the number of distinct IPv4 (and MAC) addresses.
+	Hosts int
+	// UDPRatio is the fraction of flows that are UDP, the rest are TCP.
+	UDPRatio float64
+	// PayloadSize is the number of payload bytes in each packet.
+	PayloadSize int
+	// Distribution of packets across flows, DistUniform or DistZipf.
+	Distribution string
+	// Start is the timestamp of the first packet.
+	Start time.Time
+	// Rate is the number of packets per second of (packet) time.
+	Rate int
+	// Seed for the random number generator, so runs can be reproduced.
+	Seed int64
+}
+
+type flow struct {
+	srcMAC, dstMAC   net.HardwareAddr
+	srcIP, dstIP     net.IP
+	srcPort, dstPort uint16
+	udp              bool
+}
+
+// Run writes a pcap file of synthetic Ethernet/IPv4 TCP and UDP traffic
+// that can be ingested with `capture --file` for benchmarking.
+func Run(o Options) error {
+	if o.Packets < 1 || o.Flows < 1 || o.Hosts < 2 || o.Rate < 1 {
+		return fmt.Errorf("packets, flows and rate must be at least 1 and hosts at least 2")
+	}
+	logger := log.With().Str("component", "gen").Str("file", o.File).Logger()
+
+	r := rand.New(rand.NewSource(o.Seed))
+	var zipf *rand.Zipf
+	switch o.Distribution {
+	case DistUniform:
+	case DistZipf:
+		zipf = rand.NewZipf(r, 1.1, 1, uint64(o.Flows-1))
+	default:
+		return fmt.Errorf("unknown distribution %s", o.Distribution)
+	}
+
+	flows := make([]flow, o.Flows)
+	for i := range flows {
+		s := r.Intn(o.Hosts)
+		d := (s + 1 + r.Intn(o.Hosts-1)) % o.Hosts
+		flows[i] = flow{
+			srcMAC:  hostMAC(s),
+			dstMAC:  hostMAC(d),
+			srcIP:   hostIP(s),
+			dstIP:   hostIP(d),
+			srcPort: uint16(1024 + r.Intn(64511)),
+			dstPort: uint16(1 + r.Intn(1023)),
+			udp:     r.Float64() < o.UDPRatio,
+		}
+	}
+
+	f, err := os.Create(o.File)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %s", o.File, err)
+	}
+	defer f.Close()
+	w := pcapgo.NewWriter(f)
+	err = w.WriteFileHeader(uint32(common.SnapLen), layers.LinkTypeEthernet)
+	if err != nil {
+		return fmt.Errorf("error writing file header: %s", err)
+	}
+
+	payload := make([]byte, o.PayloadSize)
+	r.Read(payload)
+	buf := gopacket.NewSerializeBuffer()
+	serializeOpts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	interval := time.Second / time.Duration(o.Rate)
+
+	for i := 0; i < o.Packets; i++ {
+		var fl flow
+		if zipf != nil {
+			fl = flows[zipf.Uint64()]
+		} else {
+			fl = flows[r.Intn(len(flows))]
+		}
+		err = serializeFlowPacket(buf, serializeOpts, fl, payload)
+		if err != nil {
+			return fmt.Errorf("error creating packet: %s", err)
+		}
+		data := buf.Bytes()
+		ci := gopacket.CaptureInfo{
+			Timestamp:     o.Start.Add(time.Duration(i) * interval),
+			CaptureLength: len(data),
+			Length:        len(data),
+		}
+		err = w.WritePacket(ci, data)
+		if err != nil {
+			return fmt.Errorf("error writing packet: %s", err)
+		}
+	}
+
+	logger.Info().
+		Int("packets", o.Packets).
+		Int("flows", o.Flows).
+		Int("hosts", o.Hosts).
+		Str("distribution", o.Distribution).
+		Msg("generated synthetic pcap")
+	return nil
+}
+
+func serializeFlowPacket(buf gopacket.SerializeBuffer, opts gopacket.SerializeOptions, fl flow, payload []byte) error {
+	eth := &layers.Ethernet{
+		SrcMAC:       fl.srcMAC,
+		DstMAC:       fl.dstMAC,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version: 4,
+		TTL:     64,
+		SrcIP:   fl.srcIP,
+		DstIP:   fl.dstIP,
+	}
+	if fl.udp {
+		ip.Protocol = layers.IPProtocolUDP
+		udp := &layers.UDP{SrcPort: layers.UDPPort(fl.srcPort), DstPort: layers.UDPPort(fl.dstPort)}
+		udp.SetNetworkLayerForChecksum(ip)
+		return gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload(payload))
+	}
+	ip.Protocol = layers.IPProtocolTCP
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(fl.srcPort), DstPort: layers.TCPPort(fl.dstPort), ACK: true, PSH: true, Window: 65535}
+	tcp.SetNetworkLayerForChecksum(ip)
+	return gopacket.SerializeLayers(buf, opts, eth, ip, tcp, gopacket.Payload(payload))
+}
+
+// hostIP returns the address of host n in 10.0.0.0/8.
+func hostIP(n int) net.IP {
+	n++
+	return net.IPv4(10, byte(n>>16), byte(n>>8), byte(n)).To4()
+}
+
+// hostMAC returns a locally administered MAC address for host n.
+func hostMAC(n int) net.HardwareAddr {
+	n++
+	return net.HardwareAddr{0x02, 0x00, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+}
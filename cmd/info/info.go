@@ -1,10 +1,14 @@
 package info
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/dgraph-io/badger/v2"
@@ -14,9 +18,65 @@ import (
 
 	"code.ornl.gov/situ/mercury/common"
 	"code.ornl.gov/situ/mercury/index"
+	"code.ornl.gov/situ/mercury/search"
 )
 
-func Get(basePath string, showKeys bool) (err error) {
+// indexInfo is the information about an index that Get prints.
+type indexInfo struct {
+	Label         string      `json:"label"`
+	Index         string      `json:"index"`
+	LSMSize       int64       `json:"lsm_size"`
+	VlogSize      int64       `json:"vlog_size"`
+	TotalSize     int64       `json:"total_size"`
+	Tables        []tableInfo `json:"tables"`
+	FormatVersion uint16      `json:"format_version"`
+	Interfaces    []string    `json:"interfaces,omitempty"`
+	InterfaceKeys []keyCount  `json:"interface_keys,omitempty"`
+	Stats         *statsInfo  `json:"stats,omitempty"`
+}
+
+// tableInfo is the number of keys of a table of an index database.
+type tableInfo struct {
+	ID   uint64 `json:"id"`
+	Keys uint64 `json:"keys"`
+}
+
+// statsInfo is the summary stored when an index was written, with the
+// distinct keys of each record type by name.
+type statsInfo struct {
+	Keys        uint64            `json:"keys"`
+	KeyCounts   map[string]uint64 `json:"key_counts"`
+	Values      uint64            `json:"values"`
+	AvgValueLen float64           `json:"avg_value_len"`
+
+	types []index.RecordType
+}
+
+// keyCount is the number of packets of a unique key.
+type keyCount struct {
+	Key     string `json:"key"`
+	Packets int    `json:"packets"`
+}
+
+// KeyOptions select the unique keys that Get prints.
+type KeyOptions struct {
+	// Show prints the unique keys, summed across the indices.
+	Show bool
+	// MinPackets only prints the keys with at least this many packets.
+	MinPackets int
+	// Top only prints the keys of each record type with the most packets,
+	// busiest first, if it is not 0.
+	Top int
+	// Packets prints the number of packets of each key.
+	Packets bool
+}
+
+// Get prints information about each index in basePath. If keyOpts.Show
+// is true, the number of unique keys of each record type and the keys
+// themselves are also printed. If jsonOut is true the output is a JSON
+// object with the indices and the unique keys grouped by record type. The
+// indices are opened with opts.
+func Get(basePath string, opts search.Options, keyOpts KeyOptions, jsonOut bool) (err error) {
 	logger := log.With().Str("component", "info").Str("index-base-path", basePath).Logger()
 
 	labelDirs, err := ioutil.ReadDir(basePath)
@@ -24,7 +84,8 @@ func Get(basePath string, showKeys bool) (err error) {
 		return err
 	}
 
-	keyMap := make(map[string]struct{})
+	keyMap := make(map[index.RecordType]map[string]int)
+	infos := make([]*indexInfo, 0)
 
 	// Loop through all of the labels in the basePath.
 	for _, label := range labelDirs {
@@ -34,68 +95,250 @@ func Get(basePath string, showKeys bool) (err error) {
 
 		// Loop through all of the indices in each of the labels.
 		labelDir := path.Join(basePath, label.Name())
-		dirs, err := ioutil.ReadDir(labelDir)
+		indices, err := search.GetIndexPaths(labelDir, time.Time{}, search.MaxTime)
 		if err != nil {
 			return err
 		}
-		for _, d := range dirs {
-			if !d.IsDir() {
-				continue
-			}
-
-			idxPath := path.Join(labelDir, d.Name())
-			fmt.Printf("Index: %s:\n", idxPath)
+		for _, indexName := range indices {
+			idxPath := path.Join(labelDir, indexName)
 
 			var db *badger.DB
-			opts := badger.DefaultOptions(idxPath).WithReadOnly(true).WithLogger(&common.BadgerLogger{Logger: logger})
-			db, err = badger.Open(opts)
+			dbOpts := badger.DefaultOptions(idxPath).WithReadOnly(true).WithLogger(&common.BadgerLogger{Logger: logger}).WithEncryptionKey(opts.EncryptionKey)
+			db, err = search.OpenDB(dbOpts)
 			if err != nil {
 				return err
 			}
 			defer db.Close()
 
-			lsm, vlog := db.Size()
-			total := lsm + vlog
-			fmt.Printf("Database size (bytes): %d (lsm) / %d (vlog) / %d (total)\n", lsm, vlog, total)
-			tables := db.Tables(true)
-			for _, table := range tables {
-				fmt.Printf("Table (%d) total keys: %d\n", table.ID, table.KeyCount)
+			info, err := getIndexInfo(idxPath, db)
+			if err != nil {
+				return err
+			}
+			info.Label = label.Name()
+			if !jsonOut {
+				info.print()
 			}
+			infos = append(infos, info)
 
-			if showKeys {
-				dbKeyMap, err := uniqueKeys(db)
+			if keyOpts.Show {
+				err = uniqueKeys(db, keyMap)
 				if err != nil {
 					return err
 				}
-				for k := range dbKeyMap {
-					if _, ok := keyMap[k]; !ok {
-						keyMap[k] = struct{}{}
-					}
-				}
 			}
-			fmt.Println()
 		}
 	}
 
-	if showKeys {
-		keys := make([]string, 0)
-		for k := range keyMap {
-			keys = append(keys, k)
+	keys := make(map[string][]keyCount)
+	// keyCounts is the number of keys of each record type with at least
+	// MinPackets packets, including those not in the top keys.
+	keyCounts := make(map[string]int)
+	types := make([]index.RecordType, 0, len(keyMap))
+	var total int
+	for t, counts := range keyMap {
+		name := t.String()
+		for k, count := range counts {
+			if count < keyOpts.MinPackets {
+				continue
+			}
+			keys[name] = append(keys[name], keyCount{Key: k, Packets: count})
 		}
-		sort.Strings(keys)
-		fmt.Printf("Unique Keys (%d)\n", len(keys))
-		for _, key := range keys {
-			fmt.Println(key)
+		if len(keys[name]) == 0 {
+			continue
+		}
+		keyCounts[name] = len(keys[name])
+		total += len(keys[name])
+		types = append(types, t)
+		sortKeys(keys[name], keyOpts.Top > 0)
+		if keyOpts.Top > 0 && len(keys[name]) > keyOpts.Top {
+			keys[name] = keys[name][:keyOpts.Top]
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].String() < types[j].String() })
+
+	if jsonOut {
+		doc := struct {
+			Indices   []*indexInfo          `json:"indices"`
+			KeyCounts map[string]int        `json:"key_counts,omitempty"`
+			Keys      map[string][]keyCount `json:"keys,omitempty"`
+		}{Indices: infos, KeyCounts: keyCounts, Keys: keys}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+	if keyOpts.Show {
+		fmt.Printf("Unique Keys (%d)\n", total)
+		for _, t := range types {
+			fmt.Printf("  %s: %d\n", t, keyCounts[t.String()])
+		}
+		for _, t := range types {
+			for _, k := range keys[t.String()] {
+				if keyOpts.Packets || keyOpts.Top > 0 {
+					fmt.Printf("%s: %s (%d packets)\n", t, k.Key, k.Packets)
+					continue
+				}
+				fmt.Printf("%s: %s\n", t, k.Key)
+			}
 		}
 	}
 
 	return
 }
 
-// Using badger stream API, get a map of all unique keys.
-func uniqueKeys(db *badger.DB) (map[string]struct{}, error) {
+// sortKeys sorts keys by key, or busiest first (then by key) if byPackets
+// is true.
+func sortKeys(keys []keyCount, byPackets bool) {
+	sort.Slice(keys, func(i, j int) bool {
+		if byPackets && keys[i].Packets != keys[j].Packets {
+			return keys[i].Packets > keys[j].Packets
+		}
+		return keys[i].Key < keys[j].Key
+	})
+}
+
+// getIndexInfo returns the information about an index.
+func getIndexInfo(idxPath string, db *badger.DB) (*indexInfo, error) {
+	info := &indexInfo{Index: idxPath, Tables: make([]tableInfo, 0)}
+	info.LSMSize, info.VlogSize = db.Size()
+	info.TotalSize = info.LSMSize + info.VlogSize
+	for _, table := range db.Tables(true) {
+		info.Tables = append(info.Tables, tableInfo{ID: table.ID, Keys: table.KeyCount})
+	}
+
+	var format index.Format
+	var interfaces, stats []byte
+	err := db.View(func(txn *badger.Txn) (err error) {
+		format, err = search.GetFormat(txn)
+		if err != nil {
+			return err
+		}
+		interfaces, err = search.GetMeta(txn, index.MetaInterface)
+		if err != nil {
+			return err
+		}
+		info.InterfaceKeys, err = interfaceKeys(txn, format)
+		if err != nil {
+			return err
+		}
+		stats, err = search.GetMeta(txn, index.MetaStats)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	info.FormatVersion = format.Version
+	// Indices of pcap files do not have any interfaces.
+	if len(interfaces) > 0 {
+		info.Interfaces = strings.Split(string(interfaces), ",")
+	}
+	// Older indices do not have stats.
+	if stats != nil {
+		info.Stats, err = newStatsInfo(stats)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// interfaceKeys returns the interface keys of an index and their number of
+// packets, by name. Indices of pcap files and indices written before
+// interfaces were indexed do not have any.
+func interfaceKeys(txn *badger.Txn, format index.Format) ([]keyCount, error) {
+	prefix := []byte{byte(index.InterfaceType)}
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var keys []keyCount
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		var k index.Key
+		err := k.UnmarshalBinary(item.Key())
+		if err != nil {
+			return nil, fmt.Errorf("error decoding key: %s", err)
+		}
+		err = item.Value(func(val []byte) error {
+			n, err := format.Count(val)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, keyCount{Key: k.DataString(), Packets: n})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error decoding value of key %s: %s", k.String(), err)
+		}
+	}
+	return keys, nil
+}
+
+func newStatsInfo(b []byte) (*statsInfo, error) {
+	stats := index.NewStats()
+	err := json.Unmarshal(b, stats)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode index stats: %s", err)
+	}
+	s := &statsInfo{
+		Keys:        stats.Keys(),
+		KeyCounts:   make(map[string]uint64),
+		Values:      stats.Values,
+		AvgValueLen: stats.AvgValueLen(),
+	}
+	for t, n := range stats.KeyCounts {
+		s.KeyCounts[t.String()] = n
+		s.types = append(s.types, t)
+	}
+	sort.Slice(s.types, func(i, j int) bool { return s.types[i] < s.types[j] })
+	return s, nil
+}
+
+// print prints the information about an index as text.
+func (info *indexInfo) print() {
+	fmt.Printf("Index: %s:\n", info.Index)
+	fmt.Printf("Database size (bytes): %d (lsm) / %d (vlog) / %d (total)\n", info.LSMSize, info.VlogSize, info.TotalSize)
+	for _, table := range info.Tables {
+		fmt.Printf("Table (%d) total keys: %d\n", table.ID, table.Keys)
+	}
+	// The format limits the size of the pcap files of indices written
+	// by older versions.
+	offsets := "varint offsets"
+	switch info.FormatVersion {
+	case index.FormatVersion1:
+		offsets = "32-bit offsets, pcap files up to 4GB"
+	case index.FormatVersion2:
+		offsets = "varint offsets, packet metadata without VLAN IDs"
+	}
+	fmt.Printf("Format version: %d (%s)\n", info.FormatVersion, offsets)
+	if len(info.Interfaces) > 0 {
+		fmt.Printf("Interfaces: %s\n", strings.Join(info.Interfaces, ", "))
+	}
+	for _, k := range info.InterfaceKeys {
+		fmt.Printf("%s: %s (%d packets)\n", index.InterfaceType, k.Key, k.Packets)
+	}
+	if s := info.Stats; s != nil {
+		fmt.Printf("Distinct keys: %d\n", s.Keys)
+		for _, t := range s.types {
+			fmt.Printf("  %s: %d\n", t, s.KeyCounts[t.String()])
+		}
+		fmt.Printf("Value elements: %d (average %.1f per key)\n", s.Values, s.AvgValueLen)
+	}
+	fmt.Println()
+}
+
+// Using badger stream API, add the number of packets (value elements) of
+// each unique key of an index to keyMap, by record type.
+func uniqueKeys(db *badger.DB, keyMap map[index.RecordType]map[string]int) error {
+	var format index.Format
+	err := db.View(func(txn *badger.Txn) (err error) {
+		format, err = search.GetFormat(txn)
+		return err
+	})
+	if err != nil {
+		return err
+	}
 	stream := db.NewStream()
-	keyMap := make(map[string]struct{})
 	stream.Send = func(list *pb.KVList) error {
 		for _, kv := range list.GetKv() {
 			var k index.Key
@@ -103,17 +346,172 @@ func uniqueKeys(db *badger.DB) (map[string]struct{}, error) {
 			if err != nil {
 				return err
 			}
-			keyMap[string(k.String())] = struct{}{}
+			if k.RecType == index.MetaType {
+				continue
+			}
+			n, err := format.Count(kv.GetValue())
+			if err != nil {
+				return fmt.Errorf("error decoding value of key %s: %s", k.String(), err)
+			}
+			if keyMap[k.RecType] == nil {
+				keyMap[k.RecType] = make(map[string]int)
+			}
+			keyMap[k.RecType][k.DataString()] += n
 		}
 		return nil
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	err := stream.Orchestrate(ctx)
+	return stream.Orchestrate(ctx)
+}
+
+// Protocols prints the number of packets of each IP protocol for each
+// label in basePath, from the protocol keys of its indices rather than by
+// reading the packets. If jsonOut is true the output is a JSON object of
+// labels to protocol counts.
+func Protocols(basePath string, opts search.Options, jsonOut bool) error {
+	labelDirs, err := ioutil.ReadDir(basePath)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return keyMap, nil
+	labels := make(map[string][]search.ProtocolCount)
+	names := make([]string, 0, len(labelDirs))
+	for _, label := range labelDirs {
+		if !label.IsDir() {
+			continue
+		}
+		labelDir := path.Join(basePath, label.Name())
+		indices, err := search.GetIndexPaths(labelDir, time.Time{}, search.MaxTime)
+		if err != nil {
+			return err
+		}
+		counts := make(map[uint8]uint64)
+		for _, indexName := range indices {
+			db, release, err := opts.Open(path.Join(labelDir, indexName))
+			if err != nil {
+				return err
+			}
+			err = search.AddProtocolCounts(db, counts)
+			release()
+			if err != nil {
+				return err
+			}
+		}
+		labels[label.Name()] = search.SortProtocolCounts(counts)
+		names = append(names, label.Name())
+	}
+
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(labels)
+	}
+	for _, name := range names {
+		fmt.Printf("Label: %s\n", name)
+		for _, p := range labels[name] {
+			fmt.Printf("  %s (%d): %d\n", p.Name, p.Number, p.Packets)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// configRange is a run of consecutive indices in a label written with the
+// same capture configuration.
+type configRange struct {
+	FirstIndex string                `json:"first_index"`
+	LastIndex  string                `json:"last_index"`
+	Indices    int                   `json:"indices"`
+	Config     *common.CaptureConfig `json:"config"`
+
+	raw []byte
+}
+
+// Config prints the capture configuration stored in the indices of each
+// label in basePath, once for each run of indices written with the same
+// configuration. Indices written before the configuration was stored
+// have a null configuration. If jsonOut is true the output is a JSON
+// object of labels to configuration ranges.
+func Config(basePath string, opts search.Options, jsonOut bool) error {
+	labelDirs, err := ioutil.ReadDir(basePath)
+	if err != nil {
+		return err
+	}
+
+	labels := make(map[string][]*configRange)
+	names := make([]string, 0, len(labelDirs))
+	for _, label := range labelDirs {
+		if !label.IsDir() {
+			continue
+		}
+		labelDir := path.Join(basePath, label.Name())
+		indices, err := search.GetIndexPaths(labelDir, time.Time{}, search.MaxTime)
+		if err != nil {
+			return err
+		}
+		var ranges []*configRange
+		for _, indexName := range indices {
+			raw, err := indexConfig(path.Join(labelDir, indexName), opts)
+			if err != nil {
+				return err
+			}
+			if n := len(ranges); n > 0 && bytes.Equal(ranges[n-1].raw, raw) {
+				ranges[n-1].LastIndex = indexName
+				ranges[n-1].Indices++
+				continue
+			}
+			r := &configRange{FirstIndex: indexName, LastIndex: indexName, Indices: 1, raw: raw}
+			if raw != nil {
+				r.Config = &common.CaptureConfig{}
+				err = json.Unmarshal(raw, r.Config)
+				if err != nil {
+					return fmt.Errorf("unable to decode capture config of %s: %s", path.Join(labelDir, indexName), err)
+				}
+			}
+			ranges = append(ranges, r)
+		}
+		labels[label.Name()] = ranges
+		names = append(names, label.Name())
+	}
+
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(labels)
+	}
+	for _, name := range names {
+		fmt.Printf("Label: %s\n", name)
+		for _, r := range labels[name] {
+			fmt.Printf("Indices %s - %s (%d):\n", r.FirstIndex, r.LastIndex, r.Indices)
+			if r.Config == nil {
+				fmt.Println("  no stored configuration")
+				continue
+			}
+			b, err := json.MarshalIndent(r.Config, "  ", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Printf("  %s\n", b)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// indexConfig returns the JSON capture configuration stored in an index,
+// or nil if there is none.
+func indexConfig(dbPath string, opts search.Options) ([]byte, error) {
+	db, release, err := opts.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	var raw []byte
+	err = db.View(func(txn *badger.Txn) error {
+		raw, err = search.GetMeta(txn, index.MetaConfig)
+		return err
+	})
+	return raw, err
 }
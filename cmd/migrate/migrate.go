@@ -0,0 +1,199 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/index"
+	"code.ornl.gov/situ/mercury/search"
+)
+
+// Run rewrites the indices of every label in indexBasePath (or only of
+// label, if it is not empty) that were written in an older format to the
+// current index.FormatVersion, and prints each one. The pcap files are not
+// changed. With dryRun the indices are only listed. Encrypted indices are
+// read with encryptionKey and the rewritten indices are encrypted with it,
+// unless it is nil.
+func Run(indexBasePath, label string, dryRun bool, encryptionKey []byte) error {
+	logger := log.With().Str("component", "migrate").Bool("dry-run", dryRun).Logger()
+
+	var labels []string
+	if label != "" {
+		labels = []string{label}
+	} else {
+		labelDirs, err := ioutil.ReadDir(indexBasePath)
+		if err != nil {
+			return err
+		}
+		for _, d := range labelDirs {
+			if d.IsDir() {
+				labels = append(labels, d.Name())
+			}
+		}
+	}
+
+	var migrated, current int
+	for _, l := range labels {
+		labelDir := path.Join(indexBasePath, l)
+		indices, err := search.GetIndexPaths(labelDir, time.Time{}, search.MaxTime)
+		if err != nil {
+			return err
+		}
+		for _, indexName := range indices {
+			idxPath := path.Join(labelDir, indexName)
+			version, err := migrateIndex(idxPath, dryRun, encryptionKey, logger)
+			if err != nil {
+				return fmt.Errorf("error migrating index %s: %s", idxPath, err)
+			}
+			if version == index.FormatVersion {
+				current++
+				continue
+			}
+			fmt.Printf("%s: format version %d -> %d\n", idxPath, version, index.FormatVersion)
+			migrated++
+		}
+	}
+
+	verb := "Migrated"
+	if dryRun {
+		verb = "Would migrate"
+	}
+	fmt.Printf("%s %d indices, %d already at format version %d\n", verb, migrated, current, index.FormatVersion)
+	logger.Info().Int("migrated", migrated).Int("current", current).Msg("migrated indices")
+	return nil
+}
+
+// migrateIndex returns the format version of an index and, if it is older
+// than the current one, rewrites it. The new index is written next to the
+// old one and renamed into place once it is complete, so an interrupted
+// migration leaves the old index.
+func migrateIndex(idxPath string, dryRun bool, encryptionKey []byte, logger zerolog.Logger) (uint16, error) {
+	opts := badger.DefaultOptions(idxPath).WithReadOnly(true).WithLogger(&common.BadgerLogger{Logger: logger}).WithEncryptionKey(encryptionKey)
+	db, err := search.OpenDB(opts)
+	if err != nil {
+		return 0, err
+	}
+	var format index.Format
+	var dropMeta bool
+	err = db.View(func(txn *badger.Txn) (err error) {
+		format, err = search.GetFormat(txn)
+		if err != nil {
+			return err
+		}
+		dropMeta, err = search.LacksVLANMeta(txn)
+		return err
+	})
+	if err != nil || format.Version == index.FormatVersion || dryRun {
+		db.Close()
+		return format.Version, err
+	}
+
+	tmpPath := idxPath + ".tmp"
+	err = os.RemoveAll(tmpPath)
+	if err == nil {
+		err = rewrite(db, format, dropMeta, tmpPath, encryptionKey, logger)
+	}
+	db.Close()
+	if err != nil {
+		os.RemoveAll(tmpPath)
+		return 0, err
+	}
+
+	// The query side only opens directories with the index suffix, so it
+	// never opens the new index before it is complete.
+	oldPath := idxPath + ".old"
+	err = os.Rename(idxPath, oldPath)
+	if err != nil {
+		return 0, err
+	}
+	err = os.Rename(tmpPath, idxPath)
+	if err != nil {
+		return 0, err
+	}
+	return format.Version, os.RemoveAll(oldPath)
+}
+
+// rewrite copies the keys of db to a new index at dbPath with the values
+// encoded in the current format version, encrypted with encryptionKey
+// unless it is nil. With dropMeta the packet metadata is not copied, for
+// indices with VLAN keys whose metadata does not have the VLAN IDs, so
+// their queries read the packets instead.
+func rewrite(db *badger.DB, format index.Format, dropMeta bool, dbPath string, encryptionKey []byte, logger zerolog.Logger) (err error) {
+	opts := badger.DefaultOptions(dbPath).WithLogger(&common.BadgerLogger{Logger: logger}).WithSyncWrites(false).WithEncryptionKey(encryptionKey)
+	out, err := badger.Open(opts)
+	if err != nil {
+		return err
+	}
+	// Closing flushes the writes, so the index is only complete if it
+	// succeeds.
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	wb := out.NewWriteBatch()
+	defer wb.Cancel()
+
+	versionKey, _ := index.NewMetaKey(index.MetaFormatVersion).MarshalBinary()
+	packetMetaKey, _ := index.NewMetaKey(index.MetaPacketMeta).MarshalBinary()
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			k := item.KeyCopy(nil)
+			if bytes.Equal(k, versionKey) || dropMeta && bytes.Equal(k, packetMetaKey) {
+				continue
+			}
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			var key index.Key
+			err = key.UnmarshalBinary(k)
+			if err != nil {
+				return err
+			}
+			if key.RecType != index.MetaType {
+				var value index.Value
+				err = value.UnmarshalFormat(v, format)
+				if err != nil {
+					return fmt.Errorf("error decoding value of key %s: %s", key.String(), err)
+				}
+				if dropMeta {
+					for _, elem := range value {
+						elem.Meta = nil
+					}
+				}
+				v, _ = value.MarshalBinary()
+			}
+			err = wb.Set(k, v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	version := make([]byte, 2)
+	binary.LittleEndian.PutUint16(version, index.FormatVersion)
+	err = wb.Set(versionKey, version)
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
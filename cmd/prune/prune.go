@@ -0,0 +1,162 @@
+package prune
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/search"
+)
+
+// Run deletes the indices of every label in indexBasePath and the pcap
+// files in pcapPaths (with their checksum sidecars) whose packets are all
+// older than olderThan, i.e. whose file name time is more than
+// common.MaxPcapFileTime before the cutoff. Each deleted path is printed
+// with its size, followed by the total. With dryRun nothing is deleted.
+func Run(indexBasePath string, pcapPaths []string, olderThan time.Duration, dryRun bool) error {
+	if olderThan <= 0 {
+		return fmt.Errorf("the age of the captures to delete must be greater than 0")
+	}
+	cutoff := time.Now().Add(-olderThan)
+	logger := log.With().Str("component", "prune").Time("cutoff", cutoff).Bool("dry-run", dryRun).Logger()
+
+	p := &pruner{dryRun: dryRun}
+	labelDirs, err := ioutil.ReadDir(indexBasePath)
+	if err != nil {
+		return err
+	}
+	for _, label := range labelDirs {
+		if !label.IsDir() {
+			continue
+		}
+		labelDir := path.Join(indexBasePath, label.Name())
+		// An index has the packets of at most MaxPcapFileTime from the
+		// time in its name, so these indices are entirely before the
+		// cutoff.
+		indices, err := search.GetIndexPaths(labelDir, time.Time{}, cutoff.Add(-common.MaxPcapFileTime))
+		if err != nil {
+			return err
+		}
+		for _, indexName := range indices {
+			err = p.remove(labelDir, indexName)
+			if err != nil {
+				return err
+			}
+			p.indices++
+		}
+	}
+
+	for _, pcapPath := range pcapPaths {
+		// Walk the pcap path so files in date partition directories are
+		// deleted too. Pcap files are deleted by their own name, so the
+		// files of indices that were already deleted (or never written)
+		// are deleted as well.
+		var files []string
+		err := filepath.Walk(pcapPath, func(file string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if f.IsDir() {
+				return nil
+			}
+			t, ok := pcapFileTime(f.Name())
+			if ok && t.Add(common.MaxPcapFileTime).Before(cutoff) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			rel, err := filepath.Rel(pcapPath, file)
+			if err != nil {
+				return err
+			}
+			err = p.remove(pcapPath, rel)
+			if err != nil {
+				return err
+			}
+			if !strings.HasSuffix(file, "."+common.ChecksumSuffix) {
+				p.pcapFiles++
+			}
+		}
+	}
+
+	verb := "Freed"
+	if dryRun {
+		verb = "Would free"
+	}
+	fmt.Printf("%s %d bytes: %d %s and %d pcap %s\n", verb, p.bytes, p.indices, plural(p.indices, "index", "indices"), p.pcapFiles, plural(p.pcapFiles, "file", "files"))
+	logger.Info().
+		Int("indices", p.indices).
+		Int("pcap-files", p.pcapFiles).
+		Int64("bytes", p.bytes).
+		Msg("pruned captures")
+	return nil
+}
+
+// pruner deletes files and directories and counts what it deleted.
+type pruner struct {
+	dryRun    bool
+	indices   int
+	pcapFiles int
+	bytes     int64
+}
+
+// remove deletes the file or directory name (which may be in date
+// partition directories) in root and prints it with its size. Partition
+// directories that are left empty are deleted too.
+func (p *pruner) remove(root, name string) error {
+	file := path.Join(root, name)
+	size, err := common.DiskSize(file)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d bytes\n", file, size)
+	p.bytes += size
+	if p.dryRun {
+		return nil
+	}
+	err = os.RemoveAll(file)
+	if err != nil {
+		return fmt.Errorf("error deleting %s: %s", file, err)
+	}
+	common.RemoveEmptyDirs(root, name)
+	return nil
+}
+
+// pcapFileTime returns the time in the name of a pcap file (compressed or
+// not) or its checksum sidecar, e.g. `2006_01_02-15_04_05_0.pcap.gz`, or
+// false if it is not one.
+func pcapFileTime(name string) (time.Time, bool) {
+	name = strings.TrimSuffix(name, "."+common.ChecksumSuffix)
+	base, ok := common.TrimPcapSuffix(name)
+	if !ok {
+		return time.Time{}, false
+	}
+	// The pcap-path index follows the last underscore.
+	i := strings.LastIndex(base, "_")
+	if i < 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(common.GetFileTimeFormat(), base[:i])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
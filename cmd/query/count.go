@@ -0,0 +1,53 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"google.golang.org/grpc"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+)
+
+// checkCount returns an error if o has options that need the packets,
+// which a count does not read.
+func (o Options) checkCount() error {
+	switch {
+	case o.Binary || o.Out != "" || o.Reassemble != "":
+		return fmt.Errorf("--count cannot be used with --binary, --out or --reassemble")
+	case o.Follow:
+		return fmt.Errorf("--count is not supported with follow")
+	case o.Targets != "" || len(o.Pivots) > 0:
+		return fmt.Errorf("--count is not supported with --targets or --pivot")
+	case len(o.GroupBy) > 0:
+		return fmt.Errorf("--count cannot be used with --group-by")
+	case o.Cursor != "":
+		return fmt.Errorf("--count cannot be used with --cursor")
+	case o.Output == OutputJSON || o.Output == OutputCSV:
+		return fmt.Errorf("--count cannot be used with --output %s", o.Output)
+	case o.MinLen > 0 || o.MaxLen > 0:
+		return fmt.Errorf("--count cannot be used with --min-len or --max-len, which filter the packets")
+	}
+	return nil
+}
+
+// count gets the number of packets that match a query from the server.
+func (c *ClientConn) count(ctx context.Context, req *v1.QueryReq, opts []grpc.CallOption, o Options) error {
+	resp, err := c.client.Count(ctx, req, opts...)
+	if err != nil {
+		return err
+	}
+	writeCount(os.Stdout, resp, o.Quiet)
+	return nil
+}
+
+// writeCount writes the number of packets of a count to w, and a warning
+// to stderr unless quiet is set if it is approximate.
+func writeCount(w io.Writer, resp *v1.CountResp, quiet bool) {
+	fmt.Fprintln(w, resp.GetPackets())
+	if resp.GetApproximate() && !quiet {
+		fmt.Fprintln(os.Stderr, "The count includes packets outside of the time range in the indices at its ends, which do not store packet metadata.")
+	}
+}
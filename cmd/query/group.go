@@ -0,0 +1,106 @@
+package query
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+)
+
+// GroupByFields are the result fields that --group-by can count by.
+var GroupByFields = []string{"srcip", "dstip", "srcport", "dstport", "proto", "srcmac", "dstmac"}
+
+// groups counts the results of a query by the values of one or more
+// fields, for a table of counts instead of a line for each packet.
+type groups struct {
+	fields []string
+	counts map[string]*groupCount
+}
+
+type groupCount struct {
+	values  []string
+	packets int
+	bytes   int64
+}
+
+// newGroups returns nil if fields is empty, i.e. results are not grouped.
+func newGroups(fields []string) *groups {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &groups{
+		fields: fields,
+		counts: make(map[string]*groupCount),
+	}
+}
+
+// add counts a result under the values of its group by fields.
+func (g *groups) add(resp *v1.QueryResp) {
+	values := make([]string, len(g.fields))
+	for i, f := range g.fields {
+		values[i] = groupValue(resp, f)
+	}
+	key := strings.Join(values, "\t")
+	c, ok := g.counts[key]
+	if !ok {
+		c = &groupCount{values: values}
+		g.counts[key] = c
+	}
+	c.packets++
+	c.bytes += resp.GetLength()
+}
+
+// groupValue returns the value of a field of a result, "-" if it is not
+// set (e.g. the IP of an ARP packet).
+func groupValue(resp *v1.QueryResp, field string) string {
+	var v string
+	switch field {
+	case "srcip":
+		v = resp.GetSrcIP()
+	case "dstip":
+		v = resp.GetDstIP()
+	case "srcport":
+		v = strconv.Itoa(int(resp.GetSrcPort()))
+	case "dstport":
+		v = strconv.Itoa(int(resp.GetDstPort()))
+	case "proto":
+		v = resp.GetProto()
+	case "srcmac":
+		v = resp.GetSrcMAC()
+	case "dstmac":
+		v = resp.GetDstMAC()
+	}
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+// write writes a table of the groups, the one with the most packets first.
+func (g *groups) write(w io.Writer) error {
+	counts := make([]*groupCount, 0, len(g.counts))
+	for _, c := range g.counts {
+		counts = append(counts, c)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].packets != counts[j].packets {
+			return counts[i].packets > counts[j].packets
+		}
+		return strings.Join(counts[i].values, "\t") < strings.Join(counts[j].values, "\t")
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, len(g.fields))
+	for i, f := range g.fields {
+		header[i] = strings.ToUpper(f)
+	}
+	fmt.Fprintf(tw, "%s\tPACKETS\tBYTES\n", strings.Join(header, "\t"))
+	for _, c := range counts {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", strings.Join(c.values, "\t"), c.packets, c.bytes)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,202 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/gopacket"
+	"github.com/rs/zerolog/log"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/index"
+	"code.ornl.gov/situ/mercury/search"
+)
+
+// ExecuteLocal runs a query in-process against the index and pcap files,
+// without a server. The output is the same as Execute.
+func ExecuteLocal(ctx context.Context, indexPath string, pcapPaths []string, o Options) error {
+	if o.Verbose {
+		writeHeader(os.Stderr, o)
+	}
+	sum := newSummary()
+	err := executeLocal(ctx, indexPath, pcapPaths, o, sum)
+	if err == nil && !o.Quiet && !o.Count {
+		sum.write(os.Stderr)
+	}
+	if err == nil {
+		sum.writeCursor(os.Stderr)
+	}
+	return err
+}
+
+func executeLocal(ctx context.Context, indexPath string, pcapPaths []string, o Options, sum *summary) error {
+	if o.Follow {
+		return fmt.Errorf("follow is not supported for local queries")
+	}
+	if len(o.GroupBy) > 0 && o.Binary {
+		return fmt.Errorf("--group-by is not supported with binary output")
+	}
+	if o.Concurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+	if err := o.checkOutput(); err != nil {
+		return err
+	}
+	req, err := newRequest(o)
+	if err != nil {
+		return err
+	}
+	keylog, err := readKeylog(o.Keylog)
+	if err != nil {
+		return err
+	}
+
+	searchOpts := search.Options{EncryptionKey: o.EncryptionKey, Strict: o.Strict}
+	err = search.ValidatePcapPaths(indexPath, pcapPaths, searchOpts)
+	if err != nil {
+		return err
+	}
+	labelPath, indices, err := search.FindIndices(indexPath, req)
+	if err != nil {
+		return err
+	}
+	sum.indices = len(indices)
+
+	if o.Count {
+		if err := o.checkCount(); err != nil {
+			return err
+		}
+		packets, approximate, err := search.CountIndices(searchOpts.Open, labelPath, indices, pcapPaths, req)
+		if err != nil {
+			return err
+		}
+		writeCount(os.Stdout, &v1.CountResp{Packets: packets, Approximate: approximate}, o.Quiet)
+		return nil
+	}
+
+	if o.Timeout > 0 {
+		var cancelFunc context.CancelFunc
+		ctx, cancelFunc = context.WithTimeout(ctx, o.Timeout)
+		defer cancelFunc()
+	}
+
+	// outputClosed is set when the pager exits to stop the query.
+	var outputClosed bool
+	var send search.PacketFunc
+	var sendMeta search.MetaFunc
+	var out io.Writer
+	g := newGroups(o.GroupBy)
+	if !o.Binary {
+		var closeOut func()
+		out, closeOut = openOutput(o)
+		defer closeOut()
+		err := o.outputHeader(out)
+		if err != nil {
+			return outputError(out, err)
+		}
+		pf, err := openPcapFile(o.Out)
+		if err != nil {
+			return err
+		}
+		defer pf.Close()
+		ra, err := openReassembler(o.Reassemble)
+		if err != nil {
+			return err
+		}
+		defer ra.Close()
+		output := func(resp *v1.QueryResp) error {
+			if !o.inLengthRange(resp) {
+				return nil
+			}
+			if g != nil {
+				g.add(resp)
+			} else if err := o.outputResult(out, resp, ""); err != nil {
+				if err = outputError(out, err); err == nil {
+					outputClosed = true
+					return fmt.Errorf("output closed")
+				}
+				return err
+			}
+			sum.add(resp.GetLength())
+			err = pf.Write(resp)
+			if err != nil {
+				return err
+			}
+			return ra.Write(resp)
+		}
+		send = func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			protoTs, err := ptypes.TimestampProto(ts)
+			if err != nil {
+				return fmt.Errorf("error converting timestamp %s for protobuf: %s", ts.String(), err)
+			}
+			return output(search.NewResp(protoTs, packetLen, packet, o.ShowAll, false, req.IncludeData))
+		}
+		// Summaries are read from the packet metadata of indices that
+		// have it.
+		if search.MetadataOnly(req) {
+			sendMeta = func(meta *index.PacketMeta, iface string) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				protoTs, err := ptypes.TimestampProto(meta.Timestamp)
+				if err != nil {
+					return fmt.Errorf("error converting timestamp %s for protobuf: %s", meta.Timestamp.String(), err)
+				}
+				return output(search.NewMetaResp(protoTs, meta, iface))
+			}
+		}
+	} else if req.BinaryFormat == v1.BinaryFormat_pcapng {
+		ng := search.NewPcapngWriter(os.Stdout)
+		if len(keylog) > 0 {
+			ng.AfterHeader = func(w io.Writer) error {
+				err := writeDecryptionSecrets(w, ngSecretsTypeTLSKeyLog, keylog)
+				if err != nil {
+					return fmt.Errorf("error writing pcapng decryption secrets: %s", err)
+				}
+				return nil
+			}
+		}
+		defer ng.Flush()
+		send = func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			sum.add(int64(len(packet.Data())))
+			return ng.WritePacket(packet)
+		}
+	} else {
+		// The header has the link type of the first packet.
+		output := search.NewPcapWriter(os.Stdout)
+		defer output.Flush()
+		send = func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			sum.add(int64(len(packet.Data())))
+			return output.WritePacket(packet)
+		}
+	}
+
+	log.Info().
+		Str("component", "query-local").
+		Str("index-path", labelPath).
+		Strs("pcap-paths", pcapPaths).
+		Msg("querying local files")
+
+	if sendMeta != nil {
+		sum.cursor, err = search.QueryIndicesMeta(searchOpts.Open, labelPath, indices, pcapPaths, req, searchOpts, 0, o.Concurrency, sendMeta)
+	} else {
+		sum.cursor, err = search.QueryIndices(searchOpts.Open, labelPath, indices, pcapPaths, req, searchOpts, 0, o.Concurrency, send)
+	}
+	if err != nil && (ctx.Err() == context.Canceled || outputClosed) {
+		return nil
+	}
+	return writeGroups(out, g, err)
+}
@@ -0,0 +1,157 @@
+package query
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+)
+
+// Output formats of the results of a text query, see Options.Output.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputCSV  = "csv"
+)
+
+// csvHeader is the header row of --output csv, which uses the names of the
+// JSON fields. Columns must not be reordered or renamed.
+var csvHeader = []string{"timestamp", "src_ip", "src_port", "dst_ip", "dst_port", "proto", "length"}
+
+// jsonResult is a query result written as a line of JSON (JSON Lines) with
+// --output json. The field names are part of the output format, so
+// existing fields must not be renamed. The fields without omitempty are in
+// every result, with their zero value if the packet does not have them
+// (e.g. the ports of an ICMP packet).
+type jsonResult struct {
+	// Target is the query argument of the result with --targets or
+	// --pivot.
+	Target    string    `json:"target,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Length    int64     `json:"length"`
+	Interface string    `json:"interface,omitempty"`
+	VLANs     []uint32  `json:"vlans,omitempty"`
+	SrcMAC    string    `json:"src_mac"`
+	DstMAC    string    `json:"dst_mac"`
+	SrcIP     string    `json:"src_ip"`
+	DstIP     string    `json:"dst_ip"`
+	IPv6      bool      `json:"ipv6"`
+	SrcPort   uint32    `json:"src_port"`
+	DstPort   uint32    `json:"dst_port"`
+	Proto     string    `json:"proto"`
+	Truncated bool      `json:"truncated"`
+	// Layers is the description of every decoded layer, only with
+	// --show-all.
+	Layers string `json:"layers,omitempty"`
+}
+
+// outputJSON writes a result as a line of JSON, with its target if it is
+// not empty.
+func outputJSON(w io.Writer, resp *v1.QueryResp, target string) error {
+	ts, err := ptypes.Timestamp(resp.GetTimestamp())
+	if err != nil {
+		return fmt.Errorf("invalid result timestamp: %s", err)
+	}
+	b, err := json.Marshal(&jsonResult{
+		Target:    target,
+		Timestamp: ts.UTC(),
+		Length:    resp.GetLength(),
+		Interface: resp.GetInterface(),
+		VLANs:     resp.GetVlan(),
+		SrcMAC:    resp.GetSrcMAC(),
+		DstMAC:    resp.GetDstMAC(),
+		SrcIP:     resp.GetSrcIP(),
+		DstIP:     resp.GetDstIP(),
+		IPv6:      resp.GetIpv6(),
+		SrcPort:   resp.GetSrcPort(),
+		DstPort:   resp.GetDstPort(),
+		Proto:     resp.GetProto(),
+		Truncated: resp.GetTruncated(),
+		Layers:    resp.GetText(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// outputCSV writes a result as a CSV row, after its target if it is not
+// empty.
+func outputCSV(w io.Writer, resp *v1.QueryResp, target string) error {
+	ts, err := ptypes.Timestamp(resp.GetTimestamp())
+	if err != nil {
+		return fmt.Errorf("invalid result timestamp: %s", err)
+	}
+	var row []string
+	if target != "" {
+		row = append(row, target)
+	}
+	row = append(row,
+		ts.UTC().Format(time.RFC3339Nano),
+		resp.GetSrcIP(),
+		strconv.FormatUint(uint64(resp.GetSrcPort()), 10),
+		resp.GetDstIP(),
+		strconv.FormatUint(uint64(resp.GetDstPort()), 10),
+		resp.GetProto(),
+		strconv.FormatInt(resp.GetLength(), 10),
+	)
+	return writeCSVRow(w, row)
+}
+
+func writeCSVRow(w io.Writer, row []string) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(row)
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// outputHeader writes the header row of the output format of o, if it has
+// one, before the results. The results of --targets and --pivot start
+// with a target column.
+func (o Options) outputHeader(w io.Writer) error {
+	if o.Output != OutputCSV {
+		return nil
+	}
+	header := csvHeader
+	if o.Targets != "" || len(o.Pivots) > 0 {
+		header = append([]string{"target"}, header...)
+	}
+	return writeCSVRow(w, header)
+}
+
+// outputResult writes a result in the output format of o, after its
+// target if it is not empty.
+func (o Options) outputResult(w io.Writer, resp *v1.QueryResp, target string) error {
+	switch o.Output {
+	case OutputJSON:
+		return outputJSON(w, resp, target)
+	case OutputCSV:
+		return outputCSV(w, resp, target)
+	}
+	if target != "" {
+		err := outputTarget(w, target, o.ShowAll)
+		if err != nil {
+			return err
+		}
+	}
+	return outputResponse(w, resp, o.ShowAll)
+}
+
+// checkOutput returns an error if the output format of o cannot be used
+// with its other options.
+func (o Options) checkOutput() error {
+	if (o.Output == OutputJSON || o.Output == OutputCSV) && (o.Binary || len(o.GroupBy) > 0) {
+		return fmt.Errorf("--output %s cannot be used with binary output or --group-by", o.Output)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package query
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// pager pipes output to a pager process.
+type pager struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+}
+
+// startPager starts $PAGER, or less if it is not set, with stdout and
+// stderr connected to the terminal.
+func startPager() (*pager, error) {
+	p := os.Getenv("PAGER")
+	if p == "" {
+		p = "less"
+	}
+	cmd := exec.Command("/bin/sh", "-c", p)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	// Like git, have less quit if the output fits on one screen and
+	// leave it on the screen.
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &pager{cmd: cmd, in: in}, nil
+}
+
+func (p *pager) Write(b []byte) (int, error) {
+	return p.in.Write(b)
+}
+
+// Close signals the end of output and waits for the user to quit the
+// pager.
+func (p *pager) Close() error {
+	p.in.Close()
+	return p.cmd.Wait()
+}
+
+// isTerminal returns true if the file is a terminal (character device).
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
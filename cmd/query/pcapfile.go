@@ -0,0 +1,93 @@
+package query
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/common"
+)
+
+// pcapFile writes the packet data of text responses to a pcap file so a
+// single query can produce both a summary and a pcap.
+type pcapFile struct {
+	f *os.File
+	// w is set once the file header is written, with the link type of
+	// the first response.
+	w        *pcapgo.Writer
+	linkType layers.LinkType
+}
+
+// openPcapFile creates the pcap file, or returns nil if name is empty.
+func openPcapFile(name string) (*pcapFile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create output file %s: %s", name, err)
+	}
+	return &pcapFile{f: f}, nil
+}
+
+func (p *pcapFile) writeHeader(linkType layers.LinkType) error {
+	w := pcapgo.NewWriter(p.f)
+	err := w.WriteFileHeader(uint32(common.SnapLen), linkType)
+	if err != nil {
+		return fmt.Errorf("error writing pcap file header to %s: %s", p.f.Name(), err)
+	}
+	p.w = w
+	p.linkType = linkType
+	return nil
+}
+
+// Write writes the packet data of a response.
+func (p *pcapFile) Write(resp *v1.QueryResp) error {
+	if p == nil {
+		return nil
+	}
+	linkType := layers.LinkType(resp.GetLinkType())
+	if p.w == nil {
+		if err := p.writeHeader(linkType); err != nil {
+			return err
+		}
+	}
+	if linkType != p.linkType {
+		return fmt.Errorf("unable to write packet to %s: packets have different link types (%s and %s), which pcap does not support", p.f.Name(), p.linkType, linkType)
+	}
+	ts, err := ptypes.Timestamp(resp.GetTimestamp())
+	if err != nil {
+		return err
+	}
+	data := resp.GetData()
+	ci := gopacket.CaptureInfo{
+		Timestamp:     ts,
+		CaptureLength: len(data),
+		Length:        len(data),
+	}
+	err = p.w.WritePacket(ci, data)
+	if err != nil {
+		return fmt.Errorf("error writing packet to %s: %s", p.f.Name(), err)
+	}
+	return nil
+}
+
+// Close closes the pcap file.
+func (p *pcapFile) Close() error {
+	if p == nil {
+		return nil
+	}
+	// A file without packets still needs a header.
+	if p.w == nil {
+		if err := p.writeHeader(layers.LinkTypeEthernet); err != nil {
+			p.f.Close()
+			return err
+		}
+	}
+	return p.f.Close()
+}
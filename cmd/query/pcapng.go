@@ -0,0 +1,86 @@
+package query
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// pcapng block constants.
+const (
+	ngBlockTypeSectionHeader     uint32 = 0x0A0D0D0A
+	ngBlockTypeEnhancedPacket    uint32 = 0x00000006
+	ngBlockTypeDecryptionSecrets uint32 = 0x0000000A
+	ngSecretsTypeTLSKeyLog       uint32 = 0x544c534b
+)
+
+// readKeylog reads a TLS key log file in the NSS format written by browsers
+// and other TLS libraries with SSLKEYLOGFILE, or returns nil if name is
+// empty.
+func readKeylog(name string) ([]byte, error) {
+	if name == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key log file %s: %s", name, err)
+	}
+	var secrets int
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// <label> <client random> <secret>
+		if len(strings.Fields(line)) != 3 {
+			return nil, fmt.Errorf("invalid key log file %s: line %d is not '<label> <client random> <secret>'", name, i+1)
+		}
+		secrets++
+	}
+	if secrets == 0 {
+		return nil, fmt.Errorf("key log file %s has no secrets", name)
+	}
+	if !bytes.HasSuffix(b, []byte("\n")) {
+		b = append(b, '\n')
+	}
+	return b, nil
+}
+
+// writeDecryptionSecrets writes a little endian pcapng Decryption Secrets
+// Block (without options).
+func writeDecryptionSecrets(w io.Writer, secretsType uint32, secrets []byte) error {
+	padding := (4 - len(secrets)&3) & 3
+	length := 20 + len(secrets) + padding
+	b := make([]byte, length)
+	binary.LittleEndian.PutUint32(b[0:], ngBlockTypeDecryptionSecrets)
+	binary.LittleEndian.PutUint32(b[4:], uint32(length))
+	binary.LittleEndian.PutUint32(b[8:], secretsType)
+	binary.LittleEndian.PutUint32(b[12:], uint32(len(secrets)))
+	copy(b[16:], secrets)
+	binary.LittleEndian.PutUint32(b[length-4:], uint32(length))
+	_, err := w.Write(b)
+	return err
+}
+
+// isPcapng returns true if b starts with a pcapng section header.
+func isPcapng(b []byte) bool {
+	return len(b) >= 4 && binary.LittleEndian.Uint32(b) == ngBlockTypeSectionHeader
+}
+
+// countPcapng counts the packets of the little endian pcapng blocks in b
+// (a response of a pcapng binary query, which only has whole blocks).
+func countPcapng(b []byte, sum *summary) {
+	for len(b) >= 12 {
+		length := binary.LittleEndian.Uint32(b[4:])
+		if length < 12 || int(length) > len(b) {
+			return
+		}
+		if binary.LittleEndian.Uint32(b) == ngBlockTypeEnhancedPacket && length >= 28 {
+			sum.add(int64(binary.LittleEndian.Uint32(b[20:])))
+		}
+		b = b[length:]
+	}
+}
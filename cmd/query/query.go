@@ -10,23 +10,33 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	v1 "code.ornl.gov/situ/mercury/api/v1"
 	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/filter"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
 )
 
 type ClientConn struct {
-	serverAddr string
-	ca         string
-	serverName string
-	conn       *grpc.ClientConn
-	client     v1.PacketServiceClient
+	serverAddr  string
+	ca          string
+	serverName  string
+	clientCert  string
+	clientKey   string
+	insecure    bool
+	token       string
+	dialTimeout time.Duration
+	keepalive   time.Duration
+	conn        *grpc.ClientConn
+	client      v1.PacketServiceClient
 }
 
 const (
@@ -34,16 +44,29 @@ const (
 	LongQueryTimeFormat  = time.RFC3339
 )
 
-func NewClientConn(serverAddr *net.TCPAddr, ca, name string) *ClientConn {
+// NewClientConn returns a connection to the query server at serverAddr,
+// which is verified with the certificate authority ca. One of ca or
+// insecure, which does not verify the server certificate at all, must be
+// set. If clientCert and clientKey
+// are not empty the client presents that certificate, and if token is not
+// empty it is sent as a bearer token with each request, for servers that
+// require them.
+func NewClientConn(serverAddr *net.TCPAddr, ca, name, clientCert, clientKey string, insecure bool, token string, dialTimeout, keepalive time.Duration) *ClientConn {
 	return &ClientConn{
-		serverAddr: serverAddr.String(),
-		ca:         ca,
-		serverName: name,
+		serverAddr:  serverAddr.String(),
+		ca:          ca,
+		serverName:  name,
+		clientCert:  clientCert,
+		clientKey:   clientKey,
+		insecure:    insecure,
+		token:       token,
+		dialTimeout: dialTimeout,
+		keepalive:   keepalive,
 	}
 }
 
 func (c *ClientConn) Open(mainCtx context.Context) error {
-	creds, err := loadCredentials(c.ca, c.serverAddr, c.serverName)
+	creds, err := loadCredentials(c.ca, c.serverAddr, c.serverName, c.clientCert, c.clientKey, c.insecure)
 	if err != nil {
 		return err
 	}
@@ -52,16 +75,30 @@ func (c *ClientConn) Open(mainCtx context.Context) error {
 		grpc.WithTransportCredentials(creds),
 		grpc.WithBlock(),
 		grpc.FailOnNonTempDialError(true),
+		// Report why the connection failed (e.g. a certificate that does
+		// not verify) rather than only the dial timeout.
+		grpc.WithReturnConnectionError(),
 		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(common.GRPCMaxSize), grpc.MaxCallSendMsgSize(common.GRPCMaxSize)),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                c.keepalive,
+			Timeout:             common.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+	}
+	if c.token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(c.token)))
 	}
 
-	timeout := 10 * time.Second
+	timeout := c.dialTimeout
 
 	log.Info().
 		Str("server-address", c.serverAddr).
 		Str("ca-file", c.ca).
 		Str("server-name-override", c.serverName).
+		Str("client-cert-file", c.clientCert).
+		Bool("token", c.token != "").
 		Dur("timeout", timeout).
+		Dur("keepalive", c.keepalive).
 		Msg("opening client connection")
 
 	ctx, cancelFunc := context.WithTimeout(mainCtx, timeout)
@@ -76,42 +113,403 @@ func (c *ClientConn) Open(mainCtx context.Context) error {
 	return nil
 }
 
-func (c *ClientConn) Execute(mainCtx context.Context, label, start string, duration time.Duration, queryType, queryArg string, binOut, showAll bool) error {
+// Options are the query settings from the command line.
+type Options struct {
+	Label        string
+	Start        string
+	Duration     time.Duration
+	QueryType    string
+	QueryArg     string
+	Direction    string
+	Binary       bool
+	ShowAll      bool
+	Follow       bool
+	PollInterval time.Duration
+	// Pager pipes text output through $PAGER (or less) when stdout is a
+	// terminal.
+	Pager bool
+	// Timeout is the maximum time for the query, 0 for no limit.
+	Timeout time.Duration
+	// FlowSummary is one of off, first, last or first_last.
+	FlowSummary string
+	// ShowInterface adds the capture interface to the text output.
+	ShowInterface bool
+	// Compress requests gzip compressed responses.
+	Compress bool
+	// Out is a pcap file to write the matching packets to, in addition
+	// to the text output.
+	Out string
+	// Reassemble is a directory to write the reassembled TCP stream
+	// payloads of the matching packets to, in addition to the text output.
+	Reassemble string
+	// MinLen and MaxLen drop text results with a packet length outside
+	// the range (0 for no limit). The server still reads every matching
+	// packet, so this only filters the output.
+	MinLen int64
+	MaxLen int64
+	// DisplayFilter is a display filter expression (see the filter
+	// package) evaluated by the server against each matching packet.
+	DisplayFilter string
+	// Format is the file format (pcap or pcapng) the server writes binary
+	// output in. Pcapng has an interface for each capture interface and
+	// link type.
+	Format string
+	// Keylog is a TLS key log file to embed in the pcapng output.
+	Keylog string
+	// Targets is a file of query arguments, one per line, to query in
+	// turn instead of QueryArg.
+	Targets string
+	// GroupBy are the fields (see GroupByFields) to count the results by,
+	// for a table of counts instead of the results.
+	GroupBy []string
+	// Pivots are queries of the form <query-type>=<query> to run in turn
+	// instead of QueryType and QueryArg, like Targets.
+	Pivots []string
+	// Quiet does not write the summary of the results to stderr when the
+	// query finishes, and Verbose also writes what is queried before it
+	// starts.
+	Quiet   bool
+	Verbose bool
+	// Strict fails a local query if an index references a pcap file that
+	// does not exist, instead of skipping its packets (see
+	// search.Options).
+	Strict bool
+	// EncryptionKey is the AES key that a local query reads encrypted
+	// indices with, nil if they are not encrypted.
+	EncryptionKey []byte
+	// Concurrency is the number of indices a local query reads at the
+	// same time, unless it has a limit.
+	Concurrency int
+	// PathIdx limits the query to the packets stored in these pcap-path
+	// indices (all if empty).
+	PathIdx []uint8
+	// WidePortRange allows a port range query (e.g. `1-65535`) of more
+	// than search.MaxPortRange ports.
+	WidePortRange bool
+	// And and Or are more queries of the form <query-type>=<query> that
+	// the results must all match, or that they can match instead.
+	And []string
+	Or  []string
+	// Count only writes the number of matching packets, counted by the
+	// server from the indices without reading the pcap files.
+	Count bool
+	// Limit stops the query after this many packets (0 for no limit), and
+	// Reverse reads the newest packets first, e.g. for the last N packets.
+	Limit   uint32
+	Reverse bool
+	// Cursor resumes a query after the last packet of the previous page,
+	// from the cursor written when a limited query stops at its limit.
+	Cursor string
+	// Output is the format of the results of a text query, OutputText
+	// (or empty), OutputJSON or OutputCSV.
+	Output string
+}
 
-	// Try to parse the time in one of the predefined formats.
-	var startTime time.Time
-	var err error
-	if len(start) > 10 {
-		startTime, err = time.Parse(LongQueryTimeFormat, start)
+// inLengthRange returns true if the packet length of a response is within
+// the MinLen and MaxLen options.
+func (o Options) inLengthRange(resp *v1.QueryResp) bool {
+	if o.MinLen > 0 && resp.GetLength() < o.MinLen {
+		return false
+	}
+	if o.MaxLen > 0 && resp.GetLength() > o.MaxLen {
+		return false
+	}
+	return true
+}
+
+// Execute runs a query against the server and writes the results to
+// stdout, followed by a summary on stderr unless o.Quiet is set.
+func (c *ClientConn) Execute(mainCtx context.Context, o Options) error {
+	if o.Verbose {
+		writeHeader(os.Stderr, o)
+	}
+	sum := newSummary()
+	err := c.execute(mainCtx, o, sum)
+	// Following only stops when it is interrupted, so it has no summary,
+	// and a count is its own summary.
+	if err == nil && !o.Quiet && !o.Follow && !o.Count {
+		sum.write(os.Stderr)
+	}
+	if err == nil {
+		sum.writeCursor(os.Stderr)
+	}
+	return err
+}
+
+func (c *ClientConn) execute(mainCtx context.Context, o Options, sum *summary) error {
+	batch := o.Targets != "" || len(o.Pivots) > 0
+	switch {
+	case o.Targets != "" && len(o.Pivots) > 0:
+		return fmt.Errorf("--targets cannot be used with --pivot")
+	case batch && o.QueryArg != "":
+		return fmt.Errorf("--targets and --pivot cannot be used with a query argument")
+	case batch && o.Binary:
+		return fmt.Errorf("--targets and --pivot are not supported with binary output")
+	case batch && o.Follow:
+		return fmt.Errorf("--targets and --pivot are not supported with follow")
+	case batch && o.Cursor != "":
+		return fmt.Errorf("--targets and --pivot are not supported with --cursor")
+	case !batch && o.QueryArg == "":
+		return fmt.Errorf("a query argument, --targets or --pivot is required")
+	case len(o.Pivots) == 0 && o.QueryType == "":
+		return fmt.Errorf("--query-type is required unless --pivot is set")
+	}
+	if len(o.GroupBy) > 0 && o.Binary {
+		return fmt.Errorf("--group-by is not supported with binary output")
+	}
+	if err := o.checkOutput(); err != nil {
+		return err
+	}
+	req, err := newRequest(o)
+	if err != nil {
+		return err
+	}
+	if o.Count {
+		if err := o.checkCount(); err != nil {
+			return err
+		}
+		ctx := mainCtx
+		if o.Timeout > 0 {
+			var cancelFunc context.CancelFunc
+			ctx, cancelFunc = context.WithTimeout(mainCtx, o.Timeout)
+			defer cancelFunc()
+		}
+		return c.count(ctx, req, []grpc.CallOption{grpc.WaitForReady(true)}, o)
+	}
+	keylog, err := readKeylog(o.Keylog)
+	if err != nil {
+		return err
+	}
+	opts := []grpc.CallOption{
+		grpc.WaitForReady(true),
+		grpc.MaxCallRecvMsgSize(common.GRPCMaxSize),
+		grpc.MaxCallSendMsgSize(common.GRPCMaxSize),
+	}
+	if o.Compress {
+		opts = append(opts, grpc.UseCompressor(gzip.Name))
+	}
+
+	out, closeOut := openOutput(o)
+	defer closeOut()
+	err = o.outputHeader(out)
+	if err != nil {
+		return outputError(out, err)
+	}
+
+	pf, err := openPcapFile(o.Out)
+	if err != nil {
+		return err
+	}
+	defer pf.Close()
+
+	ra, err := openReassembler(o.Reassemble)
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+
+	if o.Follow {
+		if o.Binary {
+			return fmt.Errorf("follow is not supported with binary output")
+		}
+		if req.FlowSummary != v1.FlowSummary_off {
+			return fmt.Errorf("follow is not supported with a flow summary")
+		}
+		if len(o.GroupBy) > 0 {
+			return fmt.Errorf("follow is not supported with --group-by")
+		}
+		if o.Limit > 0 || o.Reverse || o.Cursor != "" {
+			return fmt.Errorf("follow is not supported with --limit, --reverse or --cursor")
+		}
+		return c.follow(mainCtx, out, pf, ra, req, o, opts)
+	}
+	g := newGroups(o.GroupBy)
+	if batch {
+		queries, err := o.batchQueries()
 		if err != nil {
-			return fmt.Errorf("unable to parse start date '%s' using format %s: %s", start, LongQueryTimeFormat, err)
+			return err
+		}
+		err = c.executeBatch(mainCtx, out, pf, ra, o, opts, queries, g, sum)
+		// The counts of the queries that did not fail are still written.
+		if groupErr := writeGroups(out, g, nil); groupErr != nil {
+			return groupErr
+		}
+		return err
+	}
+
+	// Streaming queries have no deadline unless one is requested since a
+	// large export can take minutes.
+	ctx := mainCtx
+	if o.Timeout > 0 {
+		var cancelFunc context.CancelFunc
+		ctx, cancelFunc = context.WithTimeout(mainCtx, o.Timeout)
+		defer cancelFunc()
+	}
+
+	if !o.Binary {
+		err = c.streamText(ctx, req, opts, o, out, pf, ra, "", g, sum)
+		if err == errOutputClosed {
+			return nil
+		}
+		return writeGroups(out, g, err)
+	}
+	return c.copyBinary(ctx, req, opts, os.Stdout, keylog, sum)
+}
+
+// errOutputClosed stops a query when the pager has exited.
+var errOutputClosed = fmt.Errorf("output closed")
+
+// writeGroups writes the table of grouped results, if they are grouped,
+// once a query has finished without an error.
+func writeGroups(out io.Writer, g *groups, err error) error {
+	if err != nil || g == nil {
+		return err
+	}
+	err = g.write(out)
+	if err != nil {
+		if err = outputError(out, err); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// streamText writes the results of a text query to out, or counts them in
+// g if it is not nil, and writes them to the pcap file and reassembler if
+// they are open, and counts them in sum. If target is not empty, it is
+// written before each result.
+func (c *ClientConn) streamText(ctx context.Context, req *v1.QueryReq, opts []grpc.CallOption, o Options, out io.Writer, pf *pcapFile, ra *reassembler, target string, g *groups, sum *summary) error {
+	stream, err := c.client.QueryStream(ctx, req, opts...)
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			sum.addIndices(stream.Trailer())
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error receiving stream: %s", err)
+		}
+		if resp.GetCursor() != "" {
+			sum.cursor = resp.GetCursor()
+			continue
+		}
+		if !o.inLengthRange(resp) {
+			continue
+		}
+		if g != nil {
+			g.add(resp)
+		} else {
+			err = o.outputResult(out, resp, target)
+			if err != nil {
+				if err = outputError(out, err); err == nil {
+					return errOutputClosed
+				}
+				return err
+			}
+		}
+		sum.add(resp.GetLength())
+		err = pf.Write(resp)
+		if err != nil {
+			return err
+		}
+		err = ra.Write(resp)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyBinary writes the pcap or pcapng stream of a binary query to w, with
+// the TLS key log after the pcapng header if it is not empty, and counts
+// the packets in sum.
+func (c *ClientConn) copyBinary(ctx context.Context, req *v1.QueryReq, opts []grpc.CallOption, w io.Writer, keylog []byte, sum *summary) error {
+	pcapng := req.BinaryFormat == v1.BinaryFormat_pcapng
+	stream, err := c.client.QueryBinaryStream(ctx, req, opts...)
+	if err != nil {
+		return err
+	}
+	for header := true; ; header = false {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			sum.addIndices(stream.Trailer())
+			return nil
 		}
-	} else {
-		startTime, err = time.Parse(ShortQueryTimeFormat, start)
 		if err != nil {
-			return fmt.Errorf("unable to parse start date '%s' using format %s: %s", start, ShortQueryTimeFormat, err)
+			return fmt.Errorf("error receiving stream: %s", err)
+		}
+		// The cursor is sent after the packets, so it is never the header.
+		if resp.GetCursor() != "" {
+			sum.cursor = resp.GetCursor()
+			continue
+		}
+		if header && pcapng && !isPcapng(resp.GetBinary()) {
+			return fmt.Errorf("the server does not support pcapng output")
+		}
+		r := bytes.NewReader(resp.GetBinary())
+		if _, err := io.Copy(w, r); err != nil {
+			return fmt.Errorf("unable to write binary output: %s", err)
+		}
+		// The server sends the file header and then each packet record
+		// (for pcap, a 16 byte header and the data) in its own response.
+		switch {
+		case pcapng && header && len(keylog) > 0:
+			err = writeDecryptionSecrets(w, ngSecretsTypeTLSKeyLog, keylog)
+			if err != nil {
+				return fmt.Errorf("unable to write binary output: %s", err)
+			}
+		case pcapng:
+			countPcapng(resp.GetBinary(), sum)
+		case !header:
+			sum.add(int64(len(resp.GetBinary()) - 16))
 		}
 	}
+}
+
+// parseStart parses the start time in one of the predefined formats.
+func parseStart(start string) (time.Time, error) {
+	if len(start) > 10 {
+		t, err := time.Parse(LongQueryTimeFormat, start)
+		if err != nil {
+			return t, fmt.Errorf("unable to parse start date '%s' using format %s: %s", start, LongQueryTimeFormat, err)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(ShortQueryTimeFormat, start)
+	if err != nil {
+		return t, fmt.Errorf("unable to parse start date '%s' using format %s: %s", start, ShortQueryTimeFormat, err)
+	}
+	return t, nil
+}
+
+// newRequest creates the query request from the command line options.
+func newRequest(o Options) (*v1.QueryReq, error) {
+	startTime, err := parseStart(o.Start)
+	if err != nil {
+		return nil, err
+	}
 
 	log.Info().
 		Str("component", "query").
-		Str("label", label).
+		Str("label", o.Label).
 		Time("start-time", startTime).
-		Dur("duration", duration).
-		Str("server-addr", c.serverAddr).
-		Str("query-type", queryType).
-		Str("query-arg", queryArg).
+		Dur("duration", o.Duration).
+		Str("query-type", o.QueryType).
+		Str("query-arg", o.QueryArg).
+		Str("direction", o.Direction).
 		Msg("executing index query")
 
 	// Convert golang time.Time to protobyf Timestamp.
 	s, err := ptypes.TimestampProto(startTime)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Get the QueryType from the string.
 	var t v1.QueryType
-	switch strings.ToLower(queryType) {
+	switch strings.ToLower(o.QueryType) {
 	case "ip":
 		t = v1.QueryType_ip
 	case "port":
@@ -120,45 +518,113 @@ func (c *ClientConn) Execute(mainCtx context.Context, label, start string, durat
 		t = v1.QueryType_mac
 	case "protocol":
 		t = v1.QueryType_protocol
+	case "mpls":
+		t = v1.QueryType_mpls
+	case "vni":
+		t = v1.QueryType_vni
+	case "flow":
+		t = v1.QueryType_flow
+	case "interface":
+		t = v1.QueryType_interface
+	case "domain":
+		t = v1.QueryType_domain
+	case "host":
+		t = v1.QueryType_host
+	case "vlan":
+		t = v1.QueryType_vlan
 	}
 
 	req := &v1.QueryReq{
-		Label:        label,
-		ShowAll:      showAll,
-		StartTime:    s,
-		Duration:     ptypes.DurationProto(duration),
-		QueryType:    t,
-		Query:        queryArg,
-		BinaryOutput: binOut,
+		Label:         o.Label,
+		ShowAll:       o.ShowAll,
+		StartTime:     s,
+		Duration:      ptypes.DurationProto(o.Duration),
+		QueryType:     t,
+		Query:         o.QueryArg,
+		Direction:     v1.Direction(v1.Direction_value[strings.ToLower(o.Direction)]),
+		BinaryOutput:  o.Binary,
+		FlowSummary:   v1.FlowSummary(v1.FlowSummary_value[strings.ToLower(o.FlowSummary)]),
+		ShowInterface: o.ShowInterface,
+		IncludeData:   o.Out != "" || o.Reassemble != "",
+		DisplayFilter: o.DisplayFilter,
+		WidePortRange: o.WidePortRange,
+		Limit:         o.Limit,
+		Reverse:       o.Reverse,
+		Cursor:        o.Cursor,
 	}
-
-	opts := []grpc.CallOption{
-		grpc.WaitForReady(true),
-		grpc.MaxCallRecvMsgSize(common.GRPCMaxSize),
-		grpc.MaxCallSendMsgSize(common.GRPCMaxSize),
+	for _, i := range o.PathIdx {
+		req.PcapPathIdx = append(req.PcapPathIdx, uint32(i))
 	}
-
-	timeout := 90 * time.Second
-	ctx, cancelFunc := context.WithTimeout(mainCtx, timeout)
-	defer cancelFunc()
-
-	if !binOut {
-		stream, err := c.client.QueryStream(ctx, req, opts...)
+	if len(o.And) > 0 && len(o.Or) > 0 {
+		return nil, fmt.Errorf("--and and --or cannot be combined")
+	}
+	terms := o.And
+	if len(o.Or) > 0 {
+		terms = o.Or
+		req.TermMatch = v1.TermMatch_match_any
+	}
+	for _, term := range terms {
+		queryType, arg, err := parseTypedQuery(term)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		for {
-			resp, err := stream.Recv()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return fmt.Errorf("error receiving stream: %s", err)
-			}
-			outputResponse(resp, showAll)
+		req.Terms = append(req.Terms, &v1.QueryTerm{
+			QueryType: v1.QueryType(v1.QueryType_value[queryType]),
+			Query:     arg,
+		})
+	}
+	if o.Out != "" && o.Binary {
+		return nil, fmt.Errorf("--out is not supported with binary output, redirect stdout instead")
+	}
+	if o.Format == "pcapng" {
+		if !o.Binary {
+			return nil, fmt.Errorf("--format pcapng requires --binary output")
 		}
-	} else {
-		stream, err := c.client.QueryBinaryStream(ctx, req, opts...)
+		req.BinaryFormat = v1.BinaryFormat_pcapng
+	}
+	if o.Keylog != "" && req.BinaryFormat != v1.BinaryFormat_pcapng {
+		return nil, fmt.Errorf("--keylog requires --format pcapng output")
+	}
+	if o.Reassemble != "" && o.Binary {
+		return nil, fmt.Errorf("--reassemble is not supported with binary output")
+	}
+	if (o.MinLen > 0 || o.MaxLen > 0) && o.Binary {
+		return nil, fmt.Errorf("--min-len and --max-len are not supported with binary output")
+	}
+	if o.MaxLen > 0 && o.MinLen > o.MaxLen {
+		return nil, fmt.Errorf("--min-len %d is greater than --max-len %d", o.MinLen, o.MaxLen)
+	}
+	// Check the display filter before sending it so a typo is reported
+	// without a round trip.
+	if o.DisplayFilter != "" {
+		if _, err := filter.Compile(o.DisplayFilter); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// openOutput returns where to write text output: the pager if requested
+// and stdout is a terminal (never for binary output), otherwise stdout.
+// The returned function closes the pager.
+func openOutput(o Options) (io.Writer, func()) {
+	if o.Pager && !o.Binary && isTerminal(os.Stdout) {
+		p, err := startPager()
+		if err != nil {
+			log.Warn().Err(err).Msg("unable to start pager, writing to stdout")
+		} else {
+			return p, func() { p.Close() }
+		}
+	}
+	return os.Stdout, func() {}
+}
+
+// follow polls the server for packets in newly written indices until the
+// context is canceled, similar to `tail -f`.
+func (c *ClientConn) follow(ctx context.Context, out io.Writer, pf *pcapFile, ra *reassembler, req *v1.QueryReq, o Options, opts []grpc.CallOption) error {
+	var since string
+	for {
+		stream, err := c.client.QueryFollow(ctx, &v1.FollowReq{Query: req, Since: since}, opts...)
 		if err != nil {
 			return err
 		}
@@ -168,45 +634,106 @@ func (c *ClientConn) Execute(mainCtx context.Context, label, start string, durat
 				break
 			}
 			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
 				return fmt.Errorf("error receiving stream: %s", err)
 			}
-			r := bytes.NewReader(resp.GetBinary())
-			if _, err := io.Copy(os.Stdout, r); err != nil {
-				log.Fatal().Err(err).Msg("unable to write binary to stdout")
+			if resp.GetResult() != nil && o.inLengthRange(resp.GetResult()) {
+				err = o.outputResult(out, resp.GetResult(), "")
+				if err != nil {
+					return outputError(out, err)
+				}
+				err = pf.Write(resp.GetResult())
+				if err != nil {
+					return err
+				}
+				err = ra.Write(resp.GetResult())
+				if err != nil {
+					return err
+				}
+			}
+			if resp.GetCursor() != "" {
+				since = resp.GetCursor()
 			}
 		}
-	}
+		log.Debug().Str("cursor", since).Dur("poll-interval", o.PollInterval).Msg("waiting for new indices")
 
-	return nil
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(o.PollInterval):
+		}
+	}
 }
 
-func loadCredentials(ca, addr, name string) (credentials.TransportCredentials, error) {
-	var creds credentials.TransportCredentials
-	if ca == "" {
-		creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})
-	} else {
-		certPool := x509.NewCertPool()
-		ca, err := ioutil.ReadFile(ca)
+// loadCredentials returns the TLS credentials to connect to the server at
+// addr with. The server certificate is verified with the certificate
+// authority ca, which is required unless insecure is set.
+func loadCredentials(ca, addr, name, clientCert, clientKey string, insecure bool) (credentials.TransportCredentials, error) {
+	var certs []tls.Certificate
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			return nil, fmt.Errorf("both a client certificate and key are needed")
+		}
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
 		if err != nil {
-			return nil, fmt.Errorf("error loading TLS CA file %s: %s", ca, err)
+			return nil, fmt.Errorf("error loading client certificate %s: %s", clientCert, err)
 		}
-		if ok := certPool.AppendCertsFromPEM(ca); !ok {
-			return nil, fmt.Errorf("failed to append ca cert")
+		certs = []tls.Certificate{cert}
+	}
+
+	if insecure {
+		if ca != "" {
+			return nil, fmt.Errorf("--insecure cannot be used with --ca-path")
 		}
-		serverAddrFields := strings.Split(addr, ":")
-		creds = credentials.NewTLS(&tls.Config{
-			ServerName: serverAddrFields[0],
-			RootCAs:    certPool,
-		})
-		if name != "" {
-			if err := creds.OverrideServerName(name); err != nil {
-				return nil, fmt.Errorf("failed to overide server name %s: %s", name, err)
-			}
+		log.Warn().
+			Str("server-address", addr).
+			Msg("INSECURE: the server certificate is not verified, so the connection is open to a machine-in-the-middle attack")
+		return credentials.NewTLS(&tls.Config{
+			Certificates:       certs,
+			InsecureSkipVerify: true,
+		}), nil
+	}
+
+	if ca == "" {
+		return nil, fmt.Errorf("the server certificate cannot be verified without --ca-path (or use --insecure to not verify it)")
+	}
+	caPEM, err := ioutil.ReadFile(ca)
+	if err != nil {
+		return nil, fmt.Errorf("error loading TLS CA file %s: %s", ca, err)
+	}
+	certPool := x509.NewCertPool()
+	if ok := certPool.AppendCertsFromPEM(caPEM); !ok {
+		return nil, fmt.Errorf("failed to append ca cert")
+	}
+	serverAddrFields := strings.Split(addr, ":")
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: certs,
+		ServerName:   serverAddrFields[0],
+		RootCAs:      certPool,
+	})
+	if name != "" {
+		if err := creds.OverrideServerName(name); err != nil {
+			return nil, fmt.Errorf("failed to overide server name %s: %s", name, err)
 		}
 	}
 	return creds, nil
 }
 
+// bearerToken sends a token in the authorization header of each request.
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity does not allow the token to be sent in the
+// clear.
+func (t bearerToken) RequireTransportSecurity() bool {
+	return true
+}
+
 func (c *ClientConn) Close() error {
 	log.Info().
 		Str("server-address", c.serverAddr).
@@ -217,13 +744,43 @@ func (c *ClientConn) Close() error {
 	return nil
 }
 
-func outputResponse(resp *v1.QueryResp, showAll bool) {
+func outputResponse(w io.Writer, resp *v1.QueryResp, showAll bool) (err error) {
 	if showAll {
-		fmt.Printf("%s\n", resp.GetText())
+		_, err = fmt.Fprintf(w, "%s\n", resp.GetText())
+		if err == nil && resp.GetTruncated() {
+			_, err = fmt.Fprintf(w, "(truncated: the packet was longer than the capture snap length)\n")
+		}
 	} else {
 		ts, _ := ptypes.Timestamp(resp.GetTimestamp())
 		s := fmt.Sprintf("%12s:%-3d", resp.GetSrcIP(), resp.GetSrcPort())
 		d := fmt.Sprintf("%12s:%-3d", resp.GetDstIP(), resp.GetDstPort())
-		fmt.Printf("%s IP %s > %s %s, len %d\n", ts.Format("2006-01-02 15:04:05.000000"), s, d, resp.Proto, resp.GetLength())
+		var iface string
+		if resp.GetInterface() != "" {
+			iface = resp.GetInterface() + " "
+		}
+		var vlan string
+		if len(resp.GetVlan()) > 0 {
+			ids := make([]string, len(resp.GetVlan()))
+			for i, id := range resp.GetVlan() {
+				ids[i] = strconv.FormatUint(uint64(id), 10)
+			}
+			vlan = "vlan " + strings.Join(ids, ",") + " "
+		}
+		var truncated string
+		if resp.GetTruncated() {
+			truncated = " (truncated)"
+		}
+		_, err = fmt.Fprintf(w, "%s %s%sIP %s > %s %s, len %d%s\n", ts.Format("2006-01-02 15:04:05.000000"), iface, vlan, s, d, resp.Proto, resp.GetLength(), truncated)
+	}
+	return err
+}
+
+// outputError returns nil if the output was the pager and it has exited
+// (e.g. the user quit less before the end of the results).
+func outputError(w io.Writer, err error) error {
+	if _, ok := w.(*pager); ok {
+		log.Debug().Err(err).Msg("pager closed")
+		return nil
 	}
+	return fmt.Errorf("error writing output: %s", err)
 }
@@ -0,0 +1,142 @@
+package query
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+	"github.com/rs/zerolog/log"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+)
+
+// reassembler reassembles the TCP streams of text responses and writes
+// the application payload of each direction of each flow to its own file
+// in a directory, e.g. to extract files or HTTP bodies.
+type reassembler struct {
+	dir       string
+	factory   *streamFactory
+	assembler *tcpassembly.Assembler
+}
+
+// openReassembler creates the output directory, or returns nil if dir is
+// empty.
+func openReassembler(dir string) (*reassembler, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create reassembly directory %s: %s", dir, err)
+	}
+	factory := &streamFactory{dir: dir}
+	return &reassembler{
+		dir:       dir,
+		factory:   factory,
+		assembler: tcpassembly.NewAssembler(tcpassembly.NewStreamPool(factory)),
+	}, nil
+}
+
+// Write adds the packet data of a response to its TCP stream. Packets
+// that are not TCP are ignored.
+func (r *reassembler) Write(resp *v1.QueryResp) error {
+	if r == nil {
+		return nil
+	}
+	ts, err := ptypes.Timestamp(resp.GetTimestamp())
+	if err != nil {
+		return err
+	}
+	packet := gopacket.NewPacket(resp.GetData(), layers.LinkType(resp.GetLinkType()), gopacket.Default)
+	tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok || packet.NetworkLayer() == nil {
+		return nil
+	}
+	r.assembler.AssembleWithTimestamp(packet.NetworkLayer().NetworkFlow(), tcp, ts)
+	return r.factory.err
+}
+
+// Close flushes any incomplete streams and closes the stream files.
+func (r *reassembler) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.assembler.FlushAll()
+	if r.factory.err != nil {
+		log.Error().Err(r.factory.err).Str("component", "reassemble").Msg("error writing reassembled streams")
+	}
+	log.Info().
+		Str("component", "reassemble").
+		Str("dir", r.dir).
+		Int("streams", r.factory.count).
+		Msg("wrote reassembled streams")
+	return r.factory.err
+}
+
+// streamFactory creates a stream for each direction of a TCP flow.
+type streamFactory struct {
+	dir   string
+	count int
+	// err is the first error writing a stream file, since the assembler
+	// does not return errors.
+	err error
+}
+
+func (f *streamFactory) New(netFlow, tcpFlow gopacket.Flow) tcpassembly.Stream {
+	// IPv6 addresses contain colons, which some file systems do not allow.
+	name := strings.Replace(fmt.Sprintf("%s_%s-%s_%s", netFlow.Src(), tcpFlow.Src(), netFlow.Dst(), tcpFlow.Dst()), ":", ".", -1)
+	return &stream{factory: f, path: filepath.Join(f.dir, name+".bin")}
+}
+
+// stream writes the reassembled payload of one direction of a flow. The
+// file is opened on the first payload so there are no empty files for
+// directions without data, and is appended to if the same addresses and
+// ports are reused by a later connection.
+type stream struct {
+	factory *streamFactory
+	path    string
+	f       *os.File
+	skipped int
+}
+
+func (s *stream) Reassembled(reassemblies []tcpassembly.Reassembly) {
+	for _, r := range reassemblies {
+		if r.Skip > 0 {
+			s.skipped += r.Skip
+		}
+		if len(r.Bytes) == 0 || s.factory.err != nil {
+			continue
+		}
+		if s.f == nil {
+			f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				s.factory.err = fmt.Errorf("unable to create stream file %s: %s", s.path, err)
+				continue
+			}
+			s.f = f
+			s.factory.count++
+		}
+		_, err := s.f.Write(r.Bytes)
+		if err != nil {
+			s.factory.err = fmt.Errorf("error writing stream file %s: %s", s.path, err)
+		}
+	}
+}
+
+func (s *stream) ReassemblyComplete() {
+	if s.skipped > 0 {
+		log.Warn().
+			Str("component", "reassemble").
+			Str("file", s.path).
+			Int("missing-bytes", s.skipped).
+			Msg("stream has gaps from missing packets")
+	}
+	if s.f != nil {
+		s.f.Close()
+	}
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/rs/zerolog/log"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+)
+
+// StatsOptions are the host summary settings from the command line.
+type StatsOptions struct {
+	Label    string
+	Start    string
+	Duration time.Duration
+	IP       string
+	// Top is the number of peers and ports to show.
+	Top int
+	// JSON prints the summary as JSON instead of tables.
+	JSON bool
+	// Timeout is the maximum time for the summary, 0 for no limit.
+	Timeout time.Duration
+}
+
+// Stats prints a summary of the traffic of a host: its top peers,
+// protocols and ports.
+func (c *ClientConn) Stats(mainCtx context.Context, o StatsOptions) error {
+	startTime, err := parseStart(o.Start)
+	if err != nil {
+		return err
+	}
+	s, err := ptypes.TimestampProto(startTime)
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("component", "query").
+		Str("label", o.Label).
+		Time("start-time", startTime).
+		Dur("duration", o.Duration).
+		Str("ip", o.IP).
+		Msg("executing host stats")
+
+	ctx := mainCtx
+	if o.Timeout > 0 {
+		var cancelFunc context.CancelFunc
+		ctx, cancelFunc = context.WithTimeout(mainCtx, o.Timeout)
+		defer cancelFunc()
+	}
+	resp, err := c.client.Stats(ctx, &v1.StatsReq{
+		Label:     o.Label,
+		StartTime: s,
+		Duration:  ptypes.DurationProto(o.Duration),
+		Ip:        o.IP,
+		Top:       uint32(o.Top),
+	})
+	if err != nil {
+		return err
+	}
+
+	if o.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+
+	fmt.Printf("Host %s: %d packets, %d bytes\n", resp.Ip, resp.Packets, resp.Bytes)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\nPeer\tPackets\tBytes\t")
+	for _, p := range resp.Peers {
+		fmt.Fprintf(w, "%s\t%d\t%d\t\n", p.Ip, p.Packets, p.Bytes)
+	}
+	fmt.Fprintln(w, "\nProtocol\tPackets\t")
+	for _, p := range resp.Protocols {
+		fmt.Fprintf(w, "%s (%d)\t%d\t\n", p.Name, p.Number, p.Packets)
+	}
+	fmt.Fprintln(w, "\nPort\tPackets\t")
+	for _, p := range resp.Ports {
+		fmt.Fprintf(w, "%d\t%d\t\n", p.Port, p.Packets)
+	}
+	return w.Flush()
+}
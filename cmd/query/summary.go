@@ -0,0 +1,95 @@
+package query
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"code.ornl.gov/situ/mercury/common"
+)
+
+// summary counts the results of a query for the line written to stderr
+// when it finishes, so users can tell how much a query returned without
+// counting the output.
+type summary struct {
+	start   time.Time
+	packets int
+	bytes   int64
+	// indices is the number of indices read, -1 if it is not known (e.g.
+	// the server does not send it).
+	indices int
+	// cursor resumes the query after its last packet if it stopped at its
+	// limit.
+	cursor string
+}
+
+func newSummary() *summary {
+	return &summary{start: time.Now()}
+}
+
+// add counts a packet that was output.
+func (s *summary) add(packetLen int64) {
+	s.packets++
+	s.bytes += packetLen
+}
+
+// addIndices adds the number of indices from the trailer of a query
+// response.
+func (s *summary) addIndices(md metadata.MD) {
+	v := md.Get(common.IndicesTrailer)
+	if len(v) == 0 {
+		s.indices = -1
+		return
+	}
+	n, err := strconv.Atoi(v[0])
+	if err != nil {
+		s.indices = -1
+		return
+	}
+	if s.indices >= 0 {
+		s.indices += n
+	}
+}
+
+// write writes the summary line, e.g.
+// `509 packets (288094 bytes) from 3 indices in 1.2s`.
+func (s *summary) write(w io.Writer) {
+	line := fmt.Sprintf("%d %s (%d bytes)", s.packets, plural(s.packets, "packet", "packets"), s.bytes)
+	if s.indices >= 0 {
+		line += fmt.Sprintf(" from %d %s", s.indices, plural(s.indices, "index", "indices"))
+	}
+	fmt.Fprintf(w, "%s in %s\n", line, time.Since(s.start).Round(time.Millisecond))
+}
+
+// writeCursor writes the option to get the next page of a query that
+// stopped at its limit. Unlike the summary it is written with --quiet,
+// since paging needs it.
+func (s *summary) writeCursor(w io.Writer) {
+	if s.cursor != "" {
+		fmt.Fprintf(w, "Next page: --cursor %s\n", s.cursor)
+	}
+}
+
+// writeHeader writes what is about to be queried, for --verbose.
+func writeHeader(w io.Writer, o Options) {
+	arg := o.QueryArg
+	if o.Targets != "" {
+		arg = "the targets in " + o.Targets
+	}
+	if len(o.Pivots) > 0 {
+		fmt.Fprintf(w, "Querying label %s for %s from %s for %s\n", o.Label, strings.Join(o.Pivots, ", "), o.Start, o.Duration)
+		return
+	}
+	fmt.Fprintf(w, "Querying label %s for %s %s from %s for %s\n", o.Label, o.QueryType, arg, o.Start, o.Duration)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
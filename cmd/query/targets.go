@@ -0,0 +1,147 @@
+package query
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+)
+
+// batchQuery is one of the queries of a --targets file or the --pivot
+// options, which are run in turn with each result tagged by label.
+type batchQuery struct {
+	label     string
+	queryType string
+	arg       string
+}
+
+// batchQueries returns the queries of the targets file or the pivots.
+func (o Options) batchQueries() ([]batchQuery, error) {
+	if o.Targets != "" {
+		targets, err := readTargets(o.Targets)
+		if err != nil {
+			return nil, err
+		}
+		queries := make([]batchQuery, len(targets))
+		for i, t := range targets {
+			queries[i] = batchQuery{label: t, queryType: o.QueryType, arg: t}
+		}
+		return queries, nil
+	}
+	queries := make([]batchQuery, len(o.Pivots))
+	for i, p := range o.Pivots {
+		queryType, arg, err := parseTypedQuery(p)
+		if err != nil {
+			return nil, err
+		}
+		queries[i] = batchQuery{label: p, queryType: queryType, arg: arg}
+	}
+	return queries, nil
+}
+
+// parseTypedQuery splits a pivot or query term of the form
+// <query-type>=<query>, e.g. `ip=10.0.0.1` or `port=443`.
+func parseTypedQuery(p string) (string, string, error) {
+	i := strings.Index(p, "=")
+	if i < 0 {
+		return "", "", fmt.Errorf("%s is not of the form <query-type>=<query>", p)
+	}
+	queryType, arg := strings.ToLower(p[:i]), p[i+1:]
+	if _, ok := v1.QueryType_value[queryType]; !ok {
+		return "", "", fmt.Errorf("%s has an unknown query type %s", p, queryType)
+	}
+	if arg == "" {
+		return "", "", fmt.Errorf("%s has no query", p)
+	}
+	return queryType, arg, nil
+}
+
+// readTargets reads the query arguments in a targets file, one per line.
+// Blank lines and lines starting with # are skipped.
+func readTargets(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open targets file %s: %s", name, err)
+	}
+	defer f.Close()
+
+	var targets []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read targets file %s: %s", name, err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("targets file %s has no targets", name)
+	}
+	return targets, nil
+}
+
+// executeBatch runs each of the queries over the open connection, one
+// after the other, and tags each result with the label of its query. A
+// query that fails (e.g. it is not a valid address) is logged and skipped;
+// the error at the end reports how many failed. If g is not nil the results
+// of all the queries are counted in it instead.
+func (c *ClientConn) executeBatch(mainCtx context.Context, out io.Writer, pf *pcapFile, ra *reassembler, o Options, opts []grpc.CallOption, queries []batchQuery, g *groups, sum *summary) error {
+	var failed int
+	for _, q := range queries {
+		if mainCtx.Err() != nil {
+			return nil
+		}
+		o.QueryType = q.queryType
+		o.QueryArg = q.arg
+		req, err := newRequest(o)
+		if err != nil {
+			return err
+		}
+		err = func() error {
+			// The timeout applies to each query.
+			ctx := mainCtx
+			if o.Timeout > 0 {
+				var cancelFunc context.CancelFunc
+				ctx, cancelFunc = context.WithTimeout(mainCtx, o.Timeout)
+				defer cancelFunc()
+			}
+			return c.streamText(ctx, req, opts, o, out, pf, ra, q.label, g, sum)
+		}()
+		if err == errOutputClosed {
+			return nil
+		}
+		if err != nil {
+			if mainCtx.Err() != nil {
+				return nil
+			}
+			failed++
+			log.Warn().Err(err).Str("component", "query").Str("target", q.label).Msg("batch query failed")
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d queries failed", failed, len(queries))
+	}
+	return nil
+}
+
+// outputTarget writes the target of the next result: before the summary
+// line, separated by a tab so it can be cut, or on its own line before the
+// full packet details.
+func outputTarget(w io.Writer, target string, showAll bool) (err error) {
+	if showAll {
+		_, err = fmt.Fprintf(w, "%s:\n", target)
+	} else {
+		_, err = fmt.Fprintf(w, "%s\t", target)
+	}
+	return err
+}
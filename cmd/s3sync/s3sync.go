@@ -0,0 +1,107 @@
+package s3sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/storage"
+)
+
+// Fetch downloads the pcap files and index archives of a label that were
+// uploaded by capture and are missing locally, so that they can be
+// served. Pcap files are written to the pcap-path matching the index in
+// their name.
+func Fetch(ctx context.Context, store storage.Store, prefix, label, indexBasePath string, pcapPaths []string) error {
+	logger := log.With().Str("component", "s3-sync").Str("store", store.String()).Str("label", label).Logger()
+
+	keyPrefix := storage.Key(prefix, label, "") + "/"
+	keys, err := store.List(ctx, keyPrefix)
+	if err != nil {
+		return err
+	}
+
+	var fetched int
+	for _, key := range keys {
+		name := path.Base(key)
+		idxSuffix := "." + common.IndexNameSuffix + "." + storage.IndexArchiveSuffix
+
+		base, isPcap := common.TrimPcapSuffix(name)
+
+		switch {
+		case isPcap:
+			i := strings.LastIndex(base, "_")
+			if i < 0 {
+				logger.Warn().Str("key", key).Msg("skipping pcap file without a pcap-path index")
+				continue
+			}
+			pathIdx, err := strconv.Atoi(base[i+1:])
+			if err != nil || pathIdx >= len(pcapPaths) {
+				return fmt.Errorf("object %s references pcap-path %s but only %d configured", key, base[i+1:], len(pcapPaths))
+			}
+			dst := path.Join(pcapPaths[pathIdx], name)
+			if _, err := os.Stat(dst); err == nil {
+				continue
+			}
+			logger.Debug().Str("key", key).Str("file", dst).Msg("downloading pcap file")
+			err = download(ctx, store, key, dst)
+			if err != nil {
+				return err
+			}
+			fetched++
+
+		case strings.HasSuffix(name, idxSuffix):
+			dst := path.Join(indexBasePath, label, strings.TrimSuffix(name, "."+storage.IndexArchiveSuffix))
+			if _, err := os.Stat(dst); err == nil {
+				continue
+			}
+			logger.Debug().Str("key", key).Str("index", dst).Msg("downloading index archive")
+			var buf bytes.Buffer
+			err = store.Get(ctx, key, &buf)
+			if err != nil {
+				return err
+			}
+			// Extract to a temporary directory first so that a partial
+			// index is never served.
+			tmp := dst + ".tmp"
+			err = storage.UntarDir(&buf, tmp)
+			if err != nil {
+				os.RemoveAll(tmp)
+				return fmt.Errorf("unable to extract index %s: %s", key, err)
+			}
+			err = os.Rename(tmp, dst)
+			if err != nil {
+				return err
+			}
+			fetched++
+		}
+	}
+
+	logger.Info().Int("objects", len(keys)).Int("fetched", fetched).Msg("finished sync")
+	return nil
+}
+
+// download writes an object to a temporary file and renames it into place.
+func download(ctx context.Context, store storage.Store, key, dst string) error {
+	tmp := dst + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = store.Get(ctx, key, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,93 @@
+package serve
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/search"
+)
+
+// auditor writes a JSON record of every query to a separate log so there
+// is a trail of who queried what. A nil auditor does nothing.
+type auditor struct {
+	logger zerolog.Logger
+	out    io.Closer
+}
+
+// newAuditor writes audit records to the file at path, or to stderr if the
+// path is "-". It returns nil if path is empty.
+func newAuditor(path string) (*auditor, error) {
+	if path == "" {
+		return nil, nil
+	}
+	var w io.WriteCloser = os.Stderr
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open audit log %s: %s", path, err)
+		}
+		w = f
+	}
+	a := &auditor{
+		logger: zerolog.New(w).With().Timestamp().Logger(),
+	}
+	if path != "-" {
+		a.out = w
+	}
+	return a, nil
+}
+
+// Log records a completed query with the number of packets returned.
+func (a *auditor) Log(ctx context.Context, method string, req *v1.QueryReq, count int, err error) {
+	if a == nil {
+		return
+	}
+	addr, subject := clientIdentity(ctx)
+	start, end := search.GetTimes(req.StartTime, req.Duration)
+	e := a.logger.Log().
+		Str("method", method).
+		Str("client-addr", addr).
+		Str("client-subject", subject).
+		Str("label", req.Label).
+		Str("query-type", req.QueryType.String()).
+		Str("query", req.Query).
+		Str("direction", req.Direction.String()).
+		Time("start-time", start).
+		Time("end-time", end).
+		Int("results", count)
+	if err != nil {
+		e = e.Err(err)
+	}
+	e.Msg("query")
+}
+
+// Close closes the audit log file.
+func (a *auditor) Close() error {
+	if a == nil || a.out == nil {
+		return nil
+	}
+	return a.out.Close()
+}
+
+// clientIdentity returns the address of the client and, if it presented a
+// TLS client certificate, the certificate subject.
+func clientIdentity(ctx context.Context) (addr, subject string) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", ""
+	}
+	addr = p.Addr.String()
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		if certs := tlsInfo.State.PeerCertificates; len(certs) > 0 {
+			subject = certs[0].Subject.String()
+		}
+	}
+	return addr, subject
+}
@@ -0,0 +1,120 @@
+package serve
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// bearerPrefix starts the value of an authorization header with a token.
+const bearerPrefix = "Bearer "
+
+// tokenAuth rejects requests without one of the shared secret tokens in
+// their authorization header (`Bearer <token>`), over gRPC and the HTTP
+// gateway. Health checks are not authenticated so probes work without a
+// token.
+type tokenAuth struct {
+	tokens [][]byte
+}
+
+// newTokenAuth returns the authentication of tokens and the tokens in file
+// (one per line, blank lines and lines starting with # are skipped), or nil
+// if there are none.
+func newTokenAuth(tokens []string, file string) (*tokenAuth, error) {
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open auth token file: %s", err)
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				tokens = append(tokens, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading auth token file %s: %s", file, err)
+		}
+	}
+	if len(tokens) == 0 {
+		if file != "" {
+			return nil, fmt.Errorf("no tokens in auth token file %s", file)
+		}
+		return nil, nil
+	}
+	a := &tokenAuth{}
+	for _, t := range tokens {
+		a.tokens = append(a.tokens, []byte(t))
+	}
+	return a, nil
+}
+
+// valid returns whether the authorization header value has a valid token.
+// Every token is compared in constant time.
+func (a *tokenAuth) valid(authorization string) bool {
+	if !strings.HasPrefix(authorization, bearerPrefix) {
+		return false
+	}
+	token := []byte(strings.TrimPrefix(authorization, bearerPrefix))
+	ok := false
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(token, t) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// check returns an Unauthenticated error unless the request metadata has a
+// valid token.
+func (a *tokenAuth) check(ctx context.Context, method string) error {
+	if strings.HasPrefix(method, healthServicePrefix) {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if a.valid(v) {
+			return nil
+		}
+	}
+	return status.Errorf(codes.Unauthenticated, "a valid bearer token is required")
+}
+
+func (a *tokenAuth) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := a.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *tokenAuth) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.check(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// Handler rejects HTTP gateway requests without a valid token before they
+// are forwarded to the gRPC server (which checks the token again, since the
+// gateway forwards the authorization header).
+func (a *tokenAuth) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.valid(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "a valid bearer token is required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,116 @@
+package serve
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/rs/zerolog/log"
+
+	"code.ornl.gov/situ/mercury/search"
+)
+
+// dbCache keeps recently used read-only index databases open so that
+// repeated queries (and queries after a Warm) do not pay for opening them
+// again. Databases that are in use are never closed; once more than size
+// are open, the least recently used idle databases are closed.
+type dbCache struct {
+	mu      sync.Mutex
+	size    int
+	opts    search.Options
+	entries map[string]*cacheEntry
+	lru     *list.List // front is most recently used
+}
+
+type cacheEntry struct {
+	path string
+	db   *badger.DB
+	refs int
+	elem *list.Element
+}
+
+func newDBCache(size int, opts search.Options) *dbCache {
+	return &dbCache{
+		size:    size,
+		opts:    opts,
+		entries: make(map[string]*cacheEntry),
+		lru:     list.New(),
+	}
+}
+
+// Get returns the open database for dbPath, opening it if needed. The
+// release function must be called when the caller is done with it.
+func (c *dbCache) Get(dbPath string) (*badger.DB, func(), error) {
+	c.mu.Lock()
+	if e, ok := c.entries[dbPath]; ok {
+		e.refs++
+		c.lru.MoveToFront(e.elem)
+		c.mu.Unlock()
+		return e.db, func() { c.release(e) }, nil
+	}
+	c.mu.Unlock()
+
+	// Open without holding the lock so a slow open does not block other
+	// queries.
+	db, err := search.OpenIndex(dbPath, c.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	indexDBsOpened.Inc()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[dbPath]; ok {
+		// Another query opened it at the same time.
+		db.Close()
+		e.refs++
+		c.lru.MoveToFront(e.elem)
+		return e.db, func() { c.release(e) }, nil
+	}
+	e := &cacheEntry{path: dbPath, db: db, refs: 1}
+	e.elem = c.lru.PushFront(e)
+	c.entries[dbPath] = e
+	return e.db, func() { c.release(e) }, nil
+}
+
+// Contains returns true if the database is open in the cache.
+func (c *dbCache) Contains(dbPath string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[dbPath]
+	return ok
+}
+
+func (c *dbCache) release(e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refs--
+	c.evict()
+}
+
+// evict closes idle databases until the cache is within its size. It
+// must be called with the lock held.
+func (c *dbCache) evict() {
+	for elem := c.lru.Back(); elem != nil && len(c.entries) > c.size; {
+		prev := elem.Prev()
+		e := elem.Value.(*cacheEntry)
+		if e.refs == 0 {
+			log.Debug().Str("db", e.path).Msg("closing cached index database")
+			e.db.Close()
+			c.lru.Remove(elem)
+			delete(c.entries, e.path)
+		}
+		elem = prev
+	}
+}
+
+// Close closes all of the idle databases.
+func (c *dbCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size := c.size
+	c.size = 0
+	c.evict()
+	c.size = size
+	return nil
+}
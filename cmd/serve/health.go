@@ -0,0 +1,79 @@
+package serve
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// healthServicePrefix starts the gRPC methods of the health service.
+	healthServicePrefix = "/grpc.health.v1.Health/"
+	// healthCheckMethod is the gRPC method of health checks.
+	healthCheckMethod = healthServicePrefix + "Check"
+)
+
+// healthChecker reports whether the server can answer queries, for load
+// balancer and Kubernetes probes: over gRPC with the standard health
+// service, and over HTTP at /healthz. The server is not healthy once it is
+// shutting down or while the index base path cannot be read (e.g. a network
+// filesystem that is not mounted).
+type healthChecker struct {
+	*health.Server
+	indexPath string
+}
+
+func newHealthChecker(indexPath string) *healthChecker {
+	return &healthChecker{
+		Server:    health.NewServer(),
+		indexPath: indexPath,
+	}
+}
+
+// Check overrides the health service check to read the index base path.
+// Watch only reports the shutdown.
+func (h *healthChecker) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	resp, err := h.Server.Check(ctx, req)
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return resp, err
+	}
+	if err := h.checkIndexPath(); err != nil {
+		log.Warn().Err(err).Msg("health check failed")
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+	}
+	return resp, nil
+}
+
+// checkIndexPath returns an error if the index base path cannot be listed.
+func (h *healthChecker) checkIndexPath() error {
+	f, err := os.Open(h.indexPath)
+	if err != nil {
+		return fmt.Errorf("unable to open index path: %s", err)
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("unable to read index path: %s", err)
+	}
+	return nil
+}
+
+// ServeHTTP responds 200 if the server is healthy and 503 otherwise, with
+// the serving status in the body.
+func (h *healthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.Check(r.Context(), &healthpb.HealthCheckRequest{})
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case resp.Status != healthpb.HealthCheckResponse_SERVING:
+		http.Error(w, resp.Status.String(), http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, resp.Status.String())
+	}
+}
@@ -0,0 +1,76 @@
+package serve
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recoverUnary converts a panic in a unary handler to an Internal error so
+// a bug in one request does not crash the server.
+func recoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(info.FullMethod, r)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// recoverStream converts a panic in a streaming handler to an Internal
+// error so a bug in one request does not crash the server.
+func recoverStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(info.FullMethod, r)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func recovered(method string, r interface{}) error {
+	log.Error().
+		Str("method", method).
+		Interface("panic", r).
+		Bytes("stack", debug.Stack()).
+		Msg("recovered from panic in request handler")
+	return status.Errorf(codes.Internal, "internal server error")
+}
+
+// logUnary logs each unary request when it completes.
+func logUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logRequest(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+// logStream logs each streaming request when it completes.
+func logStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logRequest(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+func logRequest(ctx context.Context, method string, start time.Time, err error) {
+	addr, _ := clientIdentity(ctx)
+	e := log.Info()
+	if method == healthCheckMethod {
+		// Probes check every few seconds.
+		e = log.Debug()
+	}
+	if err != nil {
+		e = log.Warn().Err(err)
+	}
+	e.Str("method", method).
+		Str("peer", addr).
+		Str("code", status.Code(err).String()).
+		Dur("duration", time.Since(start)).
+		Msg("request completed")
+}
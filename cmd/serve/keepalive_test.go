@@ -0,0 +1,73 @@
+package serve
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+
+	"code.ornl.gov/situ/mercury/common"
+)
+
+func TestKeepaliveIdleStream(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for several keepalive intervals")
+	}
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(keepaliveOptions(common.MinKeepalive)...)
+	defer server.Stop()
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listen)
+
+	// The client pings as often as the server allows, as a query client
+	// with the shortest --keepalive does.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, listen.Addr().String(),
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                common.MinKeepalive,
+			Timeout:             common.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	stream, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("health status %s, want SERVING", resp.Status)
+	}
+
+	// The stream sends nothing for several keepalive intervals, so both
+	// sides ping, and is then still open (it is not closed for pinging
+	// too often).
+	time.Sleep(common.MinKeepalive*2 + common.MinKeepalive/2)
+	healthServer.Shutdown()
+	resp, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("idle stream was closed: %s", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("health status %s, want NOT_SERVING", resp.Status)
+	}
+}
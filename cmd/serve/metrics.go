@@ -0,0 +1,43 @@
+package serve
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/status"
+)
+
+// Prometheus metrics of the query server, served at /metrics (see
+// Options.MetricsPort). The method label is the name of the gRPC method.
+var (
+	queriesServed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mercury_queries_total",
+		Help: "Number of queries served, by method and gRPC status code.",
+	}, []string{"method", "code"})
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "mercury_query_duration_seconds",
+		Help: "Time to serve a query, by method.",
+		// From 10ms to about 45 minutes for queries of long time ranges.
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"method"})
+	packetsStreamed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mercury_packets_streamed_total",
+		Help: "Number of packets sent to clients, by method.",
+	}, []string{"method"})
+	bytesStreamed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mercury_bytes_streamed_total",
+		Help: "Number of response bytes sent to clients, by method.",
+	}, []string{"method"})
+	indexDBsOpened = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mercury_index_dbs_opened_total",
+		Help: "Number of index databases opened (not counting those reused from the index cache).",
+	})
+)
+
+// observeQuery records a query that was started at start and finished
+// with err.
+func observeQuery(method string, start time.Time, err error) {
+	queriesServed.WithLabelValues(method, status.Code(err).String()).Inc()
+	queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
@@ -2,35 +2,37 @@ package serve
 
 import (
 	"bytes"
-	"encoding/base64"
-	"encoding/binary"
+	"context"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net"
-	"os"
 	"path"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
-	"github.com/golang/protobuf/ptypes/duration"
-	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/google/gopacket"
-	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcapgo"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	v1 "code.ornl.gov/situ/mercury/api/v1"
 	"code.ornl.gov/situ/mercury/common"
 	"code.ornl.gov/situ/mercury/index"
+	"code.ornl.gov/situ/mercury/search"
 )
 
 // packetServiceServer is implementation of v1.QueryServiceServer proto interface
 type packetServiceServer struct {
 	indexBasePath string
 	pcapPaths     []string
+	cache         *dbCache
+	searchOpts    search.Options
+	audit         *auditor
+	maxQueryBytes int64
+	concurrency   int
 }
 
 const (
@@ -38,398 +40,398 @@ const (
 	apiVersion = "v1"
 )
 
-var (
-	logger *common.BadgerLogger
-)
-
-func NewPacketQueryService(indexPath string, pcapPaths []string) v1.PacketServiceServer {
-	logger = &common.BadgerLogger{Logger: log.Logger}
+func NewPacketQueryService(indexPath string, pcapPaths []string, opts Options) (v1.PacketServiceServer, error) {
+	audit, err := newAuditor(opts.AuditLog)
+	if err != nil {
+		return nil, err
+	}
+	searchOpts := opts.searchOptions()
 	return &packetServiceServer{
 		indexBasePath: indexPath,
 		pcapPaths:     pcapPaths,
-	}
+		cache:         newDBCache(opts.IndexCacheSize, searchOpts),
+		searchOpts:    searchOpts,
+		audit:         audit,
+		maxQueryBytes: opts.MaxQueryBytes,
+		concurrency:   opts.Concurrency,
+	}, nil
+}
+
+// Close closes the cached index databases and the audit log.
+func (s *packetServiceServer) Close() error {
+	s.audit.Close()
+	return s.cache.Close()
 }
 
 // QueryStream sends protobuf or text data based on request.
 func (s *packetServiceServer) QueryStream(req *v1.QueryReq, stream v1.PacketService_QueryStreamServer) (err error) {
-	label := req.Label
-	if label == "" {
-		label = common.DefaultLabel
-	}
-	indexPath := path.Join(s.indexBasePath, label)
-	startTime, endTime := getTimes(req.StartTime, req.Duration)
-	indices, err := getIndexPaths(indexPath, startTime, endTime)
+	var count int
+	start := time.Now()
+	defer func() {
+		s.audit.Log(stream.Context(), "QueryStream", req, count, err)
+		observeQuery("QueryStream", start, err)
+	}()
+
+	indexPath, indices, err := search.FindIndices(s.indexBasePath, req)
 	if err != nil {
-		return fmt.Errorf("error getting index paths, perhaps label is not set correctly: %s", err)
-	}
-	if len(indices) == 0 {
-		return fmt.Errorf("no indices within the time range %s - %s", startTime.Format(common.FileTimeFormat), endTime.Format(common.FileTimeFormat))
+		return err
 	}
+	stream.SetTrailer(indicesTrailer(indices))
 
-	log.Info().
-		Str("component", "query-server").
-		Str("label", label).
-		Time("start-time", startTime).
-		Time("end-time", endTime).
-		Str("index-path", indexPath).
-		Strs("indices", indices).
-		Str("query-type", req.QueryType.String()).
-		Str("query-arg", req.Query).
-		Msg("executing index query")
-
-	// Loop through the indices and check for the search params.
-	for _, indexName := range indices {
-		dbPath := path.Join(indexPath, indexName)
-		log.Info().Str("db", dbPath).Msg("opening index database")
-		db, err := badger.Open(badger.DefaultOptions(dbPath).WithReadOnly(true).WithLogger(logger))
+	sendResp := func(resp *v1.QueryResp) error {
+		err := stream.Send(resp)
 		if err != nil {
-			return fmt.Errorf("error opening db: %s", err)
+			return fmt.Errorf("error sending response: %s", err)
 		}
-		// Query the index for the requested IP.
-		err = db.View(func(txn *badger.Txn) error {
-			key, err := createKey(req.QueryType, req.Query)
-			if err != nil {
-				return err
-			}
-			item, err := txn.Get(key)
-			if err != nil {
-				if err == badger.ErrKeyNotFound {
-					return nil
-				}
-				return fmt.Errorf("error getting key '%s': %s", req.Query, err)
-			}
+		count++
+		packetsStreamed.WithLabelValues("QueryStream").Inc()
+		bytesStreamed.WithLabelValues("QueryStream").Add(float64(proto.Size(resp)))
+		return nil
+	}
 
-			var v []byte
-			err = item.Value(func(val []byte) error {
-				v = append([]byte{}, val...)
-				return nil
-			})
+	var cursor string
+	// Summaries are read from the packet metadata of indices that have it.
+	if search.MetadataOnly(req) {
+		cursor, err = s.queryIndicesMeta(indexPath, indices, req, func(meta *index.PacketMeta, iface string) error {
+			protoTs, err := ptypes.TimestampProto(meta.Timestamp)
 			if err != nil {
-				return fmt.Errorf("error getting value: %s", err)
+				return fmt.Errorf("error converting timestamp %s for protobuf: %s", meta.Timestamp.String(), err)
 			}
-			var values index.Value
-			err = values.UnmarshalBinary(v)
+			return sendResp(search.NewMetaResp(protoTs, meta, iface))
+		})
+	} else {
+		send := func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			protoTs, err := ptypes.TimestampProto(ts)
 			if err != nil {
-				return fmt.Errorf("error unmarshalling values: %s", err)
-			}
-
-			// Loop through the pcap file path/offset pairs.
-			for _, val := range values {
-				pcapDir := s.pcapPaths[val.PathIdx]
-				n := strings.Replace(indexName, "."+common.IndexNameSuffix, "", 1)
-				pcapFileName := fmt.Sprintf("%s_%d.%s", n, val.PathIdx, common.PcapNameSuffix)
-				pcapFilePath := path.Join(pcapDir, pcapFileName)
-				offset := val.Offset
-
-				file, err := os.Open(pcapFilePath)
-				if err != nil {
-					return fmt.Errorf("error opening file %s: %s", pcapFilePath, err)
-				}
-
-				ts, packetLen, err := readHeaderFromFile(file, int64(offset))
-				if err != nil {
-					return fmt.Errorf("error reading packet header from file %s: %s", pcapFilePath, err)
-				}
-
-				packet, err := readPacketFromFile(file, int64(offset+16), packetLen, ts)
-				if err != nil {
-					return fmt.Errorf("error reading packet data from file %s: %s", pcapFilePath, err)
-				}
-				protoTs, err := ptypes.TimestampProto(ts)
-				if err != nil {
-					return fmt.Errorf("error converting timestamp %s for protobuf: %s", ts.String(), err)
-				}
-
-				resp := createResp(protoTs, packetLen, packet, req.ShowAll, req.Encode)
-				err = stream.Send(resp)
-				if err != nil {
-					return fmt.Errorf("error sending response: %s", err)
-				}
-
-				file.Close()
+				return fmt.Errorf("error converting timestamp %s for protobuf: %s", ts.String(), err)
 			}
-			return nil
-		})
-		if err != nil {
-			return fmt.Errorf("error querying index %s: %s", dbPath, err)
+			return sendResp(search.NewResp(protoTs, packetLen, packet, req.ShowAll, req.Encode, req.IncludeData))
 		}
-
-		db.Close()
+		cursor, err = s.queryIndices(indexPath, indices, req, send)
+	}
+	if err != nil || cursor == "" {
+		return err
+	}
+	// The cursor is not a packet, so it is not counted.
+	err = stream.Send(&v1.QueryResp{Cursor: cursor})
+	if err != nil {
+		return fmt.Errorf("error sending response: %s", err)
 	}
-
 	return nil
 }
 
 // QueryBinaryStream sends binary packet data based on request.
 func (s *packetServiceServer) QueryBinaryStream(req *v1.QueryReq, stream v1.PacketService_QueryBinaryStreamServer) (err error) {
-	label := req.Label
-	if label == "" {
-		label = common.DefaultLabel
-	}
-	indexPath := path.Join(s.indexBasePath, label)
-	startTime, endTime := getTimes(req.StartTime, req.Duration)
-	indices, err := getIndexPaths(indexPath, startTime, endTime)
+	var count int
+	start := time.Now()
+	defer func() {
+		s.audit.Log(stream.Context(), "QueryBinaryStream", req, count, err)
+		observeQuery("QueryBinaryStream", start, err)
+	}()
+
+	indexPath, indices, err := search.FindIndices(s.indexBasePath, req)
 	if err != nil {
-		return fmt.Errorf("error getting index paths, perhaps label is not set correctly: %s", err)
-	}
-	if len(indices) == 0 {
-		return fmt.Errorf("no indices within the time range %s - %s", startTime.Format(common.FileTimeFormat), endTime.Format(common.FileTimeFormat))
+		return err
 	}
+	stream.SetTrailer(indicesTrailer(indices))
 
-	log.Info().
-		Str("component", "query-server").
-		Str("label", label).
-		Time("start-time", startTime).
-		Time("end-time", endTime).
-		Str("index-path", indexPath).
-		Strs("indices", indices).
-		Str("query-type", req.QueryType.String()).
-		Str("query-arg", req.Query).
-		Msg("executing index query")
-
+	// The file header is sent first, once the link type (and for pcapng
+	// the capture interface) of the first packet is known, and then each
+	// packet in its own response. A pcapng packet from a new interface
+	// has the interface description before it.
 	var buf = new(bytes.Buffer)
-	output := pcapgo.NewWriter(buf)
-	err = output.WriteFileHeader(uint32(common.SnapLen), layers.LinkTypeEthernet)
-	if err != nil {
-		return fmt.Errorf("error writing pcap file header: %s", err)
+	sendBuf := func(io.Writer) error {
+		err := stream.Send(&v1.QueryBinaryResp{Binary: buf.Bytes()})
+		if err != nil {
+			return fmt.Errorf("error sending response: %s", err)
+		}
+		bytesStreamed.WithLabelValues("QueryBinaryStream").Add(float64(buf.Len()))
+		buf.Reset()
+		return nil
 	}
-
-	err = stream.Send(&v1.QueryBinaryResp{Binary: buf.Bytes()})
-	if err != nil {
-		return fmt.Errorf("error sending response: %s", err)
+	var output packetWriter
+	if req.BinaryFormat == v1.BinaryFormat_pcapng {
+		ng := search.NewPcapngWriter(buf)
+		ng.AfterHeader = sendBuf
+		output = ng
+	} else {
+		pw := search.NewPcapWriter(buf)
+		pw.AfterHeader = sendBuf
+		output = pw
 	}
 
-	// Loop through the indices and check for the search params.
-	for _, indexName := range indices {
-		dbPath := path.Join(indexPath, indexName)
-		log.Info().Str("index", dbPath).Msg("opening index db")
-		db, err := badger.Open(badger.DefaultOptions(dbPath).WithReadOnly(true).WithLogger(logger))
+	send := func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+		err := output.WritePacket(packet)
+		if err == nil {
+			err = output.Flush()
+		}
 		if err != nil {
-			return fmt.Errorf("error opening db: %s", err)
+			return fmt.Errorf("error writing packet to buffer: %s", err)
 		}
-		// Query the index for the requested IP.
-		err = db.View(func(txn *badger.Txn) error {
-			key, err := createKey(req.QueryType, req.Query)
-			if err != nil {
-				return err
-			}
-			item, err := txn.Get(key)
-			if err != nil {
-				if err == badger.ErrKeyNotFound {
-					return nil
-				}
-				return fmt.Errorf("error getting key '%s': %s", req.Query, err)
-			}
-			var v []byte
-			err = item.Value(func(val []byte) error {
-				v = append([]byte{}, val...)
-				return nil
-			})
-			if err != nil {
-				return fmt.Errorf("error getting value: %s", err)
-			}
-			var values index.Value
-			err = values.UnmarshalBinary(v)
-			if err != nil {
-				return fmt.Errorf("error unmarshalling values: %s", err)
-			}
-
-			// Loop through the pcap file path/offset pairs.
-			for _, val := range values {
-				buf.Reset()
-				pcapDir := s.pcapPaths[val.PathIdx]
-				n := strings.Replace(indexName, "."+common.IndexNameSuffix, "", 1)
-				pcapFileName := fmt.Sprintf("%s_%d.%s", n, val.PathIdx, common.PcapNameSuffix)
-				pcapFilePath := path.Join(pcapDir, pcapFileName)
-				offset := val.Offset
-
-				file, err := os.Open(pcapFilePath)
-				if err != nil {
-					return fmt.Errorf("error opening file %s: %s", pcapFilePath, err)
-				}
-
-				timestamp, packetLen, err := readHeaderFromFile(file, int64(offset))
-				if err != nil {
-					return fmt.Errorf("error reading packet header from file %s: %s", pcapFilePath, err)
-				}
-
-				packet, err := readPacketFromFile(file, int64(offset+16), packetLen, timestamp)
-				if err != nil {
-					return fmt.Errorf("error reading packet data from file %s: %s", pcapFilePath, err)
-				}
-
-				err = output.WritePacket(packet.Metadata().CaptureInfo, packet.Data())
-				if err != nil {
-					return fmt.Errorf("error writing packet to buffer: %s", err)
-				}
-
-				err = stream.Send(&v1.QueryBinaryResp{Binary: buf.Bytes()})
-				if err != nil {
-					return fmt.Errorf("error sending response: %s", err)
-				}
-
-				file.Close()
-			}
-			return nil
-		})
+		err = sendBuf(buf)
 		if err != nil {
-			return fmt.Errorf("error querying index %s: %s", dbPath, err)
+			return err
 		}
-
-		db.Close()
+		count++
+		packetsStreamed.WithLabelValues("QueryBinaryStream").Inc()
+		return nil
 	}
 
+	cursor, err := s.queryIndices(indexPath, indices, req, send)
+	if err != nil {
+		return err
+	}
+	// Sends the header if there were no packets.
+	err = output.Flush()
+	if err != nil || cursor == "" {
+		return err
+	}
+	err = stream.Send(&v1.QueryBinaryResp{Cursor: cursor})
+	if err != nil {
+		return fmt.Errorf("error sending response: %s", err)
+	}
 	return nil
 }
 
-func getTimes(s *timestamp.Timestamp, d *duration.Duration) (start, end time.Time) {
-	start = time.Unix(s.GetSeconds(), int64(s.GetNanos()))
-	nanosecDur := d.GetSeconds()*1000000000 + int64(d.GetNanos())
-	duration, _ := time.ParseDuration(fmt.Sprintf("%dns", nanosecDur))
-	end = start.Add(duration)
-	return
+// packetWriter writes the packets of a binary query (see search.PcapWriter
+// and search.PcapngWriter).
+type packetWriter interface {
+	WritePacket(packet gopacket.Packet) error
+	Flush() error
+}
+
+// indicesTrailer tells the client how many indices a query reads, for its
+// summary.
+func indicesTrailer(indices []string) metadata.MD {
+	return metadata.Pairs(common.IndicesTrailer, strconv.Itoa(len(indices)))
+}
+
+// queryIndices runs a query with the server's index cache and packet byte
+// limit, and returns the cursor of the next page if it stopped at its limit.
+func (s *packetServiceServer) queryIndices(indexPath string, indices []string, req *v1.QueryReq, fn search.PacketFunc) (string, error) {
+	cursor, err := search.QueryIndices(s.cache.Get, indexPath, indices, s.pcapPaths, req, s.searchOpts, s.maxQueryBytes, s.concurrency, fn)
+	return cursor, s.limitError(err)
 }
 
-// Figure out the index paths. ioutil.ReadDir() returns files sorted
-// by filename, so the directories will be in timestamp order.
-func getIndexPaths(indexDir string, start, end time.Time) ([]string, error) {
-	indices := make([]string, 0)
-	dirs, err := ioutil.ReadDir(indexDir)
+// queryIndicesMeta runs a metadata query with the server's index cache and
+// packet byte limit, see queryIndices.
+func (s *packetServiceServer) queryIndicesMeta(indexPath string, indices []string, req *v1.QueryReq, fn search.MetaFunc) (string, error) {
+	cursor, err := search.QueryIndicesMeta(s.cache.Get, indexPath, indices, s.pcapPaths, req, s.searchOpts, s.maxQueryBytes, s.concurrency, fn)
+	return cursor, s.limitError(err)
+}
+
+// limitError returns a resource exhausted error if a query exceeded the
+// packet byte limit, otherwise err.
+func (s *packetServiceServer) limitError(err error) error {
+	if err == search.ErrMaxBytes {
+		return status.Errorf(codes.ResourceExhausted, "query read more than the server limit of %d packet bytes, narrow the time range or query", s.maxQueryBytes)
+	}
+	return err
+}
+
+// QueryFollow sends the packets after the since cursor, sending a new
+// cursor after each packet and each index (see search.FollowIndices).
+// Clients poll it repeatedly to follow a capture that is still running. An
+// index that cannot be opened yet (e.g. it is still being written by the
+// capture) ends the response so it is read on the next poll. The packet
+// byte limit of the server applies to each poll.
+func (s *packetServiceServer) QueryFollow(req *v1.FollowReq, stream v1.PacketService_QueryFollowServer) (err error) {
+	q := req.GetQuery()
+	if q == nil {
+		return fmt.Errorf("follow request is missing the query")
+	}
+	var count int
+	start := time.Now()
+	defer func() {
+		s.audit.Log(stream.Context(), "QueryFollow", q, count, err)
+		observeQuery("QueryFollow", start, err)
+	}()
+
+	if q.FlowSummary != v1.FlowSummary_off {
+		return fmt.Errorf("flow summary is not supported when following")
+	}
+	if q.Limit > 0 || q.Reverse || q.Cursor != "" {
+		return fmt.Errorf("limit, reverse and cursor are not supported when following")
+	}
+	label := q.Label
+	if label == "" {
+		label = common.DefaultLabel
+	}
+	// Each packet is sent with the cursor that resumes after it, so the
+	// next poll does not send it again if this one is interrupted.
+	var result *v1.QueryResp
+	sendResp := func(resp *v1.QueryResp) error {
+		result = resp
+		return nil
+	}
+	next := func(cursor string) error {
+		resp := &v1.FollowResp{Result: result, Cursor: cursor}
+		err := stream.Send(resp)
+		if err != nil {
+			return fmt.Errorf("error sending response: %s", err)
+		}
+		if result != nil {
+			count++
+			packetsStreamed.WithLabelValues("QueryFollow").Inc()
+			result = nil
+		}
+		bytesStreamed.WithLabelValues("QueryFollow").Add(float64(proto.Size(resp)))
+		return nil
+	}
+	indexPath := path.Join(s.indexBasePath, label)
+	startTime, _ := search.GetTimes(q.StartTime, q.Duration)
+	indices, err := search.GetIndexPaths(indexPath, startTime, search.MaxTime)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read directory %s:%s", indexDir, err)
+		// A label without indices yet is fine when following a capture
+		// that just started, but a missing label is likely a mistake.
+		if labelErr := search.CheckLabel(s.indexBasePath, label); labelErr != nil {
+			return labelErr
+		}
+		return fmt.Errorf("error getting index paths: %s", err)
 	}
 
-	for _, dir := range dirs {
-		if dir.IsDir() && strings.HasSuffix(dir.Name(), common.IndexNameSuffix) {
-			ts := strings.TrimSuffix(dir.Name(), "."+common.IndexNameSuffix)
-			t, err := time.Parse(common.FileTimeFormat, ts)
+	if search.MetadataOnly(q) {
+		err = search.FollowIndicesMeta(s.cache.Get, indexPath, indices, s.pcapPaths, q, s.searchOpts, req.Since, s.maxQueryBytes, func(meta *index.PacketMeta, iface string) error {
+			protoTs, err := ptypes.TimestampProto(meta.Timestamp)
 			if err != nil {
-				return nil, fmt.Errorf("unable to parse time from directory %s:%s", indexDir, err)
+				return fmt.Errorf("error converting timestamp %s for protobuf: %s", meta.Timestamp.String(), err)
 			}
-
-			if t.After(start) && t.Before(end) {
-				indices = append(indices, dir.Name())
+			return sendResp(search.NewMetaResp(protoTs, meta, iface))
+		}, next)
+	} else {
+		err = search.FollowIndices(s.cache.Get, indexPath, indices, s.pcapPaths, q, s.searchOpts, req.Since, s.maxQueryBytes, func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			protoTs, err := ptypes.TimestampProto(ts)
+			if err != nil {
+				return fmt.Errorf("error converting timestamp %s for protobuf: %s", ts.String(), err)
 			}
-		}
+			return sendResp(search.NewResp(protoTs, packetLen, packet, q.ShowAll, q.Encode, q.IncludeData))
+		}, next)
 	}
-	return indices, nil
+	return s.limitError(err)
 }
 
-func createKey(queryType v1.QueryType, queryArg string) (key []byte, err error) {
-	var k *index.Key
-	switch queryType {
-	case v1.QueryType_ip:
-		ip := net.ParseIP(queryArg)
-		if ip == nil {
-			return nil, fmt.Errorf("error parsing ip %s: %s", queryArg, err)
+// Warm opens the indices for a label and time range and keeps them in the
+// index cache.
+func (s *packetServiceServer) Warm(ctx context.Context, req *v1.WarmReq) (*v1.WarmResp, error) {
+	if s.cache.size == 0 {
+		return nil, fmt.Errorf("the index cache is disabled, set --index-cache-size to warm indices")
+	}
+	indexPath, indices, err := search.FindIndices(s.indexBasePath, &v1.QueryReq{Label: req.Label, StartTime: req.StartTime, Duration: req.Duration})
+	if err != nil {
+		return nil, err
+	}
+	if len(indices) > s.cache.size {
+		log.Warn().
+			Int("indices", len(indices)).
+			Int("index-cache-size", s.cache.size).
+			Msg("more indices than the cache size, only the newest will stay open")
+	}
+	resp := &v1.WarmResp{Indices: make([]string, 0, len(indices))}
+	for _, indexName := range indices {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
-		// Check if it is IPv4 or IPv6.
-		if ip.To4() != nil {
-			k = index.NewIPv4Key(ip)
-		} else if ip.To16() != nil {
-			k = index.NewIPv6Key(ip)
-		} else {
-			return nil, fmt.Errorf("error creating ip key for %s", queryArg)
+		dbPath := path.Join(indexPath, indexName)
+		if s.cache.Contains(dbPath) {
+			log.Debug().Str("db", dbPath).Msg("index already warm")
 		}
-	case v1.QueryType_port:
-		port, err := strconv.ParseUint(queryArg, 10, 16)
+		_, release, err := s.cache.Get(dbPath)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing port %s: %s", queryArg, err)
+			return nil, err
 		}
-		k = index.NewPortKey(uint16(port))
-	case v1.QueryType_protocol:
-		var proto uint8
-		switch strings.ToLower(queryArg) {
-		case "tcp":
-			proto = 6
-		case "udp":
-			proto = 17
-		case "icmp":
-			proto = 1
-		case "icmp6":
-			proto = 58
-		default:
-			return nil, fmt.Errorf("query protocol %s is not supported", queryArg)
+		release()
+		resp.Indices = append(resp.Indices, indexName)
+	}
+	return resp, nil
+}
+
+// Protocols returns the packet count of each IP protocol in the indices
+// for a label and time range. The counts come from the index keys, so they
+// cover the whole of each index that overlaps the time range.
+func (s *packetServiceServer) Protocols(ctx context.Context, req *v1.ProtocolsReq) (resp *v1.ProtocolsResp, err error) {
+	q := &v1.QueryReq{Label: req.Label, StartTime: req.StartTime, Duration: req.Duration}
+	var count int
+	defer func() { s.audit.Log(ctx, "Protocols", q, count, err) }()
+
+	indexPath, indices, err := search.FindIndices(s.indexBasePath, q)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint8]uint64)
+	for _, indexName := range indices {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		dbPath := path.Join(indexPath, indexName)
+		db, release, err := s.cache.Get(dbPath)
+		if err != nil {
+			return nil, err
 		}
-		k = index.NewProtoKey(proto)
-	case v1.QueryType_mac:
-		mac, err := net.ParseMAC(queryArg)
+		err = search.AddProtocolCounts(db, counts)
+		release()
 		if err != nil {
-			return nil, fmt.Errorf("error parsing MAC %s: %s", queryArg, err)
+			return nil, fmt.Errorf("error counting protocols in index %s: %s", dbPath, err)
 		}
-		k = index.NewMACKey(mac)
-	default:
-		return nil, fmt.Errorf("query type %s is not supported", queryType)
 	}
-	key, err = k.MarshalBinary()
-	if err != nil {
-		return nil, fmt.Errorf("error creating key: %s", err)
+
+	resp = &v1.ProtocolsResp{}
+	for _, p := range search.SortProtocolCounts(counts) {
+		resp.Protocols = append(resp.Protocols, &v1.ProtocolCount{
+			Number:  uint32(p.Number),
+			Name:    p.Name,
+			Packets: p.Packets,
+		})
 	}
-	return key, nil
+	count = len(resp.Protocols)
+	return resp, nil
 }
 
-func readHeaderFromFile(file *os.File, offset int64) (time.Time, int64, error) {
-	packetHeader := make([]byte, 16)
-	_, err := file.ReadAt(packetHeader, int64(offset))
+// Count returns the number of packets that match a query, from the index
+// values alone without reading the pcap files.
+func (s *packetServiceServer) Count(ctx context.Context, req *v1.QueryReq) (resp *v1.CountResp, err error) {
+	var count int
+	defer func() { s.audit.Log(ctx, "Count", req, count, err) }()
+
+	indexPath, indices, err := search.FindIndices(s.indexBasePath, req)
 	if err != nil {
-		return time.Time{}, 0, fmt.Errorf("error reading packet length from file %s: %s", file.Name(), err)
+		return nil, err
 	}
-	sec := binary.LittleEndian.Uint32(packetHeader[0:4])
-	microsec := binary.LittleEndian.Uint32(packetHeader[4:8])
-	timestamp := time.Unix(int64(sec), int64(microsec*1000))
-	packetLen := binary.LittleEndian.Uint32(packetHeader[8:12])
-	return timestamp, int64(packetLen), nil
-}
-
-func readPacketFromFile(file *os.File, offset, packetLen int64, ts time.Time) (gopacket.Packet, error) {
-	packetData := make([]byte, packetLen)
-	_, err := file.ReadAt(packetData, offset)
+	packets, approximate, err := search.CountIndices(s.cache.Get, indexPath, indices, s.pcapPaths, req)
 	if err != nil {
-		return nil, fmt.Errorf("error reading packet data from file %s: %s", file.Name(), err)
+		return nil, err
 	}
-	p := gopacket.NewPacket(packetData, layers.LayerTypeEthernet, gopacket.NoCopy)
-	p.Metadata().Timestamp = ts
-	p.Metadata().Length = int(packetLen)
-	p.Metadata().CaptureLength = int(packetLen)
-	return p, nil
+	count = int(packets)
+	return &v1.CountResp{Packets: packets, Approximate: approximate}, nil
 }
 
-func createResp(ts *timestamp.Timestamp, packetLen int64, packet gopacket.Packet, showAll, base64Enc bool) (resp *v1.QueryResp) {
-
-	// Base 64 encode the text response
-	var t bytes.Buffer
-	t.WriteString(packet.Dump())
-
-	// Only show the full text response if showAll is true.
-	var text string
-	if showAll {
-		if base64Enc {
-			text = base64.StdEncoding.EncodeToString(t.Bytes())
-		} else {
-			text = packet.String()
-		}
+// Stats summarizes the traffic of a host for a label and time range. Every
+// packet of the host is read from the pcap files, or from the packet
+// metadata of indices that have it, so it is subject to the server's
+// packet byte limit like a query.
+func (s *packetServiceServer) Stats(ctx context.Context, req *v1.StatsReq) (resp *v1.StatsResp, err error) {
+	q := &v1.QueryReq{Label: req.Label, StartTime: req.StartTime, Duration: req.Duration, QueryType: v1.QueryType_ip, Query: req.Ip}
+	var count int
+	defer func() { s.audit.Log(ctx, "Stats", q, count, err) }()
+
+	ip := net.ParseIP(req.Ip)
+	if ip == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "error parsing ip %s", req.Ip)
 	}
-
-	resp = &v1.QueryResp{
-		Timestamp: ts,
-		Length:    packetLen,
-		Text:      text,
-		// Data:      packet.Data(),
+	indexPath, indices, err := search.FindIndices(s.indexBasePath, q)
+	if err != nil {
+		return nil, err
 	}
-
-	vers, srcMAC, dstMAC, srcIP, dstIP, srcPort, dstPort, _, proto := common.ParsePacket(packet)
-	resp.SrcMAC = srcMAC.String()
-	resp.DstMAC = dstMAC.String()
-	resp.SrcIP = srcIP.String()
-	resp.DstIP = dstIP.String()
-	resp.SrcPort = uint32(srcPort)
-	resp.SrcPortStr = strconv.FormatUint(uint64(srcPort), 10)
-	resp.DstPort = uint32(dstPort)
-	resp.DstPortStr = strconv.FormatUint(uint64(dstPort), 10)
-	resp.Proto = proto
-	if vers == 6 {
-		resp.Ipv6 = true
+	stats := search.NewHostStats(ip)
+	_, err = s.queryIndicesMeta(indexPath, indices, q, func(meta *index.PacketMeta, iface string) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		stats.Add(meta)
+		count++
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	return
+	return stats.Resp(int(req.Top)), nil
 }
@@ -2,19 +2,27 @@ package serve
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // Register the gzip compressor for clients that request it.
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 
 	v1 "code.ornl.gov/situ/mercury/api/v1"
 	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/search"
 )
 
 type QueryServer struct {
@@ -29,9 +37,64 @@ type QueryServer struct {
 	serverName string
 	indexPath  string
 	pcapPaths  []string
+	opts       Options
+	service    v1.PacketServiceServer
+	health     *healthChecker
 }
 
-func NewQueryServer(grpcPort, httpPort uint16, cert, key, serverName, indexPath string, pcapPaths []string) *QueryServer {
+// Options are optional query server settings.
+type Options struct {
+	// IndexCacheSize is the number of index databases to keep open
+	// between queries (0 disables caching).
+	IndexCacheSize int
+	// Keepalive is how often to ping clients on idle connections.
+	Keepalive time.Duration
+	// RateLimit is the number of HTTP gateway requests per second allowed
+	// from each client IP (0 disables rate limiting), with bursts of up to
+	// RateBurst requests.
+	RateLimit float64
+	RateBurst int
+	// CORSOrigins are the origins allowed to make cross-origin requests
+	// to the HTTP gateway (e.g. a web UI); none are allowed by default.
+	CORSOrigins []string
+	// AuditLog is the file (or "-" for stderr) to write a JSON audit
+	// record of each query to; empty disables audit logging.
+	AuditLog string
+	// OpenRetries is the number of times to retry opening an index
+	// database or pcap file, starting after OpenRetryBackoff and doubling
+	// each time, for transient errors on network filesystems.
+	OpenRetries      int
+	OpenRetryBackoff time.Duration
+	// MaxQueryBytes stops a query with ResourceExhausted once it has read
+	// this many packet bytes (0 for no limit), to protect a shared server
+	// from queries for very common keys.
+	MaxQueryBytes int64
+	// MetricsPort is the port to serve the Prometheus metrics (/metrics)
+	// on, separate from the HTTP gateway; 0 serves them on the gateway.
+	MetricsPort uint16
+	// ClientCA is the certificate authority that signs the certificates
+	// clients must present (mutual TLS); empty accepts any client. The
+	// HTTP gateway is then served over TLS and requires them too, except
+	// for health checks and metrics.
+	ClientCA string
+	// AuthTokens are shared secret tokens, one of which clients must send
+	// as a bearer token in their authorization header, along with the
+	// tokens in AuthTokenFile (one per line); none accepts any client.
+	AuthTokens    []string
+	AuthTokenFile string
+	// Strict fails a query if an index references a pcap file that does
+	// not exist, instead of skipping its packets (see search.Options).
+	Strict bool
+	// EncryptionKey is the AES key that encrypted indices are read with,
+	// nil if they are not encrypted.
+	EncryptionKey []byte
+	// Concurrency is the number of indices each query reads at the same
+	// time, each with an open index database and pcap file. Limited
+	// queries, and all queries if MaxQueryBytes is set, read one at a time.
+	Concurrency int
+}
+
+func NewQueryServer(grpcPort, httpPort uint16, cert, key, serverName, indexPath string, pcapPaths []string, opts Options) *QueryServer {
 	return &QueryServer{
 		grpcPort:   grpcPort,
 		cert:       cert,
@@ -40,6 +103,35 @@ func NewQueryServer(grpcPort, httpPort uint16, cert, key, serverName, indexPath
 		httpPort:   httpPort,
 		indexPath:  indexPath,
 		pcapPaths:  pcapPaths,
+		opts:       opts,
+	}
+}
+
+// searchOptions returns how queries open the index databases and pcap
+// files.
+func (o Options) searchOptions() search.Options {
+	return search.Options{
+		EncryptionKey:    o.EncryptionKey,
+		OpenRetries:      o.OpenRetries,
+		OpenRetryBackoff: o.OpenRetryBackoff,
+		Strict:           o.Strict,
+	}
+}
+
+// keepaliveOptions returns the server options that ping clients every
+// interval on idle connections.
+func keepaliveOptions(interval time.Duration) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    interval,
+			Timeout: common.KeepaliveTimeout,
+		}),
+		// Allow clients to ping as often as the shortest interval they
+		// can be configured with, even between queries.
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             common.MinKeepalive,
+			PermitWithoutStream: true,
+		}),
 	}
 }
 
@@ -49,6 +141,10 @@ func (s *QueryServer) Run(ctx context.Context, done chan<- struct{}) (err error)
 	s.ctx = ctx
 	s.done = done
 
+	if s.opts.Concurrency < 1 {
+		return fmt.Errorf("the query concurrency must be at least 1")
+	}
+
 	// Validate path to certificates and key files.
 	if _, err = os.Stat(s.cert); os.IsNotExist(err) {
 		return fmt.Errorf("tls cert file '%s' does not exist", s.cert)
@@ -57,13 +153,48 @@ func (s *QueryServer) Run(ctx context.Context, done chan<- struct{}) (err error)
 		return fmt.Errorf("tls key file '%s' does not exist", s.key)
 	}
 
+	// Validate that the indices can be served with the pcap-paths.
+	err = search.ValidatePcapPaths(s.indexPath, s.pcapPaths, s.opts.searchOptions())
+	if err != nil {
+		return err
+	}
+
+	s.service, err = NewPacketQueryService(s.indexPath, s.pcapPaths, s.opts)
+	if err != nil {
+		return err
+	}
+	s.health = newHealthChecker(s.indexPath)
+
+	var clientCAs *x509.CertPool
+	if s.opts.ClientCA != "" {
+		clientCAs, err = loadCertPool(s.opts.ClientCA)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("client-ca-file", s.opts.ClientCA).Msg("requiring client certificates")
+	}
+	auth, err := newTokenAuth(s.opts.AuthTokens, s.opts.AuthTokenFile)
+	if err != nil {
+		return err
+	}
+	// Log outside of recovery so recovered panics are logged as Internal
+	// errors, and outside of authentication so rejected requests are
+	// logged.
+	unary := []grpc.UnaryServerInterceptor{logUnary, recoverUnary}
+	stream := []grpc.StreamServerInterceptor{logStream, recoverStream}
+	if auth != nil {
+		log.Info().Int("tokens", len(auth.tokens)).Msg("requiring bearer tokens")
+		unary = append(unary, auth.unary)
+		stream = append(stream, auth.stream)
+	}
+
 	go func() {
 		addr := fmt.Sprintf(":%d", s.grpcPort)
 		listen, err := net.Listen("tcp", addr)
 		if err != nil {
 			log.Fatal().Err(err).Str("grpc-address", addr).Msg("unable to start grpc listen")
 		}
-		creds, err := credentials.NewServerTLSFromFile(s.cert, s.key)
+		creds, err := s.serverCredentials(clientCAs)
 		if err != nil {
 			log.Fatal().Err(err).Str("cert", s.cert).Str("key", s.key).Msg("unable to load certificate")
 		}
@@ -71,10 +202,13 @@ func (s *QueryServer) Run(ctx context.Context, done chan<- struct{}) (err error)
 			grpc.Creds(creds),
 			grpc.MaxSendMsgSize(common.GRPCMaxSize),
 			grpc.MaxRecvMsgSize(common.GRPCMaxSize),
+			grpc.ChainUnaryInterceptor(unary...),
+			grpc.ChainStreamInterceptor(stream...),
 		}
+		opts = append(opts, keepaliveOptions(s.opts.Keepalive)...)
 		s.grpcServer = grpc.NewServer(opts...)
-		packetQueryService := NewPacketQueryService(s.indexPath, s.pcapPaths)
-		v1.RegisterPacketServiceServer(s.grpcServer, packetQueryService)
+		v1.RegisterPacketServiceServer(s.grpcServer, s.service)
+		healthpb.RegisterHealthServer(s.grpcServer, s.health)
 		log.Info().
 			Str("grpc-addr", addr).
 			Str("cert-file", s.cert).
@@ -88,7 +222,7 @@ func (s *QueryServer) Run(ctx context.Context, done chan<- struct{}) (err error)
 
 	grpcServerAddr := fmt.Sprintf("localhost:%d", s.grpcPort)
 	mux := runtime.NewServeMux()
-	creds, err := credentials.NewClientTLSFromFile(s.cert, s.serverName)
+	creds, err := s.gatewayCredentials(clientCAs)
 	if err != nil {
 		log.Fatal().Err(err).Str("cert-file", s.cert).Str("server-name", s.serverName).Msg("unable to create TLS client from cert")
 	}
@@ -103,17 +237,64 @@ func (s *QueryServer) Run(ctx context.Context, done chan<- struct{}) (err error)
 		log.Fatal().Err(err).Str("grpc-address", grpcServerAddr).Msg("register handler from grpc endpoint")
 	}
 	addr := fmt.Sprintf(":%d", s.httpPort)
-	handler := cors.Default().Handler(mux) // Handle CORS requests
+	// Only handle CORS requests for the allowed origins; without the CORS
+	// headers browsers only allow same-origin requests. An empty list is
+	// not passed to cors.New since it would allow all origins.
+	var handler http.Handler = mux
+	if len(s.opts.CORSOrigins) > 0 {
+		log.Info().
+			Strs("cors-origins", s.opts.CORSOrigins).
+			Msg("allowing cross-origin requests")
+		handler = cors.New(cors.Options{
+			AllowedOrigins: s.opts.CORSOrigins,
+			AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		}).Handler(mux)
+	}
+	if s.opts.RateLimit > 0 {
+		log.Info().
+			Float64("rate-limit", s.opts.RateLimit).
+			Int("rate-burst", s.opts.RateBurst).
+			Msg("limiting http requests per client")
+		handler = newRateLimiter(s.opts.RateLimit, s.opts.RateBurst).Handler(handler)
+	}
+	if auth != nil {
+		handler = auth.Handler(handler)
+	}
+	if clientCAs != nil {
+		handler = requireClientCert(handler)
+	}
+	// Health checks and metrics are not rate limited so probes and scrapes
+	// are not refused.
+	root := http.NewServeMux()
+	root.Handle("/healthz", s.health)
+	if s.opts.MetricsPort == 0 {
+		root.Handle("/metrics", promhttp.Handler())
+	} else {
+		err = s.startMetrics()
+		if err != nil {
+			return err
+		}
+	}
+	root.Handle("/", handler)
 	s.httpServer = &http.Server{
 		Addr:    addr,
-		Handler: handler,
+		Handler: root,
 	}
 	log.Info().
 		Uint16("http-port", s.httpPort).
 		Str("cert-file", s.cert).
+		Bool("tls", clientCAs != nil).
 		Msg("starting http gateway")
 
-	go s.httpServer.ListenAndServe()
+	if clientCAs != nil {
+		s.httpServer.TLSConfig = &tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  clientCAs,
+		}
+		go s.httpServer.ListenAndServeTLS(s.cert, s.key)
+	} else {
+		go s.httpServer.ListenAndServe()
+	}
 
 	<-s.ctx.Done()
 	s.Stop()
@@ -121,12 +302,32 @@ func (s *QueryServer) Run(ctx context.Context, done chan<- struct{}) (err error)
 	return nil
 }
 
+// startMetrics serves the Prometheus metrics on their own listener.
+func (s *QueryServer) startMetrics() error {
+	addr := fmt.Sprintf(":%d", s.opts.MetricsPort)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to start metrics listen on %s: %s", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	log.Info().Str("metrics-addr", addr).Msg("serving prometheus metrics")
+	go func() {
+		err := http.Serve(l, mux)
+		log.Error().Err(err).Msg("metrics server stopped")
+	}()
+	return nil
+}
+
 func (s *QueryServer) Stop() {
 	log.Info().
 		Str("grpc-address", fmt.Sprintf(":%d", s.grpcPort)).
 		Str("http-address", fmt.Sprintf(":%d", s.httpPort)).
 		Msg("stopping query server")
 
+	// Fail health checks first so load balancers stop sending queries.
+	s.health.Shutdown()
+
 	err := s.httpServer.Shutdown(context.Background())
 	if err != nil {
 		log.Warn().
@@ -136,5 +337,8 @@ func (s *QueryServer) Stop() {
 	}
 
 	s.grpcServer.GracefulStop()
+	if c, ok := s.service.(io.Closer); ok {
+		c.Close()
+	}
 	s.done <- struct{}{}
 }
@@ -0,0 +1,78 @@
+package serve
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// loadCertPool returns a pool of the PEM certificates in file.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading certificate authority %s: %s", file, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// serverCredentials returns the TLS credentials of the gRPC server. With
+// a client CA, clients must present a certificate signed by it.
+func (s *QueryServer) serverCredentials(clientCAs *x509.CertPool) (credentials.TransportCredentials, error) {
+	if clientCAs == nil {
+		return credentials.NewServerTLSFromFile(s.cert, s.key)
+	}
+	cert, err := tls.LoadX509KeyPair(s.cert, s.key)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}), nil
+}
+
+// gatewayCredentials returns the TLS credentials the HTTP gateway connects
+// to the gRPC server with. With a client CA the gateway presents the server
+// certificate, so it must also be signed by the client CA (and allow client
+// authentication if it has extended key usages).
+func (s *QueryServer) gatewayCredentials(clientCAs *x509.CertPool) (credentials.TransportCredentials, error) {
+	if clientCAs == nil {
+		return credentials.NewClientTLSFromFile(s.cert, s.serverName)
+	}
+	roots, err := loadCertPool(s.cert)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(s.cert, s.key)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+		ServerName:   s.serverName,
+	}), nil
+}
+
+// requireClientCert rejects HTTP requests without a verified client
+// certificate. The TLS config of the HTTP server only verifies the
+// certificates that are given, so health checks and metrics can be served
+// without one.
+func requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "a client certificate is required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,66 @@
+package verify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+
+	"code.ornl.gov/situ/mercury/common"
+)
+
+// Run recomputes the SHA-256 of every pcap file in the pcap paths that has
+// a checksum sidecar and reports any that do not match. Pcap files without
+// a sidecar (captured without --checksum) are skipped.
+func Run(pcapPaths []string) error {
+	logger := log.With().Str("component", "verify").Logger()
+
+	var checked, failed, skipped int
+	for _, pcapPath := range pcapPaths {
+		// Walk the pcap path so files in date partition directories are
+		// verified too.
+		err := filepath.Walk(pcapPath, func(file string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if f.IsDir() {
+				return nil
+			}
+			if _, ok := common.TrimPcapSuffix(f.Name()); !ok {
+				return nil
+			}
+			ok, err := common.VerifyChecksum(file)
+			if err != nil {
+				if os.IsNotExist(err) {
+					skipped++
+					logger.Debug().Str("file", file).Msg("no checksum, skipping")
+					return nil
+				}
+				return err
+			}
+			checked++
+			if !ok {
+				failed++
+				fmt.Printf("%s: FAILED\n", file)
+			} else {
+				fmt.Printf("%s: OK\n", file)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info().
+		Int("checked", checked).
+		Int("failed", failed).
+		Int("skipped", skipped).
+		Msg("verified pcap checksums")
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d pcap files do not match their checksum", failed, checked)
+	}
+	return nil
+}
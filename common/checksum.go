@@ -0,0 +1,62 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+const (
+	// ChecksumSuffix is added to a pcap file name for the sidecar file with
+	// its SHA-256 (e.g. `2006_01_02-15_04_05_0.pcap.sha256`).
+	ChecksumSuffix = "sha256"
+)
+
+// ChecksumPath returns the path of the checksum sidecar for a file.
+func ChecksumPath(file string) string {
+	return file + "." + ChecksumSuffix
+}
+
+// WriteChecksum writes the sidecar for a file in the same format as
+// `sha256sum`, so it can also be checked with `sha256sum -c`.
+func WriteChecksum(file string, sum []byte) error {
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum), path.Base(file))
+	err := ioutil.WriteFile(ChecksumPath(file), []byte(line), 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write checksum for %s: %s", file, err)
+	}
+	return nil
+}
+
+// VerifyChecksum recomputes the SHA-256 of a file and compares it to its
+// sidecar.
+func VerifyChecksum(file string) (ok bool, err error) {
+	b, err := ioutil.ReadFile(ChecksumPath(file))
+	if err != nil {
+		return false, err
+	}
+	fields := bytes.Fields(b)
+	if len(fields) == 0 {
+		return false, fmt.Errorf("empty checksum file %s", ChecksumPath(file))
+	}
+	expected, err := hex.DecodeString(string(fields[0]))
+	if err != nil {
+		return false, fmt.Errorf("invalid checksum in %s: %s", ChecksumPath(file), err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, fmt.Errorf("error reading %s: %s", file, err)
+	}
+	return bytes.Equal(h.Sum(nil), expected), nil
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pcap file compression, see capture --compress.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Compressed pcap files are written in independent blocks (gzip members or
+// zstd frames) of whole packets, so any packet can be read by decompressing
+// its block without the rest of the file. The offset of a packet in the
+// index is the offset of its block in the file shifted left by
+// PcapBlockBits, plus the offset of the packet in the decompressed block.
+const (
+	// PcapBlockBits is the number of low bits of a compressed offset that
+	// are the offset in the block.
+	PcapBlockBits = 20
+	// PcapBlockSize is the decompressed size at which a block is ended.
+	// With one more packet of up to 256KB, blocks stay below
+	// 1<<PcapBlockBits bytes.
+	PcapBlockSize = 256 * 1024
+)
+
+// CompressionSuffixes are the pcap file name suffixes of each compression.
+var CompressionSuffixes = map[string]string{
+	CompressionNone: PcapNameSuffix,
+	CompressionGzip: PcapNameSuffix + ".gz",
+	CompressionZstd: PcapNameSuffix + ".zst",
+}
+
+// PcapFileName returns the name of the pcap file of a pcap-path index with
+// the suffix of the compression (none if it is empty), e.g.
+// `_data/2006_01_02-15_04_05_0.pcap.gz` for base `_data/2006_01_02-15_04_05`.
+func PcapFileName(base string, pathIdx int, compression string) string {
+	suffix, ok := CompressionSuffixes[compression]
+	if !ok {
+		suffix = PcapNameSuffix
+	}
+	return fmt.Sprintf("%s_%d.%s", base, pathIdx, suffix)
+}
+
+// TrimPcapSuffix returns a file name without its pcap suffix (compressed or
+// not) and true, or false if it is not a pcap file name.
+func TrimPcapSuffix(name string) (string, bool) {
+	for _, suffix := range CompressionSuffixes {
+		if strings.HasSuffix(name, "."+suffix) {
+			return strings.TrimSuffix(name, "."+suffix), true
+		}
+	}
+	return name, false
+}
+
+// CompressedOffset returns the index offset of a packet in a compressed pcap
+// file.
+func CompressedOffset(blockOffset int64, offsetInBlock int) uint64 {
+	return uint64(blockOffset)<<PcapBlockBits + uint64(offsetInBlock)
+}
+
+// SplitCompressedOffset returns the offset of the block of a packet in a
+// compressed pcap file and the offset of the packet in the block.
+func SplitCompressedOffset(offset uint64) (blockOffset int64, offsetInBlock int64) {
+	return int64(offset >> PcapBlockBits), int64(offset & (1<<PcapBlockBits - 1))
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"time"
+)
+
+// CaptureConfig is the configuration a capture session was run with. It
+// is stored as JSON in each index so the data can be interpreted (e.g.
+// whether a packet was truncated by the snap length) and the capture
+// reproduced long after the session ended.
+type CaptureConfig struct {
+	Label            string    `json:"label"`
+	Interface        string    `json:"interface,omitempty"`
+	Promiscuous      bool      `json:"promiscuous,omitempty"`
+	InputFiles       []string  `json:"input_files,omitempty"`
+	PcapPaths        []string  `json:"pcap_paths"`
+	LinkType         string    `json:"link_type"`
+	SnapLen          int32     `json:"snap_length"`
+	RotationInterval string    `json:"rotation_interval"`
+	RotationSize     uint64    `json:"rotation_size"`
+	Checksum         bool      `json:"checksum"`
+	Compression      string    `json:"compression"`
+	ServerPortsOnly  bool      `json:"server_ports_only"`
+	PacketMeta       bool      `json:"packet_meta"`
+	PartitionByDate  bool      `json:"partition_by_date"`
+	FileTimeFormat   string    `json:"file_time_format"`
+	Upload           bool      `json:"upload"`
+	DeleteLocal      bool      `json:"delete_local"`
+	MaxDiskBytes     uint64    `json:"max_disk_bytes,omitempty"`
+	StartTime        time.Time `json:"start_time"`
+}
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"path"
+	"strings"
 	"time"
 )
 
@@ -23,15 +25,23 @@ const (
 	// each frame that is actually captured and stored.
 	SnapLen int32 = 8192
 
-	// FileTimeFormat is the format of the date for Pcap and index file names.
-	// Pcap file names will have a numeric suffix at the end (e.g. `_0`).
+	// FileTimeFormat is the default format of the date for Pcap and index
+	// file names (see SetFileTimeFormat). Pcap file names will have a
+	// numeric suffix at the end (e.g. `_0`).
 	FileTimeFormat = "2006_01_02-15_04_05"
 
-	// FilesPerEveryNMinutes is the number of minutes for each file.
-	FilesPerEveryNMinutes = 1
+	// PartitionFormat is the format of the date directories that pcap and
+	// index files are written to when capturing with date partitioning.
+	PartitionFormat = "2006/01/02"
 
-	// MaxPcapFileTime sets the max size of a pcap file.
-	MaxPcapFileTime = FilesPerEveryNMinutes * time.Minute
+	// DefaultRotationInterval is how often a new pcap file is started by
+	// default, see capture --rotate-interval.
+	DefaultRotationInterval = time.Minute
+
+	// MaxPcapFileTime is the longest rotation interval, and so the longest
+	// time a pcap file (and its index) can hold packets for after the time
+	// in its name.
+	MaxPcapFileTime = time.Hour
 
 	// PcapNameSuffix defines the pcap file suffix.
 	PcapNameSuffix = "pcap"
@@ -41,9 +51,52 @@ const (
 
 	// GRPCMaxSize defines the maximum size of a message.
 	GRPCMaxSize = 64 * 1024 * 1024
+
+	// IndicesTrailer is the gRPC trailer with the number of indices a
+	// query read.
+	IndicesTrailer = "mercury-indices"
+
+	// DefaultKeepalive is how often gRPC keepalive pings are sent on an
+	// idle connection so middleboxes do not drop long streams.
+	DefaultKeepalive = 30 * time.Second
+	// MinKeepalive is the shortest keepalive interval the server allows
+	// (and the shortest gRPC clients will use).
+	MinKeepalive = 10 * time.Second
+	// KeepaliveTimeout is how long to wait for a keepalive ping ack before
+	// closing the connection.
+	KeepaliveTimeout = 20 * time.Second
 )
 
 // GetFileBaseName returns the base file name given a start date.
 func GetFileBaseName(d time.Time) string {
-	return d.Format(FileTimeFormat)
+	return d.Format(fileTimeFormat)
+}
+
+// GetFilePath returns the base file name given a start date, in its date
+// partition directory (e.g. `2021/03/01/2021_03_01-15_04_05`) if partition
+// is true.
+func GetFilePath(d time.Time, partition bool) string {
+	if !partition {
+		return GetFileBaseName(d)
+	}
+	return path.Join(d.Format(PartitionFormat), GetFileBaseName(d))
+}
+
+// GetFilePathNano is GetFilePath with the nanoseconds of d after the
+// seconds (e.g. `2021_03_01-15_04_05.123456789`), for a file started in the
+// same second as the one before it. The name still parses with the file
+// time format, since time.Parse accepts fractional seconds after the
+// seconds field. It returns false if the format already has fractional
+// seconds, which time.Parse would then expect to have exactly as many
+// digits.
+func GetFilePathNano(d time.Time, partition bool) (string, bool) {
+	i := strings.LastIndex(fileTimeFormat, "05") + len("05")
+	if strings.HasPrefix(fileTimeFormat[i:], ".0") {
+		return "", false
+	}
+	name := d.Format(fileTimeFormat[:i] + ".000000000" + fileTimeFormat[i:])
+	if !partition {
+		return name, true
+	}
+	return path.Join(d.Format(PartitionFormat), name), true
 }
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DiskSize returns the size of a file, or of the files in a directory.
+func DiskSize(file string) (int64, error) {
+	var size int64
+	err := filepath.Walk(file, func(_ string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !f.IsDir() {
+			size += f.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// RemoveCapture deletes an index in indexBasePath, then its pcap files
+// (compressed or not) in pcapPaths and their checksum sidecars, and returns
+// their size. Partition directories that are left empty are deleted too.
+// Files that were already deleted (e.g. after an upload) are skipped.
+func RemoveCapture(indexBasePath string, pcapPaths []string, indexName string) (int64, error) {
+	filename := strings.TrimSuffix(indexName, "."+IndexNameSuffix)
+	files := []string{path.Join(indexBasePath, indexName)}
+	for i, p := range pcapPaths {
+		for compression := range CompressionSuffixes {
+			pcapFile := PcapFileName(path.Join(p, filename), i, compression)
+			files = append(files, pcapFile, ChecksumPath(pcapFile))
+		}
+	}
+
+	var size int64
+	for _, file := range files {
+		n, err := DiskSize(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return size, err
+		}
+		err = os.RemoveAll(file)
+		if err != nil {
+			return size, fmt.Errorf("error deleting %s: %s", file, err)
+		}
+		size += n
+	}
+
+	for _, root := range append([]string{indexBasePath}, pcapPaths...) {
+		RemoveEmptyDirs(root, filename)
+	}
+	return size, nil
+}
+
+// RemoveEmptyDirs deletes the date partition directories of the file name
+// in root that are empty, from the innermost one.
+func RemoveEmptyDirs(root, name string) {
+	// Removing a directory that is not empty fails, which stops at the
+	// first partition directory that still has files.
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if os.Remove(path.Join(root, dir)) != nil {
+			break
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ManifestVersion is the version of the capture manifest format. It
+	// should be incremented whenever a field is changed or removed.
+	ManifestVersion = 1
+
+	// ManifestNamePrefix and ManifestNameSuffix define the manifest file
+	// name that is written to the label index directory for each capture
+	// session (e.g. `manifest_2006_01_02-15_04_05.json`).
+	ManifestNamePrefix = "manifest_"
+	ManifestNameSuffix = "json"
+)
+
+// ManifestFile describes an index and the pcap files it references.
+type ManifestFile struct {
+	Index string   `json:"index"`
+	Pcaps []string `json:"pcaps"`
+}
+
+// Manifest describes a single capture session so that downstream tools
+// can find the files it produced without globbing directories.
+type Manifest struct {
+	Version          int            `json:"version"`
+	Label            string         `json:"label"`
+	IndexPath        string         `json:"index_path"`
+	PcapPaths        []string       `json:"pcap_paths"`
+	Interface        string         `json:"interface,omitempty"`
+	InputFiles       []string       `json:"input_files,omitempty"`
+	LinkType         string         `json:"link_type"`
+	SnapLen          int32          `json:"snap_length"`
+	RotationInterval string         `json:"rotation_interval"`
+	RotationSize     uint64         `json:"rotation_size"`
+	StartTime        time.Time      `json:"start_time"`
+	EndTime          *time.Time     `json:"end_time,omitempty"`
+	Files            []ManifestFile `json:"files"`
+
+	mu sync.Mutex
+}
+
+// ManifestPath returns the path of the manifest for a capture session
+// started at the given time.
+func ManifestPath(indexPath string, start time.Time) string {
+	return path.Join(indexPath, fmt.Sprintf("%s%s.%s", ManifestNamePrefix, GetFileBaseName(start.UTC()), ManifestNameSuffix))
+}
+
+// AddFile records an index and its pcap files and saves the manifest.
+func (m *Manifest) AddFile(f ManifestFile) error {
+	m.mu.Lock()
+	m.Files = append(m.Files, f)
+	m.mu.Unlock()
+	return m.Save()
+}
+
+// Finalize sets the end time of the capture session and saves the
+// manifest.
+func (m *Manifest) Finalize(end time.Time) error {
+	m.mu.Lock()
+	end = end.UTC()
+	m.EndTime = &end
+	m.mu.Unlock()
+	return m.Save()
+}
+
+// Save writes the manifest to a temporary file and renames it into place
+// so readers never see a partially written manifest.
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode manifest: %s", err)
+	}
+	p := ManifestPath(m.IndexPath, m.StartTime)
+	tmp := p + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write manifest %s: %s", tmp, err)
+	}
+	err = os.Rename(tmp, p)
+	if err != nil {
+		return fmt.Errorf("unable to rename manifest %s: %s", tmp, err)
+	}
+	return nil
+}
+
+// ReadManifests reads all of the capture manifests in a label index
+// directory, sorted by start time.
+func ReadManifests(indexPath string) ([]*Manifest, error) {
+	files, err := ioutil.ReadDir(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	manifests := make([]*Manifest, 0)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), ManifestNamePrefix) || !strings.HasSuffix(f.Name(), "."+ManifestNameSuffix) {
+			continue
+		}
+		b, err := ioutil.ReadFile(path.Join(indexPath, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := &Manifest{}
+		err = json.Unmarshal(b, m)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode manifest %s: %s", f.Name(), err)
+		}
+		manifests = append(manifests, m)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].StartTime.Before(manifests[j].StartTime)
+	})
+	return manifests, nil
+}
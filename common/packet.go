@@ -8,59 +8,121 @@ import (
 	"github.com/google/gopacket/layers"
 )
 
-// ParsePacket will parse key fields out of a packet.
+// ParsePacket will parse key fields out of a packet. The IP addresses and
+// ports are found whatever the link layer is (e.g. raw IP, Linux cooked or
+// loopback captures), and the MAC addresses are nil unless it is Ethernet
+// or 802.11.
 func ParsePacket(packet gopacket.Packet) (vers uint8, sMAC, dMAC net.HardwareAddr, sIP, dIP net.IP, sPort, dPort uint16, proto uint8, protoStr string) {
-	// If this an ethernet packet, continue
-	ethernetLayer := packet.Layer(layers.LayerTypeEthernet)
-	if ethernetLayer != nil {
-
-		if ip4Layer := packet.Layer(layers.LayerTypeIPv4); ip4Layer != nil {
-			vers = uint8(4)
-		}
-		if ip6Layer := packet.Layer(layers.LayerTypeIPv6); ip6Layer != nil {
-			vers = uint8(6)
-		}
+	// Set MAC address
+	if ethernetLayer := packet.Layer(layers.LayerTypeEthernet); ethernetLayer != nil {
 		ethernetPacket, _ := ethernetLayer.(*layers.Ethernet)
-
-		// Set MAC address
 		sMAC = ethernetPacket.SrcMAC
 		dMAC = ethernetPacket.DstMAC
+	} else if dot11Layer := packet.Layer(layers.LayerTypeDot11); dot11Layer != nil {
+		sMAC, dMAC, _ = Dot11Addrs(dot11Layer.(*layers.Dot11))
+	}
 
-		// If there is a network layer, get IPs and (for tcp and udp) ports
-		if n := packet.NetworkLayer(); n != nil {
-			flow := n.NetworkFlow()
-			src, dst := flow.Endpoints()
-			sIP = net.ParseIP(src.String())
-			dIP = net.ParseIP(dst.String())
+	if ip4Layer := packet.Layer(layers.LayerTypeIPv4); ip4Layer != nil {
+		vers = uint8(4)
+	}
+	if ip6Layer := packet.Layer(layers.LayerTypeIPv6); ip6Layer != nil {
+		vers = uint8(6)
+	}
 
-			tcp := packet.Layer(layers.LayerTypeTCP)
-			if tcp != nil {
-				proto = uint8(6)
-				protoStr = "TCP"
-			}
-			udp := packet.Layer(layers.LayerTypeUDP)
-			if udp != nil {
-				proto = uint8(17)
-				protoStr = "UDP"
-			}
-			icmp := packet.Layer(layers.LayerTypeICMPv4)
-			if icmp != nil {
-				proto = uint8(1)
-				protoStr = "ICMP"
-			}
-			icmp6 := packet.Layer(layers.LayerTypeICMPv6)
-			if icmp6 != nil {
-				proto = uint8(58)
-				protoStr = "ICMPv6"
-			}
-			if tcp != nil || udp != nil {
-				src, dst := packet.TransportLayer().TransportFlow().Endpoints()
-				sp, _ := strconv.ParseUint(src.String(), 10, 16)
-				sPort = uint16(sp)
-				dp, _ := strconv.ParseUint(dst.String(), 10, 16)
-				dPort = uint16(dp)
-			}
+	// If there is a network layer, get IPs and (for tcp and udp) ports
+	if n := packet.NetworkLayer(); n != nil {
+		flow := n.NetworkFlow()
+		src, dst := flow.Endpoints()
+		sIP = net.ParseIP(src.String())
+		dIP = net.ParseIP(dst.String())
+
+		tcp := packet.Layer(layers.LayerTypeTCP)
+		if tcp != nil {
+			proto = uint8(6)
+			protoStr = "TCP"
+		}
+		udp := packet.Layer(layers.LayerTypeUDP)
+		if udp != nil {
+			proto = uint8(17)
+			protoStr = "UDP"
+		}
+		icmp := packet.Layer(layers.LayerTypeICMPv4)
+		if icmp != nil {
+			proto = uint8(1)
+			protoStr = "ICMP"
+		}
+		icmp6 := packet.Layer(layers.LayerTypeICMPv6)
+		if icmp6 != nil {
+			proto = uint8(58)
+			protoStr = "ICMPv6"
+		}
+		if tcp != nil || udp != nil {
+			src, dst := packet.TransportLayer().TransportFlow().Endpoints()
+			sp, _ := strconv.ParseUint(src.String(), 10, 16)
+			sPort = uint16(sp)
+			dp, _ := strconv.ParseUint(dst.String(), 10, 16)
+			dPort = uint16(dp)
 		}
 	}
 	return
 }
+
+// Dot11Addrs returns the source, destination and BSSID addresses of an
+// 802.11 frame, which depend on the To DS and From DS flags. Frames
+// between access points (both flags set) have no BSSID, and control
+// frames may not have a source address.
+func Dot11Addrs(dot11 *layers.Dot11) (sMAC, dMAC, bssid net.HardwareAddr) {
+	toDS := dot11.Flags.ToDS()
+	fromDS := dot11.Flags.FromDS()
+	switch {
+	case !toDS && !fromDS:
+		return dot11.Address2, dot11.Address1, dot11.Address3
+	case toDS && !fromDS:
+		return dot11.Address2, dot11.Address3, dot11.Address1
+	case !toDS && fromDS:
+		return dot11.Address3, dot11.Address1, dot11.Address2
+	default:
+		return dot11.Address4, dot11.Address3, nil
+	}
+}
+
+// VLANIDs returns the 802.1Q VLAN IDs of a packet, the outer tag first if
+// it has stacked (QinQ) tags, or nil if it is not tagged.
+func VLANIDs(packet gopacket.Packet) []uint16 {
+	var ids []uint16
+	for _, l := range packet.Layers() {
+		if dot1q, ok := l.(*layers.Dot1Q); ok {
+			ids = append(ids, dot1q.VLANIdentifier)
+		}
+	}
+	return ids
+}
+
+// IPProtocol returns the protocol number from the IPv4 or IPv6 header, or 0
+// if there is no IP layer.
+func IPProtocol(packet gopacket.Packet) uint8 {
+	if ip4Layer := packet.Layer(layers.LayerTypeIPv4); ip4Layer != nil {
+		return uint8(ip4Layer.(*layers.IPv4).Protocol)
+	}
+	if ip6Layer := packet.Layer(layers.LayerTypeIPv6); ip6Layer != nil {
+		return uint8(ip6Layer.(*layers.IPv6).NextHeader)
+	}
+	return 0
+}
+
+// ProtoString returns the name ParsePacket gives an IP protocol number, or
+// an empty string for the protocols it does not name.
+func ProtoString(proto uint8) string {
+	switch proto {
+	case 1:
+		return "ICMP"
+	case 6:
+		return "TCP"
+	case 17:
+		return "UDP"
+	case 58:
+		return "ICMPv6"
+	default:
+		return ""
+	}
+}
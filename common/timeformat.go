@@ -0,0 +1,94 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// fileTimeFormat is the format of the date for pcap and index file names,
+// FileTimeFormat unless it is changed with SetFileTimeFormat.
+var fileTimeFormat = FileTimeFormat
+
+// sortableTimeFields are the fields a file time format must have, in
+// order, so that file names sort by time.
+var sortableTimeFields = []string{"2006", "01", "02", "15", "04", "05"}
+
+// GetFileTimeFormat returns the format of the date for pcap and index file
+// names.
+func GetFileTimeFormat() string {
+	return fileTimeFormat
+}
+
+// SetFileTimeFormat changes the format of the date for pcap and index file
+// names. It must be called before any files are written or searched, and
+// capture and serve must use the same format. The format is rejected
+// unless file names sort by time.
+func SetFileTimeFormat(format string) error {
+	err := ValidateFileTimeFormat(format)
+	if err != nil {
+		return err
+	}
+	fileTimeFormat = format
+	return nil
+}
+
+// ValidateFileTimeFormat checks that a time format (see time.Format) can be
+// used for file names that sort lexicographically by time, which finding
+// the indices for a query relies on: it must have the fixed width year,
+// month, day, hour, minute and second fields (2006, 01, 02, 15, 04 and 05),
+// in that order, optionally followed by fractional seconds with trailing
+// zeros (e.g. .000). Other characters are copied to the name as is, but
+// must not be digits, names of months, days or time zones, or a path
+// separator.
+func ValidateFileTimeFormat(format string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("invalid file time format %q: %s", format, reason)
+	}
+	if strings.ContainsAny(format, `/\`) {
+		return invalid("it cannot contain a path separator")
+	}
+	for _, name := range []string{"Jan", "Mon", "MST", "PM", "pm"} {
+		if strings.Contains(format, name) {
+			return invalid(fmt.Sprintf("%s is not a fixed width, sortable field", name))
+		}
+	}
+
+	next := 0
+	for i := 0; i < len(format); {
+		if format[i] < '0' || format[i] > '9' {
+			i++
+			continue
+		}
+		if next < len(sortableTimeFields) && strings.HasPrefix(format[i:], sortableTimeFields[next]) {
+			i += len(sortableTimeFields[next])
+			next++
+			continue
+		}
+		// Fractional seconds, e.g. .000000.
+		if next == len(sortableTimeFields) && i > 0 && format[i-1] == '.' && format[i] == '0' {
+			for i < len(format) && format[i] == '0' {
+				i++
+			}
+			continue
+		}
+		if next < len(sortableTimeFields) {
+			return invalid(fmt.Sprintf("expected %s at position %d, the year, month, day, hour, minute and second fields (2006, 01, 02, 15, 04, 05) are required in that order", sortableTimeFields[next], i))
+		}
+		return invalid(fmt.Sprintf("unexpected %q at position %d after the seconds (only fractional seconds with zeros, e.g. .000, are allowed)", format[i], i))
+	}
+	if next < len(sortableTimeFields) {
+		return invalid(fmt.Sprintf("missing %s, the year, month, day, hour, minute and second fields (2006, 01, 02, 15, 04, 05) are required in that order", sortableTimeFields[next]))
+	}
+
+	// The name must parse back to the time it was formatted from.
+	t := time.Date(2021, 3, 1, 13, 4, 5, 123456789, time.UTC)
+	parsed, err := time.Parse(format, t.Format(format))
+	if err != nil {
+		return invalid(err.Error())
+	}
+	if !parsed.Truncate(time.Second).Equal(t.Truncate(time.Second)) {
+		return invalid("file names do not parse back to the time they were written for")
+	}
+	return nil
+}
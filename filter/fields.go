@@ -0,0 +1,194 @@
+package filter
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type fieldKind int
+
+const (
+	kindProtocol fieldKind = iota
+	kindNumber
+	kindIP
+	kindMAC
+)
+
+// field is a protocol or a field of a protocol. Protocols can only be
+// tested for presence; fields return their values (uint64, net.IP or
+// net.HardwareAddr) or nothing if the packet does not have them.
+type field struct {
+	kind    fieldKind
+	present func(packet gopacket.Packet) bool
+	values  func(packet gopacket.Packet) []interface{}
+}
+
+func protocol(t gopacket.LayerType) *field {
+	return &field{
+		kind: kindProtocol,
+		present: func(packet gopacket.Packet) bool {
+			return packet.Layer(t) != nil
+		},
+	}
+}
+
+// layerField returns a field that gets its values from the first layer of
+// type t.
+func layerField(kind fieldKind, t gopacket.LayerType, fn func(l gopacket.Layer) []interface{}) *field {
+	return &field{
+		kind: kind,
+		values: func(packet gopacket.Packet) []interface{} {
+			l := packet.Layer(t)
+			if l == nil {
+				return nil
+			}
+			return fn(l)
+		},
+	}
+}
+
+func num(n uint64) []interface{} {
+	return []interface{}{n}
+}
+
+func flag(b bool) []interface{} {
+	if b {
+		return num(1)
+	}
+	return num(0)
+}
+
+func ipv4(fn func(ip *layers.IPv4) []interface{}) *field {
+	return layerField(kindNumber, layers.LayerTypeIPv4, func(l gopacket.Layer) []interface{} {
+		return fn(l.(*layers.IPv4))
+	})
+}
+
+func ipv4Addr(fn func(ip *layers.IPv4) []interface{}) *field {
+	f := ipv4(fn)
+	f.kind = kindIP
+	return f
+}
+
+func ipv6(fn func(ip *layers.IPv6) []interface{}) *field {
+	return layerField(kindNumber, layers.LayerTypeIPv6, func(l gopacket.Layer) []interface{} {
+		return fn(l.(*layers.IPv6))
+	})
+}
+
+func ipv6Addr(fn func(ip *layers.IPv6) []interface{}) *field {
+	f := ipv6(fn)
+	f.kind = kindIP
+	return f
+}
+
+func eth(fn func(eth *layers.Ethernet) []interface{}) *field {
+	return layerField(kindMAC, layers.LayerTypeEthernet, func(l gopacket.Layer) []interface{} {
+		return fn(l.(*layers.Ethernet))
+	})
+}
+
+func tcp(fn func(tcp *layers.TCP) []interface{}) *field {
+	return layerField(kindNumber, layers.LayerTypeTCP, func(l gopacket.Layer) []interface{} {
+		return fn(l.(*layers.TCP))
+	})
+}
+
+func udp(fn func(udp *layers.UDP) []interface{}) *field {
+	return layerField(kindNumber, layers.LayerTypeUDP, func(l gopacket.Layer) []interface{} {
+		return fn(l.(*layers.UDP))
+	})
+}
+
+// fields are the protocols and fields that can be used in a filter.
+var fields = map[string]*field{
+	"eth":    protocol(layers.LayerTypeEthernet),
+	"vlan":   protocol(layers.LayerTypeDot1Q),
+	"mpls":   protocol(layers.LayerTypeMPLS),
+	"arp":    protocol(layers.LayerTypeARP),
+	"ip":     protocol(layers.LayerTypeIPv4),
+	"ipv6":   protocol(layers.LayerTypeIPv6),
+	"icmp":   protocol(layers.LayerTypeICMPv4),
+	"icmpv6": protocol(layers.LayerTypeICMPv6),
+	"tcp":    protocol(layers.LayerTypeTCP),
+	"udp":    protocol(layers.LayerTypeUDP),
+	"dns":    protocol(layers.LayerTypeDNS),
+	"vxlan":  protocol(layers.LayerTypeVXLAN),
+	"wlan":   protocol(layers.LayerTypeDot11),
+
+	"frame.len": {kind: kindNumber, values: func(packet gopacket.Packet) []interface{} {
+		if md := packet.Metadata(); md != nil && md.Length > 0 {
+			return num(uint64(md.Length))
+		}
+		return num(uint64(len(packet.Data())))
+	}},
+
+	"eth.src":  eth(func(e *layers.Ethernet) []interface{} { return []interface{}{e.SrcMAC} }),
+	"eth.dst":  eth(func(e *layers.Ethernet) []interface{} { return []interface{}{e.DstMAC} }),
+	"eth.addr": eth(func(e *layers.Ethernet) []interface{} { return []interface{}{e.SrcMAC, e.DstMAC} }),
+	"eth.type": layerField(kindNumber, layers.LayerTypeEthernet, func(l gopacket.Layer) []interface{} {
+		return num(uint64(l.(*layers.Ethernet).EthernetType))
+	}),
+
+	// Stacked (QinQ) VLAN tags each add an ID.
+	"vlan.id": {kind: kindNumber, values: func(packet gopacket.Packet) []interface{} {
+		var ids []interface{}
+		for _, l := range packet.Layers() {
+			if vlan, ok := l.(*layers.Dot1Q); ok {
+				ids = append(ids, uint64(vlan.VLANIdentifier))
+			}
+		}
+		return ids
+	}},
+	"mpls.label": layerField(kindNumber, layers.LayerTypeMPLS, func(l gopacket.Layer) []interface{} {
+		return num(uint64(l.(*layers.MPLS).Label))
+	}),
+	"vxlan.vni": layerField(kindNumber, layers.LayerTypeVXLAN, func(l gopacket.Layer) []interface{} {
+		return num(uint64(l.(*layers.VXLAN).VNI))
+	}),
+
+	"ip.src":   ipv4Addr(func(ip *layers.IPv4) []interface{} { return []interface{}{ip.SrcIP} }),
+	"ip.dst":   ipv4Addr(func(ip *layers.IPv4) []interface{} { return []interface{}{ip.DstIP} }),
+	"ip.addr":  ipv4Addr(func(ip *layers.IPv4) []interface{} { return []interface{}{ip.SrcIP, ip.DstIP} }),
+	"ip.proto": ipv4(func(ip *layers.IPv4) []interface{} { return num(uint64(ip.Protocol)) }),
+	"ip.ttl":   ipv4(func(ip *layers.IPv4) []interface{} { return num(uint64(ip.TTL)) }),
+	"ip.len":   ipv4(func(ip *layers.IPv4) []interface{} { return num(uint64(ip.Length)) }),
+
+	"ipv6.src":  ipv6Addr(func(ip *layers.IPv6) []interface{} { return []interface{}{ip.SrcIP} }),
+	"ipv6.dst":  ipv6Addr(func(ip *layers.IPv6) []interface{} { return []interface{}{ip.DstIP} }),
+	"ipv6.addr": ipv6Addr(func(ip *layers.IPv6) []interface{} { return []interface{}{ip.SrcIP, ip.DstIP} }),
+	"ipv6.nxt":  ipv6(func(ip *layers.IPv6) []interface{} { return num(uint64(ip.NextHeader)) }),
+	"ipv6.hlim": ipv6(func(ip *layers.IPv6) []interface{} { return num(uint64(ip.HopLimit)) }),
+
+	"icmp.type": layerField(kindNumber, layers.LayerTypeICMPv4, func(l gopacket.Layer) []interface{} {
+		return num(uint64(l.(*layers.ICMPv4).TypeCode.Type()))
+	}),
+	"icmp.code": layerField(kindNumber, layers.LayerTypeICMPv4, func(l gopacket.Layer) []interface{} {
+		return num(uint64(l.(*layers.ICMPv4).TypeCode.Code()))
+	}),
+	"icmpv6.type": layerField(kindNumber, layers.LayerTypeICMPv6, func(l gopacket.Layer) []interface{} {
+		return num(uint64(l.(*layers.ICMPv6).TypeCode.Type()))
+	}),
+	"icmpv6.code": layerField(kindNumber, layers.LayerTypeICMPv6, func(l gopacket.Layer) []interface{} {
+		return num(uint64(l.(*layers.ICMPv6).TypeCode.Code()))
+	}),
+
+	"tcp.srcport":   tcp(func(t *layers.TCP) []interface{} { return num(uint64(t.SrcPort)) }),
+	"tcp.dstport":   tcp(func(t *layers.TCP) []interface{} { return num(uint64(t.DstPort)) }),
+	"tcp.port":      tcp(func(t *layers.TCP) []interface{} { return []interface{}{uint64(t.SrcPort), uint64(t.DstPort)} }),
+	"tcp.len":       tcp(func(t *layers.TCP) []interface{} { return num(uint64(len(t.Payload))) }),
+	"tcp.seq":       tcp(func(t *layers.TCP) []interface{} { return num(uint64(t.Seq)) }),
+	"tcp.ack":       tcp(func(t *layers.TCP) []interface{} { return num(uint64(t.Ack)) }),
+	"tcp.window":    tcp(func(t *layers.TCP) []interface{} { return num(uint64(t.Window)) }),
+	"tcp.flags.syn": tcp(func(t *layers.TCP) []interface{} { return flag(t.SYN) }),
+	"tcp.flags.ack": tcp(func(t *layers.TCP) []interface{} { return flag(t.ACK) }),
+	"tcp.flags.fin": tcp(func(t *layers.TCP) []interface{} { return flag(t.FIN) }),
+	"tcp.flags.rst": tcp(func(t *layers.TCP) []interface{} { return flag(t.RST) }),
+	"tcp.flags.psh": tcp(func(t *layers.TCP) []interface{} { return flag(t.PSH) }),
+	"tcp.flags.urg": tcp(func(t *layers.TCP) []interface{} { return flag(t.URG) }),
+
+	"udp.srcport": udp(func(u *layers.UDP) []interface{} { return num(uint64(u.SrcPort)) }),
+	"udp.dstport": udp(func(u *layers.UDP) []interface{} { return num(uint64(u.DstPort)) }),
+	"udp.port":    udp(func(u *layers.UDP) []interface{} { return []interface{}{uint64(u.SrcPort), uint64(u.DstPort)} }),
+	"udp.length":  udp(func(u *layers.UDP) []interface{} { return num(uint64(u.Length)) }),
+}
@@ -0,0 +1,421 @@
+// Package filter implements a small subset of the Wireshark display filter
+// language that is evaluated against decoded packets, e.g.
+// `tcp.port == 443 && ip.addr == 10.0.0.0/8`.
+//
+// Expressions combine comparisons and protocol or field names with `&&`
+// (`and`), `||` (`or`), `!` (`not`) and parentheses. A comparison is a field,
+// an operator (`==`, `!=`, `<`, `<=`, `>`, `>=` or `eq`, `ne`, `lt`, `le`,
+// `gt`, `ge`) and a value. A bare name is true if the protocol or field is
+// present in the packet. Fields like `ip.addr` and `tcp.port` match either
+// direction; `==` is true if any of their values matches and `!=` is true if
+// the field is present and none of its values match. IP addresses can be
+// compared to a CIDR block with `==` and `!=`, and only numeric fields can
+// be compared with `<`, `<=`, `>` and `>=`.
+package filter
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+)
+
+// Filter is a compiled display filter.
+type Filter struct {
+	expr string
+	root node
+}
+
+// Compile parses a display filter expression.
+func Compile(expr string) (*Filter, error) {
+	p := &parser{lex: newLexer(expr)}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid display filter %q: %s", expr, err)
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("invalid display filter %q: unexpected %q at position %d", expr, p.tok.text, p.tok.pos)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// Match returns true if the packet matches the filter.
+func (f *Filter) Match(packet gopacket.Packet) bool {
+	return f.root.match(packet)
+}
+
+// String returns the filter expression.
+func (f *Filter) String() string {
+	return f.expr
+}
+
+//===============================================
+// Lexer
+//===============================================
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokCompare
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type lexer struct {
+	s   string
+	pos int
+}
+
+func newLexer(s string) *lexer {
+	return &lexer{s: s}
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '.' || c == '_' || c == ':' || c == '/' || c == '-'
+}
+
+// wordOps are the word forms of the operators.
+var wordOps = map[string]token{
+	"and": {kind: tokAnd, text: "&&"},
+	"or":  {kind: tokOr, text: "||"},
+	"not": {kind: tokNot, text: "!"},
+	"eq":  {kind: tokCompare, text: "=="},
+	"ne":  {kind: tokCompare, text: "!="},
+	"lt":  {kind: tokCompare, text: "<"},
+	"le":  {kind: tokCompare, text: "<="},
+	"gt":  {kind: tokCompare, text: ">"},
+	"ge":  {kind: tokCompare, text: ">="},
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.s) && (l.s[l.pos] == ' ' || l.s[l.pos] == '\t') {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.s) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	two := ""
+	if l.pos+1 < len(l.s) {
+		two = l.s[l.pos : l.pos+2]
+	}
+	switch two {
+	case "&&":
+		l.pos += 2
+		return token{kind: tokAnd, text: two, pos: start}, nil
+	case "||":
+		l.pos += 2
+		return token{kind: tokOr, text: two, pos: start}, nil
+	case "==", "!=", "<=", ">=":
+		l.pos += 2
+		return token{kind: tokCompare, text: two, pos: start}, nil
+	}
+
+	c := l.s[l.pos]
+	switch c {
+	case '<', '>':
+		l.pos++
+		return token{kind: tokCompare, text: string(c), pos: start}, nil
+	case '!':
+		l.pos++
+		return token{kind: tokNot, text: "!", pos: start}, nil
+	case '(':
+		l.pos++
+		return token{kind: tokLParen, text: "(", pos: start}, nil
+	case ')':
+		l.pos++
+		return token{kind: tokRParen, text: ")", pos: start}, nil
+	}
+
+	for l.pos < len(l.s) && isWordChar(l.s[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		return token{}, fmt.Errorf("unexpected %q at position %d", c, start)
+	}
+	word := l.s[start:l.pos]
+	if t, ok := wordOps[strings.ToLower(word)]; ok {
+		t.pos = start
+		return t, nil
+	}
+	return token{kind: tokWord, text: word, pos: start}, nil
+}
+
+//===============================================
+// Parser
+//===============================================
+
+type parser struct {
+	lex *lexer
+	tok token
+	err error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+	if p.err != nil {
+		p.tok = token{kind: tokEOF}
+	}
+}
+
+// parseOr parses `and ( || and )*`.
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, p.err
+}
+
+// parseAnd parses `not ( && not )*`.
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokAnd {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, p.err
+}
+
+// parseNot parses `! not | primary`.
+func (p *parser) parseNot() (node, error) {
+	if p.tok.kind == tokNot {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses `( or ) | field | field op value`.
+func (p *parser) parsePrimary() (node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	switch p.tok.kind {
+	case tokLParen:
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at position %d", p.tok.pos)
+		}
+		p.next()
+		return n, nil
+	case tokWord:
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of filter")
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", p.tok.text, p.tok.pos)
+	}
+
+	name := strings.ToLower(p.tok.text)
+	f, ok := fields[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at position %d", p.tok.text, p.tok.pos)
+	}
+	p.next()
+	if p.tok.kind != tokCompare {
+		return &presentNode{f}, p.err
+	}
+	op := p.tok.text
+	p.next()
+	if p.tok.kind != tokWord {
+		return nil, fmt.Errorf("expected a value after %s %s at position %d", name, op, p.tok.pos)
+	}
+	c, err := newCompareNode(name, f, op, p.tok.text)
+	if err != nil {
+		return nil, fmt.Errorf("%s at position %d", err, p.tok.pos)
+	}
+	p.next()
+	return c, p.err
+}
+
+//===============================================
+// Evaluation
+//===============================================
+
+type node interface {
+	match(packet gopacket.Packet) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n *andNode) match(packet gopacket.Packet) bool {
+	return n.left.match(packet) && n.right.match(packet)
+}
+
+type orNode struct{ left, right node }
+
+func (n *orNode) match(packet gopacket.Packet) bool {
+	return n.left.match(packet) || n.right.match(packet)
+}
+
+type notNode struct{ n node }
+
+func (n *notNode) match(packet gopacket.Packet) bool {
+	return !n.n.match(packet)
+}
+
+// presentNode is true if the protocol or field is in the packet.
+type presentNode struct{ f *field }
+
+func (n *presentNode) match(packet gopacket.Packet) bool {
+	if n.f.kind == kindProtocol {
+		return n.f.present(packet)
+	}
+	return len(n.f.values(packet)) > 0
+}
+
+// compareNode compares the values of a field to a literal.
+type compareNode struct {
+	f   *field
+	op  string
+	num uint64
+	ip  *net.IPNet
+	mac net.HardwareAddr
+}
+
+func newCompareNode(name string, f *field, op, lit string) (*compareNode, error) {
+	c := &compareNode{f: f, op: op}
+	switch f.kind {
+	case kindProtocol:
+		return nil, fmt.Errorf("%s is a protocol and cannot be compared", name)
+	case kindNumber:
+		n, err := strconv.ParseUint(lit, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be compared to a number, not %q", name, lit)
+		}
+		c.num = n
+		return c, nil
+	}
+
+	if op != "==" && op != "!=" {
+		return nil, fmt.Errorf("%s can only be compared with == or !=", name)
+	}
+	switch f.kind {
+	case kindIP:
+		if strings.Contains(lit, "/") {
+			_, ipNet, err := net.ParseCIDR(lit)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be compared to an IP address or CIDR block, not %q", name, lit)
+			}
+			c.ip = ipNet
+			return c, nil
+		}
+		ip := net.ParseIP(lit)
+		if ip == nil {
+			return nil, fmt.Errorf("%s must be compared to an IP address or CIDR block, not %q", name, lit)
+		}
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+			bits = 32
+		}
+		c.ip = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	case kindMAC:
+		mac, err := net.ParseMAC(lit)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be compared to a MAC address, not %q", name, lit)
+		}
+		c.mac = mac
+	}
+	return c, nil
+}
+
+func (c *compareNode) equal(v interface{}) bool {
+	switch v := v.(type) {
+	case uint64:
+		return v == c.num
+	case net.IP:
+		return c.ip.Contains(v)
+	case net.HardwareAddr:
+		return strings.EqualFold(v.String(), c.mac.String())
+	}
+	return false
+}
+
+func (c *compareNode) match(packet gopacket.Packet) bool {
+	values := c.f.values(packet)
+	if len(values) == 0 {
+		return false
+	}
+	if c.op == "!=" {
+		for _, v := range values {
+			if c.equal(v) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if c.op == "==" {
+			if c.equal(v) {
+				return true
+			}
+			continue
+		}
+		n, ok := v.(uint64)
+		if !ok {
+			continue
+		}
+		switch c.op {
+		case "<":
+			if n < c.num {
+				return true
+			}
+		case "<=":
+			if n <= c.num {
+				return true
+			}
+		case ">":
+			if n > c.num {
+				return true
+			}
+		case ">=":
+			if n >= c.num {
+				return true
+			}
+		}
+	}
+	return false
+}
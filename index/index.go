@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"hash/fnv"
 	"net"
+	"sort"
+	"strings"
+	"time"
 )
 
 //===============================================
@@ -19,8 +22,90 @@ const (
 	IPv4Type
 	IPv6Type
 	PortType
+	SrcMACType
+	DstMACType
+	MPLSType
+	VNIType
+	FlowType
+	InterfaceType
+	DomainType
+	HostType
+	VLANType
+
+	// MetaType keys store metadata about the index itself rather than
+	// packets, so they use the last record type to stay clear of new
+	// packet key types.
+	MetaType RecordType = 0xff
+)
+
+// Metadata key names.
+const (
+	// MetaPcapPathCount is the number of pcap-paths (uint16) the index
+	// was captured with; ValueElement.PathIdx is always less than it.
+	MetaPcapPathCount = "pcap-path-count"
+	// MetaInterface is the name of the network interface the packets
+	// were captured on (not set when reading pcap files), or their names
+	// separated by commas if there were several. The packets of each
+	// interface have its InterfaceType key.
+	MetaInterface = "interface"
+	// MetaStats is a JSON encoded Stats summary of the index.
+	MetaStats = "stats"
+	// MetaLinkType is the link type (uint16) of the packets in the pcap
+	// files. Indices without it are Ethernet.
+	MetaLinkType = "link-type"
+	// MetaConfig is the JSON encoded common.CaptureConfig of the capture
+	// session that wrote the index.
+	MetaConfig = "config"
+	// MetaPacketMeta is set if every ValueElement in the index has a
+	// PacketMeta (see Format).
+	MetaPacketMeta = "packet-meta"
+	// MetaFormatVersion is the version (uint16) of the value element
+	// encoding. Indices without it are FormatVersion1.
+	MetaFormatVersion = "format-version"
+	// MetaPcapCompression is the compression (common.CompressionGzip or
+	// common.CompressionZstd) of the pcap files, whose offsets are then
+	// block offsets (see common.CompressedOffset). Indices without it have
+	// uncompressed pcap files.
+	MetaPcapCompression = "pcap-compression"
 )
 
+func (t RecordType) String() string {
+	switch t {
+	case MACType:
+		return "MAC"
+	case ProtoType:
+		return "Proto"
+	case IPv4Type:
+		return "IPv4"
+	case IPv6Type:
+		return "IPv6"
+	case PortType:
+		return "Port"
+	case SrcMACType:
+		return "Src MAC"
+	case DstMACType:
+		return "Dst MAC"
+	case MPLSType:
+		return "MPLS"
+	case VNIType:
+		return "VNI"
+	case FlowType:
+		return "Flow"
+	case InterfaceType:
+		return "Interface"
+	case DomainType:
+		return "Domain"
+	case HostType:
+		return "Host"
+	case VLANType:
+		return "VLAN"
+	case MetaType:
+		return "Meta"
+	default:
+		return fmt.Sprintf("Unknown (%d)", byte(t))
+	}
+}
+
 type Key struct {
 	RecType RecordType
 	Data    []byte
@@ -33,6 +118,48 @@ func NewMACKey(macAddr net.HardwareAddr) *Key {
 	}
 }
 
+func NewSrcMACKey(macAddr net.HardwareAddr) *Key {
+	return &Key{
+		RecType: SrcMACType,
+		Data:    macAddr,
+	}
+}
+
+func NewDstMACKey(macAddr net.HardwareAddr) *Key {
+	return &Key{
+		RecType: DstMACType,
+		Data:    macAddr,
+	}
+}
+
+// NewMPLSKey creates a key for the (20 bit) MPLS label at the top of the
+// label stack.
+func NewMPLSKey(label uint32) *Key {
+	d := make([]byte, 4)
+	binary.LittleEndian.PutUint32(d, label)
+	return &Key{
+		RecType: MPLSType,
+		Data:    d,
+	}
+}
+
+// NewVNIKey creates a key for the (24 bit) VXLAN network identifier.
+func NewVNIKey(vni uint32) *Key {
+	d := make([]byte, 4)
+	binary.LittleEndian.PutUint32(d, vni)
+	return &Key{
+		RecType: VNIType,
+		Data:    d,
+	}
+}
+
+func NewMetaKey(name string) *Key {
+	return &Key{
+		RecType: MetaType,
+		Data:    []byte(name),
+	}
+}
+
 func NewProtoKey(proto uint8) *Key {
 	d := make([]byte, 1)
 	d[0] = proto
@@ -42,6 +169,17 @@ func NewProtoKey(proto uint8) *Key {
 	}
 }
 
+// NewIPKey returns the IPv4 key of an IPv4 or IPv4-mapped IPv6 address
+// (e.g. ::ffff:1.2.3.4) and the IPv6 key of any other IPv6 address, or nil
+// if ip is not a valid address. Both captured packets and queries use it so
+// an address always has the same key.
+func NewIPKey(ip net.IP) *Key {
+	if ip.To4() != nil {
+		return NewIPv4Key(ip)
+	}
+	return NewIPv6Key(ip)
+}
+
 func NewIPv4Key(ip net.IP) *Key {
 	ip4 := ip.To4()
 	if ip4 == nil {
@@ -73,11 +211,46 @@ func NewPortKey(port uint16) *Key {
 	}
 }
 
-func (k *Key) Hash() uint32 {
-	h := fnv.New32a()
+// NewFlowKey creates a key for the 5-tuple of a TCP or UDP packet. The
+// endpoints are ordered (by address and then port) so both directions of a
+// conversation have the same key. It returns nil if an address is not
+// valid or the addresses are not the same IP version.
+func NewFlowKey(srcIP, dstIP net.IP, srcPort, dstPort uint16, proto uint8) *Key {
+	a, b := srcIP.To4(), dstIP.To4()
+	if a == nil || b == nil {
+		if a != nil || b != nil {
+			return nil
+		}
+		a, b = srcIP.To16(), dstIP.To16()
+		if a == nil || b == nil {
+			return nil
+		}
+	}
+	portA, portB := srcPort, dstPort
+	if c := bytes.Compare(a, b); c > 0 || (c == 0 && portA > portB) {
+		a, b = b, a
+		portA, portB = portB, portA
+	}
+	// proto, address A, port A, address B, port B
+	d := make([]byte, 0, 1+2*(len(a)+2))
+	d = append(d, proto)
+	d = append(d, a...)
+	d = append(d, byte(portA>>8), byte(portA))
+	d = append(d, b...)
+	d = append(d, byte(portB>>8), byte(portB))
+	return &Key{
+		RecType: FlowType,
+		Data:    d,
+	}
+}
+
+// Hash returns the FNV-64a hash of the key, used to bucket keys in a
+// MemIndex. It is not stored on disk.
+func (k *Key) Hash() uint64 {
+	h := fnv.New64a()
 	h.Write([]byte{byte(k.RecType)})
 	h.Write(k.Data)
-	return h.Sum32()
+	return h.Sum64()
 }
 
 func (k *Key) Equal(otherK *Key) bool {
@@ -102,18 +275,79 @@ func (k *Key) UnmarshalBinary(data []byte) error {
 }
 
 func (k *Key) String() string {
+	d := k.DataString()
+	if d == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", k.RecType, d)
+}
+
+// NewInterfaceKey creates a key for the name of the network interface a
+// packet was captured on.
+func NewInterfaceKey(name string) *Key {
+	return &Key{
+		RecType: InterfaceType,
+		Data:    []byte(name),
+	}
+}
+
+// NewVLANKey creates a key for an 802.1Q VLAN ID.
+func NewVLANKey(id uint16) *Key {
+	d := make([]byte, 2)
+	binary.LittleEndian.PutUint16(d, id)
+	return &Key{
+		RecType: VLANType,
+		Data:    d,
+	}
+}
+
+// NewDomainKey creates a key for a DNS name, in lower case and without the
+// trailing dot of a fully qualified name. Both captured packets and queries
+// use it so a name always has the same key.
+func NewDomainKey(name string) *Key {
+	return &Key{
+		RecType: DomainType,
+		Data:    []byte(strings.ToLower(strings.TrimSuffix(name, "."))),
+	}
+}
+
+// NewHostKey creates a key for the host name of a TLS server name
+// indication or HTTP Host header, normalized like NewDomainKey.
+func NewHostKey(name string) *Key {
+	return &Key{
+		RecType: HostType,
+		Data:    []byte(strings.ToLower(strings.TrimSuffix(name, "."))),
+	}
+}
+
+// DataString returns the key data formatted for its record type, e.g. the
+// IP address of an IPv4 key, or an empty string for an unknown type.
+func (k *Key) DataString() string {
 	switch k.RecType {
-	case MACType:
-		return fmt.Sprintf("MAC: %s", net.HardwareAddr(k.Data).String())
+	case MACType, SrcMACType, DstMACType:
+		return net.HardwareAddr(k.Data).String()
 	case ProtoType:
-		return fmt.Sprintf("Proto: %d", k.Data)
-	case IPv4Type:
-		return fmt.Sprintf("IPv4: %s", net.IP(k.Data).String())
-	case IPv6Type:
-		return fmt.Sprintf("IPv6: %s", net.IP(k.Data).String())
-	case PortType:
-		port := binary.LittleEndian.Uint16(k.Data)
-		return fmt.Sprintf("Port: %d", port)
+		if len(k.Data) != 1 {
+			return fmt.Sprintf("%d", k.Data)
+		}
+		return fmt.Sprintf("%d", k.Data[0])
+	case IPv4Type, IPv6Type:
+		return net.IP(k.Data).String()
+	case PortType, VLANType:
+		return fmt.Sprintf("%d", binary.LittleEndian.Uint16(k.Data))
+	case MPLSType, VNIType:
+		return fmt.Sprintf("%d", binary.LittleEndian.Uint32(k.Data))
+	case FlowType:
+		// In the syntax of a flow query, e.g. `10.0.0.1:1234,10.0.0.2:80,6`.
+		n := (len(k.Data) - 1 - 4) / 2
+		if n != net.IPv4len && n != net.IPv6len {
+			return fmt.Sprintf("%x", k.Data)
+		}
+		a := net.JoinHostPort(net.IP(k.Data[1:1+n]).String(), fmt.Sprint(binary.BigEndian.Uint16(k.Data[1+n:])))
+		b := net.JoinHostPort(net.IP(k.Data[3+n:3+2*n]).String(), fmt.Sprint(binary.BigEndian.Uint16(k.Data[3+2*n:])))
+		return fmt.Sprintf("%s,%s,%d", a, b, k.Data[0])
+	case InterfaceType, DomainType, HostType, MetaType:
+		return string(k.Data)
 	default:
 		return ""
 	}
@@ -122,31 +356,302 @@ func (k *Key) String() string {
 //===============================================
 // Value Element
 //===============================================
+
+// Value element encodings.
+const (
+	// FormatVersion1 elements have a uint32 offset, so pcap files are
+	// limited to 4GB.
+	FormatVersion1 uint16 = 1
+	// FormatVersion2 elements have a uvarint offset.
+	FormatVersion2 uint16 = 2
+	// FormatVersion3 elements have a uvarint offset and their PacketMeta
+	// has the VLAN IDs of the packet.
+	FormatVersion3 uint16 = 3
+	// FormatVersion is the encoding of the indices that are written.
+	FormatVersion = FormatVersion3
+)
+
+// ValueElementSize is the number of bytes of a FormatVersion1 ValueElement.
+const ValueElementSize = 5
+
+// ValueElementMetaSize is the number of bytes of a FormatVersion1
+// ValueElement with a PacketMeta.
+const ValueElementMetaSize = ValueElementSize + packetMetaSize2
+
+// maxValueElementSize is the largest FormatVersion2 ValueElement.
+const maxValueElementSize = 1 + binary.MaxVarintLen64 + PacketMetaSize
+
+// Format is how the values of an index are encoded, from its metadata.
+type Format struct {
+	// Version is the value element encoding.
+	Version uint16
+	// PacketMeta is set if every ValueElement has a PacketMeta.
+	PacketMeta bool
+}
+
+// PacketMetaVLANs returns true if the PacketMeta of the elements has the
+// VLAN IDs of the packets.
+func (f Format) PacketMetaVLANs() bool {
+	return f.PacketMeta && f.Version >= FormatVersion3
+}
+
+// packetMetaSize returns the number of bytes of the PacketMeta of each
+// element, 0 if they do not have one.
+func (f Format) packetMetaSize() int {
+	switch {
+	case !f.PacketMeta:
+		return 0
+	case f.Version < FormatVersion3:
+		return packetMetaSize2
+	default:
+		return PacketMetaSize
+	}
+}
+
+// Count returns the number of value elements in the data of a value
+// without decoding them.
+func (f Format) Count(data []byte) (int, error) {
+	if f.Version == FormatVersion1 {
+		size := ValueElementSize + f.packetMetaSize()
+		if len(data)%size != 0 {
+			return 0, fmt.Errorf("value length %d is not a multiple of the element size %d", len(data), size)
+		}
+		return len(data) / size, nil
+	}
+	var n int
+	for len(data) > 0 {
+		size, err := f.elementSize(data)
+		if err != nil {
+			return 0, err
+		}
+		data = data[size:]
+		n++
+	}
+	return n, nil
+}
+
+// elementSize returns the number of bytes of the first element of data.
+func (f Format) elementSize(data []byte) (int, error) {
+	size := ValueElementSize
+	if f.Version != FormatVersion1 {
+		if len(data) < 2 {
+			return 0, fmt.Errorf("truncated value element")
+		}
+		_, n := binary.Uvarint(data[1:])
+		if n <= 0 {
+			return 0, fmt.Errorf("invalid value element offset")
+		}
+		size = 1 + n
+	}
+	size += f.packetMetaSize()
+	if len(data) < size {
+		return 0, fmt.Errorf("truncated value element")
+	}
+	return size, nil
+}
+
 type ValueElement struct {
 	PathIdx byte
-	Offset  uint32
+	Offset  uint64
+	// Meta is the summary of the packet, if the index stores it.
+	Meta *PacketMeta
 }
 
-func NewValueElement(pathIdx byte, offset uint32) *ValueElement {
+func NewValueElement(pathIdx byte, offset uint64) *ValueElement {
 	return &ValueElement{
 		PathIdx: pathIdx,
 		Offset:  offset,
 	}
 }
 
+// MarshalBinary encodes the element in the current FormatVersion.
 func (v *ValueElement) MarshalBinary() (data []byte, err error) {
-	b := make([]byte, 5)
-	b[0] = v.PathIdx
-	binary.LittleEndian.PutUint32(b[1:], v.Offset)
-	return b, nil
+	return v.appendBinary(make([]byte, 0, maxValueElementSize)), nil
 }
 
+func (v *ValueElement) appendBinary(b []byte) []byte {
+	b = append(b, v.PathIdx)
+	var offset [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(offset[:], v.Offset)
+	b = append(b, offset[:n]...)
+	if v.Meta != nil {
+		var meta [PacketMetaSize]byte
+		v.Meta.marshal(meta[:])
+		b = append(b, meta[:]...)
+	}
+	return b
+}
+
+// UnmarshalBinary decodes an element of a current FormatVersion index
+// without packet metadata, like Value.UnmarshalBinary. Use UnmarshalFormat
+// with the Format stored in an index to decode its elements.
 func (v *ValueElement) UnmarshalBinary(data []byte) error {
-	v.PathIdx = data[0]
-	v.Offset = binary.LittleEndian.Uint32(data[1:])
+	return v.UnmarshalFormat(data, Format{Version: FormatVersion})
+}
+
+// UnmarshalFormat decodes an element of an index with the given Format.
+func (v *ValueElement) UnmarshalFormat(data []byte, f Format) error {
+	size, err := v.unmarshal(data, f)
+	if err != nil {
+		return err
+	}
+	if size != len(data) {
+		return fmt.Errorf("value element has %d bytes, want %d", len(data), size)
+	}
 	return nil
 }
 
+// unmarshal decodes the first element of data and returns its size.
+func (v *ValueElement) unmarshal(data []byte, f Format) (int, error) {
+	size, err := f.elementSize(data)
+	if err != nil {
+		return 0, err
+	}
+	v.PathIdx = data[0]
+	metaStart := ValueElementSize
+	if f.Version == FormatVersion1 {
+		v.Offset = uint64(binary.LittleEndian.Uint32(data[1:]))
+	} else {
+		var n int
+		v.Offset, n = binary.Uvarint(data[1:])
+		metaStart = 1 + n
+	}
+	if f.PacketMeta {
+		v.Meta = &PacketMeta{}
+		v.Meta.unmarshal(data[metaStart:], f.PacketMetaVLANs())
+	}
+	return size, nil
+}
+
+//===============================================
+// Packet Meta
+//===============================================
+
+// PacketMetaSize is the number of bytes of a marshaled PacketMeta.
+const PacketMetaSize = 66
+
+// packetMetaSize2 is the number of bytes of the PacketMeta of FormatVersion1
+// and FormatVersion2 indices, which do not have the VLAN IDs.
+const packetMetaSize2 = 62
+
+// Flags of a marshaled PacketMeta.
+const (
+	packetMetaIPv4 byte = 1 << iota
+	packetMetaIPv6
+	packetMetaSrcMAC
+	packetMetaDstMAC
+	packetMetaTruncated
+	packetMetaVLAN
+	packetMetaQinQ
+)
+
+// PacketMeta is a summary of a packet that can be stored with its
+// ValueElement, so a query that only needs the summary does not have to
+// read the packet from the pcap file.
+type PacketMeta struct {
+	// Timestamp and Length are from the pcap record header.
+	Timestamp time.Time
+	Length    uint32
+	// Truncated is true if the packet was longer than the snap length.
+	Truncated bool
+	// Proto is the IP protocol number, 0 if there is no IP layer.
+	Proto   uint8
+	SrcPort uint16
+	DstPort uint16
+	// SrcIP and DstIP are nil if there is no IP layer.
+	SrcIP net.IP
+	DstIP net.IP
+	// SrcMAC and DstMAC are nil if the link layer does not have them.
+	SrcMAC net.HardwareAddr
+	DstMAC net.HardwareAddr
+	// VLANs are the 802.1Q VLAN IDs of the packet, the outer tag first.
+	// The index stores the first two (the tags of QinQ).
+	VLANs []uint16
+}
+
+// IPVersion returns 4 or 6, or 0 if there is no IP layer.
+func (p *PacketMeta) IPVersion() uint8 {
+	switch {
+	case p.SrcIP == nil:
+		return 0
+	case p.SrcIP.To4() != nil:
+		return 4
+	default:
+		return 6
+	}
+}
+
+func (p *PacketMeta) marshal(b []byte) {
+	binary.LittleEndian.PutUint64(b[0:], uint64(p.Timestamp.UnixNano()))
+	binary.LittleEndian.PutUint32(b[8:], p.Length)
+	var flags byte
+	switch p.IPVersion() {
+	case 4:
+		flags |= packetMetaIPv4
+	case 6:
+		flags |= packetMetaIPv6
+	}
+	if len(p.SrcMAC) == 6 {
+		flags |= packetMetaSrcMAC
+		copy(b[50:56], p.SrcMAC)
+	}
+	if len(p.DstMAC) == 6 {
+		flags |= packetMetaDstMAC
+		copy(b[56:62], p.DstMAC)
+	}
+	if p.Truncated {
+		flags |= packetMetaTruncated
+	}
+	if len(p.VLANs) > 0 {
+		flags |= packetMetaVLAN
+		binary.LittleEndian.PutUint16(b[62:], p.VLANs[0])
+	}
+	if len(p.VLANs) > 1 {
+		flags |= packetMetaQinQ
+		binary.LittleEndian.PutUint16(b[64:], p.VLANs[1])
+	}
+	b[12] = flags
+	b[13] = p.Proto
+	binary.LittleEndian.PutUint16(b[14:], p.SrcPort)
+	binary.LittleEndian.PutUint16(b[16:], p.DstPort)
+	if flags&(packetMetaIPv4|packetMetaIPv6) != 0 {
+		copy(b[18:34], p.SrcIP.To16())
+		copy(b[34:50], p.DstIP.To16())
+	}
+}
+
+// unmarshal decodes a PacketMeta, which only has the VLAN IDs if vlans is
+// true (FormatVersion3 and later).
+func (p *PacketMeta) unmarshal(b []byte, vlans bool) {
+	p.Timestamp = time.Unix(0, int64(binary.LittleEndian.Uint64(b[0:])))
+	p.Length = binary.LittleEndian.Uint32(b[8:])
+	flags := b[12]
+	p.Truncated = flags&packetMetaTruncated != 0
+	p.Proto = b[13]
+	p.SrcPort = binary.LittleEndian.Uint16(b[14:])
+	p.DstPort = binary.LittleEndian.Uint16(b[16:])
+	switch {
+	case flags&packetMetaIPv4 != 0:
+		p.SrcIP = net.IP(append([]byte{}, b[30:34]...))
+		p.DstIP = net.IP(append([]byte{}, b[46:50]...))
+	case flags&packetMetaIPv6 != 0:
+		p.SrcIP = net.IP(append([]byte{}, b[18:34]...))
+		p.DstIP = net.IP(append([]byte{}, b[34:50]...))
+	}
+	if flags&packetMetaSrcMAC != 0 {
+		p.SrcMAC = net.HardwareAddr(append([]byte{}, b[50:56]...))
+	}
+	if flags&packetMetaDstMAC != 0 {
+		p.DstMAC = net.HardwareAddr(append([]byte{}, b[56:62]...))
+	}
+	if vlans && flags&packetMetaVLAN != 0 {
+		p.VLANs = []uint16{binary.LittleEndian.Uint16(b[62:])}
+		if flags&packetMetaQinQ != 0 {
+			p.VLANs = append(p.VLANs, binary.LittleEndian.Uint16(b[64:]))
+		}
+	}
+}
+
 //===============================================
 // Value
 //===============================================
@@ -161,29 +666,155 @@ func (v *Value) Append(ve *ValueElement) {
 	*v = append(*v, ve)
 }
 
+// MarshalBinary encodes the value in the current FormatVersion.
 func (v *Value) MarshalBinary() (data []byte, err error) {
-	b := make([]byte, len(*v)*5)
-	offset := 0
+	if len(*v) == 0 {
+		return []byte{}, nil
+	}
+	// Offsets are usually shorter than the largest varint.
+	size := 1 + 4
+	if (*v)[0].Meta != nil {
+		size += PacketMetaSize
+	}
+	b := make([]byte, 0, len(*v)*size)
 	for _, elem := range *v {
-		data, _ := elem.MarshalBinary()
-		copy(b[offset:offset+5], data)
-		offset += 5
+		b = elem.appendBinary(b)
 	}
 	return b, nil
 }
 
+// UnmarshalBinary decodes a value of a current FormatVersion index without
+// packet metadata. Use UnmarshalFormat with the Format stored in an index
+// to decode its values.
 func (v *Value) UnmarshalBinary(data []byte) (err error) {
-	for offset := 0; offset < len(data); offset += 5 {
+	return v.UnmarshalFormat(data, Format{Version: FormatVersion})
+}
+
+// UnmarshalFormat decodes a value of an index with the given Format.
+func (v *Value) UnmarshalFormat(data []byte, f Format) (err error) {
+	for len(data) > 0 {
 		elem := &ValueElement{}
-		err = elem.UnmarshalBinary(data[offset : offset+5])
+		size, err := elem.unmarshal(data, f)
 		if err != nil {
 			return err
 		}
 		*v = append(*v, elem)
+		data = data[size:]
 	}
 	return nil
 }
 
+// Union returns the distinct elements of the values sorted by pcap path
+// index and then offset, i.e. in pcap file order.
+func Union(values ...Value) Value {
+	type location struct {
+		pathIdx byte
+		offset  uint64
+	}
+	seen := make(map[location]struct{})
+	u := make(Value, 0)
+	for _, v := range values {
+		for _, elem := range v {
+			loc := location{elem.PathIdx, elem.Offset}
+			if _, contains := seen[loc]; contains {
+				continue
+			}
+			seen[loc] = struct{}{}
+			u = append(u, elem)
+		}
+	}
+	sort.Slice(u, func(i, j int) bool {
+		if u[i].PathIdx != u[j].PathIdx {
+			return u[i].PathIdx < u[j].PathIdx
+		}
+		return u[i].Offset < u[j].Offset
+	})
+	return u
+}
+
+// Intersect returns the distinct elements that are in every one of the
+// values, sorted by pcap path index and then offset like Union.
+func Intersect(values ...Value) Value {
+	type location struct {
+		pathIdx byte
+		offset  uint64
+	}
+	u := make(Value, 0)
+	if len(values) == 0 {
+		return u
+	}
+	// counts is the number of values each element of the first one has
+	// been seen in so far.
+	counts := make(map[location]int)
+	for _, elem := range values[0] {
+		counts[location{elem.PathIdx, elem.Offset}] = 1
+	}
+	for i, v := range values[1:] {
+		for _, elem := range v {
+			loc := location{elem.PathIdx, elem.Offset}
+			if counts[loc] == i+1 {
+				counts[loc]++
+			}
+		}
+	}
+	for _, elem := range values[0] {
+		loc := location{elem.PathIdx, elem.Offset}
+		if counts[loc] == len(values) {
+			u = append(u, elem)
+			// Duplicates of the element are skipped.
+			counts[loc] = 0
+		}
+	}
+	sort.Slice(u, func(i, j int) bool {
+		if u[i].PathIdx != u[j].PathIdx {
+			return u[i].PathIdx < u[j].PathIdx
+		}
+		return u[i].Offset < u[j].Offset
+	})
+	return u
+}
+
+//===============================================
+// Stats
+//===============================================
+
+// Stats summarizes the packet keys and values of an index so its size can
+// be understood without scanning it.
+type Stats struct {
+	// KeyCounts is the number of distinct keys of each record type.
+	KeyCounts map[RecordType]uint64 `json:"key_counts"`
+	// Values is the total number of value elements.
+	Values uint64 `json:"values"`
+}
+
+func NewStats() *Stats {
+	return &Stats{KeyCounts: make(map[RecordType]uint64)}
+}
+
+// Add counts a key and the number of elements in its value.
+func (s *Stats) Add(k *Key, values int) {
+	s.KeyCounts[k.RecType]++
+	s.Values += uint64(values)
+}
+
+// Keys returns the total number of distinct keys.
+func (s *Stats) Keys() uint64 {
+	var n uint64
+	for _, c := range s.KeyCounts {
+		n += c
+	}
+	return n
+}
+
+// AvgValueLen returns the average number of elements per value.
+func (s *Stats) AvgValueLen() float64 {
+	keys := s.Keys()
+	if keys == 0 {
+		return 0
+	}
+	return float64(s.Values) / float64(keys)
+}
+
 //===============================================
 // Mem Index
 //===============================================
@@ -192,7 +823,7 @@ type MiValue struct {
 	V *Value
 }
 
-type MemIndex map[uint32]MiValue
+type MemIndex map[uint64]MiValue
 
 func NewMemIndex() MemIndex {
 	return make(MemIndex)
@@ -216,3 +847,19 @@ func (m MemIndex) Put(k *Key, ve *ValueElement) {
 		hash++
 	}
 }
+
+// Get returns the value of a key, or nil if the key is not in the index.
+func (m MemIndex) Get(k *Key) *Value {
+	hash := k.Hash()
+
+	for {
+		miv, contains := m[hash]
+		if !contains {
+			return nil
+		}
+		if miv.K.Equal(k) {
+			return miv.V
+		}
+		hash++
+	}
+}
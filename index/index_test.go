@@ -0,0 +1,176 @@
+package index
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestValueOffsetsAbove4GB(t *testing.T) {
+	offsets := []uint64{0, 24, 1<<32 - 1, 1 << 32, 5<<30 + 7, 1 << 62}
+	for _, withMeta := range []bool{false, true} {
+		v := NewValue()
+		for i, offset := range offsets {
+			elem := NewValueElement(byte(i%3), offset)
+			if withMeta {
+				elem.Meta = &PacketMeta{
+					Timestamp: time.Unix(1577836800, 123),
+					Length:    1500,
+					Proto:     6,
+					SrcPort:   443,
+					DstPort:   50000,
+					SrcIP:     net.ParseIP("10.0.0.1"),
+					DstIP:     net.ParseIP("10.0.0.2"),
+				}
+			}
+			v.Append(elem)
+		}
+		data, err := v.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f := Format{Version: FormatVersion, PacketMeta: withMeta}
+		n, err := f.Count(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(offsets) {
+			t.Errorf("meta %t: counted %d elements, want %d", withMeta, n, len(offsets))
+		}
+		var got Value
+		err = got.UnmarshalFormat(data, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(offsets) {
+			t.Fatalf("meta %t: decoded %d elements, want %d", withMeta, len(got), len(offsets))
+		}
+		for i, elem := range got {
+			if elem.PathIdx != byte(i%3) || elem.Offset != offsets[i] {
+				t.Errorf("meta %t: element %d is %d:%d, want %d:%d", withMeta, i, elem.PathIdx, elem.Offset, i%3, offsets[i])
+			}
+			if withMeta && (elem.Meta == nil || elem.Meta.Length != 1500 || !elem.Meta.DstIP.Equal(net.ParseIP("10.0.0.2"))) {
+				t.Errorf("meta %t: element %d has packet meta %+v", withMeta, i, elem.Meta)
+			}
+		}
+	}
+}
+
+func TestValueFormatVersion1(t *testing.T) {
+	// Two elements of an index written before the offsets were varints:
+	// the pcap-path index and a little endian uint32 offset.
+	data := make([]byte, 2*ValueElementSize)
+	data[0] = 1
+	binary.LittleEndian.PutUint32(data[1:], 1<<32-1)
+	data[5] = 0
+	binary.LittleEndian.PutUint32(data[6:], 24)
+
+	f := Format{Version: FormatVersion1}
+	n, err := f.Count(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("counted %d elements, want 2", n)
+	}
+	var v Value
+	err = v.UnmarshalFormat(data, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 2 {
+		t.Fatalf("decoded %d elements, want 2", len(v))
+	}
+	if v[0].PathIdx != 1 || v[0].Offset != 1<<32-1 || v[1].PathIdx != 0 || v[1].Offset != 24 {
+		t.Errorf("decoded %+v %+v, want 1:%d and 0:24", v[0], v[1], uint64(1<<32-1))
+	}
+
+	_, err = f.Count(data[:ValueElementSize+1])
+	if err == nil {
+		t.Error("counted a truncated element")
+	}
+}
+
+func TestValueElementUnmarshal(t *testing.T) {
+	elem := NewValueElement(2, 1<<40)
+	elem.Meta = &PacketMeta{Timestamp: time.Unix(1577836800, 0), Length: 60}
+	withMeta, err := elem.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	elem.Meta = nil
+	withoutMeta, err := elem.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An element decodes the same bytes as a value of one element.
+	var got ValueElement
+	err = got.UnmarshalBinary(withoutMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v Value
+	err = v.UnmarshalBinary(withoutMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 1 || got.PathIdx != v[0].PathIdx || got.Offset != v[0].Offset || got.Meta != nil || v[0].Meta != nil {
+		t.Errorf("decoded element %+v and value %+v, want one 2:%d element", got, v, uint64(1<<40))
+	}
+
+	// The packet meta is only decoded with the format of the index.
+	err = got.UnmarshalBinary(withMeta)
+	if err == nil {
+		t.Error("decoded an element with packet meta without the format")
+	}
+	got = ValueElement{}
+	err = got.UnmarshalFormat(withMeta, Format{Version: FormatVersion, PacketMeta: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Offset != 1<<40 || got.Meta == nil || got.Meta.Length != 60 {
+		t.Errorf("decoded %+v with packet meta %+v", got, got.Meta)
+	}
+}
+
+func TestPacketMetaVLANs(t *testing.T) {
+	f := Format{Version: FormatVersion, PacketMeta: true}
+	for _, vlans := range [][]uint16{nil, {100}, {100, 4094}} {
+		elem := NewValueElement(0, 24)
+		elem.Meta = &PacketMeta{Timestamp: time.Unix(1577836800, 0), Length: 60, VLANs: vlans}
+		data, err := elem.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got ValueElement
+		err = got.UnmarshalFormat(data, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Meta.VLANs) != len(vlans) {
+			t.Fatalf("decoded VLANs %v, want %v", got.Meta.VLANs, vlans)
+		}
+		for i := range vlans {
+			if got.Meta.VLANs[i] != vlans[i] {
+				t.Errorf("decoded VLANs %v, want %v", got.Meta.VLANs, vlans)
+			}
+		}
+	}
+
+	// FormatVersion2 packet meta ends before the VLAN IDs.
+	elem := NewValueElement(0, 24)
+	elem.Meta = &PacketMeta{Timestamp: time.Unix(1577836800, 0), Length: 60}
+	data, _ := elem.MarshalBinary()
+	data = data[:len(data)-(PacketMetaSize-packetMetaSize2)]
+	var got ValueElement
+	err := got.UnmarshalFormat(data, Format{Version: FormatVersion2, PacketMeta: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Offset != 24 || got.Meta == nil || got.Meta.Length != 60 || got.Meta.VLANs != nil {
+		t.Errorf("decoded %+v with packet meta %+v", got, got.Meta)
+	}
+}
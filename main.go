@@ -3,21 +3,35 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
 	"path"
+	"strconv"
+	"time"
 
 	"github.com/alecthomas/kingpin"
+	"github.com/alecthomas/units"
 	"github.com/google/gops/agent"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	v1 "code.ornl.gov/situ/mercury/api/v1"
 	"code.ornl.gov/situ/mercury/cmd/capture"
+	"code.ornl.gov/situ/mercury/cmd/export"
+	"code.ornl.gov/situ/mercury/cmd/gen"
 	"code.ornl.gov/situ/mercury/cmd/info"
+	"code.ornl.gov/situ/mercury/cmd/migrate"
+	"code.ornl.gov/situ/mercury/cmd/prune"
 	"code.ornl.gov/situ/mercury/cmd/query"
+	"code.ornl.gov/situ/mercury/cmd/s3sync"
 	"code.ornl.gov/situ/mercury/cmd/serve"
+	"code.ornl.gov/situ/mercury/cmd/verify"
 	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/search"
+	"code.ornl.gov/situ/mercury/storage"
 )
 
 // Injected by build.
@@ -44,38 +58,211 @@ var (
 	logJSON      = app.Flag("log-json", "Structured  JSON logging.").Bool()
 	indexDirPath = app.Flag("index-path", "Directory to store the index data.").Default("./_index").String()
 	pcapDirPaths = app.Flag("pcap-path", "List of directories to store the packet capture data.").Default("./_data").Strings()
+	indexKeyFile = app.Flag("encryption-key-file", "File with a hex encoded 16, 24 or 32 byte AES key (e.g. from 'openssl rand -hex 32') to encrypt the indices that capture writes and to read encrypted indices with.").String()
+	fileTimeFmt  = app.Flag("file-time-format", "Go time format of the date in pcap and index file names; it must sort by time (year, month, day, hour, minute and second, in that order) and capture and serve must use the same one.").Default(common.FileTimeFormat).String()
+	s3Bucket     = app.Flag("s3-bucket", "S3-compatible bucket to upload finalized captures to (capture) or download them from (s3-sync).").String()
+	s3Prefix     = app.Flag("s3-prefix", "Prefix for the S3 object keys.").String()
+	s3Endpoint   = app.Flag("s3-endpoint", "URL of the S3-compatible service.").Default("https://s3.amazonaws.com").String()
+	s3Region     = app.Flag("s3-region", "Region of the S3 bucket.").Default("us-east-1").String()
+	s3AccessKey  = app.Flag("s3-access-key", "Access key for the S3 bucket.").Envar("AWS_ACCESS_KEY_ID").String()
+	s3SecretKey  = app.Flag("s3-secret-key", "Secret key for the S3 bucket.").Envar("AWS_SECRET_ACCESS_KEY").String()
 
 	// Capture command and flags.
 	captureCmd         = app.Command("capture", "Capture and index pcap data.").Alias("c")
 	captureLabel       = captureCmd.Flag("label", "Label to assign for these packet captures.").Default(common.DefaultLabel).String()
-	captureFiles       = captureCmd.Flag("file", "Pcap file(s) to ingest.").Short('f').ExistingFiles()
-	captureInterface   = captureCmd.Flag("interface", "Listen on interface.").Short('i').String()
+	captureFiles       = captureCmd.Flag("file", "Pcap or pcapng file(s) to ingest, optionally gzip compressed.").Short('f').ExistingFiles()
+	captureInterface   = captureCmd.Flag("interface", "Listen on interface (repeatable, to capture several interfaces with the same link type into the same label).").Short('i').Strings()
 	capturePromiscuous = captureCmd.Flag("promiscuous", "Capture in promiscuous mode (must be root), use --no-promiscuous to turn off.").Default("true").Bool()
 	captureGops        = captureCmd.Flag("gops", "Use gops to start the diagnostics agent.").Default("false").Bool()
+	captureChecksum    = captureCmd.Flag("checksum", "Write a SHA-256 checksum file next to each finalized pcap file for tamper detection (see the verify command).").Default("false").Bool()
+	captureCompress    = captureCmd.Flag("compress", "Compress the pcap files with gzip (.pcap.gz) or zstd (.pcap.zst), in independent blocks so queries only decompress the blocks of the packets they read; not supported with --live-query-addr.").Default(common.CompressionNone).Enum(common.CompressionNone, common.CompressionGzip, common.CompressionZstd)
+	captureResume      = captureCmd.Flag("resume", "Skip --file inputs that an earlier, interrupted capture into the same label already ingested.").Default("false").Bool()
+	captureServerPorts = captureCmd.Flag("index-server-ports-only", "Index only the lower (likely service) port of each TCP/UDP packet instead of both, so ephemeral client ports do not bloat the index; queries for an ephemeral port will not match.").Default("false").Bool()
+	capturePacketMeta  = captureCmd.Flag("index-packet-meta", "Store the timestamp, length, protocol, ports and addresses of each packet in the index so summary (text and JSON without --show-all) queries and stats do not read the pcap files; this makes the index much larger.").Default("false").Bool()
+	capturePartition   = captureCmd.Flag("partition-by-date", "Write pcap and index files to date directories (e.g. `2021/03/01/`) under each path so directory listings stay small with long retention.").Default("false").Bool()
+	captureRotateSize  = byteSize(capture.DefaultRotationSize)
+	captureRotateEvery = captureCmd.Flag("rotate-interval", "Start a new pcap file in each --pcap-path this often, up to "+common.MaxPcapFileTime.String()+"; shorter files narrow queries to fewer packets, longer ones mean fewer files and indices.").Default(common.DefaultRotationInterval.String()).Duration()
+	capturePcapBuffer  = captureCmd.Flag("pcap-buffer", "Size in bytes of the kernel buffer for capturing from --interface; raise it if packets are dropped during bursts (0 for the libpcap default, usually 2MB).").Default("0").Int()
+	captureStatsEvery  = captureCmd.Flag("stats-interval", "How often to log the capture statistics of --interface (packets received and dropped by the kernel, and packets read, written and indexed), 0 to only log them when the capture stops.").Default("1m").Duration()
+	captureImmediate   = captureCmd.Flag("immediate", "Deliver packets from --interface as they arrive instead of buffering them, so they can be queried sooner with --live-query-addr; this lowers the throughput under high packet rates.").Default("false").Bool()
+	captureLiveAddr    = captureCmd.Flag("live-query-addr", "Address (e.g. `localhost:8124`) of an HTTP endpoint for querying the packets that are not in a written index yet, disabled if empty.").String()
+	captureMaxDisk     byteSize
+	captureDeleteLocal = captureCmd.Flag("s3-delete-local", "Delete the local pcap files and index after they are uploaded to --s3-bucket.").Default("false").Bool()
+	capturePprofPort   = captureCmd.Flag("pprof-port", "Port to serve the Go pprof profiles (/debug/pprof/) on, separate from any other server, 0 to disable.").Default("0").Uint16()
+	capturePprofHost   = captureCmd.Flag("pprof-host", "Host or address to bind --pprof-port to; the profiles have no authentication, so only change it on a trusted network.").Default("localhost").String()
 
 	// Serve command and flags.
 	serveCmd            = app.Command("serve", "Start the server that will listen for queries.").Alias("s")
 	serveCert           = serveCmd.Flag("cert", "The server certificate for TLS.").Short('t').String()
 	serveKey            = serveCmd.Flag("key", "The server key for TLS.").Short('k').String()
+	serveAuthTokens     = serveCmd.Flag("auth-token", "Require clients to send this bearer token (repeatable); prefer --auth-token-file, since arguments are visible to other users.").Strings()
+	serveAuthTokenFile  = serveCmd.Flag("auth-token-file", "File of bearer tokens that clients must send one of, one per line.").ExistingFile()
+	serveClientCA       = serveCmd.Flag("client-ca", "Require clients to present a certificate signed by this certificate authority (mutual TLS); the HTTP gateway is then served over TLS too.").ExistingFile()
 	serveGRPCPort       = serveCmd.Flag("port", "The gRPC port to listen for queries on.").Short('p').Default(fmt.Sprintf("%d", defaultGRPCPort)).Uint16()
 	serveHTTPPort       = serveCmd.Flag("http-port", "The HTTP port to listen for queries on.").Default(fmt.Sprintf("%d", defaultHTTPPort)).Uint16()
+	serveIndexCacheSize = serveCmd.Flag("index-cache-size", "Number of index databases to keep open between queries (0 disables caching).").Default("32").Int()
+	serveKeepalive      = serveCmd.Flag("keepalive", "How often to ping clients on idle connections so long streams are not dropped by middleboxes.").Default(common.DefaultKeepalive.String()).Duration()
+	serveRateLimit      = serveCmd.Flag("rate-limit", "Maximum HTTP gateway requests per second from each client IP (0 for no limit).").Default("0").Float64()
+	serveRateBurst      = serveCmd.Flag("rate-burst", "Number of HTTP gateway requests a client can make at once before --rate-limit applies.").Default("10").Int()
+	serveCORSOrigins    = serveCmd.Flag("cors-origin", "Origin allowed to make cross-origin HTTP requests, e.g. a web UI (repeatable, '*' for any); none by default.").Strings()
+	serveAuditLog       = serveCmd.Flag("audit-log", "File to append a JSON audit record of each query to ('-' for stderr).").String()
+	serveMaxQueryBytes  = serveCmd.Flag("max-query-bytes", "Stop a query with a resource exhausted error once it has read this many packet bytes, 0 for no limit.").Default("0").Int64()
+	serveOpenRetries    = serveCmd.Flag("open-retries", "Number of times to retry opening an index or pcap file, for transient errors on network filesystems.").Default("2").Int()
+	servePprofPort      = serveCmd.Flag("pprof-port", "Port to serve the Go pprof profiles (/debug/pprof/) on, separate from any other server, 0 to disable.").Default("0").Uint16()
+	servePprofHost      = serveCmd.Flag("pprof-host", "Host or address to bind --pprof-port to; the profiles have no authentication, so only change it on a trusted network.").Default("localhost").String()
+	serveMetricsPort    = serveCmd.Flag("metrics-port", "Port to serve the Prometheus metrics (/metrics) on, separate from the HTTP gateway; 0 serves them on the HTTP gateway.").Default("0").Uint16()
+	serveConcurrency    = serveCmd.Flag("concurrency", "Number of indices each query without --limit or --max-query-bytes reads at the same time; each holds an open index database and pcap file, so raise the open file limit with it.").Default(fmt.Sprintf("%d", search.DefaultConcurrency)).Int()
+	serveStrict         = serveCmd.Flag("strict", "Fail a query if an index references a pcap file that does not exist (e.g. deleted by a retention job), instead of skipping its packets with a warning.").Default("false").Bool()
+	serveRetryBackoff   = serveCmd.Flag("open-retry-backoff", "How long to wait before the first open retry, doubling for each retry.").Default("100ms").Duration()
 	serveHTTPServerName = serveCmd.Flag("server-name", "The optional server name override for HTTP gateway TLS if the certificate hostname is different than the server hostname.").String()
 
 	// Query command and flags.
 	queryCmd        = app.Command("query", "Query indexed pcap data.").Alias("q")
-	queryCA         = queryCmd.Flag("ca-path", "The certificate authority for TLS.").Short('c').String()
+	queryCA         = queryCmd.Flag("ca-path", "The certificate authority for TLS, required unless --insecure.").Short('c').String()
+	queryToken      = queryCmd.Flag("token", "Bearer token to authenticate to servers that require one (see serve --auth-token).").String()
+	queryInsecure   = queryCmd.Flag("insecure", "Do not verify the server certificate (susceptible to a machine-in-the-middle attack).").Default("false").Bool()
 	queryServerName = queryCmd.Flag("server-name", "The optional server name override TLS if the certificate is different than the server-addr.").String()
+	queryClientCert = queryCmd.Flag("client-cert", "The client certificate to present to servers that require one (see serve --client-ca).").ExistingFile()
+	queryClientKey  = queryCmd.Flag("client-key", "The key of the --client-cert.").ExistingFile()
 	queryGRPCAddr   = queryCmd.Flag("server-addr", "TCP address of the gRPC server to query.").Default(fmt.Sprintf("localhost:%d", defaultGRPCPort)).TCP()
 	queryBinOut     = queryCmd.Flag("binary", "Output binary pcap to stdout (for redirecting to a pcap file or another command (e.g. tshark or tcpdump).").Short('b').Default("false").Bool()
 	queryShowAll    = queryCmd.Flag("show-all", "Show the full packet information, not just the summary.").Short('a').Default("false").Bool()
+	queryOutput     = queryCmd.Flag("output", "Format of the results: text, json for one JSON object per packet (JSON Lines) with stable field names, including the decoded layers with --show-all, or csv for a header row and one row per packet.").Default(query.OutputText).Enum(query.OutputText, query.OutputJSON, query.OutputCSV)
 	queryLabel      = queryCmd.Flag("label", "Label to filter packet captures.").Default(common.DefaultLabel).String()
 	queryStart      = queryCmd.Flag("start", "Filter to only packets after this start time (format: "+query.ShortQueryTimeFormat+" or "+query.LongQueryTimeFormat+")").Required().Short('s').String()
-	queryDuration   = queryCmd.Flag("duration", "Filter to only packets between start time and this duration. Valid time units are 'ms', 's', 'm', 'h'.").Short('d').Default("15m").Duration()
-	queryArg        = queryCmd.Arg("query", "The query to search the packet index for (e.g. '1.2.3.4' or '443' or 'tcp').").Required().String()
+	queryDirection  = queryCmd.Flag("direction", "Match only the source or destination address (mac queries only).").Default("any").Enum("any", "src", "dst")
+	queryDuration   = queryCmd.Flag("duration", "Filter to only packets between start time and this duration. Valid time units are 'us', 'ms', 's', 'm', 'h'.").Short('d').Default("15m").Duration()
+	queryFollow     = queryCmd.Flag("follow", "Keep polling for packets as new indices are written, similar to `tail -f` (the duration is ignored).").Short('f').Default("false").Bool()
+	queryPoll       = queryCmd.Flag("poll-interval", "How often to poll for new indices when following.").Default("10s").Duration()
+	queryPager      = queryCmd.Flag("pager", "Page text output through $PAGER (or less) when stdout is a terminal.").Default("false").Bool()
+	queryTimeout    = queryCmd.Flag("timeout", "Maximum time for the query to run, 0 for no limit (a streaming binary export can legitimately run for minutes).").Default("0").Duration()
+	queryDialTime   = queryCmd.Flag("dial-timeout", "Maximum time to wait to connect to the server.").Default("10s").Duration()
+	queryKeepalive  = queryCmd.Flag("keepalive", "How often to ping the server on idle connections so long streams are not dropped by middleboxes (minimum "+common.MinKeepalive.String()+").").Default(common.DefaultKeepalive.String()).Duration()
+	queryOut        = queryCmd.Flag("out", "Also write the matching packets to this pcap file (with text output).").Short('o').String()
+	queryMinLen     = queryCmd.Flag("min-len", "Only output packets at least this many bytes long (filtered by the client after the server reads them).").Default("0").Int64()
+	queryMaxLen     = queryCmd.Flag("max-len", "Only output packets at most this many bytes long, 0 for no limit (filtered by the client after the server reads them).").Default("0").Int64()
+	queryFilter     = queryCmd.Flag("display-filter", "Only output packets matching this Wireshark-style display filter (e.g. 'tcp.port == 443 && ip.addr == 1.2.3.4'), evaluated by the server.").String()
+	queryReassemble = queryCmd.Flag("reassemble", "Also reassemble the TCP streams of the matching packets and write the payload of each flow direction to a file in this directory (with text output).").String()
+	queryCompress   = queryCmd.Flag("compress", "Request gzip compressed responses to reduce bandwidth over slow links.").Default("false").Bool()
+	queryInterface  = queryCmd.Flag("show-interface", "Show the interface each packet was captured on (if known).").Default("false").Bool()
+	queryFlows      = queryCmd.Flag("flow-summary", "Only output the first and/or last matching packet of each flow (5-tuple, in either direction).").Default("off").Enum("off", "first", "last", "first_last")
+	queryFormat     = queryCmd.Flag("format", "File format of the --binary output (pcapng has an interface for each capture interface and link type).").Default("pcap").Enum("pcap", "pcapng")
+	queryKeylog     = queryCmd.Flag("keylog", "TLS key log file (SSLKEYLOGFILE format) to embed in the pcapng output as a Decryption Secrets Block so Wireshark can decrypt the TLS traffic.").ExistingFile()
+	queryPathIdx    = queryCmd.Flag("path-idx", "Only read packets stored in this --pcap-path index of the server, starting at 0 (repeatable).").Uint8List()
+	queryTargets    = queryCmd.Flag("targets", "File of queries to run in turn over one connection, one per line (e.g. a list of IPs), instead of the query argument; each result is prefixed with its query.").ExistingFile()
+	queryCount      = queryCmd.Flag("count", "Only output the number of matching packets, counted by the server from the indices without reading the pcap files.").Default("false").Bool()
+	queryLimit      = queryCmd.Flag("limit", "Stop after this many matching packets, 0 for no limit; the server stops reading indices once it is reached.").Default("0").Uint32()
+	queryReverse    = queryCmd.Flag("reverse", "Output the newest packets first, e.g. with --limit for the most recent packets.").Default("false").Bool()
+	queryCursor     = queryCmd.Flag("cursor", "Resume a query after the last packet of the previous page, with the cursor written when a --limit query stops at its limit; the other options must be the same.").String()
+	queryWidePorts  = queryCmd.Flag("wide-port-range", fmt.Sprintf("Allow a port range query (e.g. '1024-65535') of more than %d ports; each port is looked up separately in every index, so wide ranges are slow.", search.MaxPortRange)).Default("false").Bool()
+	queryAnd        = queryCmd.Flag("and", "Only return packets that also match this query of the form <query-type>=<query> (e.g. 'port=443'; repeatable).").Strings()
+	queryOr         = queryCmd.Flag("or", "Also return packets that match this query of the form <query-type>=<query> (e.g. 'ip=10.0.0.6'; repeatable), instead of only those of the query argument; cannot be combined with --and.").Strings()
+	queryPivots     = queryCmd.Flag("pivot", "Query of the form <query-type>=<query> (e.g. 'ip=1.2.3.4' or 'port=443') to run in turn with the others over one connection, instead of --query-type and the query argument (repeatable); each result is prefixed with its pivot.").Strings()
+	queryGroupBy    = queryCmd.Flag("group-by", "Count the results by this field (srcip, dstip, srcport, dstport, proto, srcmac or dstmac; repeatable) and print a table of the counts, most packets first, instead of each result.").Enums(query.GroupByFields...)
+	queryQuiet      = queryCmd.Flag("quiet", "Do not print the summary of the results (packets, bytes, indices read and time taken) to stderr.").Default("false").Bool()
+	queryVerbose    = queryCmd.Flag("verbose", "Also print what is queried to stderr before the results.").Default("false").Bool()
+	queryArg        = queryCmd.Arg("query", "The query to search the packet index for (e.g. '1.2.3.4' or '443' or 'tcp'), required unless --targets is set.").String()
+
+	// Local query command and flags.
+	localCmd         = app.Command("query-local", "Query indexed pcap data in --index-path and --pcap-path directly, without a server.")
+	localBinOut      = localCmd.Flag("binary", "Output binary pcap to stdout (for redirecting to a pcap file or another command (e.g. tshark or tcpdump).").Short('b').Default("false").Bool()
+	localShowAll     = localCmd.Flag("show-all", "Show the full packet information, not just the summary.").Short('a').Default("false").Bool()
+	localOutput      = localCmd.Flag("output", "Format of the results: text, json for one JSON object per packet (JSON Lines) with stable field names, including the decoded layers with --show-all, or csv for a header row and one row per packet.").Default(query.OutputText).Enum(query.OutputText, query.OutputJSON, query.OutputCSV)
+	localLabel       = localCmd.Flag("label", "Label to filter packet captures.").Default(common.DefaultLabel).String()
+	localStart       = localCmd.Flag("start", "Filter to only packets after this start time (format: "+query.ShortQueryTimeFormat+" or "+query.LongQueryTimeFormat+")").Required().Short('s').String()
+	localDirection   = localCmd.Flag("direction", "Match only the source or destination address (mac queries only).").Default("any").Enum("any", "src", "dst")
+	localDuration    = localCmd.Flag("duration", "Filter to only packets between start time and this duration. Valid time units are 'us', 'ms', 's', 'm', 'h'.").Short('d').Default("15m").Duration()
+	localPager       = localCmd.Flag("pager", "Page text output through $PAGER (or less) when stdout is a terminal.").Default("false").Bool()
+	localTimeout     = localCmd.Flag("timeout", "Maximum time for the query to run, 0 for no limit.").Default("0").Duration()
+	localOut         = localCmd.Flag("out", "Also write the matching packets to this pcap file (with text output).").Short('o').String()
+	localMinLen      = localCmd.Flag("min-len", "Only output packets at least this many bytes long.").Default("0").Int64()
+	localMaxLen      = localCmd.Flag("max-len", "Only output packets at most this many bytes long, 0 for no limit.").Default("0").Int64()
+	localFilter      = localCmd.Flag("display-filter", "Only output packets matching this Wireshark-style display filter (e.g. 'tcp.port == 443 && ip.addr == 1.2.3.4').").String()
+	localReassemble  = localCmd.Flag("reassemble", "Also reassemble the TCP streams of the matching packets and write the payload of each flow direction to a file in this directory (with text output).").String()
+	localInterface   = localCmd.Flag("show-interface", "Show the interface each packet was captured on (if known).").Default("false").Bool()
+	localFlowSummary = localCmd.Flag("flow-summary", "Only output the first and/or last matching packet of each flow (5-tuple, in either direction).").Default("off").Enum("off", "first", "last", "first_last")
+	localFormat      = localCmd.Flag("format", "File format of the --binary output (pcapng has an interface for each capture interface and link type).").Default("pcap").Enum("pcap", "pcapng")
+	localKeylog      = localCmd.Flag("keylog", "TLS key log file (SSLKEYLOGFILE format) to embed in the pcapng output as a Decryption Secrets Block so Wireshark can decrypt the TLS traffic.").ExistingFile()
+	localPathIdx     = localCmd.Flag("path-idx", "Only read packets stored in this --pcap-path index, starting at 0 (repeatable).").Uint8List()
+	localCount       = localCmd.Flag("count", "Only output the number of matching packets, counted from the indices without reading the pcap files.").Default("false").Bool()
+	localLimit       = localCmd.Flag("limit", "Stop after this many matching packets, 0 for no limit; no more indices are read once it is reached.").Default("0").Uint32()
+	localReverse     = localCmd.Flag("reverse", "Output the newest packets first, e.g. with --limit for the most recent packets.").Default("false").Bool()
+	localCursor      = localCmd.Flag("cursor", "Resume a query after the last packet of the previous page, with the cursor written when a --limit query stops at its limit; the other options must be the same.").String()
+	localWidePorts   = localCmd.Flag("wide-port-range", fmt.Sprintf("Allow a port range query (e.g. '1024-65535') of more than %d ports; each port is looked up separately in every index, so wide ranges are slow.", search.MaxPortRange)).Default("false").Bool()
+	localAnd         = localCmd.Flag("and", "Only return packets that also match this query of the form <query-type>=<query> (e.g. 'port=443'; repeatable).").Strings()
+	localOr          = localCmd.Flag("or", "Also return packets that match this query of the form <query-type>=<query> (e.g. 'ip=10.0.0.6'; repeatable), instead of only those of the query argument; cannot be combined with --and.").Strings()
+	localGroupBy     = localCmd.Flag("group-by", "Count the results by this field (srcip, dstip, srcport, dstport, proto, srcmac or dstmac; repeatable) and print a table of the counts, most packets first, instead of each result.").Enums(query.GroupByFields...)
+	localQuiet       = localCmd.Flag("quiet", "Do not print the summary of the results (packets, bytes, indices read and time taken) to stderr.").Default("false").Bool()
+	localVerbose     = localCmd.Flag("verbose", "Also print what is queried to stderr before the results.").Default("false").Bool()
+	localConcurrency = localCmd.Flag("concurrency", "Number of indices to read at the same time without --limit (each with an open index database and pcap file).").Default(fmt.Sprintf("%d", search.DefaultConcurrency)).Int()
+	localStrict      = localCmd.Flag("strict", "Fail if an index references a pcap file that does not exist, instead of skipping its packets with a warning.").Default("false").Bool()
+	localArg         = localCmd.Arg("query", "The query to search the packet index for (e.g. '1.2.3.4' or '443' or 'tcp').").Required().String()
+
+	// Host stats command and flags.
+	statsCmd        = app.Command("stats", "Summarize the traffic of a host: its top peers, protocols and ports (every packet of the host is read by the server).")
+	statsCA         = statsCmd.Flag("ca-path", "The certificate authority for TLS, required unless --insecure.").Short('c').String()
+	statsToken      = statsCmd.Flag("token", "Bearer token to authenticate to servers that require one (see serve --auth-token).").String()
+	statsInsecure   = statsCmd.Flag("insecure", "Do not verify the server certificate (susceptible to a machine-in-the-middle attack).").Default("false").Bool()
+	statsServerName = statsCmd.Flag("server-name", "The optional server name override TLS if the certificate is different than the server-addr.").String()
+	statsClientCert = statsCmd.Flag("client-cert", "The client certificate to present to servers that require one (see serve --client-ca).").ExistingFile()
+	statsClientKey  = statsCmd.Flag("client-key", "The key of the --client-cert.").ExistingFile()
+	statsGRPCAddr   = statsCmd.Flag("server-addr", "TCP address of the gRPC server to query.").Default(fmt.Sprintf("localhost:%d", defaultGRPCPort)).TCP()
+	statsDialTime   = statsCmd.Flag("dial-timeout", "Maximum time to wait to connect to the server.").Default("10s").Duration()
+	statsTimeout    = statsCmd.Flag("timeout", "Maximum time for the summary, 0 for no limit.").Default("0").Duration()
+	statsLabel      = statsCmd.Flag("label", "Label to filter packet captures.").Default(common.DefaultLabel).String()
+	statsStart      = statsCmd.Flag("start", "Filter to only packets after this start time (format: "+query.ShortQueryTimeFormat+" or "+query.LongQueryTimeFormat+")").Required().Short('s').String()
+	statsDuration   = statsCmd.Flag("duration", "Filter to only packets between start time and this duration. Valid time units are 'us', 'ms', 's', 'm', 'h'.").Short('d').Default("15m").Duration()
+	statsIP         = statsCmd.Flag("query", "The IP address of the host to summarize.").Short('q').Required().String()
+	statsTop        = statsCmd.Flag("top", "Number of peers and ports to show.").Default("10").Int()
+	statsJSON       = statsCmd.Flag("json", "Print the summary as JSON.").Default("false").Bool()
+
+	// S3 sync command and flags.
+	s3SyncCmd   = app.Command("s3-sync", "Download captures uploaded to --s3-bucket that are missing locally so they can be served.")
+	s3SyncLabel = s3SyncCmd.Flag("label", "Label of the packet captures to download.").Default(common.DefaultLabel).String()
+
+	// Gen command and flags.
+	genCmd      = app.Command("gen", "Generate a synthetic pcap file to ingest for benchmarking capture and query.")
+	genFile     = genCmd.Flag("file", "Pcap file to write.").Short('f').Default("synthetic.pcap").String()
+	genPackets  = genCmd.Flag("packets", "Number of packets to generate.").Default("100000").Int()
+	genFlows    = genCmd.Flag("flows", "Number of distinct 5-tuple flows.").Default("1000").Int()
+	genHosts    = genCmd.Flag("hosts", "Number of distinct hosts (IP and MAC addresses).").Default("100").Int()
+	genUDPRatio = genCmd.Flag("udp-ratio", "Fraction of flows that are UDP (the rest are TCP).").Default("0.2").Float64()
+	genPayload  = genCmd.Flag("payload-size", "Payload bytes in each packet.").Default("512").Int()
+	genDist     = genCmd.Flag("distribution", "Distribution of packets across flows.").Default(gen.DistZipf).Enum(gen.DistUniform, gen.DistZipf)
+	genStart    = genCmd.Flag("start", "Timestamp of the first packet (format: "+query.LongQueryTimeFormat+").").Default("2020-01-01T00:00:00Z").String()
+	genRate     = genCmd.Flag("rate", "Packets per second of packet time.").Default("1000").Int()
+	genSeed     = genCmd.Flag("seed", "Random seed, to reproduce a file.").Default("1").Int64()
+
+	// Interfaces command.
+	interfacesCmd = app.Command("interfaces", "List the network interfaces that can be captured from (like tcpdump -D).")
+
+	// Verify command.
+	verifyCmd = app.Command("verify", "Check the pcap files in --pcap-path against the SHA-256 checksums written with capture --checksum.")
+
+	// Prune command and flags.
+	pruneCmd       = app.Command("prune", "Delete the indices (of every label) and pcap files of captures older than --older-than, and print the disk space freed.")
+	pruneOlderThan = pruneCmd.Flag("older-than", "Delete the captures whose packets are all older than this, e.g. 720h for 30 days.").Required().Duration()
+	pruneDryRun    = pruneCmd.Flag("dry-run", "Only list what would be deleted.").Default("false").Bool()
+
+	// Migrate command and flags.
+	migrateCmd    = app.Command("migrate", "Rewrite the indices written in an older format (see info) in the current format.")
+	migrateLabel  = migrateCmd.Flag("label", "Only migrate the indices of this label, instead of every label in --index-path.").String()
+	migrateDryRun = migrateCmd.Flag("dry-run", "Only list the indices that would be migrated.").Default("false").Bool()
+
+	// Export index command and flags.
+	exportCmd    = app.Command("export-index", "Write the keys of an index and the pcap file and offset of each packet they reference.")
+	exportIndex  = exportCmd.Flag("index", "Path of the index to export (a .idx directory).").Required().ExistingDir()
+	exportFormat = exportCmd.Flag("format", "Output format, JSON lines (one key per line) or CSV (one packet reference per row).").Default(export.FormatJSON).Enum(export.FormatJSON, export.FormatCSV)
 
 	// Info command and flags.
-	infoCmd  = app.Command("info", "Get information about indexed pcap data.").Alias("i")
-	infoKeys = infoCmd.Flag("show-keys", "Show all the unique keys in the database, sorted by type.").Short('k').Default("false").Bool()
+	infoCmd        = app.Command("info", "Get information about indexed pcap data.").Alias("i")
+	infoKeys       = infoCmd.Flag("show-keys", "Show all the unique keys in the database, sorted by type.").Short('k').Default("false").Bool()
+	infoMinPackets = infoCmd.Flag("min-packets", "Only show keys with at least this many packets with --show-keys.").Default("0").Int()
+	infoTop        = infoCmd.Flag("top", "Only show the N keys of each type with the most packets, busiest first, and their packets (implies --show-keys).").Default("0").Int()
+	infoPackets    = infoCmd.Flag("show-packets", "Show the number of packets of each key (implies --show-keys).").Default("false").Bool()
+	infoProtocols  = infoCmd.Flag("protocols", "Only show the number of packets of each IP protocol in each label.").Default("false").Bool()
+	infoConfig     = infoCmd.Flag("config", "Only show the capture configuration stored in the indices of each label.").Default("false").Bool()
+	infoJSON       = infoCmd.Flag("json", "Output as JSON, e.g. for jq: the indices (with the unique keys by record type with --show-keys), or --protocols or --config.").Default("false").Bool()
 )
 
 // During initialization set up Enum flags from protobuf spec.
@@ -98,9 +285,18 @@ func main() {
 
 	// Enum flags that are built during init().
 	queryTypeHelp := fmt.Sprintf("The type of query to search the packet index for: %v", queryTypes)
-	queryType := queryCmd.Flag("query-type", queryTypeHelp).Short('q').Required().Enum(queryTypes...)
+	queryType := queryCmd.Flag("query-type", queryTypeHelp+", required unless --pivot is set").Short('q').Enum(queryTypes...)
+	localType := localCmd.Flag("query-type", queryTypeHelp).Short('q').Required().Enum(queryTypes...)
 
-	app.PreAction(func(c *kingpin.ParseContext) error {
+	// Flags with a custom value, and aliases of other flags.
+	captureCmd.Flag("rotate-size", "Start a new pcap file in each --pcap-path once one would be larger than this size (e.g. 256MB, in bytes without a unit), 0 to only rotate files every --rotate-interval (indices written by older versions cannot reference files larger than 4GB).").Default(captureRotateSize.String()).SetValue(&captureRotateSize)
+	captureCmd.Flag("max-disk-bytes", "Delete the oldest indices of the label with their pcap files (after any upload) once the label index path and --pcap-path directories use more than this size (e.g. 500GB, in bytes without a unit), like a ring buffer; 0 to keep everything.").Default("0").SetValue(&captureMaxDisk)
+	formatAlias(queryCmd, queryFormat)
+	formatAlias(localCmd, localFormat)
+
+	// The AES key of the indices, read from --encryption-key-file.
+	var indexKey []byte
+	app.PreAction(func(c *kingpin.ParseContext) (err error) {
 		zerolog.SetGlobalLevel(zerolog.WarnLevel) // default
 		if *logLevel == "debug" {
 			zerolog.SetGlobalLevel(zerolog.DebugLevel)
@@ -112,7 +308,17 @@ func main() {
 		if !*logJSON {
 			log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 		}
-		return nil
+		if *indexKeyFile != "" {
+			indexKey, err = search.ReadEncryptionKey(*indexKeyFile)
+			if err != nil {
+				return err
+			}
+		}
+		// --help runs the pre actions before the flag defaults are set.
+		if *fileTimeFmt == "" {
+			return nil
+		}
+		return common.SetFileTimeFormat(*fileTimeFmt)
 	})
 
 	// Main context for canceling on interrupt.
@@ -139,7 +345,7 @@ func main() {
 	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
 
 	case captureCmd.FullCommand():
-		if len(*captureFiles) == 0 && *captureInterface == "" {
+		if len(*captureFiles) == 0 && len(*captureInterface) == 0 {
 			log.Fatal().Msg("please specify a pcap file to read or an interface to listen on")
 		}
 		if *captureGops {
@@ -147,16 +353,45 @@ func main() {
 				log.Fatal().Err(err).Msg("unable to start gops agent")
 			}
 		}
+		if *capturePprofPort != 0 {
+			if err := startPprof(*capturePprofHost, *capturePprofPort); err != nil {
+				log.Fatal().Err(err).Msg("unable to start pprof server")
+			}
+		}
 		indexPath := path.Join(*indexDirPath, *captureLabel)
 		err := setupDirs(indexPath, *pcapDirPaths)
 		if err != nil {
 			log.Fatal().Err(err).Msg("unable to setup directories")
 		}
+		opts := capture.Options{
+			StorePrefix:      *s3Prefix,
+			DeleteLocal:      *captureDeleteLocal,
+			Checksum:         *captureChecksum,
+			ServerPortsOnly:  *captureServerPorts,
+			PacketMeta:       *capturePacketMeta,
+			Resume:           *captureResume,
+			PartitionByDate:  *capturePartition,
+			LiveQueryAddr:    *captureLiveAddr,
+			RotationSize:     uint64(captureRotateSize),
+			RotationInterval: *captureRotateEvery,
+			PcapBuffer:       *capturePcapBuffer,
+			Immediate:        *captureImmediate,
+			StatsInterval:    *captureStatsEvery,
+			Compression:      *captureCompress,
+			MaxDiskBytes:     uint64(captureMaxDisk),
+			EncryptionKey:    indexKey,
+		}
+		if *s3Bucket != "" {
+			opts.Store, err = storage.NewS3(*s3Endpoint, *s3Bucket, *s3Region, *s3AccessKey, *s3SecretKey)
+			if err != nil {
+				log.Fatal().Err(err).Msg("unable to configure s3 storage")
+			}
+		}
 		var server *capture.CaptureServer
 		if len(*captureFiles) > 0 {
-			server = capture.NewCaptureServerFile(*captureFiles, indexPath, *pcapDirPaths)
+			server = capture.NewCaptureServerFile(*captureFiles, indexPath, *pcapDirPaths, opts)
 		} else {
-			server = capture.NewCaptureServerInterface(*captureInterface, *capturePromiscuous, indexPath, *pcapDirPaths)
+			server = capture.NewCaptureServerInterface(*captureInterface, *capturePromiscuous, indexPath, *pcapDirPaths, opts)
 		}
 		kingpin.FatalIfError(server.Run(ctx, done), "Starting capture failed")
 
@@ -166,19 +401,228 @@ func main() {
 		if err != nil {
 			log.Fatal().Err(err)
 		}
-		server := serve.NewQueryServer(*serveGRPCPort, *serveHTTPPort, *serveCert, *serveKey, *serveHTTPServerName, *indexDirPath, *pcapDirPaths)
+		if *servePprofPort != 0 {
+			if err := startPprof(*servePprofHost, *servePprofPort); err != nil {
+				log.Fatal().Err(err).Msg("unable to start pprof server")
+			}
+		}
+		opts := serve.Options{
+			IndexCacheSize:   *serveIndexCacheSize,
+			Keepalive:        *serveKeepalive,
+			RateLimit:        *serveRateLimit,
+			RateBurst:        *serveRateBurst,
+			CORSOrigins:      *serveCORSOrigins,
+			AuditLog:         *serveAuditLog,
+			OpenRetries:      *serveOpenRetries,
+			OpenRetryBackoff: *serveRetryBackoff,
+			MaxQueryBytes:    *serveMaxQueryBytes,
+			MetricsPort:      *serveMetricsPort,
+			ClientCA:         *serveClientCA,
+			AuthTokens:       *serveAuthTokens,
+			AuthTokenFile:    *serveAuthTokenFile,
+			Strict:           *serveStrict,
+			Concurrency:      *serveConcurrency,
+			EncryptionKey:    indexKey,
+		}
+		server := serve.NewQueryServer(*serveGRPCPort, *serveHTTPPort, *serveCert, *serveKey, *serveHTTPServerName, *indexDirPath, *pcapDirPaths, opts)
 		kingpin.FatalIfError(server.Run(ctx, done), "Starting query server failed")
 
 	// Query captured pcap data.
 	case queryCmd.FullCommand():
-		client := query.NewClientConn(*queryGRPCAddr, *queryCA, *queryServerName)
+		if *queryKeepalive < common.MinKeepalive {
+			kingpin.Fatalf("--keepalive must be at least %s", common.MinKeepalive)
+		}
+		client := query.NewClientConn(*queryGRPCAddr, *queryCA, *queryServerName, *queryClientCert, *queryClientKey, *queryInsecure, *queryToken, *queryDialTime, *queryKeepalive)
 		kingpin.FatalIfError(client.Open(ctx), "Client connection failed")
-		kingpin.FatalIfError(client.Execute(ctx, *queryLabel, *queryStart, *queryDuration, *queryType, *queryArg, *queryBinOut, *queryShowAll), "Query failed")
+		opts := query.Options{
+			Label:         *queryLabel,
+			Start:         *queryStart,
+			Duration:      *queryDuration,
+			QueryType:     *queryType,
+			QueryArg:      *queryArg,
+			Direction:     *queryDirection,
+			Binary:        *queryBinOut,
+			ShowAll:       *queryShowAll,
+			Output:        *queryOutput,
+			Follow:        *queryFollow,
+			PollInterval:  *queryPoll,
+			Pager:         *queryPager,
+			Timeout:       *queryTimeout,
+			FlowSummary:   *queryFlows,
+			ShowInterface: *queryInterface,
+			Compress:      *queryCompress,
+			Out:           *queryOut,
+			Reassemble:    *queryReassemble,
+			MinLen:        *queryMinLen,
+			MaxLen:        *queryMaxLen,
+			DisplayFilter: *queryFilter,
+			Format:        *queryFormat,
+			Keylog:        *queryKeylog,
+			PathIdx:       *queryPathIdx,
+			Targets:       *queryTargets,
+			Pivots:        *queryPivots,
+			WidePortRange: *queryWidePorts,
+			And:           *queryAnd,
+			Or:            *queryOr,
+			Count:         *queryCount,
+			Limit:         *queryLimit,
+			Reverse:       *queryReverse,
+			Cursor:        *queryCursor,
+			GroupBy:       *queryGroupBy,
+			Quiet:         *queryQuiet,
+			Verbose:       *queryVerbose,
+		}
+		kingpin.FatalIfError(client.Execute(ctx, opts), "Query failed")
+		client.Close()
+		done <- struct{}{}
+
+	// Summarize the traffic of a host.
+	case statsCmd.FullCommand():
+		client := query.NewClientConn(*statsGRPCAddr, *statsCA, *statsServerName, *statsClientCert, *statsClientKey, *statsInsecure, *statsToken, *statsDialTime, common.DefaultKeepalive)
+		kingpin.FatalIfError(client.Open(ctx), "Client connection failed")
+		opts := query.StatsOptions{
+			Label:    *statsLabel,
+			Start:    *statsStart,
+			Duration: *statsDuration,
+			IP:       *statsIP,
+			Top:      *statsTop,
+			JSON:     *statsJSON,
+			Timeout:  *statsTimeout,
+		}
+		kingpin.FatalIfError(client.Stats(ctx, opts), "Stats failed")
 		client.Close()
 		done <- struct{}{}
 
+	// Query local pcap data without a server.
+	case localCmd.FullCommand():
+		opts := query.Options{
+			Label:         *localLabel,
+			Start:         *localStart,
+			Duration:      *localDuration,
+			QueryType:     *localType,
+			QueryArg:      *localArg,
+			Direction:     *localDirection,
+			Binary:        *localBinOut,
+			ShowAll:       *localShowAll,
+			Output:        *localOutput,
+			Pager:         *localPager,
+			Timeout:       *localTimeout,
+			FlowSummary:   *localFlowSummary,
+			ShowInterface: *localInterface,
+			Out:           *localOut,
+			Reassemble:    *localReassemble,
+			MinLen:        *localMinLen,
+			MaxLen:        *localMaxLen,
+			DisplayFilter: *localFilter,
+			Format:        *localFormat,
+			Keylog:        *localKeylog,
+			PathIdx:       *localPathIdx,
+			GroupBy:       *localGroupBy,
+			WidePortRange: *localWidePorts,
+			And:           *localAnd,
+			Or:            *localOr,
+			Count:         *localCount,
+			Limit:         *localLimit,
+			Reverse:       *localReverse,
+			Cursor:        *localCursor,
+			Quiet:         *localQuiet,
+			Verbose:       *localVerbose,
+			Strict:        *localStrict,
+			Concurrency:   *localConcurrency,
+			EncryptionKey: indexKey,
+		}
+		kingpin.FatalIfError(query.ExecuteLocal(ctx, *indexDirPath, *pcapDirPaths, opts), "Query failed")
+		done <- struct{}{}
+
+	case s3SyncCmd.FullCommand():
+		err := setupDirs(path.Join(*indexDirPath, *s3SyncLabel), *pcapDirPaths)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to setup directories")
+		}
+		store, err := storage.NewS3(*s3Endpoint, *s3Bucket, *s3Region, *s3AccessKey, *s3SecretKey)
+		if err != nil {
+			kingpin.Fatalf("Unable to configure s3 storage: %s", err)
+		}
+		err = s3sync.Fetch(ctx, store, *s3Prefix, *s3SyncLabel, *indexDirPath, *pcapDirPaths)
+		if err != nil {
+			kingpin.Fatalf("Error syncing from s3: %s", err)
+		}
+		done <- struct{}{}
+
+	case genCmd.FullCommand():
+		start, err := time.Parse(query.LongQueryTimeFormat, *genStart)
+		if err != nil {
+			kingpin.Fatalf("Unable to parse start time '%s': %s", *genStart, err)
+		}
+		opts := gen.Options{
+			File:         *genFile,
+			Packets:      *genPackets,
+			Flows:        *genFlows,
+			Hosts:        *genHosts,
+			UDPRatio:     *genUDPRatio,
+			PayloadSize:  *genPayload,
+			Distribution: *genDist,
+			Start:        start,
+			Rate:         *genRate,
+			Seed:         *genSeed,
+		}
+		err = gen.Run(opts)
+		if err != nil {
+			kingpin.Fatalf("Error generating pcap: %s", err)
+		}
+		done <- struct{}{}
+
+	case interfacesCmd.FullCommand():
+		err := capture.PrintInterfaces(os.Stdout)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		done <- struct{}{}
+
+	case verifyCmd.FullCommand():
+		err := verify.Run(*pcapDirPaths)
+		if err != nil {
+			kingpin.Fatalf("Verification failed: %s", err)
+		}
+		done <- struct{}{}
+
+	case migrateCmd.FullCommand():
+		err := migrate.Run(*indexDirPath, *migrateLabel, *migrateDryRun, indexKey)
+		if err != nil {
+			kingpin.Fatalf("Error migrating indices: %s", err)
+		}
+		done <- struct{}{}
+
+	case pruneCmd.FullCommand():
+		err := prune.Run(*indexDirPath, *pcapDirPaths, *pruneOlderThan, *pruneDryRun)
+		if err != nil {
+			kingpin.Fatalf("Error pruning captures: %s", err)
+		}
+		done <- struct{}{}
+
+	case exportCmd.FullCommand():
+		err := export.Index(ctx, *exportIndex, *exportFormat, search.Options{EncryptionKey: indexKey}, os.Stdout)
+		if err != nil {
+			kingpin.Fatalf("Error exporting index: %s", err)
+		}
+		done <- struct{}{}
+
 	case infoCmd.FullCommand():
-		err := info.Get(*indexDirPath, *infoKeys)
+		var err error
+		switch {
+		case *infoProtocols:
+			err = info.Protocols(*indexDirPath, search.Options{EncryptionKey: indexKey}, *infoJSON)
+		case *infoConfig:
+			err = info.Config(*indexDirPath, search.Options{EncryptionKey: indexKey}, *infoJSON)
+		default:
+			keyOpts := info.KeyOptions{
+				Show:       *infoKeys || *infoTop > 0 || *infoPackets,
+				MinPackets: *infoMinPackets,
+				Top:        *infoTop,
+				Packets:    *infoPackets,
+			}
+			err = info.Get(*indexDirPath, search.Options{EncryptionKey: indexKey}, keyOpts, *infoJSON)
+		}
 		if err != nil {
 			kingpin.Fatalf("Error getting information: %s", err)
 		}
@@ -188,6 +632,63 @@ func main() {
 
 }
 
+// startPprof serves the net/http/pprof handlers on their own listener, so
+// the profiles are never exposed through the HTTP gateway.
+func startPprof(host string, port uint16) error {
+	addr := net.JoinHostPort(host, fmt.Sprint(port))
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	log.Info().Str("addr", addr).Msg("serving pprof profiles")
+	go func() {
+		err := http.Serve(l, mux)
+		log.Error().Err(err).Msg("pprof server stopped")
+	}()
+	return nil
+}
+
+// formatAlias adds --pcapng to cmd, which sets its --format flag to pcapng.
+func formatAlias(cmd *kingpin.CmdClause, format *string) {
+	pcapng := new(bool)
+	cmd.Flag("pcapng", "The same as --format pcapng.").Action(func(*kingpin.ParseContext) error {
+		if *pcapng {
+			*format = "pcapng"
+		}
+		return nil
+	}).BoolVar(pcapng)
+}
+
+// byteSize is a flag value of a number of bytes, with an optional unit
+// suffix (e.g. 256MB or 256MiB, both multiples of 1024).
+type byteSize uint64
+
+func (b *byteSize) Set(s string) error {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		*b = byteSize(n)
+		return nil
+	}
+	n, err := units.ParseBase2Bytes(s)
+	if err != nil {
+		return fmt.Errorf("invalid size %s (e.g. 256MB): %s", s, err)
+	}
+	if n < 0 {
+		return fmt.Errorf("invalid size %s: must not be negative", s)
+	}
+	*b = byteSize(n)
+	return nil
+}
+
+func (b *byteSize) String() string {
+	return units.Base2Bytes(*b).String()
+}
+
 // Check that index and pcap directories exist or make them if not.
 func setupDirs(iDir string, pDirs []string) (err error) {
 	err = os.MkdirAll(iDir, os.ModePerm)
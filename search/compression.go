@@ -0,0 +1,213 @@
+package search
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/klauspost/compress/zstd"
+
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// GetCompression returns the compression of the pcap files of an index,
+// common.CompressionNone for indices written without it.
+func GetCompression(txn *badger.Txn) (string, error) {
+	b, err := GetMeta(txn, index.MetaPcapCompression)
+	if err != nil || len(b) == 0 {
+		return common.CompressionNone, err
+	}
+	switch c := string(b); c {
+	case common.CompressionGzip, common.CompressionZstd:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unsupported pcap compression %s", c)
+	}
+}
+
+// pcapReader reads the packet records of a pcap file at the offsets in an
+// index.
+type pcapReader interface {
+	io.ReaderAt
+	Name() string
+	// end returns the offset of the end of the data that off is in, the
+	// end of the file or, if it is compressed, of the block.
+	end(off int64) (int64, error)
+}
+
+// pcapFile is an uncompressed pcap file, which is read directly.
+type pcapFile struct {
+	*os.File
+}
+
+func (f pcapFile) end(off int64) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// pcapBlock is a decompressed block of a compressed pcap file.
+type pcapBlock struct {
+	file   string
+	offset int64
+	data   []byte
+}
+
+// compressedPcapFile is a compressed pcap file, which is read a block at
+// a time (see common.CompressedOffset).
+type compressedPcapFile struct {
+	*os.File
+	compression string
+	// block is the last block that was read, which is shared between the
+	// files of a query since consecutive packets are usually in the same
+	// block.
+	block *pcapBlock
+}
+
+// readBlock returns the decompressed data of the block at offset (in the
+// compressed file).
+func (f compressedPcapFile) readBlock(offset int64) ([]byte, error) {
+	if f.block.file == f.Name() && f.block.offset == offset && f.block.data != nil {
+		return f.block.data, nil
+	}
+	var data []byte
+	var err error
+	switch f.compression {
+	case common.CompressionGzip:
+		data, err = readGzipBlock(f.File, offset)
+	case common.CompressionZstd:
+		data, err = readZstdBlock(f.File, offset)
+	default:
+		return nil, fmt.Errorf("unsupported pcap compression %s", f.compression)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing block at offset %d: %s", offset, err)
+	}
+	*f.block = pcapBlock{file: f.Name(), offset: offset, data: data}
+	return data, nil
+}
+
+// readGzipBlock decompresses the gzip member at offset.
+func readGzipBlock(r io.ReaderAt, offset int64) ([]byte, error) {
+	gr, err := gzip.NewReader(io.NewSectionReader(r, offset, 1<<62))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	// Only the member of the block.
+	gr.Multistream(false)
+	return ioutil.ReadAll(io.LimitReader(gr, 1<<common.PcapBlockBits))
+}
+
+// zstdDecoder decompresses the blocks of zstd pcap files. DecodeAll can be
+// called by several queries at the same time.
+var zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(1<<common.PcapBlockBits))
+
+// readZstdBlock decompresses the zstd frame at offset, and not the frames
+// of the blocks after it.
+func readZstdBlock(r io.ReaderAt, offset int64) ([]byte, error) {
+	size, err := zstdFrameSize(r, offset)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, size)
+	_, err = r.ReadAt(frame, offset)
+	if err != nil {
+		return nil, err
+	}
+	return zstdDecoder.DecodeAll(frame, nil)
+}
+
+// maxZstdFrameSize is larger than the compressed size of any block, whose
+// data is stored as is if it does not compress.
+const maxZstdFrameSize = 2 << common.PcapBlockBits
+
+// zstdFrameSize returns the size of the zstd frame at offset from its frame
+// and block headers (see the zstd compression format, RFC 8878).
+func zstdFrameSize(r io.ReaderAt, offset int64) (int64, error) {
+	var b [5]byte
+	_, err := r.ReadAt(b[:], offset)
+	if err != nil {
+		return 0, err
+	}
+	if binary.LittleEndian.Uint32(b[:]) != zstdMagic {
+		return 0, fmt.Errorf("no zstd frame")
+	}
+	descriptor := b[4]
+	singleSegment := descriptor&(1<<5) != 0
+	size := int64(len(b))
+	if !singleSegment {
+		// The window descriptor.
+		size++
+	}
+	// The dictionary ID and frame content size.
+	size += [4]int64{0, 1, 2, 4}[descriptor&3]
+	if fcs := descriptor >> 6; fcs > 0 {
+		size += 1 << fcs
+	} else if singleSegment {
+		size++
+	}
+	for last := false; !last; {
+		_, err = r.ReadAt(b[:3], offset+size)
+		if err != nil {
+			return 0, err
+		}
+		header := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+		last = header&1 != 0
+		blockSize := int64(header >> 3)
+		switch blockType := (header >> 1) & 3; blockType {
+		case zstdBlockRLE:
+			blockSize = 1
+		case zstdBlockReserved:
+			return 0, fmt.Errorf("invalid zstd block type %d", blockType)
+		}
+		size += 3 + blockSize
+		if size > maxZstdFrameSize {
+			return 0, fmt.Errorf("zstd frame is larger than %d bytes", maxZstdFrameSize)
+		}
+	}
+	if descriptor&(1<<2) != 0 {
+		// The content checksum.
+		size += 4
+	}
+	return size, nil
+}
+
+// The magic number and block types of the zstd format.
+const (
+	zstdMagic         = 0xfd2fb528
+	zstdBlockRLE      = 1
+	zstdBlockReserved = 3
+)
+
+func (f compressedPcapFile) ReadAt(p []byte, off int64) (int, error) {
+	blockOffset, offsetInBlock := common.SplitCompressedOffset(uint64(off))
+	data, err := f.readBlock(blockOffset)
+	if err != nil {
+		return 0, err
+	}
+	if offsetInBlock >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, data[offsetInBlock:])
+	if n < len(p) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
+
+func (f compressedPcapFile) end(off int64) (int64, error) {
+	blockOffset, _ := common.SplitCompressedOffset(uint64(off))
+	data, err := f.readBlock(blockOffset)
+	if err != nil {
+		return 0, err
+	}
+	return int64(common.CompressedOffset(blockOffset, len(data))), nil
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestReadZstdBlock(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Blocks that compress, that do not (stored as raw zstd blocks) and
+	// that are one repeated byte (RLE blocks), as the capture writes them.
+	random := make([]byte, 300*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	blocks := [][]byte{
+		bytes.Repeat([]byte("mercury pcap block "), 10000),
+		random,
+		make([]byte, 200*1024),
+		[]byte("x"),
+	}
+	var file []byte
+	var offsets []int64
+	for _, block := range blocks {
+		offsets = append(offsets, int64(len(file)))
+		file = enc.EncodeAll(block, file)
+	}
+	r := bytes.NewReader(file)
+
+	for i, block := range blocks {
+		next := int64(len(file))
+		if i+1 < len(offsets) {
+			next = offsets[i+1]
+		}
+		size, err := zstdFrameSize(r, offsets[i])
+		if err != nil {
+			t.Fatalf("block %d: %s", i, err)
+		}
+		if size != next-offsets[i] {
+			t.Errorf("block %d: frame size %d, want %d", i, size, next-offsets[i])
+		}
+		data, err := readZstdBlock(r, offsets[i])
+		if err != nil {
+			t.Fatalf("block %d: %s", i, err)
+		}
+		if !bytes.Equal(data, block) {
+			t.Errorf("block %d: decompressed %d bytes, want the %d of the block", i, len(data), len(block))
+		}
+	}
+
+	_, err = zstdFrameSize(r, offsets[1]+1)
+	if err == nil {
+		t.Error("found a frame inside a block")
+	}
+}
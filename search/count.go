@@ -0,0 +1,101 @@
+package search
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// CountIndices returns the number of packets in the indices that match a
+// query, from the index values alone. Packets with packet metadata are
+// only counted if they are in the time range of the query; the others are
+// counted if their index is selected, so approximate is true if an index
+// without packet metadata is not entirely within the time range.
+func CountIndices(open Opener, indexPath string, indices []string, pcapPaths []string, req *v1.QueryReq) (count uint64, approximate bool, err error) {
+	if req.DisplayFilter != "" || req.FlowSummary != v1.FlowSummary_off {
+		return 0, false, fmt.Errorf("counting is not supported with a display filter or flow summary, which need the packets")
+	}
+	if req.Cursor != "" {
+		return 0, false, fmt.Errorf("counting is not supported with a cursor")
+	}
+	start, end := GetTimes(req.StartTime, req.Duration)
+	for i, indexName := range indices {
+		db, release, err := open(path.Join(indexPath, indexName))
+		if err != nil {
+			return 0, false, err
+		}
+		n, approx, err := CountIndex(db, pcapPaths, req, start, end)
+		release()
+		if err != nil {
+			return 0, false, fmt.Errorf("error counting index %s: %s", path.Join(indexPath, indexName), err)
+		}
+		count += n
+		next := ""
+		if i+1 < len(indices) {
+			next = indices[i+1]
+		}
+		approximate = approximate || (approx && !indexWithin(indexName, next, start, end))
+	}
+	return count, approximate, nil
+}
+
+// CountIndex returns the number of packets in an index that match a
+// query, see CountIndices. The pcap-paths are only checked against the
+// index, so the counts match those of a query.
+func CountIndex(db *badger.DB, pcapPaths []string, req *v1.QueryReq, start, end time.Time) (count uint64, approximate bool, err error) {
+	err = db.View(func(txn *badger.Txn) error {
+		err := CheckPcapPathCount(txn, pcapPaths)
+		if err != nil {
+			return err
+		}
+		err = CheckPathIdx(req.PcapPathIdx, pcapPaths)
+		if err != nil {
+			return err
+		}
+		values, err := lookupValues(txn, req)
+		if err != nil {
+			return err
+		}
+		count, approximate = countValues(values, start, end)
+		return nil
+	})
+	return count, approximate, err
+}
+
+// countValues returns the number of values with a timestamp in [start,
+// end), or of all of them without packet metadata.
+func countValues(values index.Value, start, end time.Time) (uint64, bool) {
+	if len(values) == 0 || values[0].Meta == nil {
+		return uint64(len(values)), len(values) > 0
+	}
+	var count uint64
+	for _, val := range values {
+		if val.Meta.Timestamp.Before(start) || !val.Meta.Timestamp.Before(end) {
+			continue
+		}
+		count++
+	}
+	return count, false
+}
+
+// indexWithin returns true if all of the packets of an index are within
+// [start, end). An index has the packets from the time in its name until
+// the time in the name of the next index, or for at most
+// common.MaxPcapFileTime if it is the last one.
+func indexWithin(indexName, next string, start, end time.Time) bool {
+	t, err := IndexTime(indexName)
+	if err != nil {
+		return false
+	}
+	last := t.Add(common.MaxPcapFileTime)
+	if nt, err := IndexTime(next); next != "" && err == nil {
+		last = nt
+	}
+	return !t.Before(start) && !last.After(end)
+}
@@ -0,0 +1,71 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// newCursor returns the cursor of a packet, so a query that stopped at its
+// limit can be resumed after it. It is the name of the index and the pcap
+// path index and offset of the packet's value, e.g.
+// `2021/03/01/2021_03_01-12_00_00.idx:0:1234`.
+func newCursor(indexName string, val *index.ValueElement) string {
+	return fmt.Sprintf("%s:%d:%d", indexName, val.PathIdx, val.Offset)
+}
+
+// parseCursor returns the index name and value position of a cursor.
+func parseCursor(cursor string) (string, *index.ValueElement, error) {
+	parts := strings.Split(cursor, ":")
+	n := len(parts)
+	if n < 3 {
+		return "", nil, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	pathIdx, err := strconv.ParseUint(parts[n-2], 10, 8)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid cursor %q: %s", cursor, err)
+	}
+	offset, err := strconv.ParseUint(parts[n-1], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid cursor %q: %s", cursor, err)
+	}
+	return strings.Join(parts[:n-2], ":"), index.NewValueElement(byte(pathIdx), offset), nil
+}
+
+// resumeIndices returns the indices (in the order they are read) from the
+// index of the cursor of a request, and the position in that index to
+// resume after, which is nil without a cursor.
+func resumeIndices(indices []string, req *v1.QueryReq) ([]string, *index.ValueElement, error) {
+	if req.Cursor == "" {
+		return indices, nil, nil
+	}
+	// The flows of the earlier pages would be summarized again.
+	if req.FlowSummary != v1.FlowSummary_off {
+		return nil, nil, fmt.Errorf("a cursor is not supported with a flow summary")
+	}
+	indexName, after, err := parseCursor(req.Cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, name := range indices {
+		if name == indexName {
+			return indices[i:], after, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("the index %s of the cursor is not in the query time range", indexName)
+}
+
+// skipValues returns the values after the one at the position, which must
+// be one of them since the index is queried the same way as for the page
+// that ended there.
+func skipValues(values index.Value, after *index.ValueElement) (index.Value, error) {
+	for i, val := range values {
+		if val.PathIdx == after.PathIdx && val.Offset == after.Offset {
+			return values[i+1:], nil
+		}
+	}
+	return nil, fmt.Errorf("the packet of the cursor is not in the index, the query must be the same as for the previous page")
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// ReadEncryptionKey reads a hex encoded AES key from a file, e.g. one
+// written by `openssl rand -hex 32`.
+func ReadEncryptionKey(name string) ([]byte, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read encryption key file: %s", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		log.Warn().
+			Str("file", name).
+			Str("mode", info.Mode().Perm().String()).
+			Msg("encryption key file can be read by other users")
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read encryption key file: %s", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key file %s is not hex encoded: %s", name, err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key in %s is %d bytes, it must be 16, 24 or 32 bytes", name, len(key))
+}
+
+// OpenDB opens an index database with the encryption key of opts, if it
+// has one. Indices written without encryption (e.g. before a key was
+// configured) are still opened when a key is set.
+func OpenDB(opts badger.Options) (*badger.DB, error) {
+	key := opts.EncryptionKey
+	db, err := badger.Open(opts)
+	if err != badger.ErrEncryptionKeyMismatch {
+		return db, err
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%s (the index is encrypted, set --encryption-key-file)", err)
+	}
+	db, err = badger.Open(opts.WithEncryptionKey(nil))
+	if err == badger.ErrEncryptionKeyMismatch {
+		return nil, fmt.Errorf("%s (the index was encrypted with a different key)", err)
+	}
+	return db, err
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+// writeTestDB writes an index database with one key, encrypted with key
+// unless it is nil.
+func writeTestDB(t *testing.T, dbPath string, key []byte) {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions(dbPath).WithLogger(nil).WithEncryptionKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestDB returns the value of the key written by writeTestDB.
+func readTestDB(t *testing.T, db *badger.DB) []byte {
+	t.Helper()
+	var value []byte
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("key"))
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestOpenIndexEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercury-encryption")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := bytes.Repeat([]byte{1}, 32)
+	otherKey := bytes.Repeat([]byte{2}, 32)
+	encrypted := path.Join(dir, "encrypted.idx")
+	plain := path.Join(dir, "plain.idx")
+	writeTestDB(t, encrypted, key)
+	writeTestDB(t, plain, nil)
+
+	tests := []struct {
+		name   string
+		dbPath string
+		key    []byte
+		// errText is part of the error, empty if the index is opened.
+		errText string
+	}{
+		{"same key", encrypted, key, ""},
+		{"no key", encrypted, nil, "set --encryption-key-file"},
+		{"wrong key", encrypted, otherKey, "encrypted with a different key"},
+		{"not encrypted with a key", plain, key, ""},
+		{"not encrypted", plain, nil, ""},
+	}
+	for _, tt := range tests {
+		db, err := OpenIndex(tt.dbPath, Options{EncryptionKey: tt.key})
+		if tt.errText != "" {
+			if err == nil {
+				db.Close()
+				t.Errorf("%s: opened the index", tt.name)
+			} else if !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("%s: error %q does not contain %q", tt.name, err, tt.errText)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if value := readTestDB(t, db); string(value) != "value" {
+			t.Errorf("%s: read %q, want %q", tt.name, value, "value")
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,96 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+)
+
+func TestFindIndicesWindowStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercury-find")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The indices are named for the time of their first packet, so the
+	// packets at the start of a window are in the index named before it,
+	// which after midnight is in the partition of the day before.
+	for _, name := range []string{
+		"flat/2020_01_01-00_00_00.idx",
+		"flat/2020_01_01-00_01_00.idx",
+		"flat/2020_01_01-00_02_00.idx",
+		"flat/2020_01_01-02_00_00.idx",
+		"flat/2020_01_01-02_00_00.500000000.idx",
+		"daily/2020/01/01/2020_01_01-23_59_00.idx",
+		"daily/2020/01/02/2020_01_02-00_05_00.idx",
+	} {
+		err := os.MkdirAll(path.Join(dir, name), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		label    string
+		start    time.Time
+		duration time.Duration
+		want     []string
+	}{
+		{
+			label:    "flat",
+			start:    time.Date(2020, 1, 1, 0, 1, 30, 0, time.UTC),
+			duration: time.Minute,
+			// Of the indices named before the window only the last one
+			// can hold packets in it.
+			want: []string{"2020_01_01-00_01_00.idx", "2020_01_01-00_02_00.idx"},
+		},
+		{
+			label:    "flat",
+			start:    time.Date(2020, 1, 1, 1, 30, 0, 0, time.UTC),
+			duration: time.Minute,
+			want:     nil,
+		},
+		{
+			// A file started in the same second as the one before it has
+			// the nanoseconds in its name, which is the later index.
+			label:    "flat",
+			start:    time.Date(2020, 1, 1, 2, 0, 0, 600000000, time.UTC),
+			duration: time.Minute,
+			want:     []string{"2020_01_01-02_00_00.500000000.idx"},
+		},
+		{
+			label:    "daily",
+			start:    time.Date(2020, 1, 2, 0, 0, 30, 0, time.UTC),
+			duration: time.Minute,
+			want:     []string{"2020/01/01/2020_01_01-23_59_00.idx"},
+		},
+	}
+	for _, tt := range tests {
+		start, err := ptypes.TimestampProto(tt.start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := &v1.QueryReq{Label: tt.label, StartTime: start, Duration: ptypes.DurationProto(tt.duration)}
+		indexPath, indices, err := FindIndices(dir, req)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s at %s: found indices %v, want none", tt.label, tt.start, indices)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s at %s: %s", tt.label, tt.start, err)
+			continue
+		}
+		if indexPath != path.Join(dir, tt.label) || !reflect.DeepEqual(indices, tt.want) {
+			t.Errorf("%s at %s: found %v in %s, want %v", tt.label, tt.start, indices, indexPath, tt.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// parseFlow returns the index key of a flow query of the form
+// `<ip>:<port>,<ip>:<port>,<tcp|udp>` (e.g. `10.0.0.1:1234,10.0.0.2:80,tcp`,
+// with IPv6 addresses in brackets). The endpoints can be in either order.
+func parseFlow(query string) (*index.Key, error) {
+	parts := strings.Split(query, ",")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("flow %s is not of the form <ip>:<port>,<ip>:<port>,<tcp|udp>", query)
+	}
+	var ips [2]net.IP
+	var ports [2]uint16
+	for i, endpoint := range parts[:2] {
+		host, port, err := net.SplitHostPort(strings.TrimSpace(endpoint))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing flow %s: %s", query, err)
+		}
+		ips[i] = net.ParseIP(host)
+		if ips[i] == nil {
+			return nil, fmt.Errorf("error parsing flow %s: invalid ip %s", query, host)
+		}
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing flow %s: %s", query, err)
+		}
+		ports[i] = uint16(p)
+	}
+	var proto uint8
+	switch strings.ToLower(strings.TrimSpace(parts[2])) {
+	case "tcp", "6":
+		proto = 6
+	case "udp", "17":
+		proto = 17
+	default:
+		return nil, fmt.Errorf("flow %s protocol must be tcp or udp", query)
+	}
+	k := index.NewFlowKey(ips[0], ips[1], ports[0], ports[1], proto)
+	if k == nil {
+		return nil, fmt.Errorf("flow %s addresses are not the same IP version", query)
+	}
+	return k, nil
+}
+
+// flowKey identifies a flow by its 5-tuple. The endpoints are ordered so
+// both directions of a conversation are the same flow.
+type flowKey struct {
+	ipA, ipB     string
+	portA, portB uint16
+	proto        uint8
+}
+
+func newFlowKey(sIP, dIP net.IP, sPort, dPort uint16, proto uint8) flowKey {
+	a, b := sIP.To16(), dIP.To16()
+	if c := bytes.Compare(a, b); c > 0 || (c == 0 && sPort > dPort) {
+		a, b = b, a
+		sPort, dPort = dPort, sPort
+	}
+	return flowKey{ipA: string(a), ipB: string(b), portA: sPort, portB: dPort, proto: proto}
+}
+
+type flowPacket struct {
+	ts        time.Time
+	packetLen int64
+	packet    gopacket.Packet
+}
+
+// FlowFilter filters query matches down to the first and/or last packet
+// of each flow. Only one packet per flow is kept in memory (the latest one)
+// and only when the last packet is requested, but the key of every flow
+// seen is kept until the query completes.
+type FlowFilter struct {
+	first bool
+	last  bool
+	flows map[flowKey]*flowPacket
+}
+
+// NewFlowFilter returns nil if the query is not summarizing flows.
+func NewFlowFilter(mode v1.FlowSummary) *FlowFilter {
+	f := &FlowFilter{flows: make(map[flowKey]*flowPacket)}
+	switch mode {
+	case v1.FlowSummary_first:
+		f.first = true
+	case v1.FlowSummary_last:
+		f.last = true
+	case v1.FlowSummary_first_last:
+		f.first = true
+		f.last = true
+	default:
+		return nil
+	}
+	return f
+}
+
+// Filter wraps fn so it is only called for the first packet of each flow;
+// the last packets are sent by Flush.
+func (f *FlowFilter) Filter(fn PacketFunc) PacketFunc {
+	return func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+		_, _, _, sIP, dIP, sPort, dPort, proto, _ := common.ParsePacket(packet)
+		k := newFlowKey(sIP, dIP, sPort, dPort, proto)
+		fp, seen := f.flows[k]
+		if !seen {
+			fp = &flowPacket{}
+			f.flows[k] = fp
+			if f.first {
+				// A flow with a single packet is not sent again by Flush.
+				return fn(ts, packetLen, packet)
+			}
+		}
+		if f.last {
+			fp.ts, fp.packetLen, fp.packet = ts, packetLen, packet
+		}
+		return nil
+	}
+}
+
+// Flush calls fn with the last packet of each flow, in time order.
+func (f *FlowFilter) Flush(fn PacketFunc) error {
+	if !f.last {
+		return nil
+	}
+	packets := make([]*flowPacket, 0, len(f.flows))
+	for _, fp := range f.flows {
+		if fp.packet != nil {
+			packets = append(packets, fp)
+		}
+	}
+	sort.Slice(packets, func(i, j int) bool {
+		return packets[i].ts.Before(packets[j].ts)
+	})
+	for _, fp := range packets {
+		err := fn(fp.ts, fp.packetLen, fp.packet)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package search
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/google/gopacket"
+	"github.com/rs/zerolog/log"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// FollowIndices calls fn for each packet of a follow poll: the matching
+// packets after the since cursor in the indices, from the start time of
+// the request, with its display filter applied. since is empty to start
+// with the first index, otherwise it is a cursor from next, which is
+// called with the cursor of each packet right after fn has been called for
+// it, and with the name of each index once all of its packets have been
+// read, so the next poll resumes where this one stopped (even part way
+// through an index) without sending a packet again. An index that cannot
+// be opened yet ends the poll without an error, so it is read by the next
+// one. If maxBytes is greater than 0, the poll stops with ErrMaxBytes once
+// it has read more than that many packet bytes.
+func FollowIndices(open Opener, indexPath string, indices []string, pcapPaths []string, req *v1.QueryReq, opts Options, since string, maxBytes int64, fn PacketFunc, next func(cursor string) error) error {
+	start, _ := GetTimes(req.StartTime, req.Duration)
+	// called is set if the packet passed the display filter.
+	var called bool
+	queryFn, err := DisplayFilter(req.DisplayFilter, func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+		called = true
+		return fn(ts, packetLen, packet)
+	})
+	if err != nil {
+		return err
+	}
+	var read int64
+	return followIndices(open, indexPath, indices, since, next, func(db *badger.DB, indexName string, after *index.ValueElement, send func(*index.ValueElement, func() error) error) error {
+		return queryIndex(db, indexName, pcapPaths, req, opts, start, MaxTime, after, func(val *index.ValueElement, ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			return send(val, func() error {
+				read += packetLen
+				if maxBytes > 0 && read > maxBytes {
+					return ErrMaxBytes
+				}
+				called = false
+				err := queryFn(ts, packetLen, packet)
+				if err != nil || !called {
+					return err
+				}
+				return next(newCursor(indexName, val))
+			})
+		})
+	})
+}
+
+// FollowIndicesMeta is FollowIndices for metadata queries.
+func FollowIndicesMeta(open Opener, indexPath string, indices []string, pcapPaths []string, req *v1.QueryReq, opts Options, since string, maxBytes int64, fn MetaFunc, next func(cursor string) error) error {
+	start, _ := GetTimes(req.StartTime, req.Duration)
+	var read int64
+	return followIndices(open, indexPath, indices, since, next, func(db *badger.DB, indexName string, after *index.ValueElement, send func(*index.ValueElement, func() error) error) error {
+		return queryIndexMeta(db, indexName, pcapPaths, req, opts, start, MaxTime, after, func(val *index.ValueElement, meta *index.PacketMeta, iface string) error {
+			return send(val, func() error {
+				read += int64(meta.Length)
+				if maxBytes > 0 && read > maxBytes {
+					return ErrMaxBytes
+				}
+				err := fn(meta, iface)
+				if err != nil {
+					return err
+				}
+				return next(newCursor(indexName, val))
+			})
+		})
+	})
+}
+
+// followIndices reads the indices after the since cursor one at a time
+// with read, calling next with the name of each index once it has been
+// read.
+func followIndices(open Opener, indexPath string, indices []string, since string, next func(cursor string) error, read indexReader) error {
+	indices, after := followFrom(indices, since)
+	for i, indexName := range indices {
+		dbPath := path.Join(indexPath, indexName)
+		db, release, err := open(dbPath)
+		if err != nil {
+			log.Debug().Err(err).Str("db", dbPath).Msg("index not ready, stopping follow poll")
+			return nil
+		}
+		if i > 0 {
+			after = nil
+		}
+		err = read(db, indexName, after, func(_ *index.ValueElement, call func() error) error {
+			return call()
+		})
+		release()
+		if err == ErrMaxBytes {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("error querying index %s: %s", dbPath, err)
+		}
+		err = next(indexName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// followFrom returns the indices of a follow poll after the since cursor,
+// and the position to resume after in the first one, which is nil if it
+// has not been read yet.
+func followFrom(indices []string, since string) ([]string, *index.ValueElement) {
+	if since == "" {
+		return indices, nil
+	}
+	indexName, after, err := parseCursor(since)
+	if err != nil {
+		// The cursor of a whole index is only its name.
+		indexName, after = since, nil
+	}
+	for i, name := range indices {
+		if after != nil && name == indexName {
+			return indices[i:], after
+		}
+		if indexBefore(indexName, name) {
+			return indices[i:], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,113 @@
+package search
+
+import (
+	"net"
+	"sort"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// DefaultStatsTop is the number of peers and ports in a host summary when
+// the request does not set one.
+const DefaultStatsTop = 10
+
+// HostStats summarizes the packets of a host: its peers, protocols and
+// (lower, usually service) ports.
+type HostStats struct {
+	ip        net.IP
+	packets   uint64
+	bytes     uint64
+	peers     map[string]*v1.PeerCount
+	protocols map[uint8]uint64
+	ports     map[uint16]uint64
+}
+
+func NewHostStats(ip net.IP) *HostStats {
+	return &HostStats{
+		ip:        ip,
+		peers:     make(map[string]*v1.PeerCount),
+		protocols: make(map[uint8]uint64),
+		ports:     make(map[uint16]uint64),
+	}
+}
+
+// Add counts a packet of the host.
+func (h *HostStats) Add(meta *index.PacketMeta) {
+	h.packets++
+	h.bytes += uint64(meta.Length)
+
+	peer := meta.SrcIP
+	if meta.SrcIP.Equal(h.ip) {
+		peer = meta.DstIP
+	}
+	if peer != nil {
+		p, ok := h.peers[peer.String()]
+		if !ok {
+			p = &v1.PeerCount{Ip: peer.String()}
+			h.peers[p.Ip] = p
+		}
+		p.Packets++
+		p.Bytes += uint64(meta.Length)
+	}
+
+	if meta.Proto != 0 {
+		h.protocols[meta.Proto]++
+	}
+
+	if meta.SrcPort != 0 || meta.DstPort != 0 {
+		port := meta.SrcPort
+		if meta.DstPort < port {
+			port = meta.DstPort
+		}
+		h.ports[port]++
+	}
+}
+
+// Resp returns the summary with the top peers and ports by packet count
+// and all of the protocols.
+func (h *HostStats) Resp(top int) *v1.StatsResp {
+	if top <= 0 {
+		top = DefaultStatsTop
+	}
+	resp := &v1.StatsResp{
+		Ip:      h.ip.String(),
+		Packets: h.packets,
+		Bytes:   h.bytes,
+	}
+
+	for _, p := range h.peers {
+		resp.Peers = append(resp.Peers, p)
+	}
+	sort.Slice(resp.Peers, func(i, j int) bool {
+		if resp.Peers[i].Packets != resp.Peers[j].Packets {
+			return resp.Peers[i].Packets > resp.Peers[j].Packets
+		}
+		return resp.Peers[i].Ip < resp.Peers[j].Ip
+	})
+	if len(resp.Peers) > top {
+		resp.Peers = resp.Peers[:top]
+	}
+
+	for _, p := range SortProtocolCounts(h.protocols) {
+		resp.Protocols = append(resp.Protocols, &v1.ProtocolCount{
+			Number:  uint32(p.Number),
+			Name:    p.Name,
+			Packets: p.Packets,
+		})
+	}
+
+	for port, packets := range h.ports {
+		resp.Ports = append(resp.Ports, &v1.PortCount{Port: uint32(port), Packets: packets})
+	}
+	sort.Slice(resp.Ports, func(i, j int) bool {
+		if resp.Ports[i].Packets != resp.Ports[j].Packets {
+			return resp.Ports[i].Packets > resp.Ports[j].Packets
+		}
+		return resp.Ports[i].Port < resp.Ports[j].Port
+	})
+	if len(resp.Ports) > top {
+		resp.Ports = resp.Ports[:top]
+	}
+	return resp
+}
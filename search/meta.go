@@ -0,0 +1,235 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/google/gopacket"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// MetaFunc is called with the summary of each packet that matches a
+// metadata query and the capture interface, if it was requested and is
+// known.
+type MetaFunc func(meta *index.PacketMeta, iface string) error
+
+// MetadataOnly returns true if the responses to a query only need the
+// packet summary (not the text, data, display filter or flow summary), so
+// it can be answered with QueryIndicesMeta.
+func MetadataOnly(req *v1.QueryReq) bool {
+	return !req.BinaryOutput &&
+		!req.ShowAll &&
+		!req.IncludeData &&
+		req.DisplayFilter == "" &&
+		req.FlowSummary == v1.FlowSummary_off
+}
+
+// QueryIndicesMeta calls fn with the summary of each matching packet in the
+// indices. Indices captured with packet metadata are answered without
+// reading the pcap files; the packets of other indices are read and
+// summarized. If maxBytes is greater than 0, the query stops with
+// ErrMaxBytes once the matching packets are longer than that in total.
+// Limited, reversed and resumed requests are read like in QueryIndices,
+// which returns the same cursor, and so are concurrent ones.
+func QueryIndicesMeta(open Opener, indexPath string, indices []string, pcapPaths []string, req *v1.QueryReq, opts Options, maxBytes int64, concurrency int, fn MetaFunc) (string, error) {
+	start, end := GetTimes(req.StartTime, req.Duration)
+	indices, err := orderIndices(indices, req)
+	if err != nil {
+		return "", err
+	}
+	indices, after, err := resumeIndices(indices, req)
+	if err != nil {
+		return "", err
+	}
+	fn = limitMeta(req.Limit, fn)
+	queryFn := fn
+	var exceeded bool
+	if maxBytes > 0 {
+		var read int64
+		queryFn = func(meta *index.PacketMeta, iface string) error {
+			read += int64(meta.Length)
+			if read > maxBytes {
+				exceeded = true
+				return ErrMaxBytes
+			}
+			return fn(meta, iface)
+		}
+	}
+
+	concurrency = queryConcurrency(req, maxBytes, concurrency)
+	indexName, last, err := scanIndices(open, indexPath, indices, after, concurrency, func(db *badger.DB, indexName string, after *index.ValueElement, send func(*index.ValueElement, func() error) error) error {
+		return queryIndexMeta(db, indexName, pcapPaths, req, opts, start, end, after, func(val *index.ValueElement, meta *index.PacketMeta, iface string) error {
+			return send(val, func() error {
+				return queryFn(meta, iface)
+			})
+		})
+	})
+	if exceeded {
+		return "", ErrMaxBytes
+	}
+	if err == errLimit {
+		return newCursor(indexName, last), nil
+	}
+	return "", err
+}
+
+// limitMeta is limitPackets for metadata queries.
+func limitMeta(limit uint32, fn MetaFunc) MetaFunc {
+	if limit == 0 {
+		return fn
+	}
+	var sent uint32
+	return func(meta *index.PacketMeta, iface string) error {
+		if sent >= limit {
+			return errLimit
+		}
+		sent++
+		err := fn(meta, iface)
+		if err == nil && sent >= limit {
+			return errLimit
+		}
+		return err
+	}
+}
+
+// QueryIndexMeta looks up the requested key in an index and passes the
+// summary of each packet with a timestamp in [start, end) to fn, from the
+// index if it stores packet metadata and from the pcap files otherwise, or
+// if the metadata lacks the VLAN IDs of tagged packets.
+func QueryIndexMeta(db *badger.DB, indexName string, pcapPaths []string, req *v1.QueryReq, opts Options, start, end time.Time, fn MetaFunc) error {
+	return queryIndexMeta(db, indexName, pcapPaths, req, opts, start, end, nil, func(_ *index.ValueElement, meta *index.PacketMeta, iface string) error {
+		return fn(meta, iface)
+	})
+}
+
+// queryIndexMeta is QueryIndexMeta with the value of each packet passed to
+// fn, starting after the value at the position after if it is not nil.
+func queryIndexMeta(db *badger.DB, indexName string, pcapPaths []string, req *v1.QueryReq, opts Options, start, end time.Time, after *index.ValueElement, fn func(val *index.ValueElement, meta *index.PacketMeta, iface string) error) error {
+	return db.View(func(txn *badger.Txn) error {
+		err := CheckPcapPathCount(txn, pcapPaths)
+		if err != nil {
+			return err
+		}
+		err = CheckPathIdx(req.PcapPathIdx, pcapPaths)
+		if err != nil {
+			return err
+		}
+		values, err := lookupValues(txn, req)
+		if err != nil {
+			return err
+		}
+		if after != nil {
+			values, err = skipValues(values, after)
+			if err != nil {
+				return err
+			}
+		}
+		interfaceName := func(*index.ValueElement) string { return "" }
+		if req.ShowInterface {
+			interfaceName, err = lookupInterfaceNames(txn, values)
+			if err != nil {
+				return err
+			}
+		}
+
+		fromPcap := len(values) > 0 && values[0].Meta == nil
+		if len(values) > 0 && !fromPcap {
+			fromPcap, err = LacksVLANMeta(txn)
+			if err != nil {
+				return err
+			}
+		}
+		if fromPcap {
+			linkType, err := GetLinkType(txn)
+			if err != nil {
+				return err
+			}
+			compression, err := GetCompression(txn)
+			if err != nil {
+				return err
+			}
+			return readPackets(strings.Replace(indexName, "."+common.IndexNameSuffix, "", 1), values, pcapPaths, linkType, compression, opts, start, end, func(val *index.ValueElement, ts time.Time, packetLen int64, packet gopacket.Packet) error {
+				return fn(val, NewPacketMeta(ts, packetLen, packet), interfaceName(val))
+			})
+		}
+		for _, val := range values {
+			if val.Meta.Timestamp.Before(start) || !val.Meta.Timestamp.Before(end) {
+				continue
+			}
+			err = fn(val, val.Meta, interfaceName(val))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LacksVLANMeta returns true if an index has VLAN keys but its packet
+// metadata was written before it stored the VLAN IDs, so the packets have to
+// be read to show them.
+func LacksVLANMeta(txn *badger.Txn) (bool, error) {
+	format, err := GetFormat(txn)
+	if err != nil || format.PacketMetaVLANs() {
+		return false, err
+	}
+	prefix := []byte{byte(index.VLANType)}
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	it.Seek(prefix)
+	return it.ValidForPrefix(prefix), nil
+}
+
+// NewPacketMeta summarizes a packet. Packets without a TCP, UDP or ICMP
+// layer have the protocol number from the IP header.
+func NewPacketMeta(ts time.Time, packetLen int64, packet gopacket.Packet) *index.PacketMeta {
+	_, srcMAC, dstMAC, srcIP, dstIP, srcPort, dstPort, proto, _ := common.ParsePacket(packet)
+	if proto == 0 {
+		proto = common.IPProtocol(packet)
+	}
+	return &index.PacketMeta{
+		Timestamp: ts,
+		Length:    uint32(packetLen),
+		Proto:     proto,
+		SrcPort:   srcPort,
+		DstPort:   dstPort,
+		SrcIP:     srcIP,
+		DstIP:     dstIP,
+		SrcMAC:    srcMAC,
+		DstMAC:    dstMAC,
+		Truncated: Truncated(packet),
+		VLANs:     common.VLANIDs(packet),
+	}
+}
+
+// NewMetaResp creates the summary response for a packet, the same as
+// NewResp without the text and data.
+func NewMetaResp(ts *timestamp.Timestamp, meta *index.PacketMeta, iface string) *v1.QueryResp {
+	return &v1.QueryResp{
+		Timestamp:  ts,
+		Length:     int64(meta.Length),
+		SrcMAC:     meta.SrcMAC.String(),
+		DstMAC:     meta.DstMAC.String(),
+		SrcIP:      meta.SrcIP.String(),
+		DstIP:      meta.DstIP.String(),
+		SrcPort:    uint32(meta.SrcPort),
+		SrcPortStr: strconv.FormatUint(uint64(meta.SrcPort), 10),
+		DstPort:    uint32(meta.DstPort),
+		DstPortStr: strconv.FormatUint(uint64(meta.DstPort), 10),
+		Proto:      common.ProtoString(meta.Proto),
+		Ipv6:       meta.IPVersion() == 6,
+		Interface:  iface,
+		Truncated:  meta.Truncated,
+		Vlan:       vlans(meta.VLANs),
+	}
+}
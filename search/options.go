@@ -0,0 +1,20 @@
+package search
+
+import "time"
+
+// Options are how a query opens the index databases and pcap files it
+// reads.
+type Options struct {
+	// EncryptionKey is the AES key (16, 24 or 32 bytes, for AES-128, 192
+	// or 256) that index databases are read with, nil for no encryption.
+	EncryptionKey []byte
+	// OpenRetries is the number of times to retry a failed open of an
+	// index database or pcap file, waiting OpenRetryBackoff before the
+	// first retry and doubling it after each one.
+	OpenRetries      int
+	OpenRetryBackoff time.Duration
+	// Strict fails a query if an index references a pcap file that does
+	// not exist, e.g. because it was deleted by a retention job while the
+	// query was running, instead of skipping its packets with a warning.
+	Strict bool
+}
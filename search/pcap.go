@@ -0,0 +1,73 @@
+package search
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"code.ornl.gov/situ/mercury/common"
+)
+
+// PcapWriter writes the packets of a query as pcap, with the link type of
+// the first packet in the file header. A pcap file only has one link
+// type, so a packet of another link type (from an index captured on
+// another kind of interface) is an error; use PcapngWriter for those.
+type PcapWriter struct {
+	w        io.Writer
+	pw       *pcapgo.Writer
+	linkType layers.LinkType
+	// AfterHeader is called, if it is set, once the file header has been
+	// written to w, e.g. to send the header on its own.
+	AfterHeader func(w io.Writer) error
+}
+
+// NewPcapWriter returns a writer that writes pcap to w. The header is
+// written with the first packet, or by Flush if there are none.
+func NewPcapWriter(w io.Writer) *PcapWriter {
+	return &PcapWriter{w: w}
+}
+
+// writeHeader writes the file header with a link type.
+func (w *PcapWriter) writeHeader(linkType layers.LinkType) error {
+	pw := pcapgo.NewWriter(w.w)
+	err := pw.WriteFileHeader(uint32(common.SnapLen), linkType)
+	if err != nil {
+		return fmt.Errorf("error writing pcap file header: %s", err)
+	}
+	w.pw = pw
+	w.linkType = linkType
+	if w.AfterHeader == nil {
+		return nil
+	}
+	return w.AfterHeader(w.w)
+}
+
+// WritePacket writes a packet, after the file header if it is the first.
+func (w *PcapWriter) WritePacket(packet gopacket.Packet) error {
+	linkType := PacketInterface(packet).LinkType
+	if w.pw == nil {
+		if err := w.writeHeader(linkType); err != nil {
+			return err
+		}
+	}
+	if linkType != w.linkType {
+		return fmt.Errorf("packets have different link types (%s and %s), which pcap does not support, use pcapng instead", w.linkType, linkType)
+	}
+	err := w.pw.WritePacket(packet.Metadata().CaptureInfo, packet.Data())
+	if err != nil {
+		return fmt.Errorf("error writing pcap packet: %s", err)
+	}
+	return nil
+}
+
+// Flush writes the header with the Ethernet link type if no packets have
+// been written. Packets are not buffered.
+func (w *PcapWriter) Flush() error {
+	if w.pw != nil {
+		return nil
+	}
+	return w.writeHeader(layers.LinkTypeEthernet)
+}
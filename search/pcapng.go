@@ -0,0 +1,100 @@
+package search
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"code.ornl.gov/situ/mercury/common"
+)
+
+// PcapngWriter writes the packets of a query as pcapng, with an interface
+// description for each capture interface and link type (see Interface),
+// so packets from indices of different link types can be written to the
+// same file.
+type PcapngWriter struct {
+	w   io.Writer
+	ng  *pcapgo.NgWriter
+	ids map[Interface]int
+	// AfterHeader is called, if it is set, once the section header and
+	// first interface description have been written to w, e.g. to add a
+	// Decryption Secrets Block or to send the header on its own.
+	AfterHeader func(w io.Writer) error
+}
+
+// NewPcapngWriter returns a writer that writes pcapng to w. The header is
+// written with the first packet, or by Flush if there are none.
+func NewPcapngWriter(w io.Writer) *PcapngWriter {
+	return &PcapngWriter{w: w, ids: make(map[Interface]int)}
+}
+
+func ngInterface(iface Interface) pcapgo.NgInterface {
+	intf := pcapgo.DefaultNgInterface
+	intf.Name = iface.Name
+	intf.LinkType = iface.LinkType
+	intf.SnapLength = uint32(common.SnapLen)
+	return intf
+}
+
+// writeHeader writes the section header with the first interface.
+func (w *PcapngWriter) writeHeader(iface Interface) error {
+	opts := pcapgo.DefaultNgWriterOptions
+	opts.SectionInfo.Application = "mercury"
+	ng, err := pcapgo.NewNgWriterInterface(w.w, ngInterface(iface), opts)
+	if err != nil {
+		return fmt.Errorf("error writing pcapng header: %s", err)
+	}
+	w.ng = ng
+	w.ids[iface] = 0
+	if w.AfterHeader == nil {
+		return nil
+	}
+	// The header is buffered and must come first.
+	err = ng.Flush()
+	if err != nil {
+		return fmt.Errorf("error writing pcapng header: %s", err)
+	}
+	return w.AfterHeader(w.w)
+}
+
+// WritePacket writes a packet with the interface ID of its capture
+// interface, after the interface description if it is the first packet
+// of the interface. The writer is buffered so it must be flushed.
+func (w *PcapngWriter) WritePacket(packet gopacket.Packet) error {
+	iface := PacketInterface(packet)
+	if w.ng == nil {
+		if err := w.writeHeader(iface); err != nil {
+			return err
+		}
+	}
+	id, ok := w.ids[iface]
+	if !ok {
+		var err error
+		id, err = w.ng.AddInterface(ngInterface(iface))
+		if err != nil {
+			return fmt.Errorf("error writing pcapng interface: %s", err)
+		}
+		w.ids[iface] = id
+	}
+	ci := packet.Metadata().CaptureInfo
+	ci.InterfaceIndex = id
+	err := w.ng.WritePacket(ci, packet.Data())
+	if err != nil {
+		return fmt.Errorf("error writing pcapng packet: %s", err)
+	}
+	return nil
+}
+
+// Flush writes the buffered packets, and the header with an Ethernet
+// interface if no packets have been written.
+func (w *PcapngWriter) Flush() error {
+	if w.ng == nil {
+		if err := w.writeHeader(Interface{LinkType: layers.LinkTypeEthernet}); err != nil {
+			return err
+		}
+	}
+	return w.ng.Flush()
+}
@@ -0,0 +1,80 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/google/gopacket/layers"
+
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// ProtocolCount is the number of packets of an IP protocol.
+type ProtocolCount struct {
+	Number  uint8  `json:"number"`
+	Name    string `json:"name"`
+	Packets uint64 `json:"packets"`
+}
+
+// ProtocolName returns the name of an IP protocol number.
+func ProtocolName(proto uint8) string {
+	return layers.IPProtocol(proto).String()
+}
+
+// AddProtocolCounts adds the number of packets of each protocol in an
+// index to counts. Only the protocol keys and the length of their values
+// are read, not the packets.
+func AddProtocolCounts(db *badger.DB, counts map[uint8]uint64) error {
+	return db.View(func(txn *badger.Txn) error {
+		format, err := GetFormat(txn)
+		if err != nil {
+			return err
+		}
+		prefix := []byte{byte(index.ProtoType)}
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			var k index.Key
+			err := k.UnmarshalBinary(item.Key())
+			if err != nil {
+				return fmt.Errorf("error decoding key: %s", err)
+			}
+			if len(k.Data) != 1 {
+				continue
+			}
+			err = item.Value(func(val []byte) error {
+				n, err := format.Count(val)
+				if err != nil {
+					return err
+				}
+				counts[k.Data[0]] += uint64(n)
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("error getting value: %s", err)
+			}
+		}
+		return nil
+	})
+}
+
+// SortProtocolCounts returns the counts with the most packets first.
+func SortProtocolCounts(counts map[uint8]uint64) []ProtocolCount {
+	protocols := make([]ProtocolCount, 0, len(counts))
+	for n, packets := range counts {
+		protocols = append(protocols, ProtocolCount{Number: n, Name: ProtocolName(n), Packets: packets})
+	}
+	sort.Slice(protocols, func(i, j int) bool {
+		if protocols[i].Packets != protocols[j].Packets {
+			return protocols[i].Packets > protocols[j].Packets
+		}
+		return protocols[i].Number < protocols[j].Number
+	})
+	return protocols
+}
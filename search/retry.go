@@ -0,0 +1,34 @@
+package search
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// withRetry calls open until it succeeds or the retries of opts are
+// exhausted, returning the last error, so transient errors on network
+// filesystems (e.g. NFS) do not fail a query. Files that do not exist are
+// not retried.
+func withRetry(name string, opts Options, open func() error) error {
+	retries, backoff := opts.OpenRetries, opts.OpenRetryBackoff
+	err := open()
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		if errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		log.Warn().
+			Err(err).
+			Str("path", name).
+			Int("attempt", attempt).
+			Int("retries", retries).
+			Dur("backoff", backoff).
+			Msg("open failed, retrying")
+		time.Sleep(backoff)
+		backoff *= 2
+		err = open()
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/dgraph-io/badger/v2"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// DefaultConcurrency is the number of indices a query reads at the same
+// time by default.
+const DefaultConcurrency = 4
+
+// scanBuffer is the number of packets of each index that are read ahead of
+// the ones being sent, which bounds the memory of a query to about
+// concurrency * scanBuffer packets.
+const scanBuffer = 1024
+
+// errStopped stops the indices that are read ahead once a query stops.
+var errStopped = errors.New("query stopped")
+
+// indexReader reads the matching packets of an index, starting after the
+// value at the position after if it is not nil, and calls send for each
+// one with its value and a function that passes it on to the query.
+type indexReader func(db *badger.DB, indexName string, after *index.ValueElement, send func(val *index.ValueElement, call func() error) error) error
+
+// scanItem is a packet that was read from an index.
+type scanItem struct {
+	val  *index.ValueElement
+	call func() error
+}
+
+// indexScan is an index that is being read, starting after the value at
+// the position after if it is not nil. opened and err are set before items
+// is closed.
+type indexScan struct {
+	name   string
+	after  *index.ValueElement
+	items  chan scanItem
+	opened bool
+	err    error
+}
+
+// queryConcurrency returns the number of indices a query reads at the same
+// time. A query with a packet or byte limit reads them one at a time, so
+// it stops as soon as it reaches the limit, without reading ahead.
+func queryConcurrency(req *v1.QueryReq, maxBytes int64, concurrency int) int {
+	if req.Limit > 0 || maxBytes > 0 {
+		return 1
+	}
+	return concurrency
+}
+
+// scanIndices reads the indices with read, up to concurrency at a time,
+// and calls the functions it sends in the order of the indices, so the
+// results are the same as reading the indices one at a time (and stay in
+// time order). Each index that is read holds an open database and one pcap
+// file, so concurrency also bounds the files a query has open. after is
+// passed to read for the first index.
+//
+// It stops at the first error; if a function returns errLimit it returns
+// the name of its index and the value of its packet for the cursor.
+func scanIndices(open Opener, indexPath string, indices []string, after *index.ValueElement, concurrency int, read indexReader) (string, *index.ValueElement, error) {
+	if concurrency <= 1 {
+		return readIndices(open, indexPath, indices, after, read)
+	}
+	// The indices are sent to the workers in order, so the index that is
+	// being sent is always being read and the ones read ahead of it
+	// cannot block it. Only the indices that are read ahead are buffered.
+	done := make(chan struct{})
+	ordered := make(chan *indexScan, concurrency)
+	next := make(chan *indexScan)
+	var wg sync.WaitGroup
+	defer func() {
+		// Wait for the indices that were read ahead to be released.
+		close(done)
+		wg.Wait()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(ordered)
+		defer close(next)
+		for i, indexName := range indices {
+			scan := &indexScan{name: indexName, items: make(chan scanItem, scanBuffer)}
+			if i == 0 {
+				scan.after = after
+			}
+			for _, ch := range []chan *indexScan{ordered, next} {
+				select {
+				case ch <- scan:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	for w := 0; w < concurrency && w < len(indices); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for scan := range next {
+				readIndex(open, indexPath, read, scan, done)
+			}
+		}()
+	}
+
+	for scan := range ordered {
+		var last *index.ValueElement
+		for item := range scan.items {
+			last = item.val
+			err := item.call()
+			if err == errLimit {
+				return scan.name, last, err
+			}
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		if scan.err != nil {
+			if !scan.opened {
+				return "", nil, scan.err
+			}
+			return "", nil, fmt.Errorf("error querying index %s: %s", path.Join(indexPath, scan.name), scan.err)
+		}
+	}
+	return "", nil, nil
+}
+
+// readIndices is scanIndices for reading the indices one at a time, which
+// calls the functions as they are sent.
+func readIndices(open Opener, indexPath string, indices []string, after *index.ValueElement, read indexReader) (string, *index.ValueElement, error) {
+	for _, indexName := range indices {
+		db, release, err := open(path.Join(indexPath, indexName))
+		if err != nil {
+			return "", nil, err
+		}
+		var last *index.ValueElement
+		err = read(db, indexName, after, func(val *index.ValueElement, call func() error) error {
+			last = val
+			return call()
+		})
+		release()
+		after = nil
+		if err == errLimit {
+			return indexName, last, err
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("error querying index %s: %s", path.Join(indexPath, indexName), err)
+		}
+	}
+	return "", nil, nil
+}
+
+// readIndex opens an index and reads it into scan until the query stops.
+func readIndex(open Opener, indexPath string, read indexReader, scan *indexScan, done <-chan struct{}) {
+	defer close(scan.items)
+	db, release, err := open(path.Join(indexPath, scan.name))
+	if err != nil {
+		scan.err = err
+		return
+	}
+	defer release()
+	scan.opened = true
+	scan.err = read(db, scan.name, scan.after, func(val *index.ValueElement, call func() error) error {
+		select {
+		case scan.items <- scanItem{val: val, call: call}:
+			return nil
+		case <-done:
+			return errStopped
+		}
+	})
+}
@@ -0,0 +1,1222 @@
+package search
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/rs/zerolog/log"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/filter"
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// Special mac query arguments for classes of Ethernet addresses.
+const (
+	MACBroadcast = "broadcast"
+	MACMulticast = "multicast"
+
+	broadcastMAC = "ff:ff:ff:ff:ff:ff"
+)
+
+// maxPacketLen is the largest packet length that is read from a pcap file
+// (the libpcap maximum snap length).
+const maxPacketLen = 262144
+
+// MaxTime is used as the end of open ended (follow) queries.
+var MaxTime = time.Unix(1<<62, 0)
+
+// FindIndices returns the label index path and the names of the indices
+// within the time range of the request.
+func FindIndices(indexBasePath string, req *v1.QueryReq) (string, []string, error) {
+	label := req.Label
+	if label == "" {
+		label = common.DefaultLabel
+	}
+	indexPath := path.Join(indexBasePath, label)
+	startTime, endTime := GetTimes(req.StartTime, req.Duration)
+	err := CheckLabel(indexBasePath, label)
+	if err != nil {
+		return "", nil, err
+	}
+	indices, err := GetIndexPaths(indexPath, startTime, endTime)
+	if err != nil {
+		return "", nil, fmt.Errorf("error getting index paths: %s", err)
+	}
+	if len(indices) == 0 {
+		return "", nil, fmt.Errorf("no indices within the time range %s - %s", startTime.Format(common.GetFileTimeFormat()), endTime.Format(common.GetFileTimeFormat()))
+	}
+
+	log.Info().
+		Str("component", "search").
+		Str("label", label).
+		Time("start-time", startTime).
+		Time("end-time", endTime).
+		Str("index-path", indexPath).
+		Strs("indices", indices).
+		Str("query-type", req.QueryType.String()).
+		Str("query-arg", req.Query).
+		Msg("executing index query")
+
+	return indexPath, indices, nil
+}
+
+// Labels returns the labels in the index base path that have at least one
+// index.
+func Labels(indexBasePath string) ([]string, error) {
+	dirs, err := ioutil.ReadDir(indexBasePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read directory %s: %s", indexBasePath, err)
+	}
+	labels := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		indices, err := GetIndexPaths(path.Join(indexBasePath, dir.Name()), time.Time{}, MaxTime)
+		if err == nil && len(indices) > 0 {
+			labels = append(labels, dir.Name())
+		}
+	}
+	return labels, nil
+}
+
+// CheckLabel returns an error listing the available labels if label is
+// missing or has no indices, since a query with the wrong (or a forgotten)
+// --label would otherwise only report that there are no indices.
+func CheckLabel(indexBasePath, label string) error {
+	indices, err := GetIndexPaths(path.Join(indexBasePath, label), time.Time{}, MaxTime)
+	if err == nil && len(indices) > 0 {
+		return nil
+	}
+	labels, err := Labels(indexBasePath)
+	if err != nil {
+		return err
+	}
+	if len(labels) == 0 {
+		return fmt.Errorf("label %s has no indices and there are no labels with indices in %s", label, indexBasePath)
+	}
+	return fmt.Errorf("label %s has no indices, available labels: %s", label, strings.Join(labels, ", "))
+}
+
+// OpenIndex opens an index database read only.
+func OpenIndex(dbPath string, opts Options) (*badger.DB, error) {
+	log.Info().Str("db", dbPath).Msg("opening index database")
+	var db *badger.DB
+	err := withRetry(dbPath, opts, func() (err error) {
+		db, err = OpenDB(badger.DefaultOptions(dbPath).WithReadOnly(true).WithLogger(&common.BadgerLogger{Logger: log.Logger}).WithEncryptionKey(opts.EncryptionKey))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %s", err)
+	}
+	return db, nil
+}
+
+// Interface is added to the packet metadata AncillaryData with the link
+// type of the packets of an index and, when a query requests it (or
+// pcapng output, which describes each interface), the name of the capture
+// interface.
+type Interface struct {
+	Name     string
+	LinkType layers.LinkType
+}
+
+// PacketInterface returns the capture interface of a packet returned by a
+// query, an unnamed Ethernet interface if it is unknown.
+func PacketInterface(packet gopacket.Packet) Interface {
+	for _, a := range packet.Metadata().AncillaryData {
+		if iface, ok := a.(*Interface); ok {
+			return *iface
+		}
+	}
+	return Interface{LinkType: layers.LinkTypeEthernet}
+}
+
+// InterfaceName returns the capture interface of a packet returned by a
+// query, or an empty string if it is unknown or was not requested.
+func InterfaceName(packet gopacket.Packet) string {
+	return PacketInterface(packet).Name
+}
+
+// packetPos is the location of a packet, its pcap-path and offset.
+type packetPos struct {
+	pathIdx byte
+	offset  uint64
+}
+
+// lookupInterfaceNames returns a function that returns the name of the
+// capture interface of each of the values (see index.MetaInterface). If
+// the index was captured from several interfaces, it is looked up in their
+// interface keys.
+func lookupInterfaceNames(txn *badger.Txn, values index.Value) (func(val *index.ValueElement) string, error) {
+	b, err := GetMeta(txn, index.MetaInterface)
+	if err != nil {
+		return nil, err
+	}
+	name := string(b)
+	names := strings.Split(name, ",")
+	if len(names) < 2 {
+		return func(*index.ValueElement) string { return name }, nil
+	}
+	format, err := GetFormat(txn)
+	if err != nil {
+		return nil, err
+	}
+	byPos := make(map[packetPos]string, len(values))
+	for _, val := range values {
+		byPos[packetPos{val.PathIdx, val.Offset}] = ""
+	}
+	for _, n := range names {
+		ifaceValues, err := lookupTerm(txn, &v1.QueryTerm{QueryType: v1.QueryType_interface, Query: n}, false, format)
+		if err != nil {
+			return nil, err
+		}
+		for _, val := range ifaceValues {
+			pos := packetPos{val.PathIdx, val.Offset}
+			if _, ok := byPos[pos]; ok {
+				byPos[pos] = n
+			}
+		}
+	}
+	return func(val *index.ValueElement) string {
+		return byPos[packetPos{val.PathIdx, val.Offset}]
+	}, nil
+}
+
+// PacketFunc is called for each packet that matches a query.
+type PacketFunc func(ts time.Time, packetLen int64, packet gopacket.Packet) error
+
+// Opener returns an open index database and a function to call when the
+// caller is done with it.
+type Opener func(dbPath string) (*badger.DB, func(), error)
+
+// Open is an Opener that opens the database for each query with the
+// options and closes it when it is released.
+func (o Options) Open(dbPath string) (*badger.DB, func(), error) {
+	db, err := OpenIndex(dbPath, o)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, func() { db.Close() }, nil
+}
+
+// ErrMaxBytes is returned by QueryIndices when a query reads more packet
+// bytes than its limit.
+var ErrMaxBytes = errors.New("query read too many packet bytes")
+
+// errLimit stops a query once it has sent the number of packets it is
+// limited to.
+var errLimit = errors.New("query limit reached")
+
+// limitPackets wraps fn so the query stops with errLimit once fn has been
+// called limit times (0 for no limit).
+func limitPackets(limit uint32, fn PacketFunc) PacketFunc {
+	if limit == 0 {
+		return fn
+	}
+	var sent uint32
+	return func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+		if sent >= limit {
+			return errLimit
+		}
+		sent++
+		err := fn(ts, packetLen, packet)
+		if err == nil && sent >= limit {
+			return errLimit
+		}
+		return err
+	}
+}
+
+// orderIndices returns the indices in the order a query reads them, the
+// newest first if it is reversed.
+func orderIndices(indices []string, req *v1.QueryReq) ([]string, error) {
+	if !req.Reverse {
+		return indices, nil
+	}
+	// The first and last packets of each flow would be swapped.
+	if req.FlowSummary != v1.FlowSummary_off {
+		return nil, fmt.Errorf("reverse is not supported with a flow summary")
+	}
+	reversed := make([]string, len(indices))
+	for i, indexName := range indices {
+		reversed[len(indices)-1-i] = indexName
+	}
+	return reversed, nil
+}
+
+// DisplayFilter wraps fn so it is only called for packets that match the
+// display filter expression, or returns fn if expr is empty.
+func DisplayFilter(expr string, fn PacketFunc) (PacketFunc, error) {
+	if expr == "" {
+		return fn, nil
+	}
+	f, err := filter.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+		if !f.Match(packet) {
+			return nil
+		}
+		return fn(ts, packetLen, packet)
+	}, nil
+}
+
+// QueryIndices calls fn for each matching packet in the indices, applying
+// the display filter and flow summary of the request. If maxBytes is greater than 0, the
+// query stops with ErrMaxBytes once it has read more than that many
+// packet bytes (including packets dropped by the display filter or flow
+// summary). A reversed request reads the newest indices first, and a
+// limited one stops without opening more indices once fn has been called
+// for its limit of packets. It then returns the cursor of the last packet,
+// which a request can pass to resume after it; the cursor is empty if the
+// query read all of its packets (or has a flow summary). Up to concurrency
+// indices are read at the same time, ahead of the one fn is called for, and
+// fn is called for the packets in the same order as reading them one at a
+// time; a query with a limit or maxBytes reads them one at a time.
+func QueryIndices(open Opener, indexPath string, indices []string, pcapPaths []string, req *v1.QueryReq, opts Options, maxBytes int64, concurrency int, fn PacketFunc) (string, error) {
+	start, end := GetTimes(req.StartTime, req.Duration)
+	indices, err := orderIndices(indices, req)
+	if err != nil {
+		return "", err
+	}
+	indices, after, err := resumeIndices(indices, req)
+	if err != nil {
+		return "", err
+	}
+	fn = limitPackets(req.Limit, fn)
+	flows := NewFlowFilter(req.FlowSummary)
+	queryFn := fn
+	if flows != nil {
+		queryFn = flows.Filter(fn)
+	}
+	queryFn, err = DisplayFilter(req.DisplayFilter, queryFn)
+	if err != nil {
+		return "", err
+	}
+	var exceeded bool
+	if maxBytes > 0 {
+		var read int64
+		limitFn := queryFn
+		queryFn = func(ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			read += packetLen
+			if read > maxBytes {
+				exceeded = true
+				return ErrMaxBytes
+			}
+			return limitFn(ts, packetLen, packet)
+		}
+	}
+
+	// The indices are read concurrently, but the packets are passed to
+	// queryFn (and the flow summary, display filter and limits) in order.
+	concurrency = queryConcurrency(req, maxBytes, concurrency)
+	indexName, last, err := scanIndices(open, indexPath, indices, after, concurrency, func(db *badger.DB, indexName string, after *index.ValueElement, send func(*index.ValueElement, func() error) error) error {
+		return queryIndex(db, indexName, pcapPaths, req, opts, start, end, after, func(val *index.ValueElement, ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			return send(val, func() error {
+				return queryFn(ts, packetLen, packet)
+			})
+		})
+	})
+	if exceeded {
+		return "", ErrMaxBytes
+	}
+	// No more indices are opened once the limit is reached.
+	if err == errLimit {
+		if flows != nil {
+			return "", nil
+		}
+		return newCursor(indexName, last), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if flows != nil {
+		err = flows.Flush(fn)
+		if err == errLimit {
+			return "", nil
+		}
+		return "", err
+	}
+	return "", nil
+}
+
+// QueryIndex looks up the requested key in an index and reads each of the
+// packets it references from the pcap files, passing the ones with a
+// timestamp in [start, end) to fn. Indices are selected per file, so this
+// is what limits results to the exact query window.
+func QueryIndex(db *badger.DB, indexName string, pcapPaths []string, req *v1.QueryReq, opts Options, start, end time.Time, fn PacketFunc) error {
+	return queryIndex(db, indexName, pcapPaths, req, opts, start, end, nil, func(_ *index.ValueElement, ts time.Time, packetLen int64, packet gopacket.Packet) error {
+		return fn(ts, packetLen, packet)
+	})
+}
+
+// valueFunc is a PacketFunc that is also passed the index value of the
+// packet.
+type valueFunc func(val *index.ValueElement, ts time.Time, packetLen int64, packet gopacket.Packet) error
+
+// queryIndex is QueryIndex with the value of each packet passed to fn,
+// starting after the value at the position after if it is not nil.
+func queryIndex(db *badger.DB, indexName string, pcapPaths []string, req *v1.QueryReq, opts Options, start, end time.Time, after *index.ValueElement, fn valueFunc) error {
+	return db.View(func(txn *badger.Txn) error {
+		err := CheckPcapPathCount(txn, pcapPaths)
+		if err != nil {
+			return err
+		}
+		err = CheckPathIdx(req.PcapPathIdx, pcapPaths)
+		if err != nil {
+			return err
+		}
+		values, err := lookupValues(txn, req)
+		if err != nil {
+			return err
+		}
+		if after != nil {
+			values, err = skipValues(values, after)
+			if err != nil {
+				return err
+			}
+		}
+		linkType, err := GetLinkType(txn)
+		if err != nil {
+			return err
+		}
+		compression, err := GetCompression(txn)
+		if err != nil {
+			return err
+		}
+		interfaceName := func(*index.ValueElement) string { return "" }
+		if req.ShowInterface || (req.BinaryOutput && req.BinaryFormat == v1.BinaryFormat_pcapng) {
+			interfaceName, err = lookupInterfaceNames(txn, values)
+			if err != nil {
+				return err
+			}
+		}
+		ifaces := make(map[string]*Interface)
+		return readPackets(strings.Replace(indexName, "."+common.IndexNameSuffix, "", 1), values, pcapPaths, linkType, compression, opts, start, end, func(val *index.ValueElement, ts time.Time, packetLen int64, packet gopacket.Packet) error {
+			name := interfaceName(val)
+			iface, ok := ifaces[name]
+			if !ok {
+				iface = &Interface{Name: name, LinkType: linkType}
+				ifaces[name] = iface
+			}
+			packet.Metadata().AncillaryData = append(packet.Metadata().AncillaryData, iface)
+			return fn(val, ts, packetLen, packet)
+		})
+	})
+}
+
+// ReadPackets reads the packets of the values from the pcap files of an
+// index (name is the index name without the suffix), which have a
+// compression (see GetCompression), with opts, and calls fn for each one
+// with a timestamp within [start, end).
+func ReadPackets(name string, values index.Value, pcapPaths []string, linkType layers.LinkType, compression string, opts Options, start, end time.Time, fn PacketFunc) error {
+	return readPackets(name, values, pcapPaths, linkType, compression, opts, start, end, func(_ *index.ValueElement, ts time.Time, packetLen int64, packet gopacket.Packet) error {
+		return fn(ts, packetLen, packet)
+	})
+}
+
+// readPackets is ReadPackets with the value of each packet passed to fn.
+func readPackets(name string, values index.Value, pcapPaths []string, linkType layers.LinkType, compression string, opts Options, start, end time.Time, fn valueFunc) error {
+	block := &pcapBlock{}
+	// The number of packets skipped in each missing pcap file.
+	missing := make(map[string]int)
+	defer func() {
+		for file, n := range missing {
+			log.Warn().
+				Str("file", file).
+				Int("packets", n).
+				Msg("skipped the packets of a missing pcap file")
+		}
+	}()
+	// Loop through the pcap file path/offset pairs.
+	for _, val := range values {
+		if int(val.PathIdx) >= len(pcapPaths) {
+			return fmt.Errorf("index references pcap-path %d but only %d configured", val.PathIdx, len(pcapPaths))
+		}
+		pcapDir := pcapPaths[val.PathIdx]
+		pcapFilePath := common.PcapFileName(path.Join(pcapDir, name), int(val.PathIdx), compression)
+		offset := val.Offset
+		if _, ok := missing[pcapFilePath]; ok {
+			missing[pcapFilePath]++
+			continue
+		}
+
+		err := func() error {
+			var f *os.File
+			err := withRetry(pcapFilePath, opts, func() (err error) {
+				f, err = os.Open(pcapFilePath)
+				return err
+			})
+			if err != nil && !opts.Strict && errors.Is(err, os.ErrNotExist) {
+				missing[pcapFilePath]++
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("error opening file %s: %s", pcapFilePath, err)
+			}
+			defer f.Close()
+			var file pcapReader = pcapFile{f}
+			if compression != common.CompressionNone {
+				file = compressedPcapFile{File: f, compression: compression, block: block}
+			}
+
+			ts, packetLen, origLen, err := readHeaderFromFile(file, int64(offset))
+			if err != nil {
+				return fmt.Errorf("error reading packet header from file %s: %s", pcapFilePath, err)
+			}
+			if ts.Before(start) || !ts.Before(end) {
+				return nil
+			}
+
+			// A corrupt index or pcap file must not cause a huge
+			// allocation or a read past the end of the file, so skip
+			// the packet instead.
+			err = checkPacketLen(file, int64(offset+16), packetLen)
+			if err != nil {
+				log.Warn().
+					Err(err).
+					Str("file", pcapFilePath).
+					Uint64("offset", offset).
+					Msg("skipping malformed packet")
+				return nil
+			}
+
+			packet, err := readPacketFromFile(file, int64(offset+16), packetLen, origLen, ts, linkType)
+			if err != nil {
+				return fmt.Errorf("error reading packet data from file %s: %s", pcapFilePath, err)
+			}
+
+			return fn(val, ts, packetLen, packet)
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupValues returns the pcap file path/offset pairs in an index that
+// match the query, combined with its terms, limited to the requested
+// pcap-paths, and in reverse order if the query is reversed.
+func lookupValues(txn *badger.Txn, req *v1.QueryReq) (index.Value, error) {
+	format, err := GetFormat(txn)
+	if err != nil {
+		return nil, err
+	}
+	query := &v1.QueryTerm{QueryType: req.QueryType, Query: req.Query, Direction: req.Direction}
+	values, err := lookupTerm(txn, query, req.WidePortRange, format)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Terms) > 0 {
+		// Union and Intersect also remove the packets that more than
+		// one term matches, so they are only read once.
+		terms := []index.Value{values}
+		for _, term := range req.Terms {
+			values, err := lookupTerm(txn, term, req.WidePortRange, format)
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, values)
+		}
+		if req.TermMatch == v1.TermMatch_match_any {
+			values = index.Union(terms...)
+		} else {
+			values = index.Intersect(terms...)
+		}
+	}
+	values = filterPathIdx(values, req.PcapPathIdx)
+	if req.Reverse {
+		for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+	return values, nil
+}
+
+// lookupTerm returns the pcap file path/offset pairs in an index that
+// match a query type and query.
+func lookupTerm(txn *badger.Txn, term *v1.QueryTerm, widePortRange bool, format index.Format) (index.Value, error) {
+	if term.QueryType == v1.QueryType_mac && strings.ToLower(term.Query) == MACMulticast {
+		return scanMulticast(txn, term.Direction, format)
+	}
+	// Ranges do not go through CreateKey, which checks the direction.
+	if term.Direction != v1.Direction_any && term.QueryType != v1.QueryType_mac {
+		return nil, fmt.Errorf("query direction %s is not supported for query type %s", term.Direction, term.QueryType)
+	}
+	if term.QueryType == v1.QueryType_ip && strings.Contains(term.Query, "/") {
+		ipNet, err := parseCIDR(term.Query)
+		if err != nil {
+			return nil, err
+		}
+		return scanCIDR(txn, ipNet, format)
+	}
+	if term.QueryType == v1.QueryType_port && strings.Contains(term.Query, "-") {
+		low, high, err := parsePortRange(term.Query, widePortRange)
+		if err != nil {
+			return nil, err
+		}
+		return lookupPortRange(txn, low, high, format)
+	}
+	key, err := CreateKey(term.QueryType, term.Query, term.Direction)
+	if err != nil {
+		return nil, err
+	}
+	item, err := txn.Get(key)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting key '%s': %s", term.Query, err)
+	}
+	return itemValues(item, format)
+}
+
+// filterPathIdx removes the values that are not in one of the pcap-path
+// indices, keeping all of them if pathIdx is empty. This is done before
+// the packets are read so the other pcap files are not opened.
+func filterPathIdx(values index.Value, pathIdx []uint32) index.Value {
+	if len(pathIdx) == 0 {
+		return values
+	}
+	filtered := values[:0]
+	for _, val := range values {
+		for _, i := range pathIdx {
+			if uint32(val.PathIdx) == i {
+				filtered = append(filtered, val)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// scanMulticast returns the values of every MAC key with the I/G
+// (group) bit set, i.e. multicast and broadcast addresses. Unlike other
+// queries this iterates over all MAC keys in the index.
+func scanMulticast(txn *badger.Txn, direction v1.Direction, format index.Format) (index.Value, error) {
+	recType := index.MACType
+	switch direction {
+	case v1.Direction_src:
+		recType = index.SrcMACType
+	case v1.Direction_dst:
+		recType = index.DstMACType
+	}
+	prefix := []byte{byte(recType)}
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var matches []index.Value
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		k := item.Key()
+		if len(k) < 2 || k[1]&0x01 == 0 {
+			continue
+		}
+		values, err := itemValues(item, format)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, values)
+	}
+	return index.Union(matches...), nil
+}
+
+// parseCIDR parses an ip query for a CIDR range (e.g. `10.0.0.0/24`).
+// IPv4-mapped IPv6 ranges (e.g. `::ffff:10.0.0.0/120`) are converted to
+// IPv4, like the keys of the packets they are captured in.
+func parseCIDR(query string) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(query)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CIDR range %s: %s", query, err)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if ip4 := ipNet.IP.To4(); ip4 != nil && bits == 8*net.IPv6len && ones >= 96 {
+		ipNet = &net.IPNet{IP: ip4, Mask: net.CIDRMask(ones-96, 8*net.IPv4len)}
+	}
+	return ipNet, nil
+}
+
+// scanCIDR returns the values of every IP key in a CIDR range. The keys
+// are iterated from the first byte that the range does not fix, so a
+// large range only reads the keys of the addresses that were seen rather
+// than looking up each address in it.
+func scanCIDR(txn *badger.Txn, ipNet *net.IPNet, format index.Format) (index.Value, error) {
+	recType := index.IPv6Type
+	if len(ipNet.IP) == net.IPv4len {
+		recType = index.IPv4Type
+	}
+	ones, _ := ipNet.Mask.Size()
+	prefix := append([]byte{byte(recType)}, ipNet.IP[:ones/8]...)
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var matches []index.Value
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		k := item.Key()
+		if len(k) != 1+len(ipNet.IP) || !ipNet.Contains(net.IP(k[1:])) {
+			continue
+		}
+		values, err := itemValues(item, format)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, values)
+	}
+	return index.Union(matches...), nil
+}
+
+// MaxPortRange is the most ports a port range query can have unless the
+// request allows a wide range, since each port is a separate key lookup in
+// every index.
+const MaxPortRange = 16384
+
+// parsePortRange parses a port query for a range of ports (e.g.
+// `30000-40000`, inclusive).
+func parsePortRange(query string, wide bool) (uint16, uint16, error) {
+	i := strings.Index(query, "-")
+	low, err := strconv.ParseUint(query[:i], 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing port range %s: %s", query, err)
+	}
+	high, err := strconv.ParseUint(query[i+1:], 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing port range %s: %s", query, err)
+	}
+	if low > high {
+		return 0, 0, fmt.Errorf("port range %s ends before it starts", query)
+	}
+	if n := high - low + 1; n > MaxPortRange && !wide {
+		return 0, 0, fmt.Errorf("port range %s has %d ports, more than %d requires --wide-port-range (widePortRange over HTTP)", query, n, MaxPortRange)
+	}
+	return uint16(low), uint16(high), nil
+}
+
+// lookupPortRange returns the values of every port key in [low, high].
+func lookupPortRange(txn *badger.Txn, low, high uint16, format index.Format) (index.Value, error) {
+	var matches []index.Value
+	for port := uint32(low); port <= uint32(high); port++ {
+		key, _ := index.NewPortKey(uint16(port)).MarshalBinary()
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting key '%d': %s", port, err)
+		}
+		values, err := itemValues(item, format)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, values)
+	}
+	return index.Union(matches...), nil
+}
+
+func itemValues(item *badger.Item, format index.Format) (index.Value, error) {
+	var v []byte
+	err := item.Value(func(val []byte) error {
+		v = append([]byte{}, val...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting value: %s", err)
+	}
+	var values index.Value
+	err = values.UnmarshalFormat(v, format)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling values: %s", err)
+	}
+	return values, nil
+}
+
+// GetMeta returns the value of an index metadata key, or nil if the index
+// does not have it (e.g. it was written by an older version).
+func GetMeta(txn *badger.Txn, name string) ([]byte, error) {
+	key, _ := index.NewMetaKey(name).MarshalBinary()
+	item, err := txn.Get(key)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting metadata '%s': %s", name, err)
+	}
+	return item.ValueCopy(nil)
+}
+
+// GetFormat returns how the values of an index are encoded: the format
+// version (FormatVersion1 for indices written before it was stored) and
+// whether the elements have packet metadata.
+func GetFormat(txn *badger.Txn) (index.Format, error) {
+	f := index.Format{Version: index.FormatVersion1}
+	b, err := GetMeta(txn, index.MetaFormatVersion)
+	if err != nil {
+		return f, err
+	}
+	if len(b) == 2 {
+		f.Version = binary.LittleEndian.Uint16(b)
+	}
+	if f.Version > index.FormatVersion {
+		return f, fmt.Errorf("index version mismatch: format version %d is newer than the supported version %d, please upgrade mercury or re-capture", f.Version, index.FormatVersion)
+	}
+	b, err = GetMeta(txn, index.MetaPacketMeta)
+	if err != nil {
+		return f, err
+	}
+	f.PacketMeta = len(b) > 0
+	return f, nil
+}
+
+// GetLinkType returns the link type of the packets in the pcap files of an
+// index, which is Ethernet for indices written before it was stored.
+func GetLinkType(txn *badger.Txn) (layers.LinkType, error) {
+	b, err := GetMeta(txn, index.MetaLinkType)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) != 2 {
+		return layers.LinkTypeEthernet, nil
+	}
+	return layers.LinkType(binary.LittleEndian.Uint16(b)), nil
+}
+
+// CheckPcapPathCount verifies that there are at least as many pcap-paths
+// configured as the index was captured with.
+func CheckPcapPathCount(txn *badger.Txn, pcapPaths []string) error {
+	v, err := GetMeta(txn, index.MetaPcapPathCount)
+	if err != nil || len(v) < 2 {
+		return err
+	}
+	count := binary.LittleEndian.Uint16(v)
+	if int(count) > len(pcapPaths) {
+		return fmt.Errorf("index was captured with %d pcap-paths but only %d configured", count, len(pcapPaths))
+	}
+	return nil
+}
+
+// CheckPathIdx verifies that the pcap-path indices of a query are
+// configured.
+func CheckPathIdx(pathIdx []uint32, pcapPaths []string) error {
+	for _, i := range pathIdx {
+		if int(i) >= len(pcapPaths) {
+			return fmt.Errorf("pcap-path index %d out of range (%d configured)", i, len(pcapPaths))
+		}
+	}
+	return nil
+}
+
+// ValidatePcapPaths checks the newest index of each label against the
+// configured pcap-paths so a mismatch is reported at startup rather than
+// on the first query. Indices that cannot be opened (e.g. they are still
+// being written) are skipped.
+func ValidatePcapPaths(indexBasePath string, pcapPaths []string, opts Options) error {
+	labels, err := ioutil.ReadDir(indexBasePath)
+	if err != nil {
+		return err
+	}
+	for _, label := range labels {
+		if !label.IsDir() {
+			continue
+		}
+		labelPath := path.Join(indexBasePath, label.Name())
+		indices, err := GetIndexPaths(labelPath, time.Time{}, MaxTime)
+		if err != nil || len(indices) == 0 {
+			continue
+		}
+		dbPath := path.Join(labelPath, indices[len(indices)-1])
+		db, err := OpenDB(badger.DefaultOptions(dbPath).WithReadOnly(true).WithLogger(&common.BadgerLogger{Logger: log.Logger}).WithEncryptionKey(opts.EncryptionKey))
+		if err != nil {
+			log.Debug().Err(err).Str("db", dbPath).Msg("unable to open index to validate pcap-paths")
+			continue
+		}
+		err = db.View(func(txn *badger.Txn) error {
+			return CheckPcapPathCount(txn, pcapPaths)
+		})
+		db.Close()
+		if err != nil {
+			return fmt.Errorf("label %s: %s", label.Name(), err)
+		}
+	}
+	return nil
+}
+
+// GetTimes converts the protobuf start time and duration of a query to the
+// start and end times.
+func GetTimes(s *timestamp.Timestamp, d *duration.Duration) (start, end time.Time) {
+	start = time.Unix(s.GetSeconds(), int64(s.GetNanos()))
+	nanosecDur := d.GetSeconds()*1000000000 + int64(d.GetNanos())
+	duration, _ := time.ParseDuration(fmt.Sprintf("%dns", nanosecDur))
+	end = start.Add(duration)
+	return
+}
+
+// GetIndexPaths figures out the index paths, relative to indexDir, in
+// timestamp order. Indices may be in indexDir itself or in date partition
+// directories (common.PartitionFormat) below it, so the two layouts can be
+// mixed in a label.
+// Each index name is the start time of its pcap files, which can
+// hold up to common.MaxPcapFileTime of packets, so an index is
+// included when [dirStart, dirStart+MaxPcapFileTime] overlaps the
+// query window rather than only when dirStart falls inside it.
+// The pcap files of a label follow one another, so of the indices
+// named before start only the last one can hold packets in the window.
+func GetIndexPaths(indexDir string, start, end time.Time) ([]string, error) {
+	indices, err := getIndexPaths(indexDir, "", start, end)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return indexBefore(indices[i], indices[j])
+	})
+	first := 0
+	for i, indexName := range indices {
+		t, err := IndexTime(indexName)
+		if err != nil || !t.Before(start) {
+			break
+		}
+		first = i
+	}
+	return indices[first:], nil
+}
+
+// IndexTime returns the time in the name of an index, which is the time
+// of the first packet of its pcap files.
+func IndexTime(indexName string) (time.Time, error) {
+	return time.Parse(common.GetFileTimeFormat(), strings.TrimSuffix(path.Base(indexName), "."+common.IndexNameSuffix))
+}
+
+// indexBefore returns true if the index a starts before b. Their names are
+// compared by time, since a partition path would sort before a flat index
+// name and a name with sub-second digits (see common.GetFilePathNano)
+// before the name of the same second without them.
+func indexBefore(a, b string) bool {
+	ta, errA := IndexTime(a)
+	tb, errB := IndexTime(b)
+	if errA != nil || errB != nil || ta.Equal(tb) {
+		return path.Base(a) < path.Base(b)
+	}
+	return ta.Before(tb)
+}
+
+func getIndexPaths(indexDir, partition string, start, end time.Time) ([]string, error) {
+	indices := make([]string, 0)
+	dir := path.Join(indexDir, partition)
+	dirs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read directory %s:%s", dir, err)
+	}
+
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(d.Name(), common.IndexNameSuffix) {
+			ts := strings.TrimSuffix(d.Name(), "."+common.IndexNameSuffix)
+			t, err := time.Parse(common.GetFileTimeFormat(), ts)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse time from directory %s:%s", dir, err)
+			}
+
+			if t.Before(end) && t.Add(common.MaxPcapFileTime).After(start) {
+				indices = append(indices, path.Join(partition, d.Name()))
+			}
+			continue
+		}
+		p := path.Join(partition, d.Name())
+		if !partitionOverlaps(p, start, end) {
+			continue
+		}
+		sub, err := getIndexPaths(indexDir, p, start, end)
+		if err != nil {
+			return nil, err
+		}
+		indices = append(indices, sub...)
+	}
+	return indices, nil
+}
+
+// partitionOverlaps returns true if p is a year, month or day partition
+// directory (e.g. `2021`, `2021/03` or `2021/03/01`) that can hold indices
+// within the query window. Other directories are ignored.
+func partitionOverlaps(p string, start, end time.Time) bool {
+	var t, next time.Time
+	var err error
+	switch strings.Count(p, "/") {
+	case 0:
+		t, err = time.Parse("2006", p)
+		next = t.AddDate(1, 0, 0)
+	case 1:
+		t, err = time.Parse("2006/01", p)
+		next = t.AddDate(0, 1, 0)
+	case 2:
+		t, err = time.Parse(common.PartitionFormat, p)
+		next = t.AddDate(0, 0, 1)
+	default:
+		return false
+	}
+	if err != nil {
+		return false
+	}
+	return t.Before(end) && next.Add(common.MaxPcapFileTime).After(start)
+}
+
+// CreateKey returns the index key for a query.
+func CreateKey(queryType v1.QueryType, queryArg string, direction v1.Direction) (key []byte, err error) {
+	var k *index.Key
+	if direction != v1.Direction_any && queryType != v1.QueryType_mac {
+		return nil, fmt.Errorf("query direction %s is not supported for query type %s", direction, queryType)
+	}
+	switch queryType {
+	case v1.QueryType_ip:
+		// Scoped IPv6 addresses (e.g. `fe80::1%eth0`) are matched without
+		// the zone since the index only stores the 16 address bytes.
+		if strings.Contains(queryArg, "/") {
+			return nil, fmt.Errorf("ip %s is a CIDR range, which does not have a single key", queryArg)
+		}
+		addr := queryArg
+		if i := strings.LastIndex(addr, "%"); i >= 0 {
+			addr = addr[:i]
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("error parsing ip %s", queryArg)
+		}
+		// IPv4-mapped IPv6 addresses (e.g. `::ffff:1.2.3.4`) have the
+		// IPv4 key, like the packets they are captured in.
+		k = index.NewIPKey(ip)
+		if k == nil {
+			return nil, fmt.Errorf("error creating ip key for %s", queryArg)
+		}
+	case v1.QueryType_port:
+		if strings.Contains(queryArg, "-") {
+			return nil, fmt.Errorf("port %s is a range, which does not have a single key", queryArg)
+		}
+		port, err := strconv.ParseUint(queryArg, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing port %s: %s", queryArg, err)
+		}
+		k = index.NewPortKey(uint16(port))
+	case v1.QueryType_protocol:
+		var proto uint8
+		switch strings.ToLower(queryArg) {
+		case "tcp":
+			proto = 6
+		case "udp":
+			proto = 17
+		case "icmp":
+			proto = 1
+		case "icmp6":
+			proto = 58
+		default:
+			// Any other protocol can be queried by its number.
+			p, err := strconv.ParseUint(queryArg, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("query protocol %s is not supported", queryArg)
+			}
+			proto = uint8(p)
+		}
+		k = index.NewProtoKey(proto)
+	case v1.QueryType_mpls:
+		label, err := strconv.ParseUint(queryArg, 10, 20)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing MPLS label %s: %s", queryArg, err)
+		}
+		k = index.NewMPLSKey(uint32(label))
+	case v1.QueryType_vlan:
+		id, err := strconv.ParseUint(queryArg, 10, 12)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing VLAN ID %s: %s", queryArg, err)
+		}
+		k = index.NewVLANKey(uint16(id))
+	case v1.QueryType_vni:
+		vni, err := strconv.ParseUint(queryArg, 10, 24)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing VXLAN VNI %s: %s", queryArg, err)
+		}
+		k = index.NewVNIKey(uint32(vni))
+	case v1.QueryType_flow:
+		k, err = parseFlow(queryArg)
+		if err != nil {
+			return nil, err
+		}
+	case v1.QueryType_interface:
+		k = index.NewInterfaceKey(queryArg)
+	case v1.QueryType_domain:
+		k = index.NewDomainKey(queryArg)
+		if len(k.Data) == 0 {
+			return nil, fmt.Errorf("error parsing domain %q: it is empty", queryArg)
+		}
+	case v1.QueryType_host:
+		k = index.NewHostKey(queryArg)
+		if len(k.Data) == 0 {
+			return nil, fmt.Errorf("error parsing host %q: it is empty", queryArg)
+		}
+	case v1.QueryType_mac:
+		if strings.ToLower(queryArg) == MACBroadcast {
+			queryArg = broadcastMAC
+		}
+		mac, err := net.ParseMAC(queryArg)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing MAC %s: %s", queryArg, err)
+		}
+		switch direction {
+		case v1.Direction_src:
+			k = index.NewSrcMACKey(mac)
+		case v1.Direction_dst:
+			k = index.NewDstMACKey(mac)
+		default:
+			k = index.NewMACKey(mac)
+		}
+	default:
+		return nil, fmt.Errorf("query type %s is not supported", queryType)
+	}
+	key, err = k.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("error creating key: %s", err)
+	}
+	return key, nil
+}
+
+// readHeaderFromFile returns the timestamp, captured length and original
+// (wire) length from a pcap record header.
+func readHeaderFromFile(file pcapReader, offset int64) (time.Time, int64, int64, error) {
+	packetHeader := make([]byte, 16)
+	_, err := file.ReadAt(packetHeader, int64(offset))
+	if err != nil {
+		return time.Time{}, 0, 0, fmt.Errorf("error reading packet length from file %s: %s", file.Name(), err)
+	}
+	sec := binary.LittleEndian.Uint32(packetHeader[0:4])
+	microsec := binary.LittleEndian.Uint32(packetHeader[4:8])
+	timestamp := time.Unix(int64(sec), int64(microsec)*int64(time.Microsecond))
+	packetLen := binary.LittleEndian.Uint32(packetHeader[8:12])
+	origLen := binary.LittleEndian.Uint32(packetHeader[12:16])
+	return timestamp, int64(packetLen), int64(origLen), nil
+}
+
+// checkPacketLen returns an error if the packet length is larger than any
+// pcap snap length or the packet would extend past the end of the file.
+// Packets ingested from pcap files may be longer than common.SnapLen.
+func checkPacketLen(file pcapReader, offset, packetLen int64) error {
+	if packetLen <= 0 || packetLen > maxPacketLen {
+		return fmt.Errorf("invalid packet length %d", packetLen)
+	}
+	end, err := file.end(offset)
+	if err != nil {
+		return err
+	}
+	if offset+packetLen > end {
+		return fmt.Errorf("packet length %d at offset %d is past the end of the file (%d bytes)", packetLen, offset, end)
+	}
+	return nil
+}
+
+// readPacketFromFile reads and decodes a packet. The metadata keeps the
+// original length so packets truncated by the snap length can be reported.
+func readPacketFromFile(file pcapReader, offset, packetLen, origLen int64, ts time.Time, linkType layers.LinkType) (gopacket.Packet, error) {
+	packetData := make([]byte, packetLen)
+	_, err := file.ReadAt(packetData, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error reading packet data from file %s: %s", file.Name(), err)
+	}
+	p := gopacket.NewPacket(packetData, linkType, gopacket.NoCopy)
+	p.Metadata().Timestamp = ts
+	if origLen < packetLen {
+		origLen = packetLen
+	}
+	p.Metadata().Length = int(origLen)
+	p.Metadata().CaptureLength = int(packetLen)
+	return p, nil
+}
+
+// vlans returns the VLAN IDs of a response.
+func vlans(ids []uint16) []uint32 {
+	var v []uint32
+	for _, id := range ids {
+		v = append(v, uint32(id))
+	}
+	return v
+}
+
+// Truncated returns true if a packet was captured with a snap length
+// shorter than its length on the wire.
+func Truncated(packet gopacket.Packet) bool {
+	md := packet.Metadata()
+	return md.CaptureLength < md.Length
+}
+
+// NewResp creates the text response for a packet.
+func NewResp(ts *timestamp.Timestamp, packetLen int64, packet gopacket.Packet, showAll, base64Enc, includeData bool) (resp *v1.QueryResp) {
+
+	// Base 64 encode the text response
+	var t bytes.Buffer
+	t.WriteString(packet.Dump())
+
+	// Only show the full text response if showAll is true.
+	var text string
+	if showAll {
+		if base64Enc {
+			text = base64.StdEncoding.EncodeToString(t.Bytes())
+		} else {
+			text = packet.String()
+		}
+	}
+
+	resp = &v1.QueryResp{
+		Timestamp: ts,
+		Length:    packetLen,
+		Text:      text,
+		Truncated: Truncated(packet),
+	}
+	if includeData {
+		resp.Data = packet.Data()
+		resp.LinkType = uint32(PacketInterface(packet).LinkType)
+	}
+
+	vers, srcMAC, dstMAC, srcIP, dstIP, srcPort, dstPort, _, proto := common.ParsePacket(packet)
+	resp.SrcMAC = srcMAC.String()
+	resp.DstMAC = dstMAC.String()
+	resp.SrcIP = srcIP.String()
+	resp.DstIP = dstIP.String()
+	resp.SrcPort = uint32(srcPort)
+	resp.SrcPortStr = strconv.FormatUint(uint64(srcPort), 10)
+	resp.DstPort = uint32(dstPort)
+	resp.DstPortStr = strconv.FormatUint(uint64(dstPort), 10)
+	resp.Proto = proto
+	resp.Interface = InterfaceName(packet)
+	resp.Vlan = vlans(common.VLANIDs(packet))
+	if vers == 6 {
+		resp.Ipv6 = true
+	}
+
+	return
+}
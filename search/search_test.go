@@ -0,0 +1,192 @@
+package search
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	v1 "code.ornl.gov/situ/mercury/api/v1"
+	"code.ornl.gov/situ/mercury/common"
+	"code.ornl.gov/situ/mercury/index"
+)
+
+// testPcapTime is the timestamp of the packets of writeTestPcap.
+var testPcapTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// writeTestPcap writes a pcap file for pcap-path 0 of the index name in
+// dir with a packet of each length, and returns the offsets of the
+// packets.
+func writeTestPcap(t *testing.T, dir, name string, lengths ...int) []uint64 {
+	t.Helper()
+	f, err := os.Create(common.PcapFileName(path.Join(dir, name), 0, common.CompressionNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := pcapgo.NewWriter(f)
+	err = w.WriteFileHeader(65536, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := uint64(24)
+	var offsets []uint64
+	for _, n := range lengths {
+		ci := gopacket.CaptureInfo{Timestamp: testPcapTime, CaptureLength: n, Length: n}
+		err = w.WritePacket(ci, make([]byte, n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, offset)
+		offset += 16 + uint64(n)
+	}
+	return offsets
+}
+
+func TestCheckPacketLen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercury-search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	offsets := writeTestPcap(t, dir, "test", 100)
+	f, err := os.Open(common.PcapFileName(path.Join(dir, "test"), 0, common.CompressionNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	file := pcapFile{f}
+	data := int64(offsets[0] + 16)
+
+	tests := []struct {
+		packetLen int64
+		valid     bool
+	}{
+		{100, true},
+		{0, false},
+		{-1, false},
+		{101, false},
+		{maxPacketLen + 1, false},
+		{1 << 31, false},
+	}
+	for _, tt := range tests {
+		err := checkPacketLen(file, data, tt.packetLen)
+		if tt.valid && err != nil {
+			t.Errorf("packet length %d: %s", tt.packetLen, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("packet length %d is not an error", tt.packetLen)
+		}
+	}
+
+	// The offset of a corrupt index is past the end of the file.
+	_, _, _, err = readHeaderFromFile(file, data+1000)
+	if err == nil {
+		t.Error("read a packet header past the end of the file")
+	}
+}
+
+func TestReadPacketsCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercury-search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	offsets := writeTestPcap(t, dir, "test", 60, 80)
+	pcapPaths := []string{dir}
+	name := path.Join(dir, "test")
+
+	// The length in the header of the second packet is larger than
+	// maxPacketLen, so it is skipped.
+	f, err := os.OpenFile(common.PcapFileName(name, 0, common.CompressionNone), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header [4]byte
+	binary.LittleEndian.PutUint32(header[:], maxPacketLen+1)
+	_, err = f.WriteAt(header[:], int64(offsets[1]+8))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := index.Value{index.NewValueElement(0, offsets[0]), index.NewValueElement(0, offsets[1])}
+	var lengths []int64
+	err = ReadPackets("test", values, pcapPaths, layers.LinkTypeEthernet, common.CompressionNone, Options{}, time.Time{}, MaxTime, func(_ time.Time, packetLen int64, _ gopacket.Packet) error {
+		lengths = append(lengths, packetLen)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lengths) != 1 || lengths[0] != 60 {
+		t.Errorf("read packets of lengths %v, want only 60", lengths)
+	}
+
+	// An offset past the end of the file fails the query.
+	values = index.Value{index.NewValueElement(0, offsets[1]+1000)}
+	err = ReadPackets("test", values, pcapPaths, layers.LinkTypeEthernet, common.CompressionNone, Options{}, time.Time{}, MaxTime, func(time.Time, int64, gopacket.Packet) error {
+		t.Error("read a packet at a corrupt offset")
+		return nil
+	})
+	if err == nil {
+		t.Error("a corrupt offset is not an error")
+	}
+}
+
+func TestCreateKeyScopedIPv6(t *testing.T) {
+	want, err := CreateKey(v1.QueryType_ip, "fe80::1", v1.Direction_any)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range []string{"fe80::1%eth0", "fe80::1%2"} {
+		key, err := CreateKey(v1.QueryType_ip, arg, v1.Direction_any)
+		if err != nil {
+			t.Errorf("%s: %s", arg, err)
+			continue
+		}
+		if !bytes.Equal(key, want) {
+			t.Errorf("%s has the key %x, want %x", arg, key, want)
+		}
+	}
+	for _, arg := range []string{"%eth0", "fe80::1%eth0/64"} {
+		_, err := CreateKey(v1.QueryType_ip, arg, v1.Direction_any)
+		if err == nil {
+			t.Errorf("%s is not an error", arg)
+		}
+	}
+}
+
+func TestCreateKeyIPv4Mapped(t *testing.T) {
+	// The key of the packets of an IPv4 address.
+	want, err := index.NewIPv4Key(net.IPv4(10, 0, 0, 1)).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range []string{"10.0.0.1", "::ffff:10.0.0.1", "::ffff:a00:1"} {
+		key, err := CreateKey(v1.QueryType_ip, arg, v1.Direction_any)
+		if err != nil {
+			t.Errorf("%s: %s", arg, err)
+			continue
+		}
+		if !bytes.Equal(key, want) {
+			t.Errorf("%s has the key %x, want the IPv4 key %x", arg, key, want)
+		}
+	}
+
+	// An IPv4-compatible address is IPv6.
+	key, err := CreateKey(v1.QueryType_ip, "::10.0.0.1", v1.Direction_any)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(key, want) {
+		t.Errorf("::10.0.0.1 has the IPv4 key")
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IndexArchiveSuffix is appended to an index directory name for the tar
+// archive of the index that is uploaded.
+const IndexArchiveSuffix = "tar"
+
+// Key returns the object key for a file in a label.
+func Key(prefix, label, name string) string {
+	return strings.TrimPrefix(path.Join(prefix, label, name), "/")
+}
+
+// TarDir writes the regular files in dir (not recursive, which is all a
+// Badger directory needs) to w as a tar archive.
+func TarDir(dir string, w io.Writer) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// UntarDir extracts a tar archive created by TarDir into dir.
+func UntarDir(r io.Reader, dir string) error {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Only flat archives of regular files are expected.
+		name := filepath.Base(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || name != hdr.Name || name == "." || name == ".." {
+			return fmt.Errorf("unexpected entry %s in index archive", hdr.Name)
+		}
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// Store is an object store that finalized pcap files and index archives
+// can be copied to.
+type Store interface {
+	// Put uploads size bytes read from r to key.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get downloads key and writes it to w.
+	Get(ctx context.Context, key string, w io.Writer) error
+	// List returns the keys that start with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// String describes the store for logging.
+	String() string
+}